@@ -0,0 +1,165 @@
+// rotate-token-keys は、trx_users_services に保存されたトークンと trx_users の TOTP シークレットを
+// アクティブな鍵 (TOKEN_ENCRYPTION_ACTIVE_KEY_ID) で再暗号化するコマンドです。
+//
+// 鍵のローテーション手順:
+//  1. TOKEN_ENCRYPTION_KEYS に新しい鍵を追加し、TOKEN_ENCRYPTION_ACTIVE_KEY_ID を新しい鍵に切り替えてデプロイする
+//  2. このコマンドを実行して既存の値を新しい鍵で再暗号化する（-dry-run で対象件数のみ確認できる）
+//  3. 古い鍵で暗号化された値が残っていないことを確認してから、古い鍵を設定から削除する
+//
+// 暗号化導入前の平文の TOTP シークレットもこのコマンドで暗号化する。暗号化し終えるまでは、
+// API サーバーに TOTP_ALLOW_PLAINTEXT_SECRETS=true を設定しないと平文のシークレットのユーザーは二要素認証できない。
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"music-share-api/internal/repositories"
+	"music-share-api/internal/utils"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "再暗号化せずに対象件数のみ表示する")
+	batchSize := flag.Int("batch-size", 100, "1回に取得する行数")
+	flag.Parse()
+
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file loaded:", err)
+	}
+
+	keyring, err := utils.LoadTokenKeyringFromEnv()
+	if err != nil {
+		log.Fatal("Failed to load token encryption keys:", err)
+	}
+
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true",
+		os.Getenv("DB_USER"), os.Getenv("DB_PASSWORD"), os.Getenv("DB_HOST"), os.Getenv("DB_PORT"), os.Getenv("DB_NAME"))
+	db, err := sqlx.Connect("mysql", dsn)
+	if err != nil {
+		log.Fatal("Database connection failed:", err)
+	}
+	defer db.Close()
+
+	// Redis は使用しないため nil を渡す（authRepository も同様）
+	serviceRepository := repositories.NewServiceRepository(db.DB, nil)
+
+	// skipped は、読んでから書き換えるまでの間にトークンの更新などで値が変わった行（次回の実行で再暗号化する）
+	var scanned, rotated, skipped, failed int
+	lastServiceID := 0
+	for {
+		rows, err := serviceRepository.ListEncryptedTokens(lastServiceID, *batchSize)
+		if err != nil {
+			log.Fatal("Failed to list tokens:", err)
+		}
+		if len(rows) == 0 {
+			break
+		}
+
+		for _, row := range rows {
+			lastServiceID = row.ServiceID
+			scanned++
+			if !keyring.NeedsRotation(row.EncryptedAccessToken) && !keyring.NeedsRotation(row.EncryptedRefreshToken) {
+				continue
+			}
+			if *dryRun {
+				rotated++
+				continue
+			}
+
+			accessToken, err := reencrypt(keyring, row.EncryptedAccessToken)
+			if err != nil {
+				log.Printf("service_id=%d: access token: %v", row.ServiceID, err)
+				failed++
+				continue
+			}
+			refreshToken, err := reencrypt(keyring, row.EncryptedRefreshToken)
+			if err != nil {
+				log.Printf("service_id=%d: refresh token: %v", row.ServiceID, err)
+				failed++
+				continue
+			}
+			updated, err := serviceRepository.UpdateEncryptedTokens(row, accessToken, refreshToken)
+			if err != nil {
+				log.Printf("service_id=%d: %v", row.ServiceID, err)
+				failed++
+				continue
+			}
+			if !updated {
+				log.Printf("service_id=%d: tokens changed while rotating; skipped, will rotate on next run", row.ServiceID)
+				skipped++
+				continue
+			}
+			rotated++
+		}
+	}
+
+	// TOTP シークレット（暗号化導入前の平文の値もここで暗号化する）
+	authRepository := repositories.NewAuthRepository(db.DB, nil)
+	lastUserID := 0
+	for {
+		rows, err := authRepository.ListEncryptedTOTPSecrets(lastUserID, *batchSize)
+		if err != nil {
+			log.Fatal("Failed to list totp secrets:", err)
+		}
+		if len(rows) == 0 {
+			break
+		}
+
+		for _, row := range rows {
+			lastUserID = row.UserID
+			scanned++
+			if !keyring.NeedsRotation(row.EncryptedSecret) {
+				continue
+			}
+			if *dryRun {
+				rotated++
+				continue
+			}
+
+			secret, err := utils.DecryptTOTPSecret(keyring, row.EncryptedSecret, true)
+			if err == nil {
+				secret, err = keyring.Encrypt(secret)
+			}
+			if err != nil {
+				log.Printf("user_id=%d: totp secret: %v", row.UserID, err)
+				failed++
+				continue
+			}
+			updated, err := authRepository.UpdateEncryptedTOTPSecret(row, secret)
+			if err != nil {
+				log.Printf("user_id=%d: %v", row.UserID, err)
+				failed++
+				continue
+			}
+			if !updated {
+				log.Printf("user_id=%d: totp secret changed while rotating; skipped, will rotate on next run", row.UserID)
+				skipped++
+				continue
+			}
+			rotated++
+		}
+	}
+
+	log.Printf("scanned=%d rotated=%d skipped=%d failed=%d dry_run=%t active_key=%s", scanned, rotated, skipped, failed, *dryRun, keyring.ActiveKeyID())
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// reencrypt は値を復号し、アクティブな鍵で暗号化し直します。
+func reencrypt(keyring *utils.TokenKeyring, value string) (string, error) {
+	if !keyring.NeedsRotation(value) {
+		return value, nil
+	}
+	plaintext, err := keyring.Decrypt(value)
+	if err != nil {
+		return "", err
+	}
+	return keyring.Encrypt(plaintext)
+}
@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"errors"
 	"log"
 	"net/http"
 
@@ -43,7 +44,7 @@ func (ctrl *AuthController) GetUserInfo(c *gin.Context) {
 	}
 
 	// ユーザー基本情報の取得
-	userName, email, role, isSpotify, userServices, err := ctrl.authService.GetUserInfo(userID)
+	userName, email, role, userServices, connections, err := ctrl.authService.GetUserInfo(userID)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"status":  "error",
@@ -52,15 +53,25 @@ func (ctrl *AuthController) GetUserInfo(c *gin.Context) {
 		return
 	}
 
+	emailVerified, err := ctrl.authService.IsEmailVerified(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"status":    "success",
-		"message":   "User registered successfully",
-		"userId":    userID,
-		"userName":  userName,
-		"email":     email,
-		"role":      role,
-		"isSpotify": isSpotify,
-		"services":  userServices,
+		"status":        "success",
+		"message":       "User registered successfully",
+		"userId":        userID,
+		"userName":      userName,
+		"email":         email,
+		"emailVerified": emailVerified,
+		"role":          role,
+		"connections":   connections,
+		"services":      userServices,
 	})
 }
 
@@ -95,20 +106,15 @@ func (ctrl *AuthController) SignUp(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"status":    "success",
-		"message":   "User registered successfully",
-		"userId":    userID,
-		"userName":  userName,
-		"email":     email,
-		"role":      "user",
-		"isSpotify": false,
-		"services": gin.H{
-			"spotify": gin.H{
-				"serviceUserId":        "fgthrytjyhrgafegthryj",
-				"encryptedAccessToken": "dwfagehjtythgrefe",
-				"expiresAt":            false,
-			},
-		},
+		"status":        "success",
+		"message":       "User registered successfully",
+		"userId":        userID,
+		"userName":      userName,
+		"email":         email,
+		"emailVerified": false,
+		"role":          "user",
+		"connections":   gin.H{},
+		"services":      gin.H{},
 	})
 }
 
@@ -124,12 +130,23 @@ func (ctrl *AuthController) SignIn(c *gin.Context) {
 		return
 	}
 
-	userID, userName, email, role, isSpotify, err := ctrl.authService.LoginUser(requestBody.Email, requestBody.HashPassword)
+	userID, userName, email, role, err := ctrl.authService.LoginUser(requestBody.Email, requestBody.HashPassword)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"status": "error", "message": "Invalid credentials"})
 		return
 	}
 
+	// 二要素認証が有効な場合はクッキーをセットせず、チャレンジトークンを返す
+	if ctrl.respondTwoFactorChallenge(c, userID) {
+		return
+	}
+
+	_, _, _, userServices, connections, err := ctrl.authService.GetUserInfo(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": err.Error()})
+		return
+	}
+
 	// クッキーのセット
 	if err := utils.SetAuthCookie(c.Writer, userID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to set auth cookie"})
@@ -140,33 +157,26 @@ func (ctrl *AuthController) SignIn(c *gin.Context) {
 	log.Println("User Name:", userName)
 	log.Println("Email:", email)
 	log.Println("Role:", role)
-	log.Println("Is Spotify:", isSpotify)
 
 	c.JSON(http.StatusOK, gin.H{
-		"status":    "success",
-		"message":   "Login successful",
-		"userId":    userID,
-		"userName":  userName,
-		"email":     email,
-		"role":      role,
-		"isSpotify": isSpotify,
-		"services": gin.H{
-			"spotify": gin.H{
-				"serviceUserId":        "fgthrytjyhrgafegthryj",
-				"encryptedAccessToken": "dwfagehjtythgrefe",
-				"expiresAt":            false,
-			},
-		},
+		"status":      "success",
+		"message":     "Login successful",
+		"userId":      userID,
+		"userName":    userName,
+		"email":       email,
+		"role":        role,
+		"connections": connections,
+		"services":    userServices,
 	})
 }
 
 // PUT /auth/update-profile
-// プロファイル更新（※要件に合わせ、返すJSONは固定値とする）
+// ログイン中のユーザーのプロファイルを更新する。メールアドレスを変更する場合は currentHashPassword が必要
 func (ctrl *AuthController) UpdateProfile(c *gin.Context) {
 	var req struct {
-		UserId   int    `json:"userId" binding:"required"`
-		UserName string `json:"userName" binding:"required"`
-		Email    string `json:"email" binding:"required,email"`
+		UserName            string `json:"userName" binding:"required"`
+		Email               string `json:"email" binding:"required,email"`
+		CurrentHashPassword string `json:"currentHashPassword"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -176,7 +186,22 @@ func (ctrl *AuthController) UpdateProfile(c *gin.Context) {
 		return
 	}
 
-	if err := ctrl.authService.UpdateProfile(req.UserId, req.UserName, req.Email); err != nil {
+	authUserID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"status": "error", "message": "Unauthorized"})
+		return
+	}
+	userID, ok := authUserID.(int)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to parse user ID"})
+		return
+	}
+
+	if err := ctrl.authService.UpdateProfile(userID, req.UserName, req.Email, req.CurrentHashPassword); err != nil {
+		if errors.Is(err, services.ErrInvalidCurrentPassword) {
+			c.JSON(http.StatusForbidden, gin.H{"status": "error", "message": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  "error",
 			"message": err.Error(),
@@ -184,10 +209,379 @@ func (ctrl *AuthController) UpdateProfile(c *gin.Context) {
 		return
 	}
 
-	// 要件に合わせた固定のレスポンス
 	c.JSON(http.StatusOK, gin.H{
 		"status":  "success",
-		"message": "Account deleted successfully",
+		"message": "Profile updated successfully",
+	})
+}
+
+// POST /auth/verify-email
+// メールに記載された確認用トークンを検証し、メールアドレスを確認済みにする
+func (ctrl *AuthController) VerifyEmail(c *gin.Context) {
+	var req struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid input"})
+		return
+	}
+
+	if err := ctrl.authService.VerifyEmail(req.Token); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Email verified successfully",
+	})
+}
+
+// POST /auth/resend-verification
+// ログイン中のユーザーに確認メールを再送する
+func (ctrl *AuthController) ResendVerificationEmail(c *gin.Context) {
+	authUserID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"status": "error", "message": "Unauthorized"})
+		return
+	}
+	userID, ok := authUserID.(int)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to parse user ID"})
+		return
+	}
+
+	if err := ctrl.authService.SendVerificationEmail(userID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Verification email sent",
+	})
+}
+
+// POST /auth/forgot-password
+// パスワードリセット用のメールを送信する（登録有無に関わらず同じレスポンスを返す）
+func (ctrl *AuthController) ForgotPassword(c *gin.Context) {
+	var req struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid input"})
+		return
+	}
+
+	if err := ctrl.authService.RequestPasswordReset(req.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to send password reset email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "If the email is registered, a password reset link has been sent",
+	})
+}
+
+// POST /auth/reset-password
+// リセットトークンを使ってパスワードを再設定する（既存セッションは全て失効）
+func (ctrl *AuthController) ResetPassword(c *gin.Context) {
+	var req struct {
+		Token           string `json:"token" binding:"required"`
+		NewHashPassword string `json:"newHashPassword" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid input"})
+		return
+	}
+
+	if err := ctrl.authService.ResetPassword(req.Token, req.NewHashPassword); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Password reset successfully",
+	})
+}
+
+// POST /auth/change-password
+// 現在のパスワードを確認してパスワードを変更する。
+// 既存セッションは全て失効させ、リクエストしたクライアントにのみ新しいクッキーを発行する
+func (ctrl *AuthController) ChangePassword(c *gin.Context) {
+	var req struct {
+		CurrentHashPassword string `json:"currentHashPassword" binding:"required"`
+		NewHashPassword     string `json:"newHashPassword" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid input"})
+		return
+	}
+
+	authUserID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"status": "error", "message": "Unauthorized"})
+		return
+	}
+	userID, ok := authUserID.(int)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to parse user ID"})
+		return
+	}
+
+	if err := ctrl.authService.ChangePassword(userID, req.CurrentHashPassword, req.NewHashPassword); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+		return
+	}
+
+	if err := utils.SetAuthCookie(c.Writer, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to set auth cookie"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Password changed successfully",
+	})
+}
+
+// GET /auth/spotify/authorize
+// Spotifyサインイン用の認可URL（state と PKCE 付き）を返す
+func (ctrl *AuthController) SpotifyLoginAuthorize(c *gin.Context) {
+	authorizeURL, err := ctrl.authService.BuildSpotifyLoginURL()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":       "success",
+		"message":      "Authorize URL issued",
+		"authorizeUrl": authorizeURL,
+	})
+}
+
+// POST /auth/spotify/sign-in
+// Spotifyの認証コードでサインインする（未登録の場合はユーザーを作成する）
+func (ctrl *AuthController) SignInWithSpotify(c *gin.Context) {
+	var req struct {
+		Code  string `json:"code" binding:"required"`
+		State string `json:"state" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid input"})
+		return
+	}
+
+	userID, created, err := ctrl.authService.SignInWithSpotify(req.Code, req.State)
+	if err != nil {
+		if errors.Is(err, services.ErrAccountLinkRequired) {
+			c.JSON(http.StatusConflict, gin.H{"status": "error", "message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"status": "error", "message": err.Error()})
+		return
+	}
+
+	if ctrl.respondTwoFactorChallenge(c, userID) {
+		return
+	}
+
+	userName, email, role, userServices, connections, err := ctrl.authService.GetUserInfo(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": err.Error()})
+		return
+	}
+
+	// クッキーのセット
+	if err := utils.SetAuthCookie(c.Writer, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to set auth cookie"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":      "success",
+		"message":     "Login successful",
+		"created":     created,
+		"userId":      userID,
+		"userName":    userName,
+		"email":       email,
+		"role":        role,
+		"connections": connections,
+		"services":    userServices,
+	})
+}
+
+// respondTwoFactorChallenge は、二要素認証が有効なユーザーであればチャレンジトークンを返して true を返す。
+// その場合、呼び出し元はクッキーをセットせずに処理を終了すること。
+func (ctrl *AuthController) respondTwoFactorChallenge(c *gin.Context, userID int) bool {
+	totpEnabled, err := ctrl.authService.IsTOTPEnabled(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": err.Error()})
+		return true
+	}
+	if !totpEnabled {
+		return false
+	}
+
+	challengeToken, err := utils.GenerateTwoFactorChallengeToken(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to create challenge"})
+		return true
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":         "pending",
+		"message":        "Two-factor authentication required",
+		"challengeToken": challengeToken,
+	})
+	return true
+}
+
+// POST /auth/2fa/verify
+// サインイン時に返したチャレンジトークンと TOTP コード（またはリカバリーコード）を検証し、クッキーをセットする
+func (ctrl *AuthController) VerifyTwoFactor(c *gin.Context) {
+	var req struct {
+		ChallengeToken string `json:"challengeToken" binding:"required"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recoveryCode"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Code == "" && req.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid input"})
+		return
+	}
+
+	userID, err := ctrl.authService.VerifyTwoFactor(req.ChallengeToken, req.Code, req.RecoveryCode)
+	if errors.Is(err, services.ErrTooManyTwoFactorAttempts) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"status": "error", "message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"status": "error", "message": "Invalid credentials"})
+		return
+	}
+
+	userName, email, role, userServices, connections, err := ctrl.authService.GetUserInfo(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": err.Error()})
+		return
+	}
+
+	// クッキーのセット
+	if err := utils.SetAuthCookie(c.Writer, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to set auth cookie"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":      "success",
+		"message":     "Login successful",
+		"userId":      userID,
+		"userName":    userName,
+		"email":       email,
+		"role":        role,
+		"connections": connections,
+		"services":    userServices,
+	})
+}
+
+// POST /auth/2fa/enroll
+// TOTP の登録を開始し、otpauth URI とリカバリーコードを返す（リカバリーコードはこの時だけ表示される）
+func (ctrl *AuthController) EnrollTwoFactor(c *gin.Context) {
+	authUserID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"status": "error", "message": "Unauthorized"})
+		return
+	}
+	userID, ok := authUserID.(int)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to parse user ID"})
+		return
+	}
+
+	otpauthURI, recoveryCodes, err := ctrl.authService.EnrollTOTP(userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":        "success",
+		"message":       "Two-factor enrollment started",
+		"otpauthUri":    otpauthURI,
+		"recoveryCodes": recoveryCodes,
+	})
+}
+
+// POST /auth/2fa/activate
+// 認証アプリで生成されたコードを確認し、二要素認証を有効化する
+func (ctrl *AuthController) ActivateTwoFactor(c *gin.Context) {
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid input"})
+		return
+	}
+
+	authUserID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"status": "error", "message": "Unauthorized"})
+		return
+	}
+	userID, ok := authUserID.(int)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to parse user ID"})
+		return
+	}
+
+	if err := ctrl.authService.ActivateTOTP(userID, req.Code); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Two-factor authentication enabled",
+	})
+}
+
+// POST /auth/2fa/disable
+// TOTP コードまたはリカバリーコードを確認し、二要素認証を無効化する
+func (ctrl *AuthController) DisableTwoFactor(c *gin.Context) {
+	var req struct {
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recoveryCode"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Code == "" && req.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid input"})
+		return
+	}
+
+	authUserID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"status": "error", "message": "Unauthorized"})
+		return
+	}
+	userID, ok := authUserID.(int)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to parse user ID"})
+		return
+	}
+
+	if err := ctrl.authService.DisableTOTP(userID, req.Code, req.RecoveryCode); err != nil {
+		if errors.Is(err, services.ErrTooManyTwoFactorAttempts) {
+			c.JSON(http.StatusTooManyRequests, gin.H{"status": "error", "message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Two-factor authentication disabled",
 	})
 }
 
@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"music-share-api/internal/middlewares"
+	"music-share-api/internal/services"
+	"music-share-api/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// profileAuthService は、UpdateProfile の呼び出しを記録するテスト用の AuthService です。
+// テストで使わないメソッドは埋め込んだ nil のインターフェースに委ねる（呼ばれると panic する）。
+type profileAuthService struct {
+	services.AuthService
+	updatedUserIDs []int
+}
+
+func (s *profileAuthService) ValidateSession(userID int, issuedAt time.Time) error {
+	return nil
+}
+
+func (s *profileAuthService) UpdateProfile(userID int, userName, email, currentHashPassword string) error {
+	s.updatedUserIDs = append(s.updatedUserIDs, userID)
+	return nil
+}
+
+// newProfileRouter は、main.go と同じく認証を必須にした PUT /auth/update-profile を用意します。
+func newProfileRouter(authService services.AuthService) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.PUT("/auth/update-profile", middlewares.AuthMiddleware(authService), NewAuthController(authService).UpdateProfile)
+	return r
+}
+
+func TestUpdateProfileRejectsUnauthenticatedRequests(t *testing.T) {
+	authService := &profileAuthService{}
+	r := newProfileRouter(authService)
+
+	// 以前のように body の userId で他人のメールアドレスを書き換えることはできない
+	body := `{"userId": 1, "userName": "alice", "email": "attacker@example.com"}`
+	req := httptest.NewRequest(http.MethodPut, "/auth/update-profile", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401", w.Code)
+	}
+	if len(authService.updatedUserIDs) != 0 {
+		t.Fatalf("profile was updated without authentication: %v", authService.updatedUserIDs)
+	}
+}
+
+func TestUpdateProfileUsesAuthenticatedUser(t *testing.T) {
+	authService := &profileAuthService{}
+	r := newProfileRouter(authService)
+
+	cookieRecorder := httptest.NewRecorder()
+	if err := utils.SetAuthCookie(cookieRecorder, 2); err != nil {
+		t.Fatalf("SetAuthCookie: %v", err)
+	}
+
+	// body の userId は無視し、ログイン中のユーザーを更新する
+	body := `{"userId": 1, "userName": "bob", "email": "bob@example.com"}`
+	req := httptest.NewRequest(http.MethodPut, "/auth/update-profile", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for _, cookie := range cookieRecorder.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if len(authService.updatedUserIDs) != 1 || authService.updatedUserIDs[0] != 2 {
+		t.Fatalf("updated users = %v, want [2]", authService.updatedUserIDs)
+	}
+}
@@ -0,0 +1,48 @@
+package controllers
+
+import (
+	"net/http"
+
+	"music-share-api/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type GenreController struct {
+	genreService services.GenreService
+}
+
+func NewGenreController(genreService services.GenreService) *GenreController {
+	return &GenreController{genreService: genreService}
+}
+
+// GET /genres?locale=
+// ジャンルの一覧を、表示名と公開中のルーム数付きで返す。locale を省略した場合は Accept-Language を使う
+func (ctrl *GenreController) ListGenres(c *gin.Context) {
+	locale := c.Query("locale")
+	if locale == "" {
+		locale = primaryLanguage(c.GetHeader("Accept-Language"))
+	}
+
+	genres, err := ctrl.genreService.ListGenres(locale)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Error fetching genres"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Genres retrieved",
+		"genres":  genres,
+	})
+}
+
+// primaryLanguage は、Accept-Language の先頭の言語を返します（"ja-JP,ja;q=0.9" なら "ja-JP"）。
+func primaryLanguage(acceptLanguage string) string {
+	for i, r := range acceptLanguage {
+		if r == ',' || r == ';' {
+			return acceptLanguage[:i]
+		}
+	}
+	return acceptLanguage
+}
@@ -0,0 +1,67 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"music-share-api/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type HistoryController struct {
+	playLogService services.PlayLogService
+}
+
+func NewHistoryController(playLogService services.PlayLogService) *HistoryController {
+	return &HistoryController{playLogService: playLogService}
+}
+
+// GET /room/:roomId/history?before=&limit=
+// ルームで再生された曲をセッションごとに新しい順で返す。閉じたルームでも、ホストと参加したことのあるユーザーは参照できる
+func (ctrl *HistoryController) GetRoomHistory(c *gin.Context) {
+	roomID, err := strconv.Atoi(c.Param("roomId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid roomId"})
+		return
+	}
+	limit := 0
+	if limitStr := c.Query("limit"); limitStr != "" {
+		if limit, err = strconv.Atoi(limitStr); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "limit must be an integer"})
+			return
+		}
+	}
+
+	authUserID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"status": "error", "message": "Unauthorized"})
+		return
+	}
+	userID, ok := authUserID.(int)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to parse user ID"})
+		return
+	}
+
+	history, err := ctrl.playLogService.GetRoomHistory(userID, roomID, c.Query("before"), limit)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidHistoryQuery):
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+		case errors.Is(err, services.ErrNotRoomMember):
+			c.JSON(http.StatusForbidden, gin.H{"status": "error", "message": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Error fetching room history"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":     "success",
+		"message":    "Room history retrieved",
+		"sessions":   history.Sessions,
+		"nextCursor": history.NextCursor,
+	})
+}
@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"music-share-api/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ListeningController struct {
+	listeningService services.ListeningService
+}
+
+func NewListeningController(listeningService services.ListeningService) *ListeningController {
+	return &ListeningController{listeningService: listeningService}
+}
+
+// GET /users/me/history?window=&before=&limit=
+// 自分が参加中に再生された曲と、聴いていた時間を新しい順で返す
+func (ctrl *ListeningController) GetMyHistory(c *gin.Context) {
+	limit := 0
+	if limitStr := c.Query("limit"); limitStr != "" {
+		var err error
+		if limit, err = strconv.Atoi(limitStr); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "limit must be an integer"})
+			return
+		}
+	}
+
+	authUserID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"status": "error", "message": "Unauthorized"})
+		return
+	}
+	userID, ok := authUserID.(int)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to parse user ID"})
+		return
+	}
+
+	history, err := ctrl.listeningService.GetListeningHistory(userID, c.Query("window"), c.Query("before"), limit)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidListeningQuery) {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Error fetching listening history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":     "success",
+		"message":    "Listening history retrieved",
+		"entries":    history.Entries,
+		"nextCursor": history.NextCursor,
+	})
+}
+
+// GET /users/me/stats?window=&limit=
+// 期間内のよく聴いたアーティスト・曲・ルーム・ジャンルと合計の視聴時間を返す。window は "7d"・"30d" などの日数か "all"
+func (ctrl *ListeningController) GetMyStats(c *gin.Context) {
+	limit := 0
+	if limitStr := c.Query("limit"); limitStr != "" {
+		var err error
+		if limit, err = strconv.Atoi(limitStr); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "limit must be an integer"})
+			return
+		}
+	}
+
+	authUserID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"status": "error", "message": "Unauthorized"})
+		return
+	}
+	userID, ok := authUserID.(int)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to parse user ID"})
+		return
+	}
+
+	stats, err := ctrl.listeningService.GetListeningStats(userID, c.Query("window"), limit)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidListeningQuery) {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Error fetching listening stats"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Listening stats retrieved",
+		"stats":   stats,
+	})
+}
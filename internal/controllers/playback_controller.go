@@ -0,0 +1,172 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"music-share-api/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PlaybackController struct {
+	playbackService services.PlaybackService
+}
+
+func NewPlaybackController(playbackService services.PlaybackService) *PlaybackController {
+	return &PlaybackController{
+		playbackService: playbackService,
+	}
+}
+
+// PlaybackSyncRequest は /room/:roomId/playback-sync エンドポイントのリクエストを表します
+type PlaybackSyncRequest struct {
+	Enabled *bool `json:"enabled" binding:"required"`
+}
+
+// PUT /room/:roomId/playback-sync
+// ルームの再生状態を自分の Spotify デバイスに同期するかどうかを設定する
+func (ctrl *PlaybackController) SetPlaybackSync(c *gin.Context) {
+	roomIDStr := c.Param("roomId")
+	roomID, err := strconv.Atoi(roomIDStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid roomId",
+		})
+		return
+	}
+
+	var req PlaybackSyncRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid input",
+		})
+		return
+	}
+
+	authUserID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "error",
+			"message": "Unauthorized",
+		})
+		return
+	}
+	userID, ok := authUserID.(int)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to parse user ID",
+		})
+		return
+	}
+
+	if err := ctrl.playbackService.SetPlaybackSync(userID, roomID, *req.Enabled); err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrRoomNotFound), errors.Is(err, services.ErrRoomDeleted):
+			status = roomStateStatus(err)
+		case errors.Is(err, services.ErrNotRoomMember):
+			status = http.StatusForbidden
+		case errors.Is(err, services.ErrServiceNotConnected):
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":      "success",
+		"message":     "Playback sync updated",
+		"roomId":      roomID,
+		"syncEnabled": *req.Enabled,
+	})
+}
+
+// UpdatePlaybackRequest は /room/:roomId/playback エンドポイントのリクエストを表します
+type UpdatePlaybackRequest struct {
+	// Action は "play"・"pause"・"seek" のいずれか
+	Action     string `json:"action" binding:"required"`
+	SongIndex  *int   `json:"songIndex"`
+	PositionMs *int   `json:"positionMs"`
+}
+
+// POST /room/:roomId/playback
+// ホストがルームの再生状態を変更する。再生同期を有効にしている参加者のデバイスには非同期で反映し、
+// 参加者ごとの結果は playback_results イベントとしてルームに配信する
+func (ctrl *PlaybackController) UpdatePlayback(c *gin.Context) {
+	roomIDStr := c.Param("roomId")
+	roomID, err := strconv.Atoi(roomIDStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid roomId",
+		})
+		return
+	}
+
+	var req UpdatePlaybackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid input",
+		})
+		return
+	}
+
+	authUserID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "error",
+			"message": "Unauthorized",
+		})
+		return
+	}
+	userID, ok := authUserID.(int)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to parse user ID",
+		})
+		return
+	}
+
+	state, err := ctrl.playbackService.UpdatePlayback(userID, roomID, services.PlaybackInput{
+		Action:     req.Action,
+		SongIndex:  req.SongIndex,
+		PositionMs: req.PositionMs,
+	})
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrRoomNotFound), errors.Is(err, services.ErrRoomDeleted):
+			status = roomStateStatus(err)
+		case errors.Is(err, services.ErrNotRoomHost):
+			status = http.StatusForbidden
+		case errors.Is(err, services.ErrInvalidPlayback):
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":            "success",
+		"message":           "Playback updated",
+		"roomId":            roomID,
+		"roomStatus":        state.RoomStatus,
+		"playingSongIndex":  state.PlayingSongIndex,
+		"updateSongAt":      state.UpdateSongAt,
+		"positionMs":        state.PositionMs,
+		"positionUpdatedAt": state.PositionUpdatedAt,
+	})
+}
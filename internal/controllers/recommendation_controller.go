@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"music-share-api/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RecommendationController struct {
+	recommendationService services.RecommendationService
+}
+
+func NewRecommendationController(recommendationService services.RecommendationService) *RecommendationController {
+	return &RecommendationController{recommendationService: recommendationService}
+}
+
+// GET /rooms/recommended?limit=
+// ログイン中のユーザー向けに公開ルームをスコア順に返す。各ルームにはおすすめの理由（reasons）を付ける
+func (ctrl *RecommendationController) RecommendRooms(c *gin.Context) {
+	limit := 0
+	if limitStr := c.Query("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "limit must be an integer"})
+			return
+		}
+		limit = parsed
+	}
+
+	authUserID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"status": "error", "message": "Unauthorized"})
+		return
+	}
+	userID, ok := authUserID.(int)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to parse user ID"})
+		return
+	}
+
+	rooms, err := ctrl.recommendationService.RecommendRooms(userID, limit)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidRecommendationLimit) {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Error fetching recommended rooms"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Recommended rooms",
+		"rooms":   rooms,
+	})
+}
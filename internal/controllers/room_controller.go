@@ -2,9 +2,11 @@ package controllers
 
 import (
 	// "log"
+	"errors"
 	"net/http"
 	"strconv"
 
+	"music-share-api/internal/providers"
 	"music-share-api/internal/repositories"
 	"music-share-api/internal/services"
 
@@ -12,12 +14,28 @@ import (
 )
 
 type RoomController struct {
-	roomService services.RoomService
+	roomService          services.RoomService
+	roomLifecycleService services.RoomLifecycleService
+	authService          services.AuthService
 }
 
-func NewRoomController(roomService services.RoomService) *RoomController {
+func NewRoomController(roomService services.RoomService, roomLifecycleService services.RoomLifecycleService, authService services.AuthService) *RoomController {
 	return &RoomController{
-		roomService: roomService,
+		roomService:          roomService,
+		roomLifecycleService: roomLifecycleService,
+		authService:          authService,
+	}
+}
+
+// roomStateStatus は、存在しないルームなら 404、削除されたルームなら 410、それ以外は 500 を返します。
+func roomStateStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrRoomNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrRoomDeleted):
+		return http.StatusGone
+	default:
+		return http.StatusInternalServerError
 	}
 }
 
@@ -34,8 +52,48 @@ func (ctrl *RoomController) CreateRoom(c *gin.Context) {
 		return
 	}
 
+	authUserID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "error",
+			"message": "Unauthorized",
+		})
+		return
+	}
+	userID, ok := authUserID.(int)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to parse user ID",
+		})
+		return
+	}
+	// ホストは常にリクエストしたユーザー本人（メール確認の要件やプレイリストの取り込みのトークンは本人のものを使う）
+	req.HostUserID = userID
+
 	roomID, err := ctrl.roomService.CreateRoom(req)
 	if err != nil {
+		if errors.Is(err, services.ErrInvalidGenre) || errors.Is(err, services.ErrInvalidTags) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": err.Error(),
+			})
+			return
+		}
+		if errors.Is(err, services.ErrServiceNotConnected) {
+			c.JSON(http.StatusConflict, gin.H{
+				"status":  "error",
+				"message": "Spotify is not connected",
+			})
+			return
+		}
+		if providers.IsUnavailable(err) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"status":  "error",
+				"message": "Spotify is temporarily unavailable",
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  "error",
 			"message": "Failed to create room",
@@ -89,7 +147,7 @@ func (ctrl *RoomController) JoinRoom(c *gin.Context) {
 	// コンテキストのユーザーIDを利用してルーム参加処理を実施
 	err := ctrl.roomService.JoinRoom(userID, req.UserName, req.RoomID, req.RoomPassword)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
+		c.JSON(roomStateStatus(err), gin.H{
 			"status":  "error",
 			"message": err.Error(),
 		})
@@ -104,7 +162,6 @@ func (ctrl *RoomController) JoinRoom(c *gin.Context) {
 
 // roomから退出する
 type LeaveRoomRequest struct {
-	UserID int `json:"userId" binding:"required"`
 	RoomID int `json:"roomId" binding:"required"`
 }
 
@@ -118,10 +175,28 @@ func (ctrl *RoomController) LeaveRoom(c *gin.Context) {
 		return
 	}
 
-	// サービスを呼び出してルームからの退出を処理
-	_, err := ctrl.roomService.LeaveRoom(req.UserID, req.RoomID)
-	if err != nil {
+	// ミドルウェアでセットされた userID をコンテキストから取得
+	authUserID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "error",
+			"message": "Unauthorized",
+		})
+		return
+	}
+	userID, ok := authUserID.(int)
+	if !ok {
 		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to parse user ID",
+		})
+		return
+	}
+
+	// コンテキストのユーザーIDを利用してルームからの退出を処理
+	_, err := ctrl.roomService.LeaveRoom(userID, req.RoomID)
+	if err != nil {
+		c.JSON(roomStateStatus(err), gin.H{
 			"status":  "error",
 			"message": err.Error(),
 		})
@@ -134,7 +209,7 @@ func (ctrl *RoomController) LeaveRoom(c *gin.Context) {
 	})
 }
 
-// ルームを削除する。
+// ルームを削除する（ホスト・管理者のみ）。Redis の状態を消し、参加者には room_closed イベント（reason: "deleted"）で通知する
 func (ctrl *RoomController) DeleteRoom(c *gin.Context) {
 	roomIDStr := c.Param("roomId")
 	roomID, err := strconv.Atoi(roomIDStr)
@@ -146,8 +221,38 @@ func (ctrl *RoomController) DeleteRoom(c *gin.Context) {
 		return
 	}
 
-	if err := ctrl.roomService.DeleteRoom(roomID); err != nil {
+	authUserID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "error",
+			"message": "Unauthorized",
+		})
+		return
+	}
+	userID, ok := authUserID.(int)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to parse user ID",
+		})
+		return
+	}
+
+	admin, err := ctrl.authService.IsAdmin(userID)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to check user role",
+		})
+		return
+	}
+
+	if err := ctrl.roomLifecycleService.DeleteRoom(userID, roomID, admin); err != nil {
+		status := roomStateStatus(err)
+		if errors.Is(err, services.ErrNotRoomHost) {
+			status = http.StatusForbidden
+		}
+		c.JSON(status, gin.H{
 			"status":  "error",
 			"message": err.Error(),
 		})
@@ -160,6 +265,40 @@ func (ctrl *RoomController) DeleteRoom(c *gin.Context) {
 	})
 }
 
+// POST /room/:roomId/restore
+// 削除された（閉じられた）ルームを参加者がいない状態で開き直す。管理者のみ
+func (ctrl *RoomController) RestoreRoom(c *gin.Context) {
+	roomID, err := strconv.Atoi(c.Param("roomId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid roomId",
+		})
+		return
+	}
+
+	if err := ctrl.roomLifecycleService.RestoreRoom(roomID); err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrRoomNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, services.ErrRoomNotDeleted):
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Room successfully restored",
+		"roomId":  roomID,
+	})
+}
+
 // room情報を取得する
 func (ctrl *RoomController) GetRoom(c *gin.Context) {
 	roomIDStr := c.Param("roomId")
@@ -174,7 +313,7 @@ func (ctrl *RoomController) GetRoom(c *gin.Context) {
 
 	room, err := ctrl.roomService.GetRoom(roomID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
+		c.JSON(roomStateStatus(err), gin.H{
 			"status":  "error",
 			"message": err.Error(),
 		})
@@ -189,6 +328,7 @@ func (ctrl *RoomController) GetRoom(c *gin.Context) {
 		"roomName":            room.RoomName,
 		"isPublic":            room.IsPublic,
 		"genre":               room.Genre,
+		"tags":                room.Tags,
 		"maxParticipants":     room.MaxParticipants,
 		"nowParticipants":     room.NowParticipants,
 		"host":                gin.H{"hostId": room.HostUserID, "hostName": room.HostUserName},
@@ -204,3 +344,170 @@ func (ctrl *RoomController) GetRoom(c *gin.Context) {
 		"songs":            room.Songs,
 	})
 }
+
+// ImportPlaylistRequest は /room/:roomId/import エンドポイントのリクエストを表します
+type ImportPlaylistRequest struct {
+	PlaylistID string `json:"playlistId" binding:"required"`
+}
+
+// POST /room/:roomId/import
+// ホストの Spotify プレイリストでルームの曲一覧を置き換える
+func (ctrl *RoomController) ImportPlaylist(c *gin.Context) {
+	roomIDStr := c.Param("roomId")
+	roomID, err := strconv.Atoi(roomIDStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid roomId",
+		})
+		return
+	}
+
+	var req ImportPlaylistRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid input",
+		})
+		return
+	}
+
+	authUserID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "error",
+			"message": "Unauthorized",
+		})
+		return
+	}
+	userID, ok := authUserID.(int)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to parse user ID",
+		})
+		return
+	}
+
+	playlistName, songs, err := ctrl.roomService.ImportPlaylist(userID, roomID, req.PlaylistID)
+	if err != nil {
+		status := http.StatusInternalServerError
+		var apiErr *providers.APIError
+		switch {
+		case errors.Is(err, services.ErrRoomNotFound), errors.Is(err, services.ErrRoomDeleted):
+			status = roomStateStatus(err)
+		case errors.Is(err, services.ErrNotRoomHost):
+			status = http.StatusForbidden
+		case errors.Is(err, services.ErrServiceNotConnected):
+			status = http.StatusConflict
+		case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound:
+			status = http.StatusNotFound
+		case providers.IsUnavailable(err):
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	// GetRoom と同じく、キーは song_index を文字列に変換したもの
+	songMap := make(map[string]repositories.Song, len(songs))
+	for idx, song := range songs {
+		songMap[strconv.Itoa(idx)] = song
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":              "success",
+		"message":             "Playlist successfully imported",
+		"roomId":              roomID,
+		"playingPlaylistName": playlistName,
+		"importedCount":       len(songs),
+		"songs":               songMap,
+	})
+}
+
+// ExportPlaylistRequest は /room/:roomId/export エンドポイントのリクエストを表します
+type ExportPlaylistRequest struct {
+	// Source は "queue"（ルームの曲一覧）または "history"（実際に再生された曲）。省略時は "queue"
+	Source      string `json:"source"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	IsPublic    bool   `json:"isPublic"`
+}
+
+// POST /room/:roomId/export
+// ルームの曲をリクエストしたユーザーの Spotify にプレイリストとして保存する
+func (ctrl *RoomController) ExportPlaylist(c *gin.Context) {
+	roomIDStr := c.Param("roomId")
+	roomID, err := strconv.Atoi(roomIDStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid roomId",
+		})
+		return
+	}
+
+	var req ExportPlaylistRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid input",
+		})
+		return
+	}
+
+	authUserID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "error",
+			"message": "Unauthorized",
+		})
+		return
+	}
+	userID, ok := authUserID.(int)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to parse user ID",
+		})
+		return
+	}
+
+	playlist, err := ctrl.roomService.ExportPlaylist(userID, roomID, services.ExportPlaylistInput{
+		Source:      req.Source,
+		Name:        req.Name,
+		Description: req.Description,
+		Public:      req.IsPublic,
+	})
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrRoomNotFound), errors.Is(err, services.ErrRoomDeleted):
+			status = roomStateStatus(err)
+		case errors.Is(err, services.ErrNotRoomMember):
+			status = http.StatusForbidden
+		case errors.Is(err, services.ErrServiceNotConnected):
+			status = http.StatusConflict
+		case errors.Is(err, services.ErrNothingToExport):
+			status = http.StatusBadRequest
+		case providers.IsUnavailable(err):
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":       "success",
+		"message":      "Playlist successfully exported",
+		"playlistId":   playlist.ID,
+		"playlistName": playlist.Name,
+		"playlistUrl":  playlist.URL,
+	})
+}
@@ -0,0 +1,78 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"music-share-api/internal/middlewares"
+	"music-share-api/internal/repositories"
+	"music-share-api/internal/services"
+	"music-share-api/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// leaveRoomService は、LeaveRoom の呼び出しを記録するテスト用の RoomService です。
+type leaveRoomService struct {
+	services.RoomService
+	leftUserIDs []int
+}
+
+func (s *leaveRoomService) LeaveRoom(userID int, roomID int) (*repositories.RoomAllInfo, error) {
+	s.leftUserIDs = append(s.leftUserIDs, userID)
+	return &repositories.RoomAllInfo{RoomID: roomID}, nil
+}
+
+// newLeaveRoomRouter は、main.go と同じく認証を必須にした POST /room/leave を用意します。
+func newLeaveRoomRouter(roomService services.RoomService) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	authService := &profileAuthService{}
+	r := gin.New()
+	r.POST("/room/leave", middlewares.AuthMiddleware(authService), NewRoomController(roomService, nil, authService).LeaveRoom)
+	return r
+}
+
+func TestLeaveRoomRejectsUnauthenticatedRequests(t *testing.T) {
+	roomService := &leaveRoomService{}
+	r := newLeaveRoomRouter(roomService)
+
+	req := httptest.NewRequest(http.MethodPost, "/room/leave", strings.NewReader(`{"userId": 1, "roomId": 10}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401", w.Code)
+	}
+	if len(roomService.leftUserIDs) != 0 {
+		t.Fatalf("a user left the room without authentication: %v", roomService.leftUserIDs)
+	}
+}
+
+func TestLeaveRoomUsesAuthenticatedUser(t *testing.T) {
+	roomService := &leaveRoomService{}
+	r := newLeaveRoomRouter(roomService)
+
+	cookieRecorder := httptest.NewRecorder()
+	if err := utils.SetAuthCookie(cookieRecorder, 2); err != nil {
+		t.Fatalf("SetAuthCookie: %v", err)
+	}
+
+	// body の userId で他の参加者を退出させることはできない
+	req := httptest.NewRequest(http.MethodPost, "/room/leave", strings.NewReader(`{"userId": 1, "roomId": 10}`))
+	req.Header.Set("Content-Type", "application/json")
+	for _, cookie := range cookieRecorder.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if len(roomService.leftUserIDs) != 1 || roomService.leftUserIDs[0] != 2 {
+		t.Fatalf("left users = %v, want [2]", roomService.leftUserIDs)
+	}
+}
@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"music-share-api/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// roomEventKeepAlive は、プロキシに接続を切られないよう送るコメント行の間隔です。
+const roomEventKeepAlive = 30 * time.Second
+
+type RoomEventController struct {
+	roomEventService services.RoomEventService
+}
+
+func NewRoomEventController(roomEventService services.RoomEventService) *RoomEventController {
+	return &RoomEventController{
+		roomEventService: roomEventService,
+	}
+}
+
+// GET /room/:roomId/events
+// ルームのイベントを Server-Sent Events で配信する（event にイベントの種類、data に RoomEvent の JSON）。
+// room_closed を配信したら接続を切る
+func (ctrl *RoomEventController) StreamEvents(c *gin.Context) {
+	roomIDStr := c.Param("roomId")
+	roomID, err := strconv.Atoi(roomIDStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid roomId",
+		})
+		return
+	}
+
+	authUserID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "error",
+			"message": "Unauthorized",
+		})
+		return
+	}
+	userID, ok := authUserID.(int)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to parse user ID",
+		})
+		return
+	}
+
+	events, err := ctrl.roomEventService.Subscribe(c.Request.Context(), userID, roomID)
+	if err != nil {
+		status := roomStateStatus(err)
+		if errors.Is(err, services.ErrNotRoomMember) {
+			status = http.StatusForbidden
+		}
+		c.JSON(status, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	ticker := time.NewTicker(roomEventKeepAlive)
+	defer ticker.Stop()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return false
+			}
+			c.SSEvent(event.Type, event)
+			// ルームが閉じられた（削除された）ら、通知を送ってから接続を切る
+			return event.Type != services.RoomEventRoomClosed
+		case <-ticker.C:
+			io.WriteString(w, ": keep-alive\n\n")
+			return true
+		}
+	})
+}
@@ -0,0 +1,153 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"music-share-api/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RoomMessageController struct {
+	messageService services.RoomMessageService
+}
+
+func NewRoomMessageController(messageService services.RoomMessageService) *RoomMessageController {
+	return &RoomMessageController{messageService: messageService}
+}
+
+// SendMessageRequest は POST /room/:roomId/messages のリクエストを表します
+type SendMessageRequest struct {
+	Body string `json:"body" binding:"required"`
+}
+
+// POST /room/:roomId/messages
+// チャットのメッセージを送信する（ホスト・参加者のみ）。ルームのイベントには chat_message として配信される
+func (ctrl *RoomMessageController) SendMessage(c *gin.Context) {
+	roomID, err := strconv.Atoi(c.Param("roomId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid roomId"})
+		return
+	}
+
+	var req SendMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid input"})
+		return
+	}
+
+	authUserID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"status": "error", "message": "Unauthorized"})
+		return
+	}
+	userID, ok := authUserID.(int)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to parse user ID"})
+		return
+	}
+
+	message, err := ctrl.messageService.SendMessage(userID, roomID, req.Body)
+	if err != nil {
+		ctrl.respondError(c, err, "Failed to send message")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":      "success",
+		"message":     "Message sent",
+		"roomMessage": message,
+	})
+}
+
+// GET /room/:roomId/messages?before=&limit=
+// チャットのメッセージを新しい順に返す。前のページは nextCursor を before に指定して取得する
+func (ctrl *RoomMessageController) ListMessages(c *gin.Context) {
+	roomID, err := strconv.Atoi(c.Param("roomId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid roomId"})
+		return
+	}
+	limit := 0
+	if limitStr := c.Query("limit"); limitStr != "" {
+		if limit, err = strconv.Atoi(limitStr); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "limit must be an integer"})
+			return
+		}
+	}
+
+	authUserID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"status": "error", "message": "Unauthorized"})
+		return
+	}
+	userID, ok := authUserID.(int)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to parse user ID"})
+		return
+	}
+
+	page, err := ctrl.messageService.ListMessages(userID, roomID, c.Query("before"), limit)
+	if err != nil {
+		ctrl.respondError(c, err, "Error fetching messages")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":     "success",
+		"message":    "Messages retrieved",
+		"messages":   page.Messages,
+		"nextCursor": page.NextCursor,
+	})
+}
+
+// DELETE /room/:roomId/messages/:messageId
+// チャットのメッセージを削除する（送信者またはホストのみ）。ルームのイベントには chat_message_deleted として配信される
+func (ctrl *RoomMessageController) DeleteMessage(c *gin.Context) {
+	roomID, err := strconv.Atoi(c.Param("roomId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid roomId"})
+		return
+	}
+	messageID, err := strconv.ParseInt(c.Param("messageId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid messageId"})
+		return
+	}
+
+	authUserID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"status": "error", "message": "Unauthorized"})
+		return
+	}
+	userID, ok := authUserID.(int)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to parse user ID"})
+		return
+	}
+
+	if err := ctrl.messageService.DeleteMessage(userID, roomID, messageID); err != nil {
+		ctrl.respondError(c, err, "Failed to delete message")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Message deleted"})
+}
+
+func (ctrl *RoomMessageController) respondError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrRoomNotFound), errors.Is(err, services.ErrRoomDeleted):
+		c.JSON(roomStateStatus(err), gin.H{"status": "error", "message": err.Error()})
+	case errors.Is(err, services.ErrMessageNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"status": "error", "message": err.Error()})
+	case errors.Is(err, services.ErrNotRoomMember), errors.Is(err, services.ErrNotMessageAuthor):
+		c.JSON(http.StatusForbidden, gin.H{"status": "error", "message": err.Error()})
+	case errors.Is(err, services.ErrInvalidMessage), errors.Is(err, services.ErrInvalidMessageQuery):
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+	case errors.Is(err, services.ErrMessageRateLimited):
+		c.JSON(http.StatusTooManyRequests, gin.H{"status": "error", "message": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": message})
+	}
+}
@@ -0,0 +1,187 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"music-share-api/internal/providers"
+	"music-share-api/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RoomScheduleController struct {
+	scheduleService services.RoomScheduleService
+}
+
+func NewRoomScheduleController(scheduleService services.RoomScheduleService) *RoomScheduleController {
+	return &RoomScheduleController{scheduleService: scheduleService}
+}
+
+// ScheduleRoomRequest は /room/schedule エンドポイントのリクエストを表します（CreateRoom の項目に startsAt・recurrence・recurrenceUntil を加えたもの）
+type ScheduleRoomRequest = services.ScheduleRoomInput
+
+// POST /room/schedule
+// 開始時刻を指定してルームを予約する。ホストはログイン中のユーザー
+func (ctrl *RoomScheduleController) ScheduleRoom(c *gin.Context) {
+	var req ScheduleRoomRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid input"})
+		return
+	}
+
+	authUserID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"status": "error", "message": "Unauthorized"})
+		return
+	}
+	userID, ok := authUserID.(int)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to parse user ID"})
+		return
+	}
+	if req.HostUserID != 0 && req.HostUserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"status": "error", "message": "Only the host can schedule a room"})
+		return
+	}
+
+	schedule, err := ctrl.scheduleService.ScheduleRoom(userID, req)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidSchedule), errors.Is(err, services.ErrInvalidGenre), errors.Is(err, services.ErrInvalidTags):
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+		case errors.Is(err, services.ErrServiceNotConnected):
+			c.JSON(http.StatusConflict, gin.H{"status": "error", "message": "Spotify is not connected"})
+		case providers.IsUnavailable(err):
+			c.JSON(http.StatusServiceUnavailable, gin.H{"status": "error", "message": "Spotify is temporarily unavailable"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to schedule room"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":   "success",
+		"message":  "Room successfully scheduled",
+		"schedule": schedule,
+	})
+}
+
+// GET /rooms/upcoming?limit=
+// 開始待ちの公開ルーム（と自分が予約したルーム）を開始時刻の早い順に返す
+func (ctrl *RoomScheduleController) ListUpcoming(c *gin.Context) {
+	limit := 0
+	if limitStr := c.Query("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "limit must be an integer"})
+			return
+		}
+		limit = parsed
+	}
+
+	authUserID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"status": "error", "message": "Unauthorized"})
+		return
+	}
+	userID, ok := authUserID.(int)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to parse user ID"})
+		return
+	}
+
+	schedules, err := ctrl.scheduleService.ListUpcoming(userID, limit)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidSchedule) {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Error fetching upcoming rooms"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":    "success",
+		"message":   "Upcoming rooms",
+		"schedules": schedules,
+	})
+}
+
+// DELETE /room/schedule/:scheduleId
+// ホストが予約を取り消す
+func (ctrl *RoomScheduleController) CancelSchedule(c *gin.Context) {
+	scheduleID, userID, ok := ctrl.scheduleParams(c)
+	if !ok {
+		return
+	}
+	if err := ctrl.scheduleService.CancelSchedule(userID, scheduleID); err != nil {
+		ctrl.respondError(c, err, "Failed to cancel schedule")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Schedule cancelled"})
+}
+
+// POST /room/schedule/:scheduleId/rsvp
+// 次の回に参加表明する。ルームが開いたときに通知される
+func (ctrl *RoomScheduleController) RSVP(c *gin.Context) {
+	scheduleID, userID, ok := ctrl.scheduleParams(c)
+	if !ok {
+		return
+	}
+	schedule, err := ctrl.scheduleService.RSVP(userID, scheduleID)
+	if err != nil {
+		ctrl.respondError(c, err, "Failed to rsvp")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "RSVP recorded", "schedule": schedule})
+}
+
+// DELETE /room/schedule/:scheduleId/rsvp
+// 次の回への参加表明を取り消す
+func (ctrl *RoomScheduleController) CancelRSVP(c *gin.Context) {
+	scheduleID, userID, ok := ctrl.scheduleParams(c)
+	if !ok {
+		return
+	}
+	schedule, err := ctrl.scheduleService.CancelRSVP(userID, scheduleID)
+	if err != nil {
+		ctrl.respondError(c, err, "Failed to cancel rsvp")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "RSVP cancelled", "schedule": schedule})
+}
+
+// scheduleParams は、パスの scheduleId とログイン中のユーザーIDを返します。取得できない場合はエラーを返して ok=false を返します。
+func (ctrl *RoomScheduleController) scheduleParams(c *gin.Context) (scheduleID, userID int, ok bool) {
+	scheduleID, err := strconv.Atoi(c.Param("scheduleId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid scheduleId"})
+		return 0, 0, false
+	}
+	authUserID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"status": "error", "message": "Unauthorized"})
+		return 0, 0, false
+	}
+	userID, ok = authUserID.(int)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to parse user ID"})
+		return 0, 0, false
+	}
+	return scheduleID, userID, true
+}
+
+func (ctrl *RoomScheduleController) respondError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrScheduleNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"status": "error", "message": err.Error()})
+	case errors.Is(err, services.ErrScheduleNotOpen):
+		c.JSON(http.StatusConflict, gin.H{"status": "error", "message": err.Error()})
+	case errors.Is(err, services.ErrNotRoomHost):
+		c.JSON(http.StatusForbidden, gin.H{"status": "error", "message": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": message})
+	}
+}
@@ -0,0 +1,192 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"music-share-api/internal/providers"
+	"music-share-api/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RoomTemplateController struct {
+	templateService services.RoomTemplateService
+}
+
+func NewRoomTemplateController(templateService services.RoomTemplateService) *RoomTemplateController {
+	return &RoomTemplateController{templateService: templateService}
+}
+
+// SaveTemplateRequest は POST /room/templates のリクエストを表します。
+// roomId を指定するとそのルームの設定と曲一覧を、指定しなければ room（CreateRoom と同じ項目）を保存する
+type SaveTemplateRequest = services.SaveTemplateInput
+
+// RoomFromTemplateRequest は、テンプレート・既存のルームからルームを作成するリクエストを表します。
+type RoomFromTemplateRequest = services.RoomFromTemplateInput
+
+// POST /room/templates
+// ルームの設定をテンプレートとして保存する
+func (ctrl *RoomTemplateController) SaveTemplate(c *gin.Context) {
+	var req SaveTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid input"})
+		return
+	}
+
+	authUserID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"status": "error", "message": "Unauthorized"})
+		return
+	}
+	userID, ok := authUserID.(int)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to parse user ID"})
+		return
+	}
+
+	template, err := ctrl.templateService.SaveTemplate(userID, req)
+	if err != nil {
+		ctrl.respondError(c, err, "Failed to save template")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":   "success",
+		"message":  "Template successfully saved",
+		"template": template,
+	})
+}
+
+// GET /room/templates
+// 自分のテンプレートを新しい順に返す
+func (ctrl *RoomTemplateController) ListTemplates(c *gin.Context) {
+	authUserID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"status": "error", "message": "Unauthorized"})
+		return
+	}
+	userID, ok := authUserID.(int)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to parse user ID"})
+		return
+	}
+
+	templates, err := ctrl.templateService.ListTemplates(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Error fetching templates"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":    "success",
+		"message":   "Templates retrieved",
+		"templates": templates,
+	})
+}
+
+// DELETE /room/templates/:templateId
+func (ctrl *RoomTemplateController) DeleteTemplate(c *gin.Context) {
+	templateID, err := strconv.Atoi(c.Param("templateId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid templateId"})
+		return
+	}
+
+	authUserID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"status": "error", "message": "Unauthorized"})
+		return
+	}
+	userID, ok := authUserID.(int)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to parse user ID"})
+		return
+	}
+
+	if err := ctrl.templateService.DeleteTemplate(userID, templateID); err != nil {
+		ctrl.respondError(c, err, "Failed to delete template")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Template deleted"})
+}
+
+// POST /room/templates/:templateId/rooms
+// テンプレートの設定と曲一覧でルームを作成する。roomName・roomPassword・hostUserName を指定できる
+func (ctrl *RoomTemplateController) CreateRoomFromTemplate(c *gin.Context) {
+	templateID, err := strconv.Atoi(c.Param("templateId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid templateId"})
+		return
+	}
+	ctrl.createRoom(c, func(userID int, req RoomFromTemplateRequest) (int, error) {
+		return ctrl.templateService.CreateRoomFromTemplate(userID, templateID, req)
+	})
+}
+
+// POST /room/:roomId/clone
+// ルーム（閉じたものを含む）の設定と曲一覧を複製したルームを作成する。複製できるのはホストのみ
+func (ctrl *RoomTemplateController) CloneRoom(c *gin.Context) {
+	roomID, err := strconv.Atoi(c.Param("roomId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid roomId"})
+		return
+	}
+	ctrl.createRoom(c, func(userID int, req RoomFromTemplateRequest) (int, error) {
+		return ctrl.templateService.CloneRoom(userID, roomID, req)
+	})
+}
+
+// createRoom は、リクエストを読み取って create でルームを作成し、レスポンスを返します。
+func (ctrl *RoomTemplateController) createRoom(c *gin.Context, create func(userID int, req RoomFromTemplateRequest) (int, error)) {
+	var req RoomFromTemplateRequest
+	// 上書きする項目がなければ、ボディは省略できる
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid input"})
+			return
+		}
+	}
+
+	authUserID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"status": "error", "message": "Unauthorized"})
+		return
+	}
+	userID, ok := authUserID.(int)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to parse user ID"})
+		return
+	}
+
+	roomID, err := create(userID, req)
+	if err != nil {
+		ctrl.respondError(c, err, "Failed to create room")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Room successfully created",
+		"roomId":  roomID,
+	})
+}
+
+func (ctrl *RoomTemplateController) respondError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrTemplateNotFound), errors.Is(err, services.ErrRoomNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"status": "error", "message": err.Error()})
+	case errors.Is(err, services.ErrNotRoomHost):
+		c.JSON(http.StatusForbidden, gin.H{"status": "error", "message": err.Error()})
+	case errors.Is(err, services.ErrInvalidTemplate), errors.Is(err, services.ErrPasswordPolicy),
+		errors.Is(err, services.ErrInvalidGenre), errors.Is(err, services.ErrInvalidTags):
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+	case errors.Is(err, services.ErrServiceNotConnected):
+		c.JSON(http.StatusConflict, gin.H{"status": "error", "message": "Spotify is not connected"})
+	case providers.IsUnavailable(err):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "error", "message": "Spotify is temporarily unavailable"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": message})
+	}
+}
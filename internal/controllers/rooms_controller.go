@@ -1,7 +1,10 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"music-share-api/internal/services"
 
@@ -18,9 +21,41 @@ func NewRoomsController(roomsService services.RoomsService) *RoomsController {
 	}
 }
 
+// GET /rooms/public?q=&genre=&tags=&hasFreeSlots=&sort=&limit=&cursor=
+// tags はカンマ区切りで、すべてのタグを持つルームに絞り込む。sort は participants・created・activity（既定は created。ページをまたいで並びが安定するのは created のみ）。続きは nextCursor を cursor に指定して取得する
 func (ctrl *RoomsController) GetPublicRooms(c *gin.Context) {
-	rooms, err := ctrl.roomsService.GetPublicRooms()
+	input := services.PublicRoomsInput{
+		Keyword: c.Query("q"),
+		Genre:   c.Query("genre"),
+		Sort:    c.Query("sort"),
+		Cursor:  c.Query("cursor"),
+	}
+	if tags := c.Query("tags"); tags != "" {
+		input.Tags = strings.Split(tags, ",")
+	}
+	if hasFreeSlots := c.Query("hasFreeSlots"); hasFreeSlots != "" {
+		parsed, err := strconv.ParseBool(hasFreeSlots)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "hasFreeSlots must be a boolean"})
+			return
+		}
+		input.HasFreeSlots = parsed
+	}
+	if limit := c.Query("limit"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil || parsed < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "limit must be a positive integer"})
+			return
+		}
+		input.Limit = parsed
+	}
+
+	page, err := ctrl.roomsService.GetPublicRooms(input)
 	if err != nil {
+		if errors.Is(err, services.ErrInvalidRoomsQuery) {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  "error",
 			"message": "Error fetching rooms",
@@ -29,8 +64,9 @@ func (ctrl *RoomsController) GetPublicRooms(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"status":  "success",
-		"message": "Rooms matching search criteria",
-		"rooms":   rooms,
+		"status":     "success",
+		"message":    "Rooms matching search criteria",
+		"rooms":      page.Rooms,
+		"nextCursor": page.NextCursor,
 	})
 }
@@ -0,0 +1,69 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"music-share-api/internal/providers"
+	"music-share-api/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SearchController struct {
+	searchService services.SearchService
+}
+
+func NewSearchController(searchService services.SearchService) *SearchController {
+	return &SearchController{searchService: searchService}
+}
+
+// GET /search/tracks?q=&limit=
+// ログイン中のユーザーのトークンで曲を検索し、Song 形式で返す（アクセストークンはフロントに渡さない）
+func (ctrl *SearchController) SearchTracks(c *gin.Context) {
+	query := c.Query("q")
+	limit := 20
+	if limitStr := c.Query("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed < 1 || parsed > 50 {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "limit must be between 1 and 50"})
+			return
+		}
+		limit = parsed
+	}
+
+	authUserID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"status": "error", "message": "Unauthorized"})
+		return
+	}
+	userID, ok := authUserID.(int)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to parse user ID"})
+		return
+	}
+
+	songs, cached, err := ctrl.searchService.SearchTracks(userID, query, limit)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrEmptySearchQuery):
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+		case errors.Is(err, services.ErrServiceNotConnected):
+			c.JSON(http.StatusConflict, gin.H{"status": "error", "message": "Spotify is not connected"})
+		case providers.IsUnavailable(err):
+			c.JSON(http.StatusServiceUnavailable, gin.H{"status": "error", "message": "Search is temporarily unavailable"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Search completed",
+		"query":   query,
+		"cached":  cached,
+		"songs":   songs,
+	})
+}
@@ -1,76 +1,143 @@
 package controllers
 
 import (
+	"errors"
 	"log"
 	"music-share-api/internal/services"
 	"net/http"
+	"os"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
 type ServiceController struct {
-	spotifyService services.SpotifyService
+	musicService services.MusicService
 }
 
-func NewServiceController(spotifyService services.SpotifyService) *ServiceController {
-	return &ServiceController{spotifyService: spotifyService}
+func NewServiceController(musicService services.MusicService) *ServiceController {
+	return &ServiceController{musicService: musicService}
 }
 
-// SpotifyConnct
-func (ctrl *ServiceController) SpotifyConnect(c *gin.Context) {
+// redirectURIFor は、プロバイダーごとのリダイレクトURIを環境変数から取得する（例: SPOTIFY_REDIRECT_URI）
+func redirectURIFor(provider string) string {
+	return os.Getenv(strings.ToUpper(provider) + "_REDIRECT_URI")
+}
+
+// WithProvider は、:provider を持たない旧ルート（/spotify/* など）から同じハンドラーを呼べるよう、プロバイダーを固定する
+func WithProvider(provider string, handler gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Params = append(c.Params, gin.Param{Key: "provider", Value: provider})
+		handler(c)
+	}
+}
+
+// GET /services/:provider/authorize
+// ログイン中のユーザーに紐づいた state と PKCE verifier を保存し、プロバイダーの認可URLを返す
+func (ctrl *ServiceController) Authorize(c *gin.Context) {
+	authUserID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"status": "error", "message": "Unauthorized"})
+		return
+	}
+	userID, ok := authUserID.(int)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to parse user ID"})
+		return
+	}
+
+	provider := c.Param("provider")
+	authorizeURL, err := ctrl.musicService.BuildAuthorizeURL(provider, userID, services.OAuthPurposeConnect, redirectURIFor(provider))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":       "success",
+		"message":      "Authorize URL issued",
+		"authorizeUrl": authorizeURL,
+	})
+}
+
+// POST /services/:provider/connect
+// コールバックで受け取った code と state を検証し、ログイン中のユーザーにプロバイダーを連携する
+func (ctrl *ServiceController) Connect(c *gin.Context) {
 	var req struct {
-		UserID int    `json:"userId" binding:"required"`
-		Code   string `json:"code" binding:"required"`
+		Code  string `json:"code" binding:"required"`
+		State string `json:"state" binding:"required"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid input"})
 		return
 	}
 
-	if err := ctrl.spotifyService.ConnectSpotify(req.UserID, req.Code); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": err.Error()})
+	authUserID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"status": "error", "message": "Unauthorized"})
+		return
+	}
+	userID, ok := authUserID.(int)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to parse user ID"})
+		return
+	}
+
+	if err := ctrl.musicService.Connect(c.Param("provider"), userID, req.Code, req.State); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"status":  "success",
-		"message": "Spotify connected successfully",
+		"message": "Service connected successfully",
 	})
 }
 
-func (ctrl *ServiceController) DisconnectSpotify(c *gin.Context) {
-	log.Println("DisconnectSpotify called")
-	var req struct {
-		UserID int `json:"userId" binding:"required"`
+// DELETE /services/:provider/disconnect
+func (ctrl *ServiceController) Disconnect(c *gin.Context) {
+	log.Println("Disconnect called")
+	authUserID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"status": "error", "message": "Unauthorized"})
+		return
 	}
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid input"})
+	userID, ok := authUserID.(int)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to parse user ID"})
 		return
 	}
 
-	if err := ctrl.spotifyService.DeleteSpotify(req.UserID); err != nil {
+	if err := ctrl.musicService.Disconnect(c.Param("provider"), userID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"status":  "success",
-		"message": "Account deleted successfully",
+		"message": "Service disconnected successfully",
 	})
 }
 
-// RefreshSpotifyToken
-func (ctrl *ServiceController) RefreshSpotifyToken(c *gin.Context) {
-	var req struct {
-		UserID int `json:"userId" binding:"required"`
+// POST /services/:provider/refresh-token
+func (ctrl *ServiceController) RefreshToken(c *gin.Context) {
+	authUserID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"status": "error", "message": "Unauthorized"})
+		return
 	}
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid input"})
+	userID, ok := authUserID.(int)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to parse user ID"})
 		return
 	}
 
-	encryptedAccessToken, newExpiresAt, err := ctrl.spotifyService.RefreshSpotifyToken(req.UserID)
+	newExpiresAt, err := ctrl.musicService.RefreshToken(c.Param("provider"), userID)
 	if err != nil {
+		if errors.Is(err, services.ErrConnectionBroken) || errors.Is(err, services.ErrRefreshInProgress) {
+			c.JSON(http.StatusConflict, gin.H{"status": "error", "message": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": err.Error()})
 		return
 	}
@@ -78,10 +145,10 @@ func (ctrl *ServiceController) RefreshSpotifyToken(c *gin.Context) {
 	// ここでは Format("2006-01-02T15:04:05Z") でISO8601風に変換
 	formattedExpiresAt := newExpiresAt.Format("2006-01-02T15:04:05Z")
 
+	// トークン自体はブラウザに返さない
 	c.JSON(http.StatusOK, gin.H{
-		"status":               "success",
-		"message":              "Token refresh successfully",
-		"encryptedAccessToken": encryptedAccessToken,
-		"expiresAt":            formattedExpiresAt,
+		"status":    "success",
+		"message":   "Token refresh successfully",
+		"expiresAt": formattedExpiresAt,
 	})
 }
@@ -0,0 +1,43 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"music-share-api/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// disconnectMusicService は、Disconnect に渡されたプロバイダーを記録するテスト用の MusicService です。
+type disconnectMusicService struct {
+	services.MusicService
+	providers []string
+}
+
+func (s *disconnectMusicService) Disconnect(provider string, userID int) error {
+	s.providers = append(s.providers, provider)
+	return nil
+}
+
+func TestSpotifyRoutesAliasProviderRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	musicService := &disconnectMusicService{}
+	ctrl := NewServiceController(musicService)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("userID", 1) })
+	r.DELETE("/services/:provider/disconnect", ctrl.Disconnect)
+	r.DELETE("/spotify/disconnect", WithProvider("spotify", ctrl.Disconnect))
+
+	for _, path := range []string{"/services/spotify/disconnect", "/spotify/disconnect"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, body = %s", path, w.Code, w.Body.String())
+		}
+	}
+	if len(musicService.providers) != 2 || musicService.providers[0] != "spotify" || musicService.providers[1] != "spotify" {
+		t.Fatalf("providers = %v, want [spotify spotify]", musicService.providers)
+	}
+}
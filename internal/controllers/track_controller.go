@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"music-share-api/internal/providers"
+	"music-share-api/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TrackController struct {
+	trackResolverService services.TrackResolverService
+}
+
+func NewTrackController(trackResolverService services.TrackResolverService) *TrackController {
+	return &TrackController{
+		trackResolverService: trackResolverService,
+	}
+}
+
+// GET /room/:roomId/songs/matches?provider=spotify
+// ルームの曲一覧を、リクエストしたユーザーが連携しているプロバイダーの曲に対応付ける
+func (ctrl *TrackController) ResolveRoomSongs(c *gin.Context) {
+	roomIDStr := c.Param("roomId")
+	roomID, err := strconv.Atoi(roomIDStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid roomId",
+		})
+		return
+	}
+
+	authUserID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "error",
+			"message": "Unauthorized",
+		})
+		return
+	}
+	userID, ok := authUserID.(int)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to parse user ID",
+		})
+		return
+	}
+
+	matches, err := ctrl.trackResolverService.ResolveRoomSongs(userID, roomID, c.Query("provider"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrRoomNotFound), errors.Is(err, services.ErrRoomDeleted):
+			status = roomStateStatus(err)
+		case errors.Is(err, services.ErrNotRoomMember):
+			status = http.StatusForbidden
+		case errors.Is(err, providers.ErrUnsupportedProvider):
+			status = http.StatusBadRequest
+		case errors.Is(err, services.ErrServiceNotConnected):
+			status = http.StatusConflict
+		case providers.IsUnavailable(err):
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Songs successfully resolved",
+		"roomId":  roomID,
+		"matches": matches,
+	})
+}
@@ -0,0 +1,43 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// LogMailer は開発・テスト用の Mailer です。
+// filePath が指定されていればファイルに追記し、未指定ならログに出力します。
+type LogMailer struct {
+	filePath string
+	mu       sync.Mutex
+}
+
+func NewLogMailer(filePath string) *LogMailer {
+	return &LogMailer{filePath: filePath}
+}
+
+func (m *LogMailer) Send(to, subject, body string) error {
+	entry := fmt.Sprintf("[%s] To: %s\nSubject: %s\n\n%s\n----\n", time.Now().Format(time.RFC3339), to, subject, body)
+
+	if m.filePath == "" {
+		log.Print(entry)
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := os.OpenFile(m.filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open mail log file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(entry); err != nil {
+		return fmt.Errorf("failed to write mail log: %w", err)
+	}
+	return nil
+}
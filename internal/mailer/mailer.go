@@ -0,0 +1,32 @@
+package mailer
+
+import (
+	"log"
+	"os"
+)
+
+// Mailer はメール送信の抽象化です。
+// 本番では SMTPMailer、開発・テストでは LogMailer を利用します。
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// NewMailerFromEnv は環境変数 MAILER（smtp / log）に応じた Mailer を返します。
+// 未設定の場合は LogMailer を返します。
+func NewMailerFromEnv() Mailer {
+	switch os.Getenv("MAILER") {
+	case "smtp":
+		return NewSMTPMailer(
+			os.Getenv("SMTP_HOST"),
+			os.Getenv("SMTP_PORT"),
+			os.Getenv("SMTP_USERNAME"),
+			os.Getenv("SMTP_PASSWORD"),
+			os.Getenv("MAIL_FROM"),
+		)
+	case "", "log":
+		return NewLogMailer(os.Getenv("MAILER_LOG_FILE"))
+	default:
+		log.Printf("Unknown MAILER %q, falling back to log mailer", os.Getenv("MAILER"))
+		return NewLogMailer(os.Getenv("MAILER_LOG_FILE"))
+	}
+}
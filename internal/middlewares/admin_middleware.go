@@ -0,0 +1,37 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"music-share-api/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireAdmin は、管理者（trx_users.role が "admin"）以外のユーザーが
+// 管理用のエンドポイントを実行するのを防ぎます。
+// AuthMiddleware の後に設定してください。
+func RequireAdmin(authService services.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := c.Get("userID")
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"status": "error", "message": "Unauthorized"})
+			c.Abort()
+			return
+		}
+
+		admin, err := authService.IsAdmin(userID.(int))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": err.Error()})
+			c.Abort()
+			return
+		}
+		if !admin {
+			c.JSON(http.StatusForbidden, gin.H{"status": "error", "message": "Admin privileges required"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
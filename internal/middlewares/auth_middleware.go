@@ -3,23 +3,30 @@ package middlewares
 import (
 	"net/http"
 
+	"music-share-api/internal/services"
 	"music-share-api/internal/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
+func AuthMiddleware(authService services.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, issuedAt, err := utils.CheckAuthCookie(c.Request)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"status": "error", "message": err.Error()})
+			c.Abort()
+			return
+		}
 
-func AuthMiddleware() gin.HandlerFunc {
-    return func(c *gin.Context) {
-        userID, err := utils.CheckAuthCookie(c.Request)
-        if err != nil {
-            c.JSON(http.StatusUnauthorized, gin.H{"status": "error", "message": err.Error()})
-            c.Abort()
-            return
-        }
+		// パスワード変更などで失効したセッションを拒否する
+		if err := authService.ValidateSession(userID, issuedAt); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"status": "error", "message": err.Error()})
+			c.Abort()
+			return
+		}
 
-        // 取得した userID をコンテキストに保存して後続のハンドラーで利用可能にする
-        c.Set("userID", userID)
-        c.Next()
-    }
-}
\ No newline at end of file
+		// 取得した userID をコンテキストに保存して後続のハンドラーで利用可能にする
+		c.Set("userID", userID)
+		c.Next()
+	}
+}
@@ -0,0 +1,43 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"music-share-api/internal/services"
+	"music-share-api/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireVerifiedEmail は、メールアドレス未確認のユーザーが
+// ポリシーで制限された操作(action)を実行するのを防ぎます。
+// AuthMiddleware の後に設定してください。
+func RequireVerifiedEmail(authService services.AuthService, action string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !utils.IsRestrictedForUnverifiedUser(action) {
+			c.Next()
+			return
+		}
+
+		userID, ok := c.Get("userID")
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"status": "error", "message": "Unauthorized"})
+			c.Abort()
+			return
+		}
+
+		verified, err := authService.IsEmailVerified(userID.(int))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": err.Error()})
+			c.Abort()
+			return
+		}
+		if !verified {
+			c.JSON(http.StatusForbidden, gin.H{"status": "error", "message": "Email verification required"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
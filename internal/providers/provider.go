@@ -0,0 +1,154 @@
+package providers
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidGrant は、リフレッシュトークンが失効（ユーザーによる連携解除など）している場合に返されます。
+	ErrInvalidGrant = errors.New("refresh token has been revoked")
+	// ErrUnsupportedProvider は、登録されていないプロバイダー名が指定された場合に返されます。
+	ErrUnsupportedProvider = errors.New("unsupported provider")
+	// ErrNoActiveDevice は、再生操作の対象となるアクティブなデバイスがない場合に返されます。
+	ErrNoActiveDevice = errors.New("no active device")
+	// ErrPremiumRequired は、再生操作に有料プランが必要な場合に返されます。
+	ErrPremiumRequired = errors.New("premium account required")
+	// ErrInsufficientScope は、連携時に許可されたスコープが足りず、再連携が必要な場合に返されます。
+	ErrInsufficientScope = errors.New("insufficient scope; please reconnect")
+)
+
+// APIError は、プロバイダーの API が 2xx 以外を返した場合のエラーです。
+type APIError struct {
+	Provider   string
+	StatusCode int
+	// RetryAfter は 429 などで Retry-After ヘッダーが返された場合の待機時間です（なければ 0）。
+	RetryAfter time.Duration
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s request failed, status %d: %s", e.Provider, e.StatusCode, e.Body)
+}
+
+// IsRateLimited は、err がレート制限（429）によるものかどうかを返します。
+func IsRateLimited(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == 429
+}
+
+// Token は、認可コードの交換・トークン更新の結果です。
+// RefreshToken は更新時に再発行されない場合は空になります。
+type Token struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    int
+}
+
+// Profile は、連携先サービスのユーザー情報です。
+type Profile struct {
+	ID          string
+	DisplayName string
+	// Email は取得できない（スコープ未許可など）場合は空になります。
+	Email string
+	// Country は、アカウントの国（ISO 3166-1 alpha-2）です。検索結果の対象市場（market）に使います。
+	Country string
+}
+
+// Track は、サービスに依存しない曲情報です。
+type Track struct {
+	ID         string
+	Name       string
+	Artists    []string
+	DurationMs int
+	ImageURL   string
+	ISRC       string
+}
+
+// TrackID は、プロバイダーに依存しない曲IDを返します。
+// ISRC があれば "isrc:<ISRC>"、なければ "<provider>:<プロバイダーの曲ID>" です。
+func TrackID(provider, providerTrackID, isrc string) string {
+	if isrc != "" {
+		return "isrc:" + strings.ToUpper(isrc)
+	}
+	return provider + ":" + providerTrackID
+}
+
+// Playlist は、プレイリストと含まれる全曲です。
+type Playlist struct {
+	ID   string
+	Name string
+	// URL は、ブラウザやアプリでプレイリストを開くためのURLです。
+	URL    string
+	Tracks []Track
+}
+
+// 再生操作の種類
+const (
+	PlaybackActionPlay  = "play"
+	PlaybackActionPause = "pause"
+	PlaybackActionSeek  = "seek"
+)
+
+// PlaybackCommand は、ユーザーのアクティブなデバイスに送る再生操作です。
+type PlaybackCommand struct {
+	Action string
+	// TrackID は play の場合に再生する曲（空なら現在の曲を再開）
+	TrackID    string
+	PositionMs int
+}
+
+// MusicProvider は、音楽配信サービス（Spotify など）との連携を抽象化します。
+type MusicProvider interface {
+	// Name は trx_users_services.service_name に保存される識別子です（例: "spotify"）。
+	Name() string
+	AuthorizeURL(state, codeChallenge, redirectURI string) string
+	ExchangeCode(code, redirectURI, codeVerifier string) (*Token, error)
+	RefreshToken(refreshToken string) (*Token, error)
+	GetProfile(accessToken string) (*Profile, error)
+	// SearchTracks は、market（空ならトークンの持ち主の国）で聴ける曲を検索します。
+	SearchTracks(accessToken, query, market string, limit int) ([]Track, error)
+	GetTrack(accessToken, trackID string) (*Track, error)
+	// FindTracksByISRC は、ISRC が一致する曲を返します（見つからなければ空）。
+	FindTracksByISRC(accessToken, isrc string) ([]Track, error)
+	GetPlaylist(accessToken, playlistID string) (*Playlist, error)
+	// CreatePlaylist は、トークンの持ち主のアカウントにプレイリストを作成し、trackIDs の曲を順に追加します。
+	// 返される Playlist の Tracks は空です。
+	CreatePlaylist(accessToken, name, description string, public bool, trackIDs []string) (*Playlist, error)
+	// ControlPlayback は、トークンの持ち主のアクティブなデバイスで再生操作を行います。
+	ControlPlayback(accessToken string, command PlaybackCommand) error
+}
+
+// Registry は、利用可能な MusicProvider を名前で管理します。
+type Registry struct {
+	providers map[string]MusicProvider
+}
+
+func NewRegistry(musicProviders ...MusicProvider) *Registry {
+	registry := &Registry{providers: make(map[string]MusicProvider)}
+	for _, provider := range musicProviders {
+		registry.providers[provider.Name()] = provider
+	}
+	return registry
+}
+
+func (r *Registry) Get(name string) (MusicProvider, error) {
+	provider, ok := r.providers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedProvider, name)
+	}
+	return provider, nil
+}
+
+// Names は登録されているプロバイダー名を昇順で返します。
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
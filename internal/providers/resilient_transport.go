@@ -0,0 +1,413 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen は、プロバイダーへのリクエストが続けて失敗しているため、リクエストを送らずに失敗させた場合に返されます。
+var ErrCircuitOpen = errors.New("provider circuit breaker is open")
+
+// IsUnavailable は、err がプロバイダーの一時的な利用不可（レート制限・サーキットブレーカー）によるものかどうかを返します。
+func IsUnavailable(err error) bool {
+	return IsRateLimited(err) || errors.Is(err, ErrCircuitOpen)
+}
+
+type noRetryKey struct{}
+
+// WithoutRetry は、このコンテキストで送るリクエストをトランスポートで再試行しないようにします。
+// 再試行ごとにリクエストの内容を作り直す必要がある呼び出し元（再生位置を送る再生操作など）は、自分で再試行します。
+func WithoutRetry(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noRetryKey{}, true)
+}
+
+// providerHTTPMetrics は /debug/vars の "provider_http" に、プロバイダーごとの送信数・再試行数・サーキットの状態などを公開します。
+var providerHTTPMetrics = expvar.NewMap("provider_http")
+
+// サーキットブレーカーの状態
+const (
+	circuitClosed   = "closed"
+	circuitOpen     = "open"
+	circuitHalfOpen = "half_open"
+)
+
+// TransportConfig は、ResilientTransport の設定です。0 の項目には既定値が使われます。
+type TransportConfig struct {
+	// Name はメトリクスの名前です（例: "spotify"）。
+	Name string
+	// MaxRetries は、最初のリクエストに加えて再試行する回数の上限です（負の値で再試行しない）。
+	MaxRetries  int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// MaxRetryAfter は、リクエスト内で待つ Retry-After の上限です。これより長い場合は 429 をそのまま返します。
+	MaxRetryAfter time.Duration
+	// AttemptTimeout は、1回のリクエスト（レスポンスボディの読み込みを含む）のタイムアウトです。
+	AttemptTimeout time.Duration
+	// FailureThreshold 回続けて失敗（5xx・通信エラー）するとサーキットを開き、OpenDuration の間はリクエストを送りません。
+	FailureThreshold int
+	OpenDuration     time.Duration
+}
+
+func (cfg TransportConfig) withDefaults() TransportConfig {
+	if cfg.Name == "" {
+		cfg.Name = "default"
+	}
+	if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = 2
+	} else if cfg.MaxRetries < 0 {
+		cfg.MaxRetries = 0
+	}
+	if cfg.BaseBackoff <= 0 {
+		cfg.BaseBackoff = 200 * time.Millisecond
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 5 * time.Second
+	}
+	if cfg.MaxRetryAfter <= 0 {
+		cfg.MaxRetryAfter = 10 * time.Second
+	}
+	if cfg.AttemptTimeout <= 0 {
+		cfg.AttemptTimeout = 10 * time.Second
+	}
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = 5
+	}
+	if cfg.OpenDuration <= 0 {
+		cfg.OpenDuration = 30 * time.Second
+	}
+	return cfg
+}
+
+// ResilientTransport は、プロバイダーへのリクエストを以下のように扱う http.RoundTripper です。
+//   - 429 の Retry-After を守り、待つ間は同じホストへの他のリクエストも待たせる
+//   - 冪等なリクエスト（GET・PUT・DELETE など）は、5xx・通信エラーの場合にジッター付きの指数バックオフで再試行する
+//   - ホストへのリクエストが続けて失敗したらサーキットを開き、しばらくは送らずに ErrCircuitOpen を返す
+type ResilientTransport struct {
+	base    http.RoundTripper
+	cfg     TransportConfig
+	metrics *expvar.Map
+
+	mu    sync.Mutex
+	hosts map[string]*hostState
+}
+
+// hostState は、ホストごとのサーキットブレーカーとレート制限の状態です。
+type hostState struct {
+	state               string
+	consecutiveFailures int
+	openUntil           time.Time
+	// probing は、半開状態で試しに送ったリクエストの結果を待っていることを表す
+	probing bool
+	// blockedUntil は、Retry-After で指定された時刻
+	blockedUntil time.Time
+	stateVar     *expvar.String
+}
+
+// NewResilientClient は、ResilientTransport を使う http.Client を返します。base が nil の場合は http.DefaultTransport を使います。
+func NewResilientClient(base http.RoundTripper, cfg TransportConfig) *http.Client {
+	return &http.Client{Transport: NewResilientTransport(base, cfg)}
+}
+
+func NewResilientTransport(base http.RoundTripper, cfg TransportConfig) *ResilientTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	cfg = cfg.withDefaults()
+
+	metrics, ok := providerHTTPMetrics.Get(cfg.Name).(*expvar.Map)
+	if !ok {
+		metrics = new(expvar.Map).Init()
+		providerHTTPMetrics.Set(cfg.Name, metrics)
+	}
+	return &ResilientTransport{
+		base:    base,
+		cfg:     cfg,
+		metrics: metrics,
+		hosts:   make(map[string]*hostState),
+	}
+}
+
+// Metrics は、このトランスポートのメトリクス（/debug/vars の provider_http.<Name>）を返します。
+func (t *ResilientTransport) Metrics() *expvar.Map {
+	return t.metrics
+}
+
+func (t *ResilientTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.metrics.Add("requests", 1)
+	ctx := req.Context()
+	retryable := isIdempotent(req) && (req.Body == nil || req.GetBody != nil)
+	maxRetries := t.cfg.MaxRetries
+	if noRetry, _ := ctx.Value(noRetryKey{}).(bool); noRetry {
+		maxRetries = 0
+	}
+
+	for attempt := 0; ; attempt++ {
+		// 他のリクエストが受け取った Retry-After の間は送らない
+		if wait := t.rateLimitWait(req.URL.Host); wait > 0 {
+			if wait > t.cfg.MaxRetryAfter {
+				t.metrics.Add("rate_limit_rejected", 1)
+				return rateLimitedResponse(req, wait), nil
+			}
+			if err := sleepContext(ctx, wait); err != nil {
+				return nil, err
+			}
+		}
+		if err := t.allow(req.URL.Host); err != nil {
+			t.metrics.Add("circuit_rejected", 1)
+			return nil, err
+		}
+
+		if attempt > 0 {
+			t.metrics.Add("retries", 1)
+		}
+		resp, err := t.send(req, attempt)
+		t.metrics.Add("attempts", 1)
+
+		switch {
+		case err != nil:
+			if ctx.Err() != nil {
+				// 呼び出し元のキャンセルはプロバイダーの失敗として数えない
+				t.release(req.URL.Host)
+				return nil, err
+			}
+			t.metrics.Add("failures", 1)
+			t.recordFailure(req.URL.Host)
+			if !retryable || attempt >= maxRetries {
+				return nil, err
+			}
+			if err := sleepContext(ctx, t.backoff(attempt)); err != nil {
+				return nil, err
+			}
+
+		case resp.StatusCode == http.StatusTooManyRequests:
+			// レート制限はプロバイダーの障害ではないため、サーキットには影響させない
+			t.metrics.Add("rate_limited", 1)
+			t.recordSuccess(req.URL.Host)
+			retryAfter := parseRetryAfter(resp.Header.Get("Retry-After"))
+			if retryAfter <= 0 {
+				retryAfter = t.backoff(attempt)
+			}
+			t.block(req.URL.Host, retryAfter)
+			// 429 はリクエストが処理されていないため、冪等でなくても再試行できる
+			if attempt >= maxRetries || retryAfter > t.cfg.MaxRetryAfter || (req.Body != nil && req.GetBody == nil) {
+				return resp, nil
+			}
+			drainAndClose(resp)
+			// 待機は次のループの先頭で行う
+
+		case resp.StatusCode >= 500:
+			t.metrics.Add("failures", 1)
+			t.recordFailure(req.URL.Host)
+			if !retryable || attempt >= maxRetries {
+				return resp, nil
+			}
+			wait := t.backoff(attempt)
+			if retryAfter := parseRetryAfter(resp.Header.Get("Retry-After")); retryAfter > 0 && retryAfter <= t.cfg.MaxRetryAfter {
+				wait = retryAfter
+			}
+			drainAndClose(resp)
+			if err := sleepContext(ctx, wait); err != nil {
+				return nil, err
+			}
+
+		default:
+			t.recordSuccess(req.URL.Host)
+			return resp, nil
+		}
+	}
+}
+
+// send は、1回分のリクエストを AttemptTimeout 付きで送ります。タイムアウトはレスポンスボディを閉じるまで有効です。
+func (t *ResilientTransport) send(req *http.Request, attempt int) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), t.cfg.AttemptTimeout)
+	attemptReq := req.Clone(ctx)
+	if attempt > 0 && req.Body != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("failed to rewind request body: %w", err)
+		}
+		attemptReq.Body = body
+	}
+
+	resp, err := t.base.RoundTrip(attemptReq)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+func (t *ResilientTransport) host(name string) *hostState {
+	hs, ok := t.hosts[name]
+	if !ok {
+		hs = &hostState{state: circuitClosed, stateVar: new(expvar.String)}
+		hs.stateVar.Set(circuitClosed)
+		t.metrics.Set("circuit:"+name, hs.stateVar)
+		t.hosts[name] = hs
+	}
+	return hs
+}
+
+func (t *ResilientTransport) setState(hs *hostState, state string) {
+	hs.state = state
+	hs.stateVar.Set(state)
+}
+
+// allow は、サーキットが開いている間は ErrCircuitOpen を返します。
+// 開いてから OpenDuration が過ぎたら半開状態にし、1件だけ試しに送らせます。
+func (t *ResilientTransport) allow(host string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	hs := t.host(host)
+	switch hs.state {
+	case circuitOpen:
+		if time.Now().Before(hs.openUntil) {
+			return fmt.Errorf("%w: %s", ErrCircuitOpen, host)
+		}
+		t.setState(hs, circuitHalfOpen)
+		hs.probing = true
+	case circuitHalfOpen:
+		if hs.probing {
+			return fmt.Errorf("%w: %s", ErrCircuitOpen, host)
+		}
+		hs.probing = true
+	}
+	return nil
+}
+
+func (t *ResilientTransport) recordSuccess(host string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	hs := t.host(host)
+	hs.consecutiveFailures = 0
+	hs.probing = false
+	if hs.state != circuitClosed {
+		t.setState(hs, circuitClosed)
+	}
+}
+
+func (t *ResilientTransport) recordFailure(host string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	hs := t.host(host)
+	hs.consecutiveFailures++
+	hs.probing = false
+	if hs.state == circuitHalfOpen || (hs.state == circuitClosed && hs.consecutiveFailures >= t.cfg.FailureThreshold) {
+		t.setState(hs, circuitOpen)
+		hs.openUntil = time.Now().Add(t.cfg.OpenDuration)
+		t.metrics.Add("circuit_opened", 1)
+	}
+}
+
+// release は、結果の出なかった試しのリクエストを取り消し、次のリクエストで改めて試せるようにします。
+func (t *ResilientTransport) release(host string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.host(host).probing = false
+}
+
+func (t *ResilientTransport) block(host string, retryAfter time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	hs := t.host(host)
+	if until := time.Now().Add(retryAfter); until.After(hs.blockedUntil) {
+		hs.blockedUntil = until
+	}
+}
+
+func (t *ResilientTransport) rateLimitWait(host string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return time.Until(t.host(host).blockedUntil)
+}
+
+// backoff は、attempt 回目の失敗後に待つ時間を返します（指数バックオフの後半をランダムに選ぶ）。
+func (t *ResilientTransport) backoff(attempt int) time.Duration {
+	wait := t.cfg.BaseBackoff << uint(attempt)
+	if wait <= 0 || wait > t.cfg.MaxBackoff {
+		wait = t.cfg.MaxBackoff
+	}
+	if half := int64(wait / 2); half > 0 {
+		wait = wait/2 + time.Duration(rand.Int63n(half+1))
+	}
+	return wait
+}
+
+// isIdempotent は、再送しても結果が変わらないリクエストかどうかを返します。
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != ""
+}
+
+// parseRetryAfter は、Retry-After ヘッダー（秒数または HTTP 日付）を待ち時間に変換します。
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return time.Until(at)
+	}
+	return 0
+}
+
+// rateLimitedResponse は、Retry-After の間に送ろうとしたリクエストに対して、送らずに返す 429 レスポンスです。
+func rateLimitedResponse(req *http.Request, wait time.Duration) *http.Response {
+	seconds := int((wait + time.Second - 1) / time.Second)
+	body := `{"error":{"status":429,"message":"rate limited; waiting for Retry-After"}}`
+	return &http.Response{
+		Status:        "429 Too Many Requests",
+		StatusCode:    http.StatusTooManyRequests,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Retry-After": []string{strconv.Itoa(seconds)}, "Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func drainAndClose(resp *http.Response) {
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+}
+
+// cancelOnClose は、レスポンスボディを閉じたときにリクエストのコンテキストを解放します。
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
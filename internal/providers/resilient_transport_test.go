@@ -0,0 +1,168 @@
+package providers_test
+
+import (
+	"errors"
+	"expvar"
+	"net/http"
+	"testing"
+	"time"
+
+	"music-share-api/internal/providers"
+	"music-share-api/internal/providers/spotifytest"
+)
+
+func newResilientSpotify(t *testing.T, cfg providers.TransportConfig) (*spotifytest.Server, providers.MusicProvider, *providers.ResilientTransport) {
+	t.Helper()
+	fake := spotifytest.NewServer()
+	t.Cleanup(fake.Close)
+	fake.AddUser(spotifytest.User{ID: "sp-user"})
+
+	// メトリクスはテストごとに分ける
+	cfg.Name = t.Name()
+	transport := providers.NewResilientTransport(fake.Client().Transport, cfg)
+	provider := providers.NewSpotifyProvider(providers.SpotifyConfig{
+		ClientID:        spotifytest.ClientID,
+		ClientSecret:    spotifytest.ClientSecret,
+		AccountsBaseURL: fake.AccountsBaseURL(),
+		APIBaseURL:      fake.APIBaseURL(),
+		HTTPClient:      &http.Client{Transport: transport},
+	})
+	return fake, provider, transport
+}
+
+func metric(transport *providers.ResilientTransport, key string) string {
+	if v := transport.Metrics().Get(key); v != nil {
+		return v.String()
+	}
+	return "0"
+}
+
+func TestResilientTransportRetriesIdempotentRequests(t *testing.T) {
+	fake, provider, transport := newResilientSpotify(t, providers.TransportConfig{MaxRetries: 2, BaseBackoff: time.Millisecond})
+	accessToken, _ := fake.IssueTokens("sp-user")
+
+	fake.FailNext("/v1/me", http.StatusBadGateway, `{"error":{"status":502}}`)
+	fake.FailNext("/v1/me", http.StatusServiceUnavailable, `{"error":{"status":503}}`)
+	if _, err := provider.GetProfile(accessToken); err != nil {
+		t.Fatalf("GetProfile: %v", err)
+	}
+	if got := fake.RequestCount("/v1/me"); got != 3 {
+		t.Fatalf("requests = %d, want 3", got)
+	}
+	if got := metric(transport, "retries"); got != "2" {
+		t.Fatalf("retries metric = %s, want 2", got)
+	}
+
+	// 再試行の上限を超えたら最後のエラーを返す
+	for i := 0; i < 3; i++ {
+		fake.FailNext("/v1/me", http.StatusInternalServerError, `{"error":{"status":500}}`)
+	}
+	var apiErr *providers.APIError
+	if _, err := provider.GetProfile(accessToken); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("err = %v, want 500 APIError", err)
+	}
+}
+
+func TestResilientTransportDoesNotRetryNonIdempotentRequests(t *testing.T) {
+	fake, provider, _ := newResilientSpotify(t, providers.TransportConfig{MaxRetries: 2, BaseBackoff: time.Millisecond})
+	accessToken, _ := fake.IssueTokens("sp-user")
+
+	fake.FailNext("/v1/users/sp-user/playlists", http.StatusInternalServerError, `{"error":{"status":500}}`)
+	if _, err := provider.CreatePlaylist(accessToken, "Session", "", false, nil); err == nil {
+		t.Fatal("CreatePlaylist succeeded although the provider failed")
+	}
+	if got := fake.RequestCount("/v1/users/sp-user/playlists"); got != 1 {
+		t.Fatalf("requests = %d, want 1", got)
+	}
+}
+
+func TestResilientTransportDoesNotRetryPlaybackCommands(t *testing.T) {
+	fake, provider, _ := newResilientSpotify(t, providers.TransportConfig{MaxRetries: 2, BaseBackoff: time.Millisecond})
+	accessToken, _ := fake.IssueTokens("sp-user")
+
+	// 再生操作は再生位置を計算し直して呼び出し元が再試行するため、トランスポートでは送り直さない
+	fake.FailNext("/v1/me/player/play", http.StatusBadGateway, `{"error":{"status":502}}`)
+	var apiErr *providers.APIError
+	err := provider.ControlPlayback(accessToken, providers.PlaybackCommand{Action: providers.PlaybackActionPlay, TrackID: "t1", PositionMs: 1000})
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadGateway {
+		t.Fatalf("err = %v, want 502 APIError", err)
+	}
+	if got := fake.RequestCount("/v1/me/player/play"); got != 1 {
+		t.Fatalf("requests = %d, want 1", got)
+	}
+}
+
+func TestResilientTransportHonorsRetryAfter(t *testing.T) {
+	fake, provider, transport := newResilientSpotify(t, providers.TransportConfig{MaxRetries: 2, MaxRetryAfter: 2 * time.Second})
+	accessToken, _ := fake.IssueTokens("sp-user")
+
+	fake.RateLimitNext("/v1/me", 1)
+	started := time.Now()
+	if _, err := provider.GetProfile(accessToken); err != nil {
+		t.Fatalf("GetProfile: %v", err)
+	}
+	if elapsed := time.Since(started); elapsed < time.Second {
+		t.Fatalf("retried after %v, want at least the Retry-After of 1s", elapsed)
+	}
+
+	// 長すぎる Retry-After は待たずに返し、その間の他のリクエストは送らない
+	fake.RateLimitNext("/v1/me", 30)
+	_, err := provider.GetProfile(accessToken)
+	var apiErr *providers.APIError
+	if !errors.As(err, &apiErr) || !providers.IsRateLimited(err) || apiErr.RetryAfter != 30*time.Second {
+		t.Fatalf("err = %v, want rate limited with Retry-After 30s", err)
+	}
+	requests := fake.RequestCount("/v1/me")
+	if _, err := provider.SearchTracks(accessToken, "sky", "", 10); !providers.IsRateLimited(err) {
+		t.Fatalf("err = %v, want rate limited while waiting for Retry-After", err)
+	}
+	if got := fake.RequestCount("/v1/search"); got != 0 || fake.RequestCount("/v1/me") != requests {
+		t.Fatal("request was sent while waiting for Retry-After")
+	}
+	if got := metric(transport, "rate_limit_rejected"); got != "1" {
+		t.Fatalf("rate_limit_rejected metric = %s, want 1", got)
+	}
+}
+
+func TestResilientTransportCircuitBreaker(t *testing.T) {
+	fake, provider, transport := newResilientSpotify(t, providers.TransportConfig{
+		MaxRetries:       -1,
+		FailureThreshold: 2,
+		OpenDuration:     50 * time.Millisecond,
+	})
+	accessToken, _ := fake.IssueTokens("sp-user")
+	circuitKey := "circuit:" + fake.Listener.Addr().String()
+
+	for i := 0; i < 2; i++ {
+		fake.FailNext("/v1/me", http.StatusInternalServerError, `{"error":{"status":500}}`)
+		if _, err := provider.GetProfile(accessToken); err == nil {
+			t.Fatal("GetProfile succeeded although the provider failed")
+		}
+	}
+	if got := metric(transport, circuitKey); got != `"open"` {
+		t.Fatalf("circuit state = %s, want open", got)
+	}
+
+	// サーキットが開いている間は送らずに失敗させる
+	_, err := provider.GetProfile(accessToken)
+	if !errors.Is(err, providers.ErrCircuitOpen) || !providers.IsUnavailable(err) {
+		t.Fatalf("err = %v, want ErrCircuitOpen", err)
+	}
+	if got := fake.RequestCount("/v1/me"); got != 2 {
+		t.Fatalf("requests = %d, want 2", got)
+	}
+
+	// 一定時間後に試しに送ったリクエストが成功すれば閉じる
+	time.Sleep(60 * time.Millisecond)
+	if _, err := provider.GetProfile(accessToken); err != nil {
+		t.Fatalf("GetProfile after the circuit was reopened: %v", err)
+	}
+	if got := metric(transport, circuitKey); got != `"closed"` {
+		t.Fatalf("circuit state = %s, want closed", got)
+	}
+
+	// /debug/vars に公開される
+	if expvar.Get("provider_http").(*expvar.Map).Get(t.Name()) == nil {
+		t.Fatal("metrics are not published")
+	}
+}
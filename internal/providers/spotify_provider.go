@@ -0,0 +1,440 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSpotifyAccountsBaseURL = "https://accounts.spotify.com"
+	defaultSpotifyAPIBaseURL      = "https://api.spotify.com/v1"
+)
+
+// SpotifyConfig は Spotify プロバイダーの設定です。
+// AccountsBaseURL / APIBaseURL / HTTPClient は省略時に本番の値が使われ、テストではフェイクサーバーに差し替えられます。
+type SpotifyConfig struct {
+	ClientID     string
+	ClientSecret string
+	Scopes       string
+	// AccountsBaseURL は認可・トークンエンドポイントのベースURL（例: https://accounts.spotify.com）
+	AccountsBaseURL string
+	// APIBaseURL は Web API のベースURL（例: https://api.spotify.com/v1）
+	APIBaseURL string
+	HTTPClient *http.Client
+}
+
+// spotifyProvider は Spotify Web API を利用した MusicProvider の実装です。
+type spotifyProvider struct {
+	clientID        string
+	clientSecret    string
+	scopes          string
+	accountsBaseURL string
+	apiBaseURL      string
+	httpClient      *http.Client
+}
+
+func NewSpotifyProvider(cfg SpotifyConfig) MusicProvider {
+	provider := &spotifyProvider{
+		clientID:        cfg.ClientID,
+		clientSecret:    cfg.ClientSecret,
+		scopes:          cfg.Scopes,
+		accountsBaseURL: strings.TrimRight(cfg.AccountsBaseURL, "/"),
+		apiBaseURL:      strings.TrimRight(cfg.APIBaseURL, "/"),
+		httpClient:      cfg.HTTPClient,
+	}
+	if provider.accountsBaseURL == "" {
+		provider.accountsBaseURL = defaultSpotifyAccountsBaseURL
+	}
+	if provider.apiBaseURL == "" {
+		provider.apiBaseURL = defaultSpotifyAPIBaseURL
+	}
+	if provider.httpClient == nil {
+		provider.httpClient = NewResilientClient(nil, TransportConfig{Name: "spotify"})
+	}
+	return provider
+}
+
+// spotifyTokenResponse はSpotifyのトークンレスポンスを表します。
+type spotifyTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+// spotifyUserProfile はSpotifyのユーザー情報レスポンスを表します。
+type spotifyUserProfile struct {
+	ID          string `json:"id"`
+	DisplayName string `json:"display_name"`
+	// user-read-email スコープが許可されている場合のみ取得できる
+	Email string `json:"email"`
+	// user-read-private スコープが許可されている場合のみ取得できる
+	Country string `json:"country"`
+}
+
+// spotifyTrack は Spotify の track オブジェクトのうち利用するフィールドです。
+type spotifyTrack struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	DurationMs int    `json:"duration_ms"`
+	Artists    []struct {
+		Name string `json:"name"`
+	} `json:"artists"`
+	Album struct {
+		Images []struct {
+			URL string `json:"url"`
+		} `json:"images"`
+	} `json:"album"`
+	ExternalIDs struct {
+		ISRC string `json:"isrc"`
+	} `json:"external_ids"`
+}
+
+type spotifyExternalURLs struct {
+	Spotify string `json:"spotify"`
+}
+
+type spotifyPlaylistTracksPage struct {
+	Items []struct {
+		// ローカルファイルや削除済みの曲は null になる
+		Track *spotifyTrack `json:"track"`
+	} `json:"items"`
+	Next string `json:"next"`
+}
+
+func (p *spotifyProvider) Name() string {
+	return "spotify"
+}
+
+func (p *spotifyProvider) AuthorizeURL(state, codeChallenge, redirectURI string) string {
+	params := url.Values{}
+	params.Set("client_id", p.clientID)
+	params.Set("response_type", "code")
+	params.Set("redirect_uri", redirectURI)
+	params.Set("scope", p.scopes)
+	params.Set("state", state)
+	params.Set("code_challenge_method", "S256")
+	params.Set("code_challenge", codeChallenge)
+	return p.accountsBaseURL + "/authorize?" + params.Encode()
+}
+
+func (p *spotifyProvider) ExchangeCode(code, redirectURI, codeVerifier string) (*Token, error) {
+	formData := url.Values{}
+	formData.Set("grant_type", "authorization_code")
+	formData.Set("code", code)
+	formData.Set("redirect_uri", redirectURI)
+	formData.Set("code_verifier", codeVerifier)
+	return p.requestToken(formData)
+}
+
+func (p *spotifyProvider) RefreshToken(refreshToken string) (*Token, error) {
+	formData := url.Values{}
+	formData.Set("grant_type", "refresh_token")
+	formData.Set("refresh_token", refreshToken)
+	return p.requestToken(formData)
+}
+
+// requestToken は、トークンエンドポイントに Basic 認証付きでリクエストします。
+func (p *spotifyProvider) requestToken(formData url.Values) (*Token, error) {
+	if p.clientID == "" || p.clientSecret == "" {
+		return nil, fmt.Errorf("missing spotify credentials")
+	}
+
+	tokenURL := p.accountsBaseURL + "/api/token"
+	req, err := http.NewRequest("POST", tokenURL, bytes.NewBufferString(formData.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	// Basic認証ヘッダーの設定
+	authStr := fmt.Sprintf("%s:%s", p.clientID, p.clientSecret)
+	req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(authStr)))
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute token request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		// invalid_grant は再試行しても回復しない（リフレッシュトークンの失効など）
+		if resp.StatusCode == http.StatusBadRequest && strings.Contains(string(body), "invalid_grant") {
+			return nil, ErrInvalidGrant
+		}
+		return nil, newSpotifyAPIError(resp, body)
+	}
+
+	var tokenResp spotifyTokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return nil, fmt.Errorf("failed to decode token response: %w", err)
+	}
+	return &Token{
+		AccessToken:  tokenResp.AccessToken,
+		RefreshToken: tokenResp.RefreshToken,
+		ExpiresIn:    tokenResp.ExpiresIn,
+	}, nil
+}
+
+func (p *spotifyProvider) GetProfile(accessToken string) (*Profile, error) {
+	var userProfile spotifyUserProfile
+	if err := p.getJSON(accessToken, p.apiBaseURL+"/me", &userProfile); err != nil {
+		return nil, err
+	}
+	return &Profile{
+		ID:          userProfile.ID,
+		DisplayName: userProfile.DisplayName,
+		Email:       userProfile.Email,
+		Country:     userProfile.Country,
+	}, nil
+}
+
+func (p *spotifyProvider) SearchTracks(accessToken, query, market string, limit int) ([]Track, error) {
+	params := url.Values{}
+	params.Set("q", query)
+	params.Set("type", "track")
+	params.Set("limit", fmt.Sprintf("%d", limit))
+	if market != "" {
+		params.Set("market", market)
+	}
+
+	var searchResp struct {
+		Tracks struct {
+			Items []spotifyTrack `json:"items"`
+		} `json:"tracks"`
+	}
+	if err := p.getJSON(accessToken, p.apiBaseURL+"/search?"+params.Encode(), &searchResp); err != nil {
+		return nil, err
+	}
+
+	tracks := make([]Track, 0, len(searchResp.Tracks.Items))
+	for _, item := range searchResp.Tracks.Items {
+		tracks = append(tracks, item.toTrack())
+	}
+	return tracks, nil
+}
+
+func (p *spotifyProvider) FindTracksByISRC(accessToken, isrc string) ([]Track, error) {
+	tracks, err := p.SearchTracks(accessToken, "isrc:"+isrc, "", 10)
+	if err != nil {
+		return nil, err
+	}
+	// 検索は部分一致の結果を含むことがあるため、完全に一致するものだけを返す
+	matched := make([]Track, 0, len(tracks))
+	for _, track := range tracks {
+		if strings.EqualFold(track.ISRC, isrc) {
+			matched = append(matched, track)
+		}
+	}
+	return matched, nil
+}
+
+func (p *spotifyProvider) GetTrack(accessToken, trackID string) (*Track, error) {
+	var track spotifyTrack
+	if err := p.getJSON(accessToken, p.apiBaseURL+"/tracks/"+url.PathEscape(trackID), &track); err != nil {
+		return nil, err
+	}
+	result := track.toTrack()
+	return &result, nil
+}
+
+// GetPlaylist は、プレイリストの全曲をページングしながら取得します。
+func (p *spotifyProvider) GetPlaylist(accessToken, playlistID string) (*Playlist, error) {
+	var playlistResp struct {
+		ID           string                    `json:"id"`
+		Name         string                    `json:"name"`
+		ExternalURLs spotifyExternalURLs       `json:"external_urls"`
+		Tracks       spotifyPlaylistTracksPage `json:"tracks"`
+	}
+	if err := p.getJSON(accessToken, p.apiBaseURL+"/playlists/"+url.PathEscape(playlistID), &playlistResp); err != nil {
+		return nil, err
+	}
+
+	playlist := &Playlist{ID: playlistResp.ID, Name: playlistResp.Name, URL: playlistResp.ExternalURLs.Spotify}
+	page := playlistResp.Tracks
+	for {
+		for _, item := range page.Items {
+			if item.Track == nil || item.Track.ID == "" {
+				continue
+			}
+			playlist.Tracks = append(playlist.Tracks, item.Track.toTrack())
+		}
+		if page.Next == "" {
+			break
+		}
+		next := page.Next
+		page = spotifyPlaylistTracksPage{}
+		if err := p.getJSON(accessToken, next, &page); err != nil {
+			return nil, err
+		}
+	}
+	return playlist, nil
+}
+
+// spotifyAddTracksLimit は、プレイリストへの曲追加1回あたりの上限です。
+const spotifyAddTracksLimit = 100
+
+func (p *spotifyProvider) CreatePlaylist(accessToken, name, description string, public bool, trackIDs []string) (*Playlist, error) {
+	// プレイリストはユーザー単位のエンドポイントで作成するため、先にユーザーIDを取得する
+	profile, err := p.GetProfile(accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	var created struct {
+		ID           string              `json:"id"`
+		Name         string              `json:"name"`
+		ExternalURLs spotifyExternalURLs `json:"external_urls"`
+	}
+	createBody := map[string]interface{}{
+		"name":        name,
+		"description": description,
+		"public":      public,
+	}
+	if err := p.sendJSON(accessToken, "POST", p.apiBaseURL+"/users/"+url.PathEscape(profile.ID)+"/playlists", createBody, &created); err != nil {
+		return nil, err
+	}
+
+	for start := 0; start < len(trackIDs); start += spotifyAddTracksLimit {
+		end := start + spotifyAddTracksLimit
+		if end > len(trackIDs) {
+			end = len(trackIDs)
+		}
+		uris := make([]string, 0, end-start)
+		for _, trackID := range trackIDs[start:end] {
+			uris = append(uris, "spotify:track:"+trackID)
+		}
+		if err := p.sendJSON(accessToken, "POST", p.apiBaseURL+"/playlists/"+url.PathEscape(created.ID)+"/tracks", map[string]interface{}{"uris": uris}, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Playlist{ID: created.ID, Name: created.Name, URL: created.ExternalURLs.Spotify}, nil
+}
+
+func (p *spotifyProvider) ControlPlayback(accessToken string, command PlaybackCommand) error {
+	// 再試行ごとに再生位置を計算し直せるよう、再試行は呼び出し元に任せる
+	ctx := WithoutRetry(context.Background())
+	var err error
+	switch command.Action {
+	case PlaybackActionPlay:
+		// 曲を指定しない場合は現在の曲を再開する
+		var body interface{}
+		if command.TrackID != "" {
+			body = map[string]interface{}{
+				"uris":        []string{"spotify:track:" + command.TrackID},
+				"position_ms": command.PositionMs,
+			}
+		}
+		err = p.sendJSONContext(ctx, accessToken, "PUT", p.apiBaseURL+"/me/player/play", body, nil)
+	case PlaybackActionPause:
+		err = p.sendJSONContext(ctx, accessToken, "PUT", p.apiBaseURL+"/me/player/pause", nil, nil)
+	case PlaybackActionSeek:
+		err = p.sendJSONContext(ctx, accessToken, "PUT", fmt.Sprintf("%s/me/player/seek?position_ms=%d", p.apiBaseURL, command.PositionMs), nil, nil)
+	default:
+		return fmt.Errorf("unsupported playback action: %s", command.Action)
+	}
+
+	// 再試行しても回復しないエラーは、呼び出し元で判別できるよう専用のエラーに変換する
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		switch {
+		case strings.Contains(apiErr.Body, "NO_ACTIVE_DEVICE"):
+			return ErrNoActiveDevice
+		case strings.Contains(apiErr.Body, "PREMIUM_REQUIRED"):
+			return ErrPremiumRequired
+		case apiErr.StatusCode == http.StatusForbidden:
+			// 再生操作のスコープを許可する前に連携したユーザーは 403 になる
+			return ErrInsufficientScope
+		}
+	}
+	return err
+}
+
+// getJSON は、アクセストークン付きで GET し、レスポンスを out にデコードします。
+func (p *spotifyProvider) getJSON(accessToken, requestURL string, out interface{}) error {
+	return p.sendJSON(accessToken, "GET", requestURL, nil, out)
+}
+
+// sendJSON は、アクセストークン付きで body を JSON として送信し、レスポンスを out にデコードします（out が nil なら読み捨てる）。
+func (p *spotifyProvider) sendJSON(accessToken, method, requestURL string, body, out interface{}) error {
+	return p.sendJSONContext(context.Background(), accessToken, method, requestURL, body, out)
+}
+
+// sendJSONContext は、sendJSON をコンテキスト付きで行います。
+func (p *spotifyProvider) sendJSONContext(ctx context.Context, accessToken, method, requestURL string, body, out interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal spotify request: %w", err)
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, requestURL, reqBody)
+	if err != nil {
+		return fmt.Errorf("failed to create spotify request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to execute spotify request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		return newSpotifyAPIError(resp, respBody)
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode spotify response: %w", err)
+	}
+	return nil
+}
+
+// newSpotifyAPIError は、エラーレスポンスを APIError に変換します（Retry-After は秒数で返される）。
+func newSpotifyAPIError(resp *http.Response, body []byte) *APIError {
+	apiErr := &APIError{Provider: "spotify", StatusCode: resp.StatusCode, Body: string(body)}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		apiErr.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	return apiErr
+}
+
+func (t spotifyTrack) toTrack() Track {
+	artists := make([]string, 0, len(t.Artists))
+	for _, artist := range t.Artists {
+		artists = append(artists, artist.Name)
+	}
+	imageURL := ""
+	if len(t.Album.Images) > 0 {
+		imageURL = t.Album.Images[0].URL
+	}
+	return Track{
+		ID:         t.ID,
+		Name:       t.Name,
+		Artists:    artists,
+		DurationMs: t.DurationMs,
+		ImageURL:   imageURL,
+		ISRC:       t.ExternalIDs.ISRC,
+	}
+}
@@ -0,0 +1,268 @@
+package providers_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"music-share-api/internal/providers"
+	"music-share-api/internal/providers/spotifytest"
+)
+
+func newTestSpotify(t *testing.T) (*spotifytest.Server, providers.MusicProvider) {
+	t.Helper()
+	fake := spotifytest.NewServer()
+	t.Cleanup(fake.Close)
+
+	provider := providers.NewSpotifyProvider(providers.SpotifyConfig{
+		ClientID:        spotifytest.ClientID,
+		ClientSecret:    spotifytest.ClientSecret,
+		Scopes:          "user-read-email",
+		AccountsBaseURL: fake.AccountsBaseURL(),
+		APIBaseURL:      fake.APIBaseURL(),
+		HTTPClient:      fake.Client(),
+	})
+	return fake, provider
+}
+
+func TestSpotifyExchangeCodeAndProfile(t *testing.T) {
+	fake, provider := newTestSpotify(t)
+	fake.AddUser(spotifytest.User{ID: "sp-user", DisplayName: "Alice", Email: "alice@example.com"})
+
+	// code_verifier "verifier" の S256 チャレンジ
+	challenge := "iMnq5o6zALKXGivsnlom_0F5_WYda32GHkxlV7mq7hQ"
+	authorizeURL := provider.AuthorizeURL("state-1", challenge, "http://localhost/callback")
+	if !strings.HasPrefix(authorizeURL, fake.AccountsBaseURL()+"/authorize?") {
+		t.Fatalf("authorize url does not use configured base url: %s", authorizeURL)
+	}
+
+	code, state, err := fake.Approve(authorizeURL, "sp-user")
+	if err != nil {
+		t.Fatalf("Approve: %v", err)
+	}
+	if state != "state-1" {
+		t.Fatalf("state = %q, want state-1", state)
+	}
+
+	token, err := provider.ExchangeCode(code, "http://localhost/callback", "verifier")
+	if err != nil {
+		t.Fatalf("ExchangeCode: %v", err)
+	}
+	if token.AccessToken == "" || token.RefreshToken == "" || token.ExpiresIn != spotifytest.TokenExpiresIn {
+		t.Fatalf("unexpected token: %+v", token)
+	}
+
+	profile, err := provider.GetProfile(token.AccessToken)
+	if err != nil {
+		t.Fatalf("GetProfile: %v", err)
+	}
+	if profile.ID != "sp-user" || profile.DisplayName != "Alice" || profile.Email != "alice@example.com" {
+		t.Fatalf("unexpected profile: %+v", profile)
+	}
+}
+
+func TestSpotifyExchangeCodeRejectsWrongVerifier(t *testing.T) {
+	fake, provider := newTestSpotify(t)
+	fake.AddUser(spotifytest.User{ID: "sp-user"})
+
+	authorizeURL := provider.AuthorizeURL("state-1", "iMnq5o6zALKXGivsnlom_0F5_WYda32GHkxlV7mq7hQ", "http://localhost/callback")
+	code, _, err := fake.Approve(authorizeURL, "sp-user")
+	if err != nil {
+		t.Fatalf("Approve: %v", err)
+	}
+
+	if _, err := provider.ExchangeCode(code, "http://localhost/callback", "another-verifier"); err == nil {
+		t.Fatal("ExchangeCode succeeded with a wrong code verifier")
+	}
+}
+
+func TestSpotifyRefreshToken(t *testing.T) {
+	fake, provider := newTestSpotify(t)
+	fake.AddUser(spotifytest.User{ID: "sp-user"})
+	accessToken, refreshToken := fake.IssueTokens("sp-user")
+
+	token, err := provider.RefreshToken(refreshToken)
+	if err != nil {
+		t.Fatalf("RefreshToken: %v", err)
+	}
+	if token.AccessToken == "" || token.AccessToken == accessToken {
+		t.Fatalf("access token was not renewed: %+v", token)
+	}
+	if token.RefreshToken != "" {
+		t.Fatalf("refresh token should not be reissued, got %q", token.RefreshToken)
+	}
+
+	fake.RevokeUser("sp-user")
+	if _, err := provider.RefreshToken(refreshToken); !errors.Is(err, providers.ErrInvalidGrant) {
+		t.Fatalf("RefreshToken after revoke: err = %v, want ErrInvalidGrant", err)
+	}
+}
+
+func TestSpotifySearchTracks(t *testing.T) {
+	fake, provider := newTestSpotify(t)
+	fake.AddUser(spotifytest.User{ID: "sp-user"})
+	fake.AddTrack(spotifytest.Track{ID: "t1", Name: "Blue Sky", Artists: []string{"Band A", "Band B"}, DurationMs: 201000, ImageURL: "http://img/1", ISRC: "JPAB01234567"})
+	fake.AddTrack(spotifytest.Track{ID: "t2", Name: "Red Sun", Artists: []string{"Band C"}, DurationMs: 180000})
+	accessToken, _ := fake.IssueTokens("sp-user")
+
+	tracks, err := provider.SearchTracks(accessToken, "sky", "", 10)
+	if err != nil {
+		t.Fatalf("SearchTracks: %v", err)
+	}
+	if len(tracks) != 1 {
+		t.Fatalf("len(tracks) = %d, want 1", len(tracks))
+	}
+	got := tracks[0]
+	if got.ID != "t1" || got.Name != "Blue Sky" || got.DurationMs != 201000 || got.ImageURL != "http://img/1" || got.ISRC != "JPAB01234567" {
+		t.Fatalf("unexpected track: %+v", got)
+	}
+	if strings.Join(got.Artists, ",") != "Band A,Band B" {
+		t.Fatalf("artists = %v", got.Artists)
+	}
+}
+
+func TestSpotifyGetPlaylistPagesThroughTracks(t *testing.T) {
+	fake, provider := newTestSpotify(t)
+	fake.PageSize = 2
+	fake.AddUser(spotifytest.User{ID: "sp-user"})
+	for _, id := range []string{"t1", "t2", "t3", "t4", "t5"} {
+		fake.AddTrack(spotifytest.Track{ID: id, Name: "Song " + id, Artists: []string{"Artist"}})
+	}
+	// "gone" は削除済みの曲として null で返される
+	fake.AddPlaylist("pl1", "Morning", "t1", "t2", "gone", "t3", "t4", "t5")
+	accessToken, _ := fake.IssueTokens("sp-user")
+
+	playlist, err := provider.GetPlaylist(accessToken, "pl1")
+	if err != nil {
+		t.Fatalf("GetPlaylist: %v", err)
+	}
+	if playlist.Name != "Morning" {
+		t.Fatalf("playlist name = %q", playlist.Name)
+	}
+	var ids []string
+	for _, track := range playlist.Tracks {
+		ids = append(ids, track.ID)
+	}
+	if strings.Join(ids, ",") != "t1,t2,t3,t4,t5" {
+		t.Fatalf("track ids = %v", ids)
+	}
+	if got := fake.RequestCount("/v1/playlists/pl1/tracks"); got != 2 {
+		t.Fatalf("tracks page requests = %d, want 2", got)
+	}
+}
+
+func TestSpotifyRateLimitAndErrors(t *testing.T) {
+	fake, provider := newTestSpotify(t)
+	fake.AddUser(spotifytest.User{ID: "sp-user"})
+	accessToken, _ := fake.IssueTokens("sp-user")
+
+	fake.RateLimitNext("/v1/me", 7)
+	_, err := provider.GetProfile(accessToken)
+	if !providers.IsRateLimited(err) {
+		t.Fatalf("err = %v, want rate limited", err)
+	}
+	var apiErr *providers.APIError
+	if !errors.As(err, &apiErr) || apiErr.RetryAfter != 7*time.Second {
+		t.Fatalf("RetryAfter not parsed: %v", err)
+	}
+
+	fake.FailNext("/v1/me", http.StatusInternalServerError, `{"error":{"status":500}}`)
+	_, err = provider.GetProfile(accessToken)
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusInternalServerError || providers.IsRateLimited(err) {
+		t.Fatalf("err = %v, want 500 APIError", err)
+	}
+
+	// 強制エラーは1回限りで、次のリクエストは成功する
+	if _, err := provider.GetProfile(accessToken); err != nil {
+		t.Fatalf("GetProfile after failures: %v", err)
+	}
+
+	if _, err := provider.GetProfile("unknown-token"); err == nil {
+		t.Fatal("GetProfile succeeded with an unknown access token")
+	}
+}
+
+func TestSpotifyCreatePlaylistAddsTracksInChunks(t *testing.T) {
+	fake, provider := newTestSpotify(t)
+	fake.AddUser(spotifytest.User{ID: "sp-user"})
+	accessToken, _ := fake.IssueTokens("sp-user")
+
+	trackIDs := make([]string, 0, 150)
+	for i := 0; i < 150; i++ {
+		trackIDs = append(trackIDs, fmt.Sprintf("t%d", i))
+	}
+
+	playlist, err := provider.CreatePlaylist(accessToken, "Session", "from room", false, trackIDs)
+	if err != nil {
+		t.Fatalf("CreatePlaylist: %v", err)
+	}
+	if playlist.ID == "" || playlist.Name != "Session" || !strings.HasSuffix(playlist.URL, "/playlist/"+playlist.ID) {
+		t.Fatalf("unexpected playlist: %+v", playlist)
+	}
+
+	name, description, ownerID, gotIDs, ok := fake.PlaylistTracks(playlist.ID)
+	if !ok || name != "Session" || description != "from room" || ownerID != "sp-user" {
+		t.Fatalf("unexpected stored playlist: %q %q %q", name, description, ownerID)
+	}
+	if strings.Join(gotIDs, ",") != strings.Join(trackIDs, ",") {
+		t.Fatalf("tracks were not added in order: %d tracks", len(gotIDs))
+	}
+	if got := fake.RequestCount("/v1/playlists/" + playlist.ID + "/tracks"); got != 2 {
+		t.Fatalf("add tracks requests = %d, want 2", got)
+	}
+}
+
+func TestSpotifyControlPlayback(t *testing.T) {
+	fake, provider := newTestSpotify(t)
+	fake.AddUser(spotifytest.User{ID: "sp-user"})
+	accessToken, _ := fake.IssueTokens("sp-user")
+
+	if err := provider.ControlPlayback(accessToken, providers.PlaybackCommand{Action: providers.PlaybackActionPlay, TrackID: "t1", PositionMs: 5000}); err != nil {
+		t.Fatalf("play: %v", err)
+	}
+	if got := fake.Player("sp-user"); got != (spotifytest.PlayerState{TrackID: "t1", PositionMs: 5000, IsPlaying: true}) {
+		t.Fatalf("player after play = %+v", got)
+	}
+	if err := provider.ControlPlayback(accessToken, providers.PlaybackCommand{Action: providers.PlaybackActionSeek, PositionMs: 9000}); err != nil {
+		t.Fatalf("seek: %v", err)
+	}
+	if err := provider.ControlPlayback(accessToken, providers.PlaybackCommand{Action: providers.PlaybackActionPause}); err != nil {
+		t.Fatalf("pause: %v", err)
+	}
+	if got := fake.Player("sp-user"); got != (spotifytest.PlayerState{TrackID: "t1", PositionMs: 9000}) {
+		t.Fatalf("player after seek and pause = %+v", got)
+	}
+
+	fake.SetNoActiveDevice("sp-user")
+	if err := provider.ControlPlayback(accessToken, providers.PlaybackCommand{Action: providers.PlaybackActionPause}); !errors.Is(err, providers.ErrNoActiveDevice) {
+		t.Fatalf("err = %v, want ErrNoActiveDevice", err)
+	}
+	fake.SetFreeAccount("sp-user")
+	if err := provider.ControlPlayback(accessToken, providers.PlaybackCommand{Action: providers.PlaybackActionPause}); !errors.Is(err, providers.ErrPremiumRequired) {
+		t.Fatalf("err = %v, want ErrPremiumRequired", err)
+	}
+}
+
+func TestSpotifyFindTracksByISRC(t *testing.T) {
+	fake, provider := newTestSpotify(t)
+	fake.AddUser(spotifytest.User{ID: "sp-user"})
+	fake.AddTrack(spotifytest.Track{ID: "t1", Name: "Blue Sky", ISRC: "JPAB01234567"})
+	fake.AddTrack(spotifytest.Track{ID: "t2", Name: "Blue Sky (Live)", ISRC: "JPAB07654321"})
+	accessToken, _ := fake.IssueTokens("sp-user")
+
+	tracks, err := provider.FindTracksByISRC(accessToken, "jpab01234567")
+	if err != nil {
+		t.Fatalf("FindTracksByISRC: %v", err)
+	}
+	if len(tracks) != 1 || tracks[0].ID != "t1" {
+		t.Fatalf("tracks = %+v", tracks)
+	}
+
+	tracks, err = provider.FindTracksByISRC(accessToken, "USXX00000000")
+	if err != nil || len(tracks) != 0 {
+		t.Fatalf("tracks = %+v, err = %v", tracks, err)
+	}
+}
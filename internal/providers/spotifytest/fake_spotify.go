@@ -0,0 +1,716 @@
+// Package spotifytest は、テスト用のフェイク Spotify サーバーを提供します。
+//
+// httptest.Server 上でトークン発行・更新、/me、検索、曲、プレイリスト、再生操作の各エンドポイントを再現し、
+// エラーやレート制限（429 + Retry-After）も任意に発生させられます。
+// providers.SpotifyConfig の AccountsBaseURL / APIBaseURL に AccountsBaseURL() / APIBaseURL() を渡して使います。
+package spotifytest
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	ClientID     = "fake-client-id"
+	ClientSecret = "fake-client-secret"
+	// TokenExpiresIn は発行するアクセストークンの有効期間（秒）です。
+	TokenExpiresIn = 3600
+)
+
+// User は、フェイクサーバーに登録する Spotify ユーザーです。
+type User struct {
+	ID          string
+	DisplayName string
+	Email       string
+	// Country は /me の country として返す国コードです。
+	Country string
+}
+
+// Track は、フェイクサーバーに登録する曲です。
+type Track struct {
+	ID         string
+	Name       string
+	Artists    []string
+	DurationMs int
+	ImageURL   string
+	ISRC       string
+	// Markets は曲を聴ける国です（空ならすべての国）。検索の market で絞り込みます。
+	Markets []string
+}
+
+// PlayerState は、ユーザーのアクティブなデバイスの再生状態です。
+type PlayerState struct {
+	TrackID    string
+	PositionMs int
+	IsPlaying  bool
+}
+
+type authCode struct {
+	userID        string
+	redirectURI   string
+	codeChallenge string
+}
+
+type playlist struct {
+	id          string
+	name        string
+	description string
+	ownerID     string
+	public      bool
+	trackIDs    []string
+}
+
+// forcedResponse は、次のリクエストに対して強制的に返すエラーレスポンスです。
+type forcedResponse struct {
+	status     int
+	retryAfter int
+	body       string
+}
+
+// Server は、フェイク Spotify サーバーです。
+type Server struct {
+	*httptest.Server
+
+	// PageSize は、プレイリストの曲を返す際の1ページあたりの件数です。
+	PageSize int
+
+	mu            sync.Mutex
+	users         map[string]User
+	codes         map[string]authCode
+	accessTokens  map[string]string
+	refreshTokens map[string]string
+	tracks        map[string]Track
+	playlists     map[string]playlist
+	forced        map[string][]forcedResponse
+	requestCounts map[string]int
+	players       map[string]PlayerState
+	noDevice      map[string]bool
+	freeUsers     map[string]bool
+	scopeMissing  map[string]bool
+	issued        int
+}
+
+// NewServer は、フェイクサーバーを起動します。使い終わったら Close を呼んでください。
+func NewServer() *Server {
+	s := &Server{
+		PageSize:      100,
+		users:         make(map[string]User),
+		codes:         make(map[string]authCode),
+		accessTokens:  make(map[string]string),
+		refreshTokens: make(map[string]string),
+		tracks:        make(map[string]Track),
+		playlists:     make(map[string]playlist),
+		forced:        make(map[string][]forcedResponse),
+		requestCounts: make(map[string]int),
+		players:       make(map[string]PlayerState),
+		noDevice:      make(map[string]bool),
+		freeUsers:     make(map[string]bool),
+		scopeMissing:  make(map[string]bool),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/token", s.handleToken)
+	mux.HandleFunc("/v1/me", s.handleMe)
+	mux.HandleFunc("/v1/me/player/", s.handlePlayer)
+	mux.HandleFunc("/v1/search", s.handleSearch)
+	mux.HandleFunc("/v1/tracks/", s.handleTrack)
+	mux.HandleFunc("/v1/playlists/", s.handlePlaylist)
+	mux.HandleFunc("/v1/users/", s.handleCreatePlaylist)
+	s.Server = httptest.NewServer(s.withForcedResponses(mux))
+	return s
+}
+
+func (s *Server) AccountsBaseURL() string {
+	return s.URL
+}
+
+func (s *Server) APIBaseURL() string {
+	return s.URL + "/v1"
+}
+
+func (s *Server) AddUser(user User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[user.ID] = user
+}
+
+func (s *Server) AddTrack(track Track) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tracks[track.ID] = track
+}
+
+// AddPlaylist は、登録済みの曲IDからなるプレイリストを登録します。
+func (s *Server) AddPlaylist(id, name string, trackIDs ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.playlists[id] = playlist{id: id, name: name, trackIDs: trackIDs}
+}
+
+// PlaylistTracks は、プレイリストの名前・説明・所有者と曲IDを返します（作成されたプレイリストの検証用）。
+func (s *Server) PlaylistTracks(id string) (name, description, ownerID string, trackIDs []string, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	found, ok := s.playlists[id]
+	if !ok {
+		return "", "", "", nil, false
+	}
+	return found.name, found.description, found.ownerID, append([]string(nil), found.trackIDs...), true
+}
+
+// SetNoActiveDevice は、ユーザーにアクティブなデバイスがない状態にします。
+func (s *Server) SetNoActiveDevice(userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.noDevice[userID] = true
+}
+
+// SetFreeAccount は、ユーザーを無料プラン（再生操作不可）にします。
+func (s *Server) SetFreeAccount(userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.freeUsers[userID] = true
+}
+
+// SetPlaybackScopeMissing は、ユーザーが再生操作のスコープを許可せずに連携した状態にします。
+func (s *Server) SetPlaybackScopeMissing(userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scopeMissing[userID] = true
+}
+
+// Player は、ユーザーのデバイスの現在の再生状態を返します。
+func (s *Server) Player(userID string) PlayerState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.players[userID]
+}
+
+// Approve は、ユーザーが authorizeURL の認可画面で許可した状態を再現し、コールバックに渡される code と state を返します。
+func (s *Server) Approve(authorizeURL, userID string) (string, string, error) {
+	parsed, err := url.Parse(authorizeURL)
+	if err != nil {
+		return "", "", err
+	}
+	query := parsed.Query()
+	if query.Get("client_id") != ClientID {
+		return "", "", fmt.Errorf("unexpected client_id %q", query.Get("client_id"))
+	}
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		return "", "", fmt.Errorf("authorize url has no S256 code challenge")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[userID]; !ok {
+		return "", "", fmt.Errorf("unknown user %q", userID)
+	}
+	code := s.nextValue("code")
+	s.codes[code] = authCode{
+		userID:        userID,
+		redirectURI:   query.Get("redirect_uri"),
+		codeChallenge: query.Get("code_challenge"),
+	}
+	return code, query.Get("state"), nil
+}
+
+// IssueTokens は、認可フローを経ずにユーザーのアクセストークンとリフレッシュトークンを発行します。
+func (s *Server) IssueTokens(userID string) (string, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.issueTokensLocked(userID)
+}
+
+// RevokeUser は、ユーザーのトークンを全て失効させます（ユーザーが Spotify 側で連携を解除した状態）。
+func (s *Server) RevokeUser(userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for token, owner := range s.accessTokens {
+		if owner == userID {
+			delete(s.accessTokens, token)
+		}
+	}
+	for token, owner := range s.refreshTokens {
+		if owner == userID {
+			delete(s.refreshTokens, token)
+		}
+	}
+}
+
+// FailNext は、path（例: "/v1/me"）への次のリクエストに status とボディを返します。
+func (s *Server) FailNext(path string, status int, body string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.forced[path] = append(s.forced[path], forcedResponse{status: status, body: body})
+}
+
+// RateLimitNext は、path への次のリクエストに 429 と Retry-After（秒）を返します。
+func (s *Server) RateLimitNext(path string, retryAfterSeconds int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.forced[path] = append(s.forced[path], forcedResponse{
+		status:     http.StatusTooManyRequests,
+		retryAfter: retryAfterSeconds,
+		body:       `{"error":{"status":429,"message":"API rate limit exceeded"}}`,
+	})
+}
+
+// RequestCount は、path へのリクエスト数を返します（強制エラーを返したものも含む）。
+func (s *Server) RequestCount(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requestCounts[path]
+}
+
+func (s *Server) withForcedResponses(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requestCounts[r.URL.Path]++
+		var forced *forcedResponse
+		if queue := s.forced[r.URL.Path]; len(queue) > 0 {
+			forced = &queue[0]
+			s.forced[r.URL.Path] = queue[1:]
+		}
+		s.mu.Unlock()
+
+		if forced == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if forced.retryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(forced.retryAfter))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(forced.status)
+		fmt.Fprint(w, forced.body)
+	})
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok || clientID != ClientID || clientSecret != ClientSecret {
+		writeTokenError(w, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeTokenError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		code, ok := s.codes[r.PostForm.Get("code")]
+		if !ok {
+			writeTokenError(w, http.StatusBadRequest, "invalid_grant")
+			return
+		}
+		// 認可コードは1回限り有効
+		delete(s.codes, r.PostForm.Get("code"))
+		if code.redirectURI != r.PostForm.Get("redirect_uri") {
+			writeTokenError(w, http.StatusBadRequest, "invalid_grant")
+			return
+		}
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if base64.RawURLEncoding.EncodeToString(sum[:]) != code.codeChallenge {
+			writeTokenError(w, http.StatusBadRequest, "invalid_grant")
+			return
+		}
+		accessToken, refreshToken := s.issueTokensLocked(code.userID)
+		writeJSON(w, map[string]interface{}{
+			"access_token":  accessToken,
+			"token_type":    "Bearer",
+			"refresh_token": refreshToken,
+			"expires_in":    TokenExpiresIn,
+		})
+	case "refresh_token":
+		userID, ok := s.refreshTokens[r.PostForm.Get("refresh_token")]
+		if !ok {
+			writeTokenError(w, http.StatusBadRequest, "invalid_grant")
+			return
+		}
+		// 本物の Spotify と同様に、更新時はリフレッシュトークンを再発行しない
+		accessToken := s.nextValue("access")
+		s.accessTokens[accessToken] = userID
+		writeJSON(w, map[string]interface{}{
+			"access_token": accessToken,
+			"token_type":   "Bearer",
+			"expires_in":   TokenExpiresIn,
+		})
+	default:
+		writeTokenError(w, http.StatusBadRequest, "unsupported_grant_type")
+	}
+}
+
+func (s *Server) handleMe(w http.ResponseWriter, r *http.Request) {
+	userID, ok := s.authenticate(w, r)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	user := s.users[userID]
+	s.mu.Unlock()
+
+	writeJSON(w, map[string]interface{}{
+		"id":           user.ID,
+		"display_name": user.DisplayName,
+		"email":        user.Email,
+		"country":      user.Country,
+	})
+}
+
+// handleSearch は、q の各語を曲名またはアーティスト名に含む曲を返します。
+// "isrc:<ISRC>" の場合は ISRC が一致する曲を返します。market が指定された場合は、その国で聴けない曲を除きます。
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.authenticate(w, r); !ok {
+		return
+	}
+	query := strings.ToLower(r.URL.Query().Get("q"))
+	market := r.URL.Query().Get("market")
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 20
+	}
+
+	s.mu.Lock()
+	items := make([]map[string]interface{}, 0)
+	for _, track := range s.sortedTracksLocked() {
+		if matchesQuery(track, query) && availableIn(track, market) && len(items) < limit {
+			items = append(items, trackJSON(track))
+		}
+	}
+	s.mu.Unlock()
+
+	writeJSON(w, map[string]interface{}{
+		"tracks": map[string]interface{}{"items": items},
+	})
+}
+
+func (s *Server) handleTrack(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.authenticate(w, r); !ok {
+		return
+	}
+	s.mu.Lock()
+	track, ok := s.tracks[strings.TrimPrefix(r.URL.Path, "/v1/tracks/")]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "Non existing id")
+		return
+	}
+	writeJSON(w, trackJSON(track))
+}
+
+// handlePlaylist は、/v1/playlists/{id} と /v1/playlists/{id}/tracks?offset= の取得、
+// および POST /v1/playlists/{id}/tracks による曲の追加を処理します。
+func (s *Server) handlePlaylist(w http.ResponseWriter, r *http.Request) {
+	userID, ok := s.authenticate(w, r)
+	if !ok {
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/v1/playlists/")
+	playlistID := strings.TrimSuffix(path, "/tracks")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	found, ok := s.playlists[playlistID]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not found.")
+		return
+	}
+
+	if r.Method == http.MethodPost && strings.HasSuffix(path, "/tracks") {
+		if found.ownerID != userID {
+			writeError(w, http.StatusForbidden, "You cannot add tracks to a playlist you don't own.")
+			return
+		}
+		var body struct {
+			URIs []string `json:"uris"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || len(body.URIs) == 0 || len(body.URIs) > 100 {
+			writeError(w, http.StatusBadRequest, "Invalid uris")
+			return
+		}
+		for _, uri := range body.URIs {
+			found.trackIDs = append(found.trackIDs, strings.TrimPrefix(uri, "spotify:track:"))
+		}
+		s.playlists[playlistID] = found
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"snapshot_id": s.nextValue("snapshot")})
+		return
+	}
+
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	page := s.playlistPageLocked(found, offset)
+	if strings.HasSuffix(path, "/tracks") {
+		writeJSON(w, page)
+		return
+	}
+	writeJSON(w, map[string]interface{}{
+		"id":            found.id,
+		"name":          found.name,
+		"external_urls": map[string]string{"spotify": "https://open.spotify.com/playlist/" + found.id},
+		"tracks":        page,
+	})
+}
+
+// handlePlayer は、PUT /v1/me/player/play・pause・seek を処理します。
+func (s *Server) handlePlayer(w http.ResponseWriter, r *http.Request) {
+	userID, ok := s.authenticate(w, r)
+	if !ok {
+		return
+	}
+	if r.Method != http.MethodPut {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.scopeMissing[userID] {
+		writeError(w, http.StatusForbidden, "Insufficient client scope")
+		return
+	}
+	if s.freeUsers[userID] {
+		writePlayerError(w, http.StatusForbidden, "Player command failed: Premium required", "PREMIUM_REQUIRED")
+		return
+	}
+	if s.noDevice[userID] {
+		writePlayerError(w, http.StatusNotFound, "Player command failed: No active device found", "NO_ACTIVE_DEVICE")
+		return
+	}
+
+	state := s.players[userID]
+	switch strings.TrimPrefix(r.URL.Path, "/v1/me/player/") {
+	case "play":
+		var body struct {
+			URIs       []string `json:"uris"`
+			PositionMs int      `json:"position_ms"`
+		}
+		if r.ContentLength > 0 {
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				writeError(w, http.StatusBadRequest, "Malformed json")
+				return
+			}
+		}
+		if len(body.URIs) > 0 {
+			state.TrackID = strings.TrimPrefix(body.URIs[0], "spotify:track:")
+			state.PositionMs = body.PositionMs
+		}
+		state.IsPlaying = true
+	case "pause":
+		state.IsPlaying = false
+	case "seek":
+		positionMs, err := strconv.Atoi(r.URL.Query().Get("position_ms"))
+		if err != nil || positionMs < 0 {
+			writeError(w, http.StatusBadRequest, "Invalid position_ms")
+			return
+		}
+		state.PositionMs = positionMs
+	default:
+		writeError(w, http.StatusNotFound, "Not found.")
+		return
+	}
+	s.players[userID] = state
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleCreatePlaylist は、POST /v1/users/{user_id}/playlists を処理します。
+func (s *Server) handleCreatePlaylist(w http.ResponseWriter, r *http.Request) {
+	userID, ok := s.authenticate(w, r)
+	if !ok {
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/v1/users/")
+	if r.Method != http.MethodPost || !strings.HasSuffix(path, "/playlists") {
+		writeError(w, http.StatusNotFound, "Not found.")
+		return
+	}
+	if strings.TrimSuffix(path, "/playlists") != userID {
+		writeError(w, http.StatusForbidden, "You cannot create a playlist for another user.")
+		return
+	}
+
+	var body struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		Public      bool   `json:"public"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Name == "" {
+		writeError(w, http.StatusBadRequest, "Missing name")
+		return
+	}
+
+	s.mu.Lock()
+	created := playlist{
+		id:          s.nextValue("playlist"),
+		name:        body.Name,
+		description: body.Description,
+		ownerID:     userID,
+		public:      body.Public,
+	}
+	s.playlists[created.id] = created
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":            created.id,
+		"name":          created.name,
+		"external_urls": map[string]string{"spotify": "https://open.spotify.com/playlist/" + created.id},
+	})
+}
+
+func (s *Server) playlistPageLocked(found playlist, offset int) map[string]interface{} {
+	end := offset + s.PageSize
+	if end > len(found.trackIDs) {
+		end = len(found.trackIDs)
+	}
+	items := make([]map[string]interface{}, 0)
+	for _, trackID := range found.trackIDs[offset:end] {
+		track, ok := s.tracks[trackID]
+		if !ok {
+			// 削除済みの曲は track が null になる
+			items = append(items, map[string]interface{}{"track": nil})
+			continue
+		}
+		items = append(items, map[string]interface{}{"track": trackJSON(track)})
+	}
+
+	var next interface{}
+	if end < len(found.trackIDs) {
+		next = fmt.Sprintf("%s/v1/playlists/%s/tracks?offset=%d&limit=%d", s.URL, found.id, end, s.PageSize)
+	}
+	return map[string]interface{}{
+		"items": items,
+		"next":  next,
+		"total": len(found.trackIDs),
+	}
+}
+
+// authenticate は Bearer トークンを検証し、トークンの持ち主のユーザーIDを返します。
+func (s *Server) authenticate(w http.ResponseWriter, r *http.Request) (string, bool) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	s.mu.Lock()
+	userID, ok := s.accessTokens[token]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Invalid access token")
+		return "", false
+	}
+	return userID, true
+}
+
+func (s *Server) issueTokensLocked(userID string) (string, string) {
+	accessToken := s.nextValue("access")
+	refreshToken := s.nextValue("refresh")
+	s.accessTokens[accessToken] = userID
+	s.refreshTokens[refreshToken] = userID
+	return accessToken, refreshToken
+}
+
+func (s *Server) nextValue(prefix string) string {
+	s.issued++
+	return fmt.Sprintf("%s-%d", prefix, s.issued)
+}
+
+// sortedTracksLocked は、検索結果が安定するよう曲ID順に並べた曲一覧を返します。
+func (s *Server) sortedTracksLocked() []Track {
+	tracks := make([]Track, 0, len(s.tracks))
+	for _, track := range s.tracks {
+		tracks = append(tracks, track)
+	}
+	sort.Slice(tracks, func(i, j int) bool { return tracks[i].ID < tracks[j].ID })
+	return tracks
+}
+
+func matchesQuery(track Track, query string) bool {
+	if isrc, ok := strings.CutPrefix(query, "isrc:"); ok {
+		return strings.EqualFold(track.ISRC, isrc)
+	}
+	for _, term := range strings.Fields(query) {
+		matched := strings.Contains(strings.ToLower(track.Name), term)
+		for _, artist := range track.Artists {
+			matched = matched || strings.Contains(strings.ToLower(artist), term)
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// availableIn は、曲が market の国で聴けるかを返します（market が空なら常に true）。
+func availableIn(track Track, market string) bool {
+	if market == "" || len(track.Markets) == 0 {
+		return true
+	}
+	for _, m := range track.Markets {
+		if m == market {
+			return true
+		}
+	}
+	return false
+}
+
+func trackJSON(track Track) map[string]interface{} {
+	artists := make([]map[string]interface{}, 0, len(track.Artists))
+	for _, name := range track.Artists {
+		artists = append(artists, map[string]interface{}{"name": name})
+	}
+	images := make([]map[string]interface{}, 0)
+	if track.ImageURL != "" {
+		images = append(images, map[string]interface{}{"url": track.ImageURL})
+	}
+	return map[string]interface{}{
+		"id":           track.ID,
+		"name":         track.Name,
+		"duration_ms":  track.DurationMs,
+		"artists":      artists,
+		"album":        map[string]interface{}{"images": images},
+		"external_ids": map[string]interface{}{"isrc": track.ISRC},
+		"uri":          "spotify:track:" + track.ID,
+	}
+}
+
+func writeJSON(w http.ResponseWriter, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{"status": status, "message": message},
+	})
+}
+
+func writePlayerError(w http.ResponseWriter, status int, message, reason string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{"status": status, "message": message, "reason": reason},
+	})
+}
+
+func writeTokenError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": code})
+}
@@ -1,66 +1,109 @@
 package repositories
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
 	"time"
+
+	"github.com/go-redis/redis/v8"
 )
 
 // UserServiceData は１サービスの連携情報を表します。
+// トークンはサーバー側でのみ扱い、クライアントには返さない。
 type UserServiceData struct {
-	ServiceUserID        string    `json:"serviceUserId"`
-	ServiceUserName      string    `json:"serviceUserName"` // 追加
-	EncryptedAccessToken string    `json:"encryptedAccessToken"`
-	ExpiresAt            time.Time `json:"expiresAt"`
+	ServiceUserID   string    `json:"serviceUserId"`
+	ServiceUserName string    `json:"serviceUserName"` // 追加
+	ExpiresAt       time.Time `json:"expiresAt"`
+	// Broken は、リフレッシュトークンが失効しており再連携が必要なことを表します。
+	Broken bool `json:"broken"`
+	// ReauthorizeRequired は、許可されたスコープが足りず再連携が必要なことを表します。
+	ReauthorizeRequired bool `json:"reauthorizeRequired"`
 }
 
 type AuthRepository interface {
 	// GetUserInfo は、ユーザー基本情報と連携サービス情報を返します。
-	GetUserInfo(userID int) (string, string, string, bool, map[string]UserServiceData, error)
+	GetUserInfo(userID int) (string, string, string, map[string]UserServiceData, error)
 	CreateUser(userName, email, hashedPassword string) (int, error)
-	GetUserByEmail(email string) (int, string, string, string, bool, error)
+	GetUserByEmail(email string) (int, string, string, string, error)
 	UpdateUserProfile(userID int, userName, email string) error
+	// GetUserRole は、ユーザーの role（"user" または "admin"）を返します。
+	GetUserRole(userID int) (string, error)
+	// GetEmailVerification は、ユーザーのメールアドレスと確認日時を返します。
+	GetEmailVerification(userID int) (string, sql.NullTime, error)
+	MarkEmailVerified(userID int, email string) error
+	GetPasswordHash(userID int) (string, error)
+	// UpdatePassword は、パスワードを更新し、既存セッションを全て失効させます。
+	UpdatePassword(userID int, hashedPassword string) error
+	GetSessionsRevokedAt(userID int) (sql.NullTime, error)
+	CreatePasswordReset(userID int, tokenHash string, expiresAt time.Time) error
+	// ConsumePasswordReset は、有効なリセットトークンを使用済みにし、対象の userID を返します。
+	ConsumePasswordReset(tokenHash string) (int, error)
+	// GetTOTPState は、TOTP シークレット・有効化日時・最後に使用されたステップを返します。
+	GetTOTPState(userID int) (string, sql.NullTime, int64, error)
+	// StartTOTPEnrollment は、未有効化の TOTP シークレットとリカバリーコード（ハッシュ）を保存します。
+	StartTOTPEnrollment(userID int, secret string, recoveryCodeHashes []string) error
+	EnableTOTP(userID int, step int64) error
+	DisableTOTP(userID int) error
+	// MarkTOTPStepUsed は、step がこれまでに使用されたステップより新しい場合のみ記録します。
+	MarkTOTPStepUsed(userID int, step int64) error
+	ConsumeRecoveryCode(userID int, codeHash string) error
+	// IncrementTwoFactorAttempts は、window 内の二要素認証のコード確認の回数をカウントアップし、現在の回数を返します。
+	IncrementTwoFactorAttempts(userID int, window time.Duration) (int64, error)
+	// ResetTwoFactorAttempts は、二要素認証のコード確認の回数をリセットします。
+	ResetTwoFactorAttempts(userID int) error
+	// ListEncryptedTOTPSecrets は、user_id が afterUserID より大きく TOTP シークレットを持つ行を最大 limit 件取得します。
+	ListEncryptedTOTPSecrets(afterUserID, limit int) ([]EncryptedTOTPSecretRow, error)
+	// UpdateEncryptedTOTPSecret は、シークレットが current を読んだ時点から変わっていない場合のみ書き換えます。
+	// 間に二要素認証の再設定・無効化があった場合は書き換えずに false を返します。
+	UpdateEncryptedTOTPSecret(current EncryptedTOTPSecretRow, encryptedSecret string) (bool, error)
+}
+
+// EncryptedTOTPSecretRow は、鍵のローテーション用に読み出す暗号化済みの TOTP シークレットです。
+type EncryptedTOTPSecretRow struct {
+	UserID          int
+	EncryptedSecret string
 }
 
 type authRepository struct {
-	DB *sql.DB
+	DB          *sql.DB
+	RedisClient *redis.Client
 }
 
-func NewAuthRepository(db *sql.DB) AuthRepository {
-	return &authRepository{DB: db}
+func NewAuthRepository(db *sql.DB, redisClient *redis.Client) AuthRepository {
+	return &authRepository{DB: db, RedisClient: redisClient}
 }
 
 // userIDからユーザー基本情報と連携サービス情報を取得
-func (r *authRepository) GetUserInfo(userID int) (string, string, string, bool, map[string]UserServiceData, error) {
+func (r *authRepository) GetUserInfo(userID int) (string, string, string, map[string]UserServiceData, error) {
 	var userName, email, role string
-	var isSpotify bool
 
 	query := `
-        SELECT user_name, email, role, is_spotify
+        SELECT user_name, email, role
         FROM trx_users
         WHERE user_id = ?
         LIMIT 1
     `
-	err := r.DB.QueryRow(query, userID).Scan(&userName, &email, &role, &isSpotify)
+	err := r.DB.QueryRow(query, userID).Scan(&userName, &email, &role)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			log.Printf("User not found for userID: %d", userID)
-			return "", "", "", false, nil, fmt.Errorf("user not found")
+			return "", "", "", nil, fmt.Errorf("user not found")
 		}
 		log.Printf("Error retrieving user info for userID %d: %v", userID, err)
-		return "", "", "", false, nil, fmt.Errorf("error retrieving user info: %w", err)
+		return "", "", "", nil, fmt.Errorf("error retrieving user info: %w", err)
 	}
 
 	// 連携サービス情報を取得（1ユーザーにつき各サービスは１件前提）
 	serviceQuery := `
-        SELECT service_name, service_user_id, service_user_name, encrypted_access_token, expires_at
+        SELECT service_name, service_user_id, service_user_name, expires_at, broken_at IS NOT NULL, reauthorize_required_at IS NOT NULL
         FROM trx_users_services
         WHERE user_id = ? AND deleted_at IS NULL
     `
 	rows, err := r.DB.Query(serviceQuery, userID)
 	if err != nil {
-		return "", "", "", false, nil, fmt.Errorf("failed to query user services: %w", err)
+		return "", "", "", nil, fmt.Errorf("failed to query user services: %w", err)
 	}
 	defer rows.Close()
 
@@ -69,17 +112,17 @@ func (r *authRepository) GetUserInfo(userID int) (string, string, string, bool,
 		var serviceName string
 		var data UserServiceData
 		// 変更：service_user_name も取得
-		if err := rows.Scan(&serviceName, &data.ServiceUserID, &data.ServiceUserName, &data.EncryptedAccessToken, &data.ExpiresAt); err != nil {
-			return "", "", "", false, nil, fmt.Errorf("failed to scan service row: %w", err)
+		if err := rows.Scan(&serviceName, &data.ServiceUserID, &data.ServiceUserName, &data.ExpiresAt, &data.Broken, &data.ReauthorizeRequired); err != nil {
+			return "", "", "", nil, fmt.Errorf("failed to scan service row: %w", err)
 		}
 		services[serviceName] = data
 	}
-	return userName, email, role, isSpotify, services, nil
+	return userName, email, role, services, nil
 }
 
 func (r *authRepository) CreateUser(userName, email, hashedPassword string) (int, error) {
 	// 既存のユーザーが存在するか確認
-	_, _, _, _, _, err := r.GetUserByEmail(email)
+	_, _, _, _, err := r.GetUserByEmail(email)
 	if err == nil {
 		// ユーザーが見つかった場合は既に登録されているのでエラーを返す
 		return 0, fmt.Errorf("user with email %s already exists", email)
@@ -87,11 +130,11 @@ func (r *authRepository) CreateUser(userName, email, hashedPassword string) (int
 
 	query := `
         INSERT INTO trx_users 
-        (user_name, email, hash_password, profile_image_url, role, is_spotify)
-        VALUES (?, ?, ?, ?, ?, ?)
+        (user_name, email, hash_password, profile_image_url, role)
+        VALUES (?, ?, ?, ?, ?)
     `
-	// profile_image_url: 空文字、role: "user", is_verified: false を設定
-	result, err := r.DB.Exec(query, userName, email, hashedPassword, "", "user", false)
+	// profile_image_url: 空文字、role: "user" を設定
+	result, err := r.DB.Exec(query, userName, email, hashedPassword, "", "user")
 	if err != nil {
 		log.Println("Error inserting user:", err)
 		return 0, fmt.Errorf("error creating user: %v", err)
@@ -105,37 +148,417 @@ func (r *authRepository) CreateUser(userName, email, hashedPassword string) (int
 	return int(userID), nil
 }
 
-func (r *authRepository) GetUserByEmail(email string) (int, string, string, string, bool, error) {
+func (r *authRepository) GetUserByEmail(email string) (int, string, string, string, error) {
 	var userID int
 	var userName, hashedPassword, role string
-	var isSpotify bool
 
 	query := `
-        SELECT user_id, user_name, hash_password, role, is_spotify
+        SELECT user_id, user_name, hash_password, role
         FROM trx_users 
         WHERE email = ?
         LIMIT 1
     `
-	err := r.DB.QueryRow(query, email).Scan(&userID, &userName, &hashedPassword, &role, &isSpotify)
+	err := r.DB.QueryRow(query, email).Scan(&userID, &userName, &hashedPassword, &role)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return 0, "", "", "", false, fmt.Errorf("user not found")
+			return 0, "", "", "", fmt.Errorf("user not found")
 		}
-		return 0, "", "", "", false, fmt.Errorf("error retrieving user: %v", err)
+		return 0, "", "", "", fmt.Errorf("error retrieving user: %v", err)
 	}
 
-	return userID, userName, hashedPassword, role, isSpotify, nil
+	return userID, userName, hashedPassword, role, nil
 }
 
 func (r *authRepository) UpdateUserProfile(userID int, userName, email string) error {
+	// メールアドレスが変更された場合は確認済み状態をリセットする（email より先に評価させる）
 	query := `
         UPDATE trx_users
-        SET user_name = ?, email = ?
+        SET user_name = ?, email_verified_at = IF(email = ?, email_verified_at, NULL), email = ?
         WHERE user_id = ?
     `
-	_, err := r.DB.Exec(query, userName, email, userID)
+	_, err := r.DB.Exec(query, userName, email, email, userID)
 	if err != nil {
 		return fmt.Errorf("failed to update user profile: %v", err)
 	}
 	return nil
 }
+
+// GetUserRole は、ユーザーの role を取得します。
+func (r *authRepository) GetUserRole(userID int) (string, error) {
+	var role string
+	query := `
+        SELECT role
+        FROM trx_users
+        WHERE user_id = ?
+        LIMIT 1
+    `
+	err := r.DB.QueryRow(query, userID).Scan(&role)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", fmt.Errorf("user not found")
+		}
+		return "", fmt.Errorf("error retrieving user role: %v", err)
+	}
+	return role, nil
+}
+
+// GetEmailVerification は、ユーザーのメールアドレスと email_verified_at を取得します。
+func (r *authRepository) GetEmailVerification(userID int) (string, sql.NullTime, error) {
+	var email string
+	var verifiedAt sql.NullTime
+
+	query := `
+        SELECT email, email_verified_at
+        FROM trx_users
+        WHERE user_id = ?
+        LIMIT 1
+    `
+	err := r.DB.QueryRow(query, userID).Scan(&email, &verifiedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", sql.NullTime{}, fmt.Errorf("user not found")
+		}
+		return "", sql.NullTime{}, fmt.Errorf("error retrieving email verification: %v", err)
+	}
+	return email, verifiedAt, nil
+}
+
+// MarkEmailVerified は、メールアドレスが一致する場合に email_verified_at を記録します。
+func (r *authRepository) MarkEmailVerified(userID int, email string) error {
+	query := `
+        UPDATE trx_users
+        SET email_verified_at = ?
+        WHERE user_id = ? AND email = ? AND email_verified_at IS NULL
+    `
+	result, err := r.DB.Exec(query, time.Now(), userID, email)
+	if err != nil {
+		return fmt.Errorf("failed to mark email verified: %v", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %v", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("email does not match or is already verified")
+	}
+	return nil
+}
+
+func (r *authRepository) GetPasswordHash(userID int) (string, error) {
+	var hashedPassword string
+	query := `
+        SELECT hash_password
+        FROM trx_users
+        WHERE user_id = ?
+        LIMIT 1
+    `
+	err := r.DB.QueryRow(query, userID).Scan(&hashedPassword)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", fmt.Errorf("user not found")
+		}
+		return "", fmt.Errorf("error retrieving password: %v", err)
+	}
+	return hashedPassword, nil
+}
+
+// UpdatePassword は、パスワードを更新して sessions_revoked_at を記録し、未使用のリセットトークンを無効化します。
+func (r *authRepository) UpdatePassword(userID int, hashedPassword string) error {
+	// TIMESTAMP は秒精度で丸められるため、直後に発行するクッキーが失効扱いにならないよう切り捨てる
+	now := time.Now().Truncate(time.Second)
+
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	updateQuery := `
+        UPDATE trx_users
+        SET hash_password = ?, sessions_revoked_at = ?
+        WHERE user_id = ?
+    `
+	if _, err := tx.Exec(updateQuery, hashedPassword, now, userID); err != nil {
+		return fmt.Errorf("failed to update password: %v", err)
+	}
+
+	resetQuery := `
+        UPDATE trx_password_resets
+        SET used_at = ?
+        WHERE user_id = ? AND used_at IS NULL
+    `
+	if _, err := tx.Exec(resetQuery, now, userID); err != nil {
+		return fmt.Errorf("failed to invalidate password resets: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return nil
+}
+
+func (r *authRepository) GetSessionsRevokedAt(userID int) (sql.NullTime, error) {
+	var revokedAt sql.NullTime
+	query := `
+        SELECT sessions_revoked_at
+        FROM trx_users
+        WHERE user_id = ? AND deleted_at IS NULL
+        LIMIT 1
+    `
+	err := r.DB.QueryRow(query, userID).Scan(&revokedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return sql.NullTime{}, fmt.Errorf("user not found")
+		}
+		return sql.NullTime{}, fmt.Errorf("error retrieving session state: %v", err)
+	}
+	return revokedAt, nil
+}
+
+func (r *authRepository) CreatePasswordReset(userID int, tokenHash string, expiresAt time.Time) error {
+	query := `
+        INSERT INTO trx_password_resets
+        (user_id, token_hash, expires_at)
+        VALUES (?, ?, ?)
+    `
+	if _, err := r.DB.Exec(query, userID, tokenHash, expiresAt); err != nil {
+		return fmt.Errorf("failed to create password reset: %v", err)
+	}
+	return nil
+}
+
+// ConsumePasswordReset は、未使用かつ期限内のトークンを使用済みにします（1回限り有効）。
+func (r *authRepository) ConsumePasswordReset(tokenHash string) (int, error) {
+	now := time.Now()
+
+	updateQuery := `
+        UPDATE trx_password_resets
+        SET used_at = ?
+        WHERE token_hash = ? AND used_at IS NULL AND expires_at > ?
+    `
+	result, err := r.DB.Exec(updateQuery, now, tokenHash, now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to consume password reset: %v", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get affected rows: %v", err)
+	}
+	if affected == 0 {
+		return 0, fmt.Errorf("invalid or expired reset token")
+	}
+
+	var userID int
+	selectQuery := `
+        SELECT user_id
+        FROM trx_password_resets
+        WHERE token_hash = ?
+        LIMIT 1
+    `
+	if err := r.DB.QueryRow(selectQuery, tokenHash).Scan(&userID); err != nil {
+		return 0, fmt.Errorf("failed to get password reset user: %v", err)
+	}
+	return userID, nil
+}
+
+func (r *authRepository) GetTOTPState(userID int) (string, sql.NullTime, int64, error) {
+	var secret sql.NullString
+	var enabledAt sql.NullTime
+	var lastStep int64
+
+	query := `
+        SELECT totp_secret, totp_enabled_at, totp_last_step
+        FROM trx_users
+        WHERE user_id = ?
+        LIMIT 1
+    `
+	err := r.DB.QueryRow(query, userID).Scan(&secret, &enabledAt, &lastStep)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", sql.NullTime{}, 0, fmt.Errorf("user not found")
+		}
+		return "", sql.NullTime{}, 0, fmt.Errorf("error retrieving totp state: %v", err)
+	}
+	return secret.String, enabledAt, lastStep, nil
+}
+
+func (r *authRepository) StartTOTPEnrollment(userID int, secret string, recoveryCodeHashes []string) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	updateQuery := `
+        UPDATE trx_users
+        SET totp_secret = ?, totp_enabled_at = NULL, totp_last_step = 0
+        WHERE user_id = ?
+    `
+	if _, err := tx.Exec(updateQuery, secret, userID); err != nil {
+		return fmt.Errorf("failed to save totp secret: %v", err)
+	}
+
+	// 再登録時は古いリカバリーコードを破棄する
+	if _, err := tx.Exec(`DELETE FROM trx_users_recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %v", err)
+	}
+	for _, codeHash := range recoveryCodeHashes {
+		insertQuery := `
+            INSERT INTO trx_users_recovery_codes
+            (user_id, code_hash)
+            VALUES (?, ?)
+        `
+		if _, err := tx.Exec(insertQuery, userID, codeHash); err != nil {
+			return fmt.Errorf("failed to insert recovery code: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return nil
+}
+
+func (r *authRepository) EnableTOTP(userID int, step int64) error {
+	query := `
+        UPDATE trx_users
+        SET totp_enabled_at = ?, totp_last_step = ?
+        WHERE user_id = ? AND totp_secret IS NOT NULL
+    `
+	if _, err := r.DB.Exec(query, time.Now(), step, userID); err != nil {
+		return fmt.Errorf("failed to enable totp: %v", err)
+	}
+	return nil
+}
+
+func (r *authRepository) DisableTOTP(userID int) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	updateQuery := `
+        UPDATE trx_users
+        SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = 0
+        WHERE user_id = ?
+    `
+	if _, err := tx.Exec(updateQuery, userID); err != nil {
+		return fmt.Errorf("failed to disable totp: %v", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM trx_users_recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return nil
+}
+
+// MarkTOTPStepUsed は、同じコードの再利用（リプレイ）を防ぐために使用済みステップを更新します。
+func (r *authRepository) MarkTOTPStepUsed(userID int, step int64) error {
+	query := `
+        UPDATE trx_users
+        SET totp_last_step = ?
+        WHERE user_id = ? AND totp_last_step < ?
+    `
+	result, err := r.DB.Exec(query, step, userID, step)
+	if err != nil {
+		return fmt.Errorf("failed to update totp step: %v", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %v", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("totp code has already been used")
+	}
+	return nil
+}
+
+// ConsumeRecoveryCode は、未使用のリカバリーコードを使用済みにします（1回限り有効）。
+func (r *authRepository) ConsumeRecoveryCode(userID int, codeHash string) error {
+	query := `
+        UPDATE trx_users_recovery_codes
+        SET used_at = ?
+        WHERE user_id = ? AND code_hash = ? AND used_at IS NULL
+    `
+	result, err := r.DB.Exec(query, time.Now(), userID, codeHash)
+	if err != nil {
+		return fmt.Errorf("failed to consume recovery code: %v", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %v", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("invalid recovery code")
+	}
+	return nil
+}
+
+func (r *authRepository) IncrementTwoFactorAttempts(userID int, window time.Duration) (int64, error) {
+	ctx := context.Background()
+	key := fmt.Sprintf("2fa:attempts:%d", userID)
+
+	count, err := r.RedisClient.Incr(ctx, key).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to increment two-factor attempts: %v", err)
+	}
+	// 最初の確認から window の間だけ数える
+	if count == 1 {
+		if err := r.RedisClient.Expire(ctx, key, window).Err(); err != nil {
+			return 0, fmt.Errorf("failed to set two-factor attempts expiry: %v", err)
+		}
+	}
+	return count, nil
+}
+
+func (r *authRepository) ResetTwoFactorAttempts(userID int) error {
+	if err := r.RedisClient.Del(context.Background(), fmt.Sprintf("2fa:attempts:%d", userID)).Err(); err != nil {
+		return fmt.Errorf("failed to reset two-factor attempts: %v", err)
+	}
+	return nil
+}
+
+func (r *authRepository) ListEncryptedTOTPSecrets(afterUserID, limit int) ([]EncryptedTOTPSecretRow, error) {
+	query := `
+        SELECT user_id, totp_secret
+        FROM trx_users
+        WHERE user_id > ? AND totp_secret IS NOT NULL
+        ORDER BY user_id ASC
+        LIMIT ?
+    `
+	rows, err := r.DB.Query(query, afterUserID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query totp secrets: %v", err)
+	}
+	defer rows.Close()
+
+	var secrets []EncryptedTOTPSecretRow
+	for rows.Next() {
+		var row EncryptedTOTPSecretRow
+		if err := rows.Scan(&row.UserID, &row.EncryptedSecret); err != nil {
+			return nil, fmt.Errorf("failed to scan totp secret: %v", err)
+		}
+		secrets = append(secrets, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query totp secrets: %v", err)
+	}
+	return secrets, nil
+}
+
+func (r *authRepository) UpdateEncryptedTOTPSecret(current EncryptedTOTPSecretRow, encryptedSecret string) (bool, error) {
+	query := `UPDATE trx_users SET totp_secret = ? WHERE user_id = ? AND totp_secret = ?`
+	result, err := r.DB.Exec(query, encryptedSecret, current.UserID, current.EncryptedSecret)
+	if err != nil {
+		return false, fmt.Errorf("failed to update totp secret: %v", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get affected rows: %v", err)
+	}
+	return affected > 0, nil
+}
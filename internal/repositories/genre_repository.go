@@ -0,0 +1,82 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Genre は、ルームのジャンル（mst_genres）です。
+type Genre struct {
+	Code string `json:"code"`
+	// Name は指定したロケールの表示名（なければ既定のロケール、それもなければコード）
+	Name string `json:"name"`
+	// RoomCount はこのジャンルの公開中のルーム数
+	RoomCount int `json:"roomCount"`
+}
+
+type GenreRepository interface {
+	// ListGenres は、表示順にジャンルと公開中のルーム数を返します。
+	ListGenres(locale, defaultLocale string) ([]Genre, error)
+	// ListGenreCodes は、すべてのジャンルコードを返します。
+	ListGenreCodes() ([]string, error)
+}
+
+type genreRepository struct {
+	DB *sql.DB
+}
+
+func NewGenreRepository(db *sql.DB) GenreRepository {
+	return &genreRepository{DB: db}
+}
+
+func (r *genreRepository) ListGenres(locale, defaultLocale string) ([]Genre, error) {
+	query := `
+        SELECT g.genre_code,
+               COALESCE(n.display_name, d.display_name, g.genre_code),
+               (SELECT COUNT(*) FROM trx_rooms r
+                WHERE r.genre = g.genre_code AND r.is_public = TRUE AND r.deleted_at IS NULL)
+        FROM mst_genres g
+        LEFT JOIN mst_genre_names n ON n.genre_code = g.genre_code AND n.locale = ?
+        LEFT JOIN mst_genre_names d ON d.genre_code = g.genre_code AND d.locale = ?
+        ORDER BY g.sort_order ASC, g.genre_code ASC
+    `
+	rows, err := r.DB.Query(query, locale, defaultLocale)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list genres: %w", err)
+	}
+	defer rows.Close()
+
+	genres := []Genre{}
+	for rows.Next() {
+		var genre Genre
+		if err := rows.Scan(&genre.Code, &genre.Name, &genre.RoomCount); err != nil {
+			return nil, fmt.Errorf("failed to scan genre: %w", err)
+		}
+		genres = append(genres, genre)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list genres: %w", err)
+	}
+	return genres, nil
+}
+
+func (r *genreRepository) ListGenreCodes() ([]string, error) {
+	rows, err := r.DB.Query(`SELECT genre_code FROM mst_genres`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list genre codes: %w", err)
+	}
+	defer rows.Close()
+
+	var codes []string
+	for rows.Next() {
+		var code string
+		if err := rows.Scan(&code); err != nil {
+			return nil, fmt.Errorf("failed to scan genre code: %w", err)
+		}
+		codes = append(codes, code)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list genre codes: %w", err)
+	}
+	return codes, nil
+}
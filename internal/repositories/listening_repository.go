@@ -0,0 +1,239 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// ListeningEntry は、ユーザーが参加中に再生されていた曲1回分と、実際に聴いていた時間です。
+type ListeningEntry struct {
+	PlayID     int64     `json:"playId"`
+	RoomID     int       `json:"roomId"`
+	RoomName   string    `json:"roomName"`
+	SongID     string    `json:"songId"`
+	TrackID    string    `json:"trackId"`
+	SongName   string    `json:"songName"`
+	Artist     string    `json:"artist"`
+	SongLength int       `json:"songLength"`
+	StartedAt  time.Time `json:"startedAt"`
+	// ListenedMs は、再生中かつ参加中だった時間（ミリ秒）
+	ListenedMs int `json:"listenedMs"`
+}
+
+// ListeningCount は、集計キーごとの再生回数と聴いていた時間です。
+type ListeningCount struct {
+	Key        string
+	Label      string
+	Plays      int
+	ListenedMs int
+}
+
+// RoomVisit は、ルームごとの参加回数と聴いていた時間です。
+type RoomVisit struct {
+	RoomID     int    `json:"roomId"`
+	RoomName   string `json:"roomName"`
+	Visits     int    `json:"visits"`
+	ListenedMs int    `json:"listenedMs"`
+}
+
+type ListeningRepository interface {
+	// ListListeningHistory は、since 以降に参加中に再生された曲を新しい順に返します（beforeID より前、0 なら最新から）。
+	ListListeningHistory(userID int, since time.Time, beforeID int64, limit int) ([]ListeningEntry, error)
+	// GetTotalListeningMs は、since 以降に聴いていた時間の合計を返します。
+	GetTotalListeningMs(userID int, since time.Time) (int, error)
+	// CountListeningByTrack は、曲（track_id、なければ曲名とアーティスト）ごとに集計します。minListenMs 未満の再生は回数に含めない。
+	CountListeningByTrack(userID int, since time.Time, minListenMs int) ([]ListeningCount, error)
+	// CountListeningByArtist は、アーティスト（trx_room_plays.artist の値そのまま）ごとに集計します。
+	CountListeningByArtist(userID int, since time.Time, minListenMs int) ([]ListeningCount, error)
+	// CountListeningByGenre は、ルームのジャンルごとに集計します。
+	CountListeningByGenre(userID int, since time.Time, minListenMs int) ([]ListeningCount, error)
+	// ListRoomVisits は、参加回数の多い順にルームを最大 limit 件返します。
+	ListRoomVisits(userID int, since time.Time, limit int) ([]RoomVisit, error)
+}
+
+type listeningRepository struct {
+	DB *sql.DB
+}
+
+func NewListeningRepository(db *sql.DB) ListeningRepository {
+	return &listeningRepository{DB: db}
+}
+
+// listensQuery は、ユーザーの参加期間と曲の再生期間が重なった部分を1行ずつ返すサブクエリです。
+// 引数は (user_id, since)。再生中・参加中のものは現在時刻までとして計算する。
+// 同じルームの参加期間が重なっている場合（退出を記録できずに再参加したなど）は1つにまとめてから重ねる。
+// 聴いていた時間は、終了した再生では再生された長さ（played_ms）、再生中の曲では曲の長さを上限とする（一時停止中の時間を含めない）。
+const listensQuery = `
+        SELECT o.play_id, o.room_id, o.song_id, o.track_id, o.song_name, o.artist, o.song_length, o.started_at,
+               LEAST(o.overlap_ms, IF(o.ended_at IS NOT NULL, o.played_ms, IF(o.song_length > 0, o.song_length, o.overlap_ms))) AS listened_ms
+        FROM (
+            SELECT p.play_id, p.room_id, p.song_id, p.track_id, p.song_name, p.artist, p.song_length, p.started_at, p.ended_at, p.played_ms,
+                   GREATEST(0, TIMESTAMPDIFF(MICROSECOND,
+                       GREATEST(p.started_at, j.joined_at),
+                       LEAST(COALESCE(p.ended_at, CURRENT_TIMESTAMP(3)), j.left_at)
+                   ) DIV 1000) AS overlap_ms
+            FROM (
+                SELECT room_id, MIN(joined_at) AS joined_at, MAX(left_at) AS left_at
+                FROM (
+                    SELECT room_id, joined_at, left_at,
+                           SUM(IF(prev_left_at IS NULL OR joined_at > prev_left_at, 1, 0))
+                               OVER (PARTITION BY room_id ORDER BY joined_at, left_at ROWS UNBOUNDED PRECEDING) AS span
+                    FROM (
+                        SELECT room_id, joined_at, left_at,
+                               MAX(left_at) OVER (PARTITION BY room_id ORDER BY joined_at, left_at
+                                                  ROWS BETWEEN UNBOUNDED PRECEDING AND 1 PRECEDING) AS prev_left_at
+                        FROM (
+                            SELECT room_id, joined_at, COALESCE(left_at, CURRENT_TIMESTAMP(3)) AS left_at
+                            FROM trx_room_joins
+                            WHERE user_id = ?
+                        ) raw_joins
+                    ) ordered_joins
+                ) spanned_joins
+                GROUP BY room_id, span
+            ) j
+            JOIN trx_room_plays p
+              ON p.room_id = j.room_id
+             AND p.started_at < j.left_at
+             AND COALESCE(p.ended_at, CURRENT_TIMESTAMP(3)) > j.joined_at
+            WHERE p.started_at >= ?
+        ) o`
+
+func (r *listeningRepository) ListListeningHistory(userID int, since time.Time, beforeID int64, limit int) ([]ListeningEntry, error) {
+	query := `
+        SELECT l.play_id, l.room_id, COALESCE(r.room_name, ''), l.song_id, l.track_id, l.song_name, l.artist, l.song_length,
+               l.started_at, SUM(l.listened_ms)
+        FROM (` + listensQuery + `) l
+        LEFT JOIN trx_rooms r ON r.room_id = l.room_id
+        WHERE (? = 0 OR l.play_id < ?)
+        GROUP BY l.play_id, l.room_id, r.room_name, l.song_id, l.track_id, l.song_name, l.artist, l.song_length, l.started_at
+        ORDER BY l.play_id DESC
+        LIMIT ?
+    `
+	rows, err := r.DB.Query(query, userID, since, beforeID, beforeID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list listening history: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []ListeningEntry{}
+	for rows.Next() {
+		var entry ListeningEntry
+		if err := rows.Scan(
+			&entry.PlayID, &entry.RoomID, &entry.RoomName, &entry.SongID, &entry.TrackID, &entry.SongName, &entry.Artist, &entry.SongLength,
+			&entry.StartedAt, &entry.ListenedMs,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan listening history: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list listening history: %w", err)
+	}
+	return entries, nil
+}
+
+func (r *listeningRepository) GetTotalListeningMs(userID int, since time.Time) (int, error) {
+	query := `SELECT COALESCE(SUM(l.listened_ms), 0) FROM (` + listensQuery + `) l`
+	var total int
+	if err := r.DB.QueryRow(query, userID, since).Scan(&total); err != nil {
+		return 0, fmt.Errorf("failed to get total listening time: %w", err)
+	}
+	return total, nil
+}
+
+func (r *listeningRepository) CountListeningByTrack(userID int, since time.Time, minListenMs int) ([]ListeningCount, error) {
+	query := `
+        SELECT IF(l.track_id <> '', l.track_id, CONCAT(l.song_name, ' - ', l.artist)),
+               CONCAT(l.song_name, ' - ', l.artist),
+               COUNT(DISTINCT IF(l.listened_ms >= ?, l.play_id, NULL)),
+               SUM(l.listened_ms)
+        FROM (` + listensQuery + `) l
+        GROUP BY 1, 2
+    `
+	return r.countListening(query, minListenMs, userID, since)
+}
+
+func (r *listeningRepository) CountListeningByArtist(userID int, since time.Time, minListenMs int) ([]ListeningCount, error) {
+	query := `
+        SELECT l.artist, l.artist,
+               COUNT(DISTINCT IF(l.listened_ms >= ?, l.play_id, NULL)),
+               SUM(l.listened_ms)
+        FROM (` + listensQuery + `) l
+        WHERE l.artist <> ''
+        GROUP BY l.artist
+    `
+	return r.countListening(query, minListenMs, userID, since)
+}
+
+func (r *listeningRepository) CountListeningByGenre(userID int, since time.Time, minListenMs int) ([]ListeningCount, error) {
+	query := `
+        SELECT rm.genre, rm.genre,
+               COUNT(DISTINCT IF(l.listened_ms >= ?, l.play_id, NULL)),
+               SUM(l.listened_ms)
+        FROM (` + listensQuery + `) l
+        JOIN trx_rooms rm ON rm.room_id = l.room_id
+        WHERE rm.genre <> ''
+        GROUP BY rm.genre
+    `
+	return r.countListening(query, minListenMs, userID, since)
+}
+
+func (r *listeningRepository) countListening(query string, args ...interface{}) ([]ListeningCount, error) {
+	rows, err := r.DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate listening: %w", err)
+	}
+	defer rows.Close()
+
+	var counts []ListeningCount
+	for rows.Next() {
+		var count ListeningCount
+		if err := rows.Scan(&count.Key, &count.Label, &count.Plays, &count.ListenedMs); err != nil {
+			return nil, fmt.Errorf("failed to scan listening count: %w", err)
+		}
+		counts = append(counts, count)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to aggregate listening: %w", err)
+	}
+	return counts, nil
+}
+
+func (r *listeningRepository) ListRoomVisits(userID int, since time.Time, limit int) ([]RoomVisit, error) {
+	query := `
+        SELECT v.room_id, COALESCE(rm.room_name, ''), v.visits, COALESCE(t.listened_ms, 0)
+        FROM (
+            SELECT room_id, COUNT(*) AS visits, MAX(joined_at) AS last_joined_at
+            FROM trx_room_joins
+            WHERE user_id = ? AND joined_at >= ?
+            GROUP BY room_id
+        ) v
+        LEFT JOIN (
+            SELECT l.room_id, SUM(l.listened_ms) AS listened_ms
+            FROM (` + listensQuery + `) l
+            GROUP BY l.room_id
+        ) t ON t.room_id = v.room_id
+        LEFT JOIN trx_rooms rm ON rm.room_id = v.room_id
+        ORDER BY v.visits DESC, t.listened_ms DESC, v.last_joined_at DESC
+        LIMIT ?
+    `
+	rows, err := r.DB.Query(query, userID, since, userID, since, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list room visits: %w", err)
+	}
+	defer rows.Close()
+
+	visits := []RoomVisit{}
+	for rows.Next() {
+		var visit RoomVisit
+		if err := rows.Scan(&visit.RoomID, &visit.RoomName, &visit.Visits, &visit.ListenedMs); err != nil {
+			return nil, fmt.Errorf("failed to scan room visit: %w", err)
+		}
+		visits = append(visits, visit)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list room visits: %w", err)
+	}
+	return visits, nil
+}
@@ -0,0 +1,183 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// RoomPlay は、ルームで再生された曲1回分の記録です。
+type RoomPlay struct {
+	PlayID     int64  `json:"playId"`
+	RoomID     int    `json:"roomId"`
+	SongIndex  int    `json:"songIndex"`
+	SongID     string `json:"songId"`
+	TrackID    string `json:"trackId"`
+	SongName   string `json:"songName"`
+	Artist     string `json:"artist"`
+	SongLength int    `json:"songLength"`
+	// StartedBy は再生したユーザー（ホスト）
+	StartedBy     int        `json:"startedBy"`
+	StartedByName string     `json:"startedByName"`
+	StartedAt     time.Time  `json:"startedAt"`
+	EndedAt       *time.Time `json:"endedAt"`
+	// Outcome は "completed"・"skipped"・"stopped"。再生中は空
+	Outcome string `json:"outcome"`
+	// PlayedMs は終了時点の再生位置（ミリ秒）
+	PlayedMs      int `json:"playedMs"`
+	ListenerCount int `json:"listenerCount"`
+}
+
+type PlayLogRepository interface {
+	// StartPlay は、再生の開始を記録して play_id を返します。
+	StartPlay(play RoomPlay) (int64, error)
+	// GetCurrentPlay は、ルームで再生中（未終了）の記録を返します。ない場合は found=false を返します。
+	GetCurrentPlay(roomID int) (*RoomPlay, bool, error)
+	// EndPlay は、再生の終了を記録します。
+	EndPlay(playID int64, outcome string, playedMs int) error
+	// ListRoomPlays は、beforeID より前（0 なら最新から）の再生記録を新しい順に最大 limit 件返します。
+	ListRoomPlays(roomID int, beforeID int64, limit int) ([]RoomPlay, error)
+	// ListPlayedSongIDs は、ルームで再生された曲の Spotify の曲IDを、最初に再生された順に重複なしで返します。
+	ListPlayedSongIDs(roomID int) ([]string, error)
+	// CanViewRoomHistory は、ユーザーがルームのホストか、過去を含めて参加したことがあるかを返します。
+	CanViewRoomHistory(roomID, userID int) (bool, error)
+}
+
+type playLogRepository struct {
+	DB *sql.DB
+}
+
+func NewPlayLogRepository(db *sql.DB) PlayLogRepository {
+	return &playLogRepository{DB: db}
+}
+
+const roomPlayColumns = `
+        p.play_id, p.room_id, p.song_index, p.song_id, p.track_id, p.song_name, p.artist, p.song_length,
+        p.started_by, COALESCE(u.user_name, ''), p.started_at, p.ended_at, COALESCE(p.outcome, ''), p.played_ms, p.listener_count`
+
+func scanRoomPlay(scanner interface{ Scan(...interface{}) error }) (*RoomPlay, error) {
+	var play RoomPlay
+	var endedAt sql.NullTime
+	if err := scanner.Scan(
+		&play.PlayID, &play.RoomID, &play.SongIndex, &play.SongID, &play.TrackID, &play.SongName, &play.Artist, &play.SongLength,
+		&play.StartedBy, &play.StartedByName, &play.StartedAt, &endedAt, &play.Outcome, &play.PlayedMs, &play.ListenerCount,
+	); err != nil {
+		return nil, err
+	}
+	if endedAt.Valid {
+		play.EndedAt = &endedAt.Time
+	}
+	return &play, nil
+}
+
+func (r *playLogRepository) StartPlay(play RoomPlay) (int64, error) {
+	query := `
+        INSERT INTO trx_room_plays
+        (room_id, song_index, song_id, track_id, song_name, artist, song_length, started_by, listener_count)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+    `
+	result, err := r.DB.Exec(query, play.RoomID, play.SongIndex, play.SongID, play.TrackID, play.SongName, play.Artist, play.SongLength, play.StartedBy, play.ListenerCount)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert room play: %w", err)
+	}
+	playID, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get play id: %w", err)
+	}
+	return playID, nil
+}
+
+func (r *playLogRepository) GetCurrentPlay(roomID int) (*RoomPlay, bool, error) {
+	query := `SELECT` + roomPlayColumns + `
+        FROM trx_room_plays p
+        LEFT JOIN trx_users u ON u.user_id = p.started_by
+        WHERE p.room_id = ? AND p.ended_at IS NULL
+        ORDER BY p.play_id DESC
+        LIMIT 1
+    `
+	play, err := scanRoomPlay(r.DB.QueryRow(query, roomID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get current play: %w", err)
+	}
+	return play, true, nil
+}
+
+func (r *playLogRepository) EndPlay(playID int64, outcome string, playedMs int) error {
+	query := `UPDATE trx_room_plays SET ended_at = CURRENT_TIMESTAMP(3), outcome = ?, played_ms = ? WHERE play_id = ? AND ended_at IS NULL`
+	if _, err := r.DB.Exec(query, outcome, playedMs, playID); err != nil {
+		return fmt.Errorf("failed to end room play: %w", err)
+	}
+	return nil
+}
+
+func (r *playLogRepository) ListRoomPlays(roomID int, beforeID int64, limit int) ([]RoomPlay, error) {
+	query := `SELECT` + roomPlayColumns + `
+        FROM trx_room_plays p
+        LEFT JOIN trx_users u ON u.user_id = p.started_by
+        WHERE p.room_id = ? AND (? = 0 OR p.play_id < ?)
+        ORDER BY p.play_id DESC
+        LIMIT ?
+    `
+	rows, err := r.DB.Query(query, roomID, beforeID, beforeID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list room plays: %w", err)
+	}
+	defer rows.Close()
+
+	plays := []RoomPlay{}
+	for rows.Next() {
+		play, err := scanRoomPlay(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan room play: %w", err)
+		}
+		plays = append(plays, *play)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list room plays: %w", err)
+	}
+	return plays, nil
+}
+
+func (r *playLogRepository) ListPlayedSongIDs(roomID int) ([]string, error) {
+	query := `
+        SELECT song_id
+        FROM trx_room_plays
+        WHERE room_id = ? AND song_id <> ''
+        GROUP BY song_id
+        ORDER BY MIN(play_id) ASC
+    `
+	rows, err := r.DB.Query(query, roomID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list played songs: %w", err)
+	}
+	defer rows.Close()
+
+	var songIDs []string
+	for rows.Next() {
+		var songID string
+		if err := rows.Scan(&songID); err != nil {
+			return nil, fmt.Errorf("failed to scan played song: %w", err)
+		}
+		songIDs = append(songIDs, songID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list played songs: %w", err)
+	}
+	return songIDs, nil
+}
+
+func (r *playLogRepository) CanViewRoomHistory(roomID, userID int) (bool, error) {
+	query := `
+        SELECT EXISTS (SELECT 1 FROM trx_rooms WHERE room_id = ? AND host_user_id = ?)
+            OR EXISTS (SELECT 1 FROM trx_room_joins WHERE room_id = ? AND user_id = ?)
+    `
+	var allowed bool
+	if err := r.DB.QueryRow(query, roomID, userID, roomID, userID).Scan(&allowed); err != nil {
+		return false, fmt.Errorf("failed to check room history access: %w", err)
+	}
+	return allowed, nil
+}
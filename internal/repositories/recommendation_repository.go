@@ -0,0 +1,213 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RecommendationCandidate は、おすすめの候補となる公開ルームと、スコア計算に使う情報です。
+type RecommendationCandidate struct {
+	Room Room
+	// Artists はルームの曲のアーティスト（trx_rooms_songs.artist）
+	Artists []string
+	// MemberIDs は参加中のユーザー（ホストを含む）
+	MemberIDs []int
+}
+
+// Companion は、過去に同じ時間に同じルームにいたユーザーです。
+type Companion struct {
+	UserID   int
+	UserName string
+	// Rooms は一緒にいたルームの数
+	Rooms int
+}
+
+// UserAffinity は、ユーザーの参加履歴から集計した好みです。
+type UserAffinity struct {
+	// Genres はジャンルごとの参加したルーム数
+	Genres map[string]int
+	// Artists は参加したルームの曲に含まれていたアーティストごとの曲数
+	Artists map[string]int
+	// Companions はユーザーIDごとの一緒にいたユーザー
+	Companions map[int]Companion
+}
+
+type RecommendationRepository interface {
+	// ListRecommendationCandidates は、空きのある公開ルームを最近の活動順に最大 limit 件返します。
+	ListRecommendationCandidates(limit int) ([]RecommendationCandidate, error)
+	// GetUserAffinity は、since 以降の参加履歴からユーザーの好みを集計します。
+	GetUserAffinity(userID int, since time.Time) (*UserAffinity, error)
+}
+
+type recommendationRepository struct {
+	DB *sql.DB
+}
+
+func NewRecommendationRepository(db *sql.DB) RecommendationRepository {
+	return &recommendationRepository{DB: db}
+}
+
+func (r *recommendationRepository) ListRecommendationCandidates(limit int) ([]RecommendationCandidate, error) {
+	query := `
+        SELECT room_id, room_name, is_public, genre, playing_playlist_name, playing_song_name,
+               max_participants, now_participants, host_user_id, host_user_name, created_at, updated_at
+        FROM trx_rooms
+        WHERE is_public = TRUE AND deleted_at IS NULL AND now_participants < max_participants
+        ORDER BY updated_at DESC, room_id DESC
+        LIMIT ?
+    `
+	rows, err := r.DB.Query(query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list candidate rooms: %w", err)
+	}
+	defer rows.Close()
+
+	candidates := []RecommendationCandidate{}
+	indexes := make(map[int]int)
+	for rows.Next() {
+		var room Room
+		if err := rows.Scan(
+			&room.RoomID, &room.RoomName, &room.IsPublic, &room.Genre, &room.PlayingPlaylistName, &room.PlayingSongName,
+			&room.MaxParticipants, &room.NowParticipants, &room.HostUserID, &room.HostUserName, &room.CreateAt, &room.UpdateAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan candidate room: %w", err)
+		}
+		room.Tags = []string{}
+		indexes[room.RoomID] = len(candidates)
+		candidates = append(candidates, RecommendationCandidate{Room: room})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list candidate rooms: %w", err)
+	}
+	if len(candidates) == 0 {
+		return candidates, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(candidates)), ", ")
+	args := make([]interface{}, 0, len(candidates))
+	for _, candidate := range candidates {
+		args = append(args, candidate.Room.RoomID)
+	}
+
+	artistQuery := fmt.Sprintf(`SELECT DISTINCT room_id, artist FROM trx_rooms_songs WHERE room_id IN (%s) AND artist <> ''`, placeholders)
+	if err := r.scanPairs(artistQuery, args, func(roomID int, value string) {
+		candidates[indexes[roomID]].Artists = append(candidates[indexes[roomID]].Artists, value)
+	}); err != nil {
+		return nil, fmt.Errorf("failed to list candidate artists: %w", err)
+	}
+
+	memberQuery := fmt.Sprintf(`SELECT DISTINCT room_id, user_id FROM trx_room_joins WHERE room_id IN (%s) AND left_at IS NULL`, placeholders)
+	if err := r.scanPairs(memberQuery, args, func(roomID int, value string) {
+		if userID, err := strconv.Atoi(value); err == nil {
+			candidates[indexes[roomID]].MemberIDs = append(candidates[indexes[roomID]].MemberIDs, userID)
+		}
+	}); err != nil {
+		return nil, fmt.Errorf("failed to list candidate members: %w", err)
+	}
+
+	tagQuery := fmt.Sprintf(`SELECT room_id, tag FROM trx_room_tags WHERE room_id IN (%s) ORDER BY created_at ASC, tag ASC`, placeholders)
+	if err := r.scanPairs(tagQuery, args, func(roomID int, value string) {
+		candidates[indexes[roomID]].Room.Tags = append(candidates[indexes[roomID]].Room.Tags, value)
+	}); err != nil {
+		return nil, fmt.Errorf("failed to list candidate tags: %w", err)
+	}
+	return candidates, nil
+}
+
+// scanPairs は、(room_id, 値) の2列を返すクエリを実行し、行ごとに fn を呼びます。
+func (r *recommendationRepository) scanPairs(query string, args []interface{}, fn func(roomID int, value string)) error {
+	rows, err := r.DB.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var roomID int
+		var value string
+		if err := rows.Scan(&roomID, &value); err != nil {
+			return err
+		}
+		fn(roomID, value)
+	}
+	return rows.Err()
+}
+
+func (r *recommendationRepository) GetUserAffinity(userID int, since time.Time) (*UserAffinity, error) {
+	affinity := &UserAffinity{
+		Genres:     make(map[string]int),
+		Artists:    make(map[string]int),
+		Companions: make(map[int]Companion),
+	}
+
+	genreQuery := `
+        SELECT r.genre, COUNT(DISTINCT j.room_id)
+        FROM trx_room_joins j
+        JOIN trx_rooms r ON r.room_id = j.room_id
+        WHERE j.user_id = ? AND j.joined_at >= ? AND r.genre <> ''
+        GROUP BY r.genre
+    `
+	if err := r.scanCounts(genreQuery, []interface{}{userID, since}, affinity.Genres); err != nil {
+		return nil, fmt.Errorf("failed to aggregate joined genres: %w", err)
+	}
+
+	artistQuery := `
+        SELECT s.artist, COUNT(*)
+        FROM (SELECT DISTINCT room_id FROM trx_room_joins WHERE user_id = ? AND joined_at >= ?) j
+        JOIN trx_rooms_songs s ON s.room_id = j.room_id
+        WHERE s.artist <> ''
+        GROUP BY s.artist
+    `
+	if err := r.scanCounts(artistQuery, []interface{}{userID, since}, affinity.Artists); err != nil {
+		return nil, fmt.Errorf("failed to aggregate listened artists: %w", err)
+	}
+
+	// 参加していた時間が重なっていたユーザー
+	companionQuery := `
+        SELECT o.user_id, u.user_name, COUNT(DISTINCT o.room_id)
+        FROM trx_room_joins j
+        JOIN trx_room_joins o
+          ON o.room_id = j.room_id AND o.user_id <> j.user_id
+         AND o.joined_at < COALESCE(j.left_at, CURRENT_TIMESTAMP)
+         AND COALESCE(o.left_at, CURRENT_TIMESTAMP) > j.joined_at
+        JOIN trx_users u ON u.user_id = o.user_id AND u.deleted_at IS NULL
+        WHERE j.user_id = ? AND j.joined_at >= ?
+        GROUP BY o.user_id, u.user_name
+    `
+	rows, err := r.DB.Query(companionQuery, userID, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate companions: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var companion Companion
+		if err := rows.Scan(&companion.UserID, &companion.UserName, &companion.Rooms); err != nil {
+			return nil, fmt.Errorf("failed to scan companion: %w", err)
+		}
+		affinity.Companions[companion.UserID] = companion
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to aggregate companions: %w", err)
+	}
+	return affinity, nil
+}
+
+// scanCounts は、(キー, 件数) の2列を返すクエリの結果を counts に加えます。
+func (r *recommendationRepository) scanCounts(query string, args []interface{}, counts map[string]int) error {
+	rows, err := r.DB.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key string
+		var count int
+		if err := rows.Scan(&key, &count); err != nil {
+			return err
+		}
+		counts[key] += count
+	}
+	return rows.Err()
+}
@@ -0,0 +1,85 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RoomEvent は、ルームの参加者にリアルタイムで配信するイベントです。
+type RoomEvent struct {
+	Type      string          `json:"type"`
+	RoomID    int             `json:"roomId"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+type RoomEventRepository interface {
+	PublishRoomEvent(event RoomEvent) error
+	// SubscribeRoomEvents は、ルームのイベントを受け取るチャネルを返します。ctx が終了するとチャネルは閉じられます。
+	SubscribeRoomEvents(ctx context.Context, roomID int) (<-chan RoomEvent, error)
+}
+
+type roomEventRepository struct {
+	RedisClient *redis.Client
+}
+
+func NewRoomEventRepository(redisClient *redis.Client) RoomEventRepository {
+	return &roomEventRepository{RedisClient: redisClient}
+}
+
+func roomEventChannel(roomID int) string {
+	return fmt.Sprintf("room:%d:events", roomID)
+}
+
+func (r *roomEventRepository) PublishRoomEvent(event RoomEvent) error {
+	ctx := context.Background()
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal room event: %w", err)
+	}
+	if err := r.RedisClient.Publish(ctx, roomEventChannel(event.RoomID), data).Err(); err != nil {
+		return fmt.Errorf("failed to publish room event: %w", err)
+	}
+	return nil
+}
+
+func (r *roomEventRepository) SubscribeRoomEvents(ctx context.Context, roomID int) (<-chan RoomEvent, error) {
+	pubsub := r.RedisClient.Subscribe(ctx, roomEventChannel(roomID))
+	// 購読の確立を待ってから返す（確立前に発行されたイベントは受け取れないため）
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, fmt.Errorf("failed to subscribe room events: %w", err)
+	}
+
+	events := make(chan RoomEvent)
+	go func() {
+		defer close(events)
+		defer pubsub.Close()
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case message, ok := <-messages:
+				if !ok {
+					return
+				}
+				var event RoomEvent
+				if err := json.Unmarshal([]byte(message.Payload), &event); err != nil {
+					// 形式の異なるメッセージは読み飛ばす
+					continue
+				}
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return events, nil
+}
@@ -0,0 +1,237 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// LifecycleRoom は、自動で閉じるかどうかの判定に使うルームの状態です。
+type LifecycleRoom struct {
+	RoomID          int
+	NowParticipants int
+	// UpdatedAt は trx_rooms の最終更新（参加・退出・曲の切り替えなど）
+	UpdatedAt time.Time
+	// LastPlaybackAt は Redis 上の最後の再生操作の時刻（記録がなければゼロ値）
+	LastPlaybackAt time.Time
+}
+
+type RoomLifecycleRepository interface {
+	// ListStaleRooms は、updatedBefore より前から更新されていない開いているルームを古い順に最大 limit 件返します。
+	// after を指定した場合は、(updated_at, room_id) がそのルームより後のものから返します（前のページの最後のルームを渡す）。
+	ListStaleRooms(updatedBefore time.Time, after *LifecycleRoom, limit int) ([]LifecycleRoom, error)
+	// CloseRoom は、ルームを論理削除して Redis の状態を保存し、Redis のキーに ttl の有効期限を付けます（0 以下ならすぐに消す）。
+	// すでに閉じられていた場合は false を返します。
+	CloseRoom(roomID int, reason string, ttl time.Duration) (bool, error)
+	// RestoreRoom は、閉じたルームを参加者がいない状態で開き直し、保存していた再生状態を Redis に戻します。
+	// 閉じられていなかった場合は false を返します。
+	RestoreRoom(roomID int) (bool, error)
+	// GetRoomHostUserID は、ルーム（閉じたものを含む）のホストの user_id を返します。ない場合は found=false を返します。
+	GetRoomHostUserID(roomID int) (int, bool, error)
+}
+
+type roomLifecycleRepository struct {
+	DB          *sql.DB
+	RedisClient *redis.Client
+}
+
+func NewRoomLifecycleRepository(db *sql.DB, redisClient *redis.Client) RoomLifecycleRepository {
+	return &roomLifecycleRepository{DB: db, RedisClient: redisClient}
+}
+
+func (r *roomLifecycleRepository) ListStaleRooms(updatedBefore time.Time, after *LifecycleRoom, limit int) ([]LifecycleRoom, error) {
+	conditions := "deleted_at IS NULL AND updated_at < ?"
+	args := []interface{}{updatedBefore}
+	if after != nil {
+		conditions += " AND (updated_at, room_id) > (?, ?)"
+		args = append(args, after.UpdatedAt, after.RoomID)
+	}
+	query := `
+        SELECT room_id, now_participants, updated_at
+        FROM trx_rooms
+        WHERE ` + conditions + `
+        ORDER BY updated_at ASC, room_id ASC
+        LIMIT ?
+    `
+	args = append(args, limit)
+	rows, err := r.DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list stale rooms: %w", err)
+	}
+	defer rows.Close()
+
+	var rooms []LifecycleRoom
+	for rows.Next() {
+		var room LifecycleRoom
+		if err := rows.Scan(&room.RoomID, &room.NowParticipants, &room.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan stale room: %w", err)
+		}
+		rooms = append(rooms, room)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list stale rooms: %w", err)
+	}
+
+	// 一時停止・シークは Redis だけが更新されるため、最後の再生操作の時刻は Redis から取る
+	ctx := context.Background()
+	for i := range rooms {
+		val, err := r.RedisClient.Get(ctx, fmt.Sprintf("room:%d", rooms[i].RoomID)).Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get room data from Redis: %w", err)
+		}
+		var redisData RedisRoomData
+		if err := json.Unmarshal([]byte(val), &redisData); err != nil {
+			continue
+		}
+		rooms[i].LastPlaybackAt = lastPlaybackAt(redisData)
+	}
+	return rooms, nil
+}
+
+// lastPlaybackAt は、再生位置の更新時刻と曲の切り替え時刻の新しい方を返します。
+func lastPlaybackAt(data RedisRoomData) time.Time {
+	var last time.Time
+	if t, err := time.Parse(time.RFC3339Nano, data.PositionUpdatedAt); err == nil {
+		last = t
+	}
+	// update_song_at はサーバーのローカル時刻の YYYYMMDDHHmm 形式
+	if t, err := time.ParseInLocation("200601021504", data.UpdateSongAt, time.Local); err == nil && t.After(last) {
+		last = t
+	}
+	return last
+}
+
+func (r *roomLifecycleRepository) CloseRoom(roomID int, reason string, ttl time.Duration) (bool, error) {
+	ctx := context.Background()
+	key := fmt.Sprintf("room:%d", roomID)
+	state, err := r.RedisClient.Get(ctx, key).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return false, fmt.Errorf("failed to get room data from Redis: %w", err)
+	}
+
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// 同時に閉じようとした場合に二重に処理しないよう、開いている場合のみ更新する
+	result, err := tx.Exec(`UPDATE trx_rooms SET deleted_at = CURRENT_TIMESTAMP, closed_reason = ? WHERE room_id = ? AND deleted_at IS NULL`, reason, roomID)
+	if err != nil {
+		return false, fmt.Errorf("failed to close room: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		return false, err
+	}
+
+	var redisState interface{}
+	if state != "" {
+		redisState = state
+	}
+	archiveQuery := `
+        INSERT INTO trx_room_archives (room_id, redis_state, closed_reason) VALUES (?, ?, ?)
+        ON DUPLICATE KEY UPDATE redis_state = VALUES(redis_state), closed_reason = VALUES(closed_reason), closed_at = CURRENT_TIMESTAMP
+    `
+	if _, err := tx.Exec(archiveQuery, roomID, redisState, reason); err != nil {
+		return false, fmt.Errorf("failed to archive room state: %w", err)
+	}
+	if _, err := tx.Exec(`UPDATE trx_room_joins SET left_at = CURRENT_TIMESTAMP WHERE room_id = ? AND left_at IS NULL`, roomID); err != nil {
+		return false, fmt.Errorf("failed to close room joins: %w", err)
+	}
+	// 再生中だった曲は、開始からの経過時間（曲の長さまで）を再生時間とする
+	playsQuery := `
+        UPDATE trx_room_plays
+        SET ended_at = CURRENT_TIMESTAMP(3), outcome = 'stopped',
+            played_ms = IF(song_length > 0,
+                           LEAST(song_length, TIMESTAMPDIFF(MICROSECOND, started_at, CURRENT_TIMESTAMP(3)) DIV 1000),
+                           TIMESTAMPDIFF(MICROSECOND, started_at, CURRENT_TIMESTAMP(3)) DIV 1000)
+        WHERE room_id = ? AND ended_at IS NULL
+    `
+	if _, err := tx.Exec(playsQuery, roomID); err != nil {
+		return false, fmt.Errorf("failed to end room plays: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit room close: %w", err)
+	}
+
+	// 閉じた直後に接続しているクライアントが最終状態を読めるよう、すぐには消さずに期限を付ける（削除の場合はすぐに消す）
+	if ttl <= 0 {
+		if err := r.RedisClient.Del(ctx, key).Err(); err != nil {
+			return true, fmt.Errorf("failed to delete room data in Redis: %w", err)
+		}
+	} else if err := r.RedisClient.Expire(ctx, key, ttl).Err(); err != nil {
+		return true, fmt.Errorf("failed to expire room data in Redis: %w", err)
+	}
+	// チャットは trx_room_messages に残っているため、直近のメッセージの Stream は消してよい
+	if err := r.RedisClient.Del(ctx, fmt.Sprintf("room:%d:playback_sync", roomID), roomMessagesKey(roomID)).Err(); err != nil {
+		return true, fmt.Errorf("failed to delete playback sync users and recent messages: %w", err)
+	}
+	return true, nil
+}
+
+func (r *roomLifecycleRepository) RestoreRoom(roomID int) (bool, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// 閉じたときに全員退出しているため、参加者数は 0 から数え直す
+	result, err := tx.Exec(`UPDATE trx_rooms SET deleted_at = NULL, closed_reason = NULL, now_participants = 0 WHERE room_id = ? AND deleted_at IS NOT NULL`, roomID)
+	if err != nil {
+		return false, fmt.Errorf("failed to restore room: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		return false, err
+	}
+
+	var archived sql.NullString
+	err = tx.QueryRow(`SELECT redis_state FROM trx_room_archives WHERE room_id = ?`, roomID).Scan(&archived)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, fmt.Errorf("failed to get archived room state: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit room restore: %w", err)
+	}
+
+	// 保存していた状態がなければ、作成時と同じ初期状態にする
+	redisData := RedisRoomData{
+		RoomStatus:   "playing",
+		UpdateSongAt: time.Now().Format("200601021504"),
+	}
+	if archived.Valid {
+		if err := json.Unmarshal([]byte(archived.String), &redisData); err != nil {
+			return true, fmt.Errorf("failed to unmarshal archived room state: %w", err)
+		}
+	}
+	redisData.Participants = []RedisRoomParticipant{}
+	redisJSON, err := json.Marshal(redisData)
+	if err != nil {
+		return true, fmt.Errorf("failed to marshal Redis data: %w", err)
+	}
+	// 閉じたときに付けた有効期限は、上書きで解除される
+	if err := r.RedisClient.Set(context.Background(), fmt.Sprintf("room:%d", roomID), redisJSON, 0).Err(); err != nil {
+		return true, fmt.Errorf("failed to save room data to Redis: %w", err)
+	}
+	return true, nil
+}
+
+func (r *roomLifecycleRepository) GetRoomHostUserID(roomID int) (int, bool, error) {
+	var hostUserID int
+	err := r.DB.QueryRow(`SELECT host_user_id FROM trx_rooms WHERE room_id = ?`, roomID).Scan(&hostUserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to get room host: %w", err)
+	}
+	return hostUserID, true, nil
+}
@@ -0,0 +1,218 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RoomMessage は、ルーム内のチャットのメッセージです。
+type RoomMessage struct {
+	MessageID int64     `json:"messageId"`
+	RoomID    int       `json:"roomId"`
+	UserID    int       `json:"userId"`
+	UserName  string    `json:"userName"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type RoomMessageRepository interface {
+	// SaveMessage は、メッセージを MySQL に保存し、message_id を返します。
+	SaveMessage(message RoomMessage) (int64, error)
+	// GetMessage は、削除されていないメッセージを返します。ない場合は found=false を返します。
+	GetMessage(roomID int, messageID int64) (*RoomMessage, bool, error)
+	// ListMessages は、beforeID より前（0 なら最新から）の削除されていないメッセージを新しい順に最大 limit 件返します。
+	ListMessages(roomID int, beforeID int64, limit int) ([]RoomMessage, error)
+	// DeleteMessage は、メッセージを論理削除します。
+	DeleteMessage(messageID int64, deletedBy int) error
+	// AppendRecentMessage は、直近のメッセージの Stream にメッセージを追加し、おおよそ keep 件に切り詰めます。
+	AppendRecentMessage(message RoomMessage, keep int) error
+	// ListRecentMessages は、直近のメッセージの Stream の内容を新しい順に返します。
+	ListRecentMessages(roomID int) ([]RoomMessage, error)
+	// RemoveRecentMessage は、直近のメッセージの Stream からメッセージを取り除きます。
+	RemoveRecentMessage(roomID int, messageID int64) error
+	// ClearRecentMessages は、直近のメッセージの Stream を消します（以降は MySQL から読み、新しいメッセージから溜め直す）。
+	ClearRecentMessages(roomID int) error
+	// IncrementMessageCount は、window 内にユーザーが送信したメッセージの数をカウントアップし、現在の数を返します。
+	IncrementMessageCount(userID int, window time.Duration) (int64, error)
+}
+
+type roomMessageRepository struct {
+	DB          *sql.DB
+	RedisClient *redis.Client
+}
+
+func NewRoomMessageRepository(db *sql.DB, redisClient *redis.Client) RoomMessageRepository {
+	return &roomMessageRepository{DB: db, RedisClient: redisClient}
+}
+
+// roomMessagesKey は、ルームの直近のメッセージを保持する Stream のキーです。
+func roomMessagesKey(roomID int) string {
+	return fmt.Sprintf("room:%d:messages", roomID)
+}
+
+func (r *roomMessageRepository) SaveMessage(message RoomMessage) (int64, error) {
+	query := `INSERT INTO trx_room_messages (room_id, user_id, user_name, body, created_at) VALUES (?, ?, ?, ?, ?)`
+	result, err := r.DB.Exec(query, message.RoomID, message.UserID, message.UserName, message.Body, message.CreatedAt)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert room message: %w", err)
+	}
+	messageID, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get message id: %w", err)
+	}
+	return messageID, nil
+}
+
+func scanRoomMessage(scanner interface{ Scan(...interface{}) error }) (*RoomMessage, error) {
+	var message RoomMessage
+	if err := scanner.Scan(&message.MessageID, &message.RoomID, &message.UserID, &message.UserName, &message.Body, &message.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+func (r *roomMessageRepository) GetMessage(roomID int, messageID int64) (*RoomMessage, bool, error) {
+	query := `
+        SELECT message_id, room_id, user_id, user_name, body, created_at
+        FROM trx_room_messages
+        WHERE room_id = ? AND message_id = ? AND deleted_at IS NULL
+    `
+	message, err := scanRoomMessage(r.DB.QueryRow(query, roomID, messageID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get room message: %w", err)
+	}
+	return message, true, nil
+}
+
+func (r *roomMessageRepository) ListMessages(roomID int, beforeID int64, limit int) ([]RoomMessage, error) {
+	conditions := "room_id = ? AND deleted_at IS NULL"
+	args := []interface{}{roomID}
+	if beforeID > 0 {
+		conditions += " AND message_id < ?"
+		args = append(args, beforeID)
+	}
+	query := `
+        SELECT message_id, room_id, user_id, user_name, body, created_at
+        FROM trx_room_messages
+        WHERE ` + conditions + `
+        ORDER BY message_id DESC
+        LIMIT ?
+    `
+	args = append(args, limit)
+
+	rows, err := r.DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list room messages: %w", err)
+	}
+	defer rows.Close()
+
+	messages := []RoomMessage{}
+	for rows.Next() {
+		message, err := scanRoomMessage(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan room message: %w", err)
+		}
+		messages = append(messages, *message)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list room messages: %w", err)
+	}
+	return messages, nil
+}
+
+func (r *roomMessageRepository) DeleteMessage(messageID int64, deletedBy int) error {
+	query := `UPDATE trx_room_messages SET deleted_at = CURRENT_TIMESTAMP, deleted_by = ? WHERE message_id = ? AND deleted_at IS NULL`
+	if _, err := r.DB.Exec(query, deletedBy, messageID); err != nil {
+		return fmt.Errorf("failed to delete room message: %w", err)
+	}
+	return nil
+}
+
+func (r *roomMessageRepository) AppendRecentMessage(message RoomMessage, keep int) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to marshal room message: %w", err)
+	}
+	err = r.RedisClient.XAdd(context.Background(), &redis.XAddArgs{
+		Stream: roomMessagesKey(message.RoomID),
+		MaxLen: int64(keep),
+		Approx: true,
+		Values: map[string]interface{}{"message": data},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to append recent message: %w", err)
+	}
+	return nil
+}
+
+// readRecentMessages は、Stream の各エントリの ID とメッセージを新しい順に返します。
+func (r *roomMessageRepository) readRecentMessages(roomID int) ([]redis.XMessage, []RoomMessage, error) {
+	entries, err := r.RedisClient.XRevRange(context.Background(), roomMessagesKey(roomID), "+", "-").Result()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read recent messages: %w", err)
+	}
+	messages := make([]RoomMessage, 0, len(entries))
+	for _, entry := range entries {
+		data, _ := entry.Values["message"].(string)
+		var message RoomMessage
+		if err := json.Unmarshal([]byte(data), &message); err != nil {
+			return nil, nil, fmt.Errorf("failed to unmarshal recent message: %w", err)
+		}
+		messages = append(messages, message)
+	}
+	return entries, messages, nil
+}
+
+func (r *roomMessageRepository) ListRecentMessages(roomID int) ([]RoomMessage, error) {
+	_, messages, err := r.readRecentMessages(roomID)
+	return messages, err
+}
+
+func (r *roomMessageRepository) RemoveRecentMessage(roomID int, messageID int64) error {
+	entries, messages, err := r.readRecentMessages(roomID)
+	if err != nil {
+		return err
+	}
+	for i, message := range messages {
+		if message.MessageID != messageID {
+			continue
+		}
+		if err := r.RedisClient.XDel(context.Background(), roomMessagesKey(roomID), entries[i].ID).Err(); err != nil {
+			return fmt.Errorf("failed to remove recent message: %w", err)
+		}
+	}
+	return nil
+}
+
+func (r *roomMessageRepository) ClearRecentMessages(roomID int) error {
+	if err := r.RedisClient.Del(context.Background(), roomMessagesKey(roomID)).Err(); err != nil {
+		return fmt.Errorf("failed to clear recent messages: %w", err)
+	}
+	return nil
+}
+
+func (r *roomMessageRepository) IncrementMessageCount(userID int, window time.Duration) (int64, error) {
+	ctx := context.Background()
+	key := fmt.Sprintf("chat:count:%d", userID)
+
+	count, err := r.RedisClient.Incr(ctx, key).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to increment message count: %w", err)
+	}
+	// 最初の送信から window の間だけ数える
+	if count == 1 {
+		if err := r.RedisClient.Expire(ctx, key, window).Err(); err != nil {
+			return 0, fmt.Errorf("failed to set message count expiry: %w", err)
+		}
+	}
+	return count, nil
+}
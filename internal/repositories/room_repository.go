@@ -4,17 +4,27 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 )
 
+var (
+	// ErrRoomNotFound は、ルームが存在しない場合に返されます。
+	ErrRoomNotFound = errors.New("room not found")
+	// ErrRoomDeleted は、ルームが削除された（閉じられた）場合に返されます。
+	ErrRoomDeleted = errors.New("room has been deleted")
+)
+
 type RoomCreateInput struct {
 	RoomName            string          `json:"roomName"`
 	IsPublic            bool            `json:"isPublic"`
 	RoomPassword        *string         `json:"roomPassword"`
 	Genre               string          `json:"genre"`
+	Tags                []string        `json:"tags"`
 	MaxParticipants     int             `json:"maxParticipants"`
 	HostUserID          int             `json:"hostUserId"`
 	HostUserName        string          `json:"hostUserName"`
@@ -22,14 +32,19 @@ type RoomCreateInput struct {
 	PlayingSongName     string          `json:"playingSongName"`
 	PlayingSongIndex    int             `json:"playingSongIndex"`
 	Songs               map[string]Song `json:"songs"`
+	// ImportPlaylistID が指定された場合、Songs の代わりにホストの Spotify プレイリストから曲を取り込む
+	ImportPlaylistID string `json:"importPlaylistId"`
 }
 
 type Song struct {
-	SongId       string `json:"songId"`
+	SongId       string `json:"songId"` // Spotify の曲ID
 	SongName     string `json:"songName"`
 	Artist       string `json:"artist"`
-	SongLength   int    `json:"songLength"`
+	SongLength   int    `json:"songLength"` // ミリ秒
 	SongImageUrl string `json:"songImageUrl"`
+	ISRC         string `json:"isrc"`
+	// TrackID はプロバイダーに依存しない曲ID（providers.TrackID を参照）
+	TrackID string `json:"trackId"`
 }
 
 // RedisRoomParticipant はRedis内の参加者情報を表します
@@ -44,6 +59,17 @@ type RedisRoomData struct {
 	PlayingSongIndex int                    `json:"playing_song_index"`
 	UpdateSongAt     string                 `json:"update_song_at"`
 	Participants     []RedisRoomParticipant `json:"participants"`
+	// PositionMs は PositionUpdatedAt 時点の再生位置（ミリ秒）
+	PositionMs        int    `json:"position_ms"`
+	PositionUpdatedAt string `json:"position_updated_at"`
+}
+
+// PlaybackState は、ホストが変更するルームの再生状態です。
+type PlaybackState struct {
+	RoomStatus       string
+	PlayingSongIndex int
+	PlayingSongName  string
+	PositionMs       int
 }
 
 // RoomAllInfo はルーム情報を表します（MySQLとRedisのデータを統合）
@@ -63,14 +89,26 @@ type RoomAllInfo struct {
 	DeletedAt           sql.NullTime    `db:"deleted_at" json:"deletedAt"`
 	RedisData           RedisRoomData   `json:"redisData"` // Redisからの情報
 	Songs               map[string]Song `json:"songs"`     // 追加：曲情報。キーは song_index を文字列に変換したもの
+	Tags                []string        `json:"tags"`
 }
 
 type RoomRepository interface {
 	CreateRoom(input RoomCreateInput) (int, error)
 	JoinRoom(userID int, userName string, roomID int, roomPassword *string) error
 	LeaveRoom(userID int, roomID int) (*RoomAllInfo, error)
-	DeleteRoom(roomID int) error
+	// GetRoomByID は、ルームの詳細を返します。ない場合は ErrRoomNotFound、削除済みの場合は ErrRoomDeleted を返します。
 	GetRoomByID(roomID int) (*RoomAllInfo, error)
+	// GetStoredRoomByID は、削除済み（閉じた）ルームを含めて、MySQL に保存されたルームの詳細（曲・タグ）を返します。
+	// Redis のデータ（参加者・再生状態）は含みません。ない場合は ErrRoomNotFound を返します。
+	GetStoredRoomByID(roomID int) (*RoomAllInfo, error)
+	// ReplaceRoomSongs は、ルームの曲一覧を songs で置き換え、再生中のプレイリスト名と再生位置をリセットします。
+	ReplaceRoomSongs(roomID int, playlistName string, songs []Song) error
+	// UpdatePlaybackState は、ルームの再生状態を更新し、更新後の Redis データを返します。
+	UpdatePlaybackState(roomID int, state PlaybackState) (*RedisRoomData, error)
+	// SetPlaybackSync は、ユーザーの再生同期（自分のデバイスでの自動再生）の有効・無効を設定します。
+	SetPlaybackSync(roomID, userID int, enabled bool) error
+	// ListPlaybackSyncUsers は、再生同期を有効にしているユーザーIDを返します。
+	ListPlaybackSyncUsers(roomID int) ([]int, error)
 }
 
 type roomRepository struct {
@@ -141,16 +179,18 @@ func (r *roomRepository) CreateRoom(input RoomCreateInput) (int, error) {
 	for idx, song := range input.Songs {
 		insertSongQuery := `
             INSERT INTO trx_rooms_songs
-            (room_id, song_index, song_id, song_name, artist, song_length, song_image_url)
-            VALUES (?, ?, ?, ?, ?, ?, ?)
+            (room_id, song_index, song_id, isrc, track_id, song_name, artist, song_length, song_image_url)
+            VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
         `
 		if _, err := r.DB.Exec(insertSongQuery,
 			roomID,
 			idx, // songs のキー (何番目か)
 			song.SongId,
+			song.ISRC,
+			song.TrackID,
 			song.SongName,
 			song.Artist,
-			song.SongLength, // DB で timestamp 型の場合は必要に応じて変換
+			song.SongLength,
 			song.SongImageUrl,
 		); err != nil {
 			fmt.Println(err)
@@ -158,6 +198,17 @@ func (r *roomRepository) CreateRoom(input RoomCreateInput) (int, error) {
 		}
 	}
 
+	for _, tag := range input.Tags {
+		if _, err := r.DB.Exec(`INSERT IGNORE INTO trx_room_tags (room_id, tag) VALUES (?, ?)`, roomID, tag); err != nil {
+			return int(roomID), fmt.Errorf("failed to insert room tag: %w", err)
+		}
+	}
+
+	// ホストも参加履歴に含める
+	if err := r.recordJoin(int(roomID), input.HostUserID); err != nil {
+		return int(roomID), err
+	}
+
 	return int(roomID), nil
 }
 
@@ -167,16 +218,23 @@ func (r *roomRepository) JoinRoom(userID int, userName string, roomID int, roomP
 	var room RoomAllInfo
 	query := `
         SELECT room_id, room_name, is_public, genre, max_participants, now_participants, 
-               host_user_id, host_user_name, playing_playlist_name, playing_song_name 
-        FROM trx_rooms 
+               host_user_id, host_user_name, playing_playlist_name, playing_song_name, deleted_at
+        FROM trx_rooms
         WHERE room_id = ?`
 	err := r.DB.QueryRow(query, roomID).Scan(
 		&room.RoomID, &room.RoomName, &room.IsPublic, &room.Genre, &room.MaxParticipants, &room.NowParticipants,
-		&room.HostUserID, &room.HostUserName, &room.PlayingPlaylistName, &room.PlayingSongName,
+		&room.HostUserID, &room.HostUserName, &room.PlayingPlaylistName, &room.PlayingSongName, &room.DeletedAt,
 	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrRoomNotFound
+	}
 	if err != nil {
 		return fmt.Errorf("failed to get room: %w", err)
 	}
+	// 削除されたルームには参加できない
+	if room.DeletedAt.Valid {
+		return ErrRoomDeleted
+	}
 
 	// 2. 参加人数が上限に達していないか確認
 	if room.NowParticipants >= room.MaxParticipants {
@@ -218,6 +276,15 @@ func (r *roomRepository) JoinRoom(userID int, userName string, roomID int, roomP
 		return fmt.Errorf("failed to update participants in MySQL: %w", err)
 	}
 
+	// 7. 参加履歴を記録
+	return r.recordJoin(roomID, userID)
+}
+
+func (r *roomRepository) recordJoin(roomID, userID int) error {
+	query := `INSERT INTO trx_room_joins (room_id, user_id) VALUES (?, ?)`
+	if _, err := r.DB.Exec(query, roomID, userID); err != nil {
+		return fmt.Errorf("failed to record room join: %w", err)
+	}
 	return nil
 }
 
@@ -225,6 +292,17 @@ func (r *roomRepository) JoinRoom(userID int, userName string, roomID int, roomP
 func (r *roomRepository) LeaveRoom(userID int, roomID int) (*RoomAllInfo, error) {
 	var room RoomAllInfo
 
+	// 1. 削除されたルームの参加者は、削除時に退出済みになっている
+	if err := r.DB.QueryRow(`SELECT deleted_at FROM trx_rooms WHERE room_id = ?`, roomID).Scan(&room.DeletedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRoomNotFound
+		}
+		return nil, fmt.Errorf("failed to get room: %w", err)
+	}
+	if room.DeletedAt.Valid {
+		return nil, ErrRoomDeleted
+	}
+
 	// 2. Redisからルームデータ（参加者リストなど）を取得
 	ctx := context.Background()
 	key := fmt.Sprintf("room:%d", roomID)
@@ -240,11 +318,18 @@ func (r *roomRepository) LeaveRoom(userID int, roomID int) (*RoomAllInfo, error)
 	// 3. 自分の参加者データを削除（ユーザーIDは文字列に変換）
 	userIDStr := fmt.Sprintf("%d", userID)
 	newParticipants := make([]RedisRoomParticipant, 0)
+	joined := false
 	for _, participant := range redisData.Participants {
 		if participant.UserID != userIDStr {
 			newParticipants = append(newParticipants, participant)
+		} else {
+			joined = true
 		}
 	}
+	// 参加していないユーザーの退出（二重送信など）では参加者数や参加履歴を変えない
+	if !joined {
+		return &room, nil
+	}
 	redisData.Participants = newParticipants
 
 	// 4. Redisに更新されたデータを保存
@@ -256,42 +341,30 @@ func (r *roomRepository) LeaveRoom(userID int, roomID int) (*RoomAllInfo, error)
 		return nil, fmt.Errorf("failed to update room data in Redis: %w", err)
 	}
 
-	// 5. MySQLの参加者数(now_participants)を -1 し、deleted_at に現在のタイムスタンプを記録する
-	updateQuery := `UPDATE trx_rooms SET now_participants = now_participants - 1 WHERE room_id = ?`
+	// 5. MySQLの参加者数(now_participants)を -1 する（0 未満にはしない）
+	updateQuery := `UPDATE trx_rooms SET now_participants = IF(now_participants > 0, now_participants - 1, 0) WHERE room_id = ?`
 	if _, err = r.DB.Exec(updateQuery, roomID); err != nil {
 		return nil, fmt.Errorf("failed to update participants in MySQL: %w", err)
 	}
 
-	return &room, nil
-}
-
-func (r *roomRepository) DeleteRoom(roomID int) error {
-	now := time.Now()
-	updateQuery := `UPDATE trx_rooms SET deleted_at = ? WHERE room_id = ?`
-	_, err := r.DB.Exec(updateQuery, now, roomID)
-	if err != nil {
-		return fmt.Errorf("failed to delete room: %w", err)
+	// 6. 参加履歴に退出時刻を記録
+	leaveQuery := `UPDATE trx_room_joins SET left_at = CURRENT_TIMESTAMP WHERE room_id = ? AND user_id = ? AND left_at IS NULL`
+	if _, err = r.DB.Exec(leaveQuery, roomID, userID); err != nil {
+		return nil, fmt.Errorf("failed to record room leave: %w", err)
 	}
-	return nil
+
+	return &room, nil
 }
 
 // GetRoomByID はroomIDからMySQLとRedisの情報を統合して部屋の詳細情報を取得します。
 func (r *roomRepository) GetRoomByID(roomID int) (*RoomAllInfo, error) {
-	var room RoomAllInfo
-
-	// MySQLから部屋の詳細情報を取得
-	query := `
-        SELECT room_id, room_name, is_public, genre, playing_playlist_name, playing_song_name,
-               max_participants, now_participants, host_user_id, host_user_name, created_at
-        FROM trx_rooms 
-        WHERE room_id = ?`
-	err := r.DB.QueryRow(query, roomID).Scan(
-		&room.RoomID, &room.RoomName, &room.IsPublic, &room.Genre,
-		&room.PlayingPlaylistName, &room.PlayingSongName, &room.MaxParticipants,
-		&room.NowParticipants, &room.HostUserID, &room.HostUserName, &room.CreateAt,
-	)
+	room, err := r.getRoomRow(roomID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get room from MySQL: %w", err)
+		return nil, err
+	}
+	// 削除されたルームは Redis のデータも消えているため、存在しないルームと区別して返す
+	if room.DeletedAt.Valid {
+		return nil, ErrRoomDeleted
 	}
 
 	// Redisから部屋データ（参加者リストなど）を取得
@@ -307,16 +380,59 @@ func (r *roomRepository) GetRoomByID(roomID int) (*RoomAllInfo, error) {
 	}
 	room.RedisData = redisData
 
+	if err := r.loadRoomSongsAndTags(room); err != nil {
+		return nil, err
+	}
+	return room, nil
+}
+
+func (r *roomRepository) GetStoredRoomByID(roomID int) (*RoomAllInfo, error) {
+	room, err := r.getRoomRow(roomID)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.loadRoomSongsAndTags(room); err != nil {
+		return nil, err
+	}
+	return room, nil
+}
+
+// getRoomRow は、trx_rooms の行を（削除済みでも）返します。ない場合は ErrRoomNotFound を返します。
+func (r *roomRepository) getRoomRow(roomID int) (*RoomAllInfo, error) {
+	var room RoomAllInfo
+
+	// MySQLから部屋の詳細情報を取得
+	query := `
+        SELECT room_id, room_name, is_public, genre, playing_playlist_name, playing_song_name,
+               max_participants, now_participants, host_user_id, host_user_name, created_at, deleted_at
+        FROM trx_rooms
+        WHERE room_id = ?`
+	err := r.DB.QueryRow(query, roomID).Scan(
+		&room.RoomID, &room.RoomName, &room.IsPublic, &room.Genre,
+		&room.PlayingPlaylistName, &room.PlayingSongName, &room.MaxParticipants,
+		&room.NowParticipants, &room.HostUserID, &room.HostUserName, &room.CreateAt, &room.DeletedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrRoomNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get room from MySQL: %w", err)
+	}
+	return &room, nil
+}
+
+// loadRoomSongsAndTags は、ルームの曲とタグを読み込みます。
+func (r *roomRepository) loadRoomSongsAndTags(room *RoomAllInfo) error {
 	// trx_rooms_songs から指定された roomID の曲情報を取得
 	songsQuery := `
-        SELECT song_index, song_id, song_name, artist, song_length, song_image_url 
+        SELECT song_index, song_id, isrc, track_id, song_name, artist, song_length, song_image_url 
         FROM trx_rooms_songs 
         WHERE room_id = ?
         ORDER BY song_index ASC
     `
-	rows, err := r.DB.Query(songsQuery, roomID)
+	rows, err := r.DB.Query(songsQuery, room.RoomID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get songs: %w", err)
+		return fmt.Errorf("failed to get songs: %w", err)
 	}
 	defer rows.Close()
 
@@ -324,12 +440,169 @@ func (r *roomRepository) GetRoomByID(roomID int) (*RoomAllInfo, error) {
 	for rows.Next() {
 		var songIndex int
 		var song Song
-		if err := rows.Scan(&songIndex, &song.SongId, &song.SongName, &song.Artist, &song.SongLength, &song.SongImageUrl); err != nil {
-			return nil, fmt.Errorf("failed to scan song: %w", err)
+		if err := rows.Scan(&songIndex, &song.SongId, &song.ISRC, &song.TrackID, &song.SongName, &song.Artist, &song.SongLength, &song.SongImageUrl); err != nil {
+			return fmt.Errorf("failed to scan song: %w", err)
 		}
 		songs[fmt.Sprintf("%d", songIndex)] = song
 	}
 	room.Songs = songs
 
-	return &room, nil
+	tags, err := r.getRoomTags(room.RoomID)
+	if err != nil {
+		return err
+	}
+	room.Tags = tags
+	return nil
+}
+
+func (r *roomRepository) getRoomTags(roomID int) ([]string, error) {
+	rows, err := r.DB.Query(`SELECT tag FROM trx_room_tags WHERE room_id = ? ORDER BY created_at ASC, tag ASC`, roomID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get room tags: %w", err)
+	}
+	defer rows.Close()
+
+	tags := []string{}
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, fmt.Errorf("failed to scan room tag: %w", err)
+		}
+		tags = append(tags, tag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get room tags: %w", err)
+	}
+	return tags, nil
+}
+
+func (r *roomRepository) ReplaceRoomSongs(roomID int, playlistName string, songs []Song) error {
+	playingSongName := ""
+	if len(songs) > 0 {
+		playingSongName = songs[0].SongName
+	}
+
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM trx_rooms_songs WHERE room_id = ?`, roomID); err != nil {
+		return fmt.Errorf("failed to delete room songs: %w", err)
+	}
+
+	insertSongQuery := `
+        INSERT INTO trx_rooms_songs
+        (room_id, song_index, song_id, isrc, track_id, song_name, artist, song_length, song_image_url)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+    `
+	for idx, song := range songs {
+		if _, err := tx.Exec(insertSongQuery, roomID, idx, song.SongId, song.ISRC, song.TrackID, song.SongName, song.Artist, song.SongLength, song.SongImageUrl); err != nil {
+			return fmt.Errorf("failed to insert room song: %w", err)
+		}
+	}
+
+	updateQuery := `UPDATE trx_rooms SET playing_playlist_name = ?, playing_song_name = ? WHERE room_id = ?`
+	if _, err := tx.Exec(updateQuery, playlistName, playingSongName, roomID); err != nil {
+		return fmt.Errorf("failed to update playing playlist: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit room songs: %w", err)
+	}
+
+	// 曲順が変わるため、Redis の再生位置を先頭に戻す
+	ctx := context.Background()
+	key := fmt.Sprintf("room:%d", roomID)
+	val, err := r.RedisClient.Get(ctx, key).Result()
+	if err != nil {
+		return fmt.Errorf("failed to get room data from Redis: %w", err)
+	}
+	var redisData RedisRoomData
+	if err = json.Unmarshal([]byte(val), &redisData); err != nil {
+		return fmt.Errorf("failed to unmarshal Redis data: %w", err)
+	}
+	redisData.PlayingSongIndex = 0
+	redisData.UpdateSongAt = time.Now().Format("200601021504") // YYYYMMDDHHmm形式
+	updatedRedisJSON, err := json.Marshal(redisData)
+	if err != nil {
+		return fmt.Errorf("failed to marshal updated Redis data: %w", err)
+	}
+	if err = r.RedisClient.Set(ctx, key, updatedRedisJSON, 0).Err(); err != nil {
+		return fmt.Errorf("failed to update room data in Redis: %w", err)
+	}
+	return nil
+}
+
+func (r *roomRepository) UpdatePlaybackState(roomID int, state PlaybackState) (*RedisRoomData, error) {
+	ctx := context.Background()
+	key := fmt.Sprintf("room:%d", roomID)
+	val, err := r.RedisClient.Get(ctx, key).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get room data from Redis: %w", err)
+	}
+	var redisData RedisRoomData
+	if err = json.Unmarshal([]byte(val), &redisData); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal Redis data: %w", err)
+	}
+
+	now := time.Now()
+	songChanged := redisData.PlayingSongIndex != state.PlayingSongIndex
+	if songChanged {
+		redisData.UpdateSongAt = now.Format("200601021504") // YYYYMMDDHHmm形式
+	}
+	redisData.RoomStatus = state.RoomStatus
+	redisData.PlayingSongIndex = state.PlayingSongIndex
+	redisData.PositionMs = state.PositionMs
+	redisData.PositionUpdatedAt = now.Format(time.RFC3339Nano)
+
+	updatedRedisJSON, err := json.Marshal(redisData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal updated Redis data: %w", err)
+	}
+	if err = r.RedisClient.Set(ctx, key, updatedRedisJSON, 0).Err(); err != nil {
+		return nil, fmt.Errorf("failed to update room data in Redis: %w", err)
+	}
+
+	if songChanged {
+		updateQuery := `UPDATE trx_rooms SET playing_song_name = ? WHERE room_id = ?`
+		if _, err := r.DB.Exec(updateQuery, state.PlayingSongName, roomID); err != nil {
+			return nil, fmt.Errorf("failed to update playing song: %w", err)
+		}
+	}
+	return &redisData, nil
+}
+
+func (r *roomRepository) SetPlaybackSync(roomID, userID int, enabled bool) error {
+	ctx := context.Background()
+	key := fmt.Sprintf("room:%d:playback_sync", roomID)
+	var err error
+	if enabled {
+		err = r.RedisClient.SAdd(ctx, key, userID).Err()
+	} else {
+		err = r.RedisClient.SRem(ctx, key, userID).Err()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update playback sync: %w", err)
+	}
+	return nil
+}
+
+func (r *roomRepository) ListPlaybackSyncUsers(roomID int) ([]int, error) {
+	ctx := context.Background()
+	key := fmt.Sprintf("room:%d:playback_sync", roomID)
+	members, err := r.RedisClient.SMembers(ctx, key).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get playback sync users: %w", err)
+	}
+	userIDs := make([]int, 0, len(members))
+	for _, member := range members {
+		userID, err := strconv.Atoi(member)
+		if err != nil {
+			continue
+		}
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs, nil
 }
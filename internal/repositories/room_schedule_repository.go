@@ -0,0 +1,288 @@
+package repositories
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// 予約したルームの状態（trx_room_schedules.status）
+const (
+	RoomScheduleScheduled = "scheduled"
+	RoomScheduleOpened    = "opened"
+	RoomScheduleCancelled = "cancelled"
+)
+
+// RoomSchedule は、開始時刻を予約したルームです。
+type RoomSchedule struct {
+	ScheduleID      int      `json:"scheduleId"`
+	HostUserID      int      `json:"hostUserId"`
+	HostUserName    string   `json:"hostUserName"`
+	RoomName        string   `json:"roomName"`
+	IsPublic        bool     `json:"isPublic"`
+	Genre           string   `json:"genre"`
+	Tags            []string `json:"tags"`
+	MaxParticipants int      `json:"maxParticipants"`
+	// Input は開始時刻に作成するルームの内容（パスワードを含むためレスポンスには含めない）
+	Input RoomCreateInput `json:"-"`
+	// StartsAt は次の回の開始時刻
+	StartsAt        time.Time  `json:"startsAt"`
+	Recurrence      string     `json:"recurrence"`
+	RecurrenceUntil *time.Time `json:"recurrenceUntil"`
+	Status          string     `json:"status"`
+	// LastRoomID は最後に開いたルーム（まだ開いていなければ null）
+	LastRoomID *int `json:"lastRoomId"`
+	// RSVPCount は次の回に参加表明したユーザー数、RSVPed はリクエストしたユーザーが参加表明しているか
+	RSVPCount int  `json:"rsvpCount"`
+	RSVPed    bool `json:"rsvped"`
+}
+
+// RSVPUser は、参加表明したユーザーの通知先です。
+type RSVPUser struct {
+	UserID   int
+	UserName string
+	Email    string
+}
+
+type RoomScheduleRepository interface {
+	// CreateSchedule は、ルームの予約を保存して schedule_id を返します。
+	CreateSchedule(schedule RoomSchedule) (int, error)
+	// GetSchedule は、予約を返します（RSVPCount・RSVPed は userID から見た値）。ない場合は found=false を返します。
+	GetSchedule(scheduleID, userID int) (*RoomSchedule, bool, error)
+	// ListUpcomingSchedules は、開始待ちの予約のうち公開のものと userID がホストのものを、開始時刻の早い順に最大 limit 件返します。
+	ListUpcomingSchedules(userID int, limit int) ([]RoomSchedule, error)
+	// ListDueSchedules は、開始時刻が now 以前の開始待ちの予約を最大 limit 件返します。
+	ListDueSchedules(now time.Time, limit int) ([]RoomSchedule, error)
+	// ClaimOccurrence は、startsAt の回を開く権利を取得します。next が nil なら予約を "opened" にし、そうでなければ starts_at を next に進めます。
+	// 他の処理が先に取得していた場合は false を返します。
+	ClaimOccurrence(scheduleID int, startsAt time.Time, next *time.Time) (bool, error)
+	// ReleaseOccurrence は、ClaimOccurrence を取り消して startsAt の回を開始待ちに戻します（ルームの作成に失敗した場合）。
+	ReleaseOccurrence(scheduleID int, startsAt time.Time, next *time.Time) error
+	// RecordOpenedRoom は、予約から開いたルームを記録します。
+	RecordOpenedRoom(scheduleID, roomID int) error
+	// CancelSchedule は、開始待ちの予約を取り消します。
+	CancelSchedule(scheduleID int) error
+	// AddRSVP・RemoveRSVP は、startsAt の回への参加表明を記録・取り消します。
+	AddRSVP(scheduleID int, startsAt time.Time, userID int) error
+	RemoveRSVP(scheduleID int, startsAt time.Time, userID int) error
+	// ListRSVPUsers は、startsAt の回に参加表明したユーザーを返します。
+	ListRSVPUsers(scheduleID int, startsAt time.Time) ([]RSVPUser, error)
+}
+
+type roomScheduleRepository struct {
+	DB *sql.DB
+}
+
+func NewRoomScheduleRepository(db *sql.DB) RoomScheduleRepository {
+	return &roomScheduleRepository{DB: db}
+}
+
+func (r *roomScheduleRepository) CreateSchedule(schedule RoomSchedule) (int, error) {
+	input, err := json.Marshal(schedule.Input)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal room input: %w", err)
+	}
+	query := `
+        INSERT INTO trx_room_schedules
+        (host_user_id, host_user_name, room_name, is_public, genre, max_participants, room_input, starts_at, recurrence, recurrence_until, status)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+    `
+	result, err := r.DB.Exec(query,
+		schedule.HostUserID, schedule.HostUserName, schedule.RoomName, schedule.IsPublic, schedule.Genre, schedule.MaxParticipants,
+		input, schedule.StartsAt, schedule.Recurrence, schedule.RecurrenceUntil, RoomScheduleScheduled,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert room schedule: %w", err)
+	}
+	scheduleID, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get schedule id: %w", err)
+	}
+	return int(scheduleID), nil
+}
+
+// roomScheduleColumns は、scanRoomSchedule で読み取る列です。引数は RSVP したかを調べる user_id。
+const roomScheduleColumns = `
+        s.schedule_id, s.host_user_id, s.host_user_name, s.room_name, s.is_public, s.genre, s.max_participants, s.room_input,
+        s.starts_at, s.recurrence, s.recurrence_until, s.status, s.last_room_id,
+        (SELECT COUNT(*) FROM trx_room_schedule_rsvps v WHERE v.schedule_id = s.schedule_id AND v.starts_at = s.starts_at),
+        EXISTS (SELECT 1 FROM trx_room_schedule_rsvps v WHERE v.schedule_id = s.schedule_id AND v.starts_at = s.starts_at AND v.user_id = ?)`
+
+func scanRoomSchedule(scanner interface{ Scan(...interface{}) error }) (*RoomSchedule, error) {
+	var schedule RoomSchedule
+	var input []byte
+	var recurrenceUntil sql.NullTime
+	var lastRoomID sql.NullInt64
+	if err := scanner.Scan(
+		&schedule.ScheduleID, &schedule.HostUserID, &schedule.HostUserName, &schedule.RoomName, &schedule.IsPublic, &schedule.Genre,
+		&schedule.MaxParticipants, &input, &schedule.StartsAt, &schedule.Recurrence, &recurrenceUntil, &schedule.Status, &lastRoomID,
+		&schedule.RSVPCount, &schedule.RSVPed,
+	); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(input, &schedule.Input); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal room input: %w", err)
+	}
+	schedule.Tags = schedule.Input.Tags
+	if schedule.Tags == nil {
+		schedule.Tags = []string{}
+	}
+	if recurrenceUntil.Valid {
+		schedule.RecurrenceUntil = &recurrenceUntil.Time
+	}
+	if lastRoomID.Valid {
+		roomID := int(lastRoomID.Int64)
+		schedule.LastRoomID = &roomID
+	}
+	return &schedule, nil
+}
+
+func (r *roomScheduleRepository) GetSchedule(scheduleID, userID int) (*RoomSchedule, bool, error) {
+	query := `SELECT` + roomScheduleColumns + `
+        FROM trx_room_schedules s
+        WHERE s.schedule_id = ?
+    `
+	schedule, err := scanRoomSchedule(r.DB.QueryRow(query, userID, scheduleID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get room schedule: %w", err)
+	}
+	return schedule, true, nil
+}
+
+func (r *roomScheduleRepository) ListUpcomingSchedules(userID int, limit int) ([]RoomSchedule, error) {
+	query := `SELECT` + roomScheduleColumns + `
+        FROM trx_room_schedules s
+        WHERE s.status = ? AND (s.is_public = TRUE OR s.host_user_id = ?)
+        ORDER BY s.starts_at ASC, s.schedule_id ASC
+        LIMIT ?
+    `
+	return r.listSchedules(query, userID, RoomScheduleScheduled, userID, limit)
+}
+
+func (r *roomScheduleRepository) ListDueSchedules(now time.Time, limit int) ([]RoomSchedule, error) {
+	query := `SELECT` + roomScheduleColumns + `
+        FROM trx_room_schedules s
+        WHERE s.status = ? AND s.starts_at <= ?
+        ORDER BY s.starts_at ASC, s.schedule_id ASC
+        LIMIT ?
+    `
+	return r.listSchedules(query, 0, RoomScheduleScheduled, now, limit)
+}
+
+func (r *roomScheduleRepository) listSchedules(query string, args ...interface{}) ([]RoomSchedule, error) {
+	rows, err := r.DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list room schedules: %w", err)
+	}
+	defer rows.Close()
+
+	schedules := []RoomSchedule{}
+	for rows.Next() {
+		schedule, err := scanRoomSchedule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan room schedule: %w", err)
+		}
+		schedules = append(schedules, *schedule)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list room schedules: %w", err)
+	}
+	return schedules, nil
+}
+
+func (r *roomScheduleRepository) ClaimOccurrence(scheduleID int, startsAt time.Time, next *time.Time) (bool, error) {
+	query := `
+        UPDATE trx_room_schedules
+        SET starts_at = COALESCE(?, starts_at), status = IF(? IS NULL, ?, status), last_opened_at = CURRENT_TIMESTAMP
+        WHERE schedule_id = ? AND starts_at = ? AND status = ?
+    `
+	result, err := r.DB.Exec(query, next, next, RoomScheduleOpened, scheduleID, startsAt, RoomScheduleScheduled)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim room schedule: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to claim room schedule: %w", err)
+	}
+	return affected == 1, nil
+}
+
+func (r *roomScheduleRepository) ReleaseOccurrence(scheduleID int, startsAt time.Time, next *time.Time) error {
+	query := `
+        UPDATE trx_room_schedules
+        SET starts_at = ?, status = ?
+        WHERE schedule_id = ? AND starts_at = COALESCE(?, ?) AND status = IF(? IS NULL, ?, ?)
+    `
+	if _, err := r.DB.Exec(query,
+		startsAt, RoomScheduleScheduled,
+		scheduleID, next, startsAt, next, RoomScheduleOpened, RoomScheduleScheduled,
+	); err != nil {
+		return fmt.Errorf("failed to release room schedule: %w", err)
+	}
+	return nil
+}
+
+func (r *roomScheduleRepository) RecordOpenedRoom(scheduleID, roomID int) error {
+	query := `UPDATE trx_room_schedules SET last_room_id = ? WHERE schedule_id = ?`
+	if _, err := r.DB.Exec(query, roomID, scheduleID); err != nil {
+		return fmt.Errorf("failed to record opened room: %w", err)
+	}
+	return nil
+}
+
+func (r *roomScheduleRepository) CancelSchedule(scheduleID int) error {
+	query := `UPDATE trx_room_schedules SET status = ? WHERE schedule_id = ? AND status = ?`
+	if _, err := r.DB.Exec(query, RoomScheduleCancelled, scheduleID, RoomScheduleScheduled); err != nil {
+		return fmt.Errorf("failed to cancel room schedule: %w", err)
+	}
+	return nil
+}
+
+func (r *roomScheduleRepository) AddRSVP(scheduleID int, startsAt time.Time, userID int) error {
+	query := `INSERT IGNORE INTO trx_room_schedule_rsvps (schedule_id, starts_at, user_id) VALUES (?, ?, ?)`
+	if _, err := r.DB.Exec(query, scheduleID, startsAt, userID); err != nil {
+		return fmt.Errorf("failed to add rsvp: %w", err)
+	}
+	return nil
+}
+
+func (r *roomScheduleRepository) RemoveRSVP(scheduleID int, startsAt time.Time, userID int) error {
+	query := `DELETE FROM trx_room_schedule_rsvps WHERE schedule_id = ? AND starts_at = ? AND user_id = ?`
+	if _, err := r.DB.Exec(query, scheduleID, startsAt, userID); err != nil {
+		return fmt.Errorf("failed to remove rsvp: %w", err)
+	}
+	return nil
+}
+
+func (r *roomScheduleRepository) ListRSVPUsers(scheduleID int, startsAt time.Time) ([]RSVPUser, error) {
+	query := `
+        SELECT u.user_id, u.user_name, u.email
+        FROM trx_room_schedule_rsvps v
+        JOIN trx_users u ON u.user_id = v.user_id AND u.deleted_at IS NULL
+        WHERE v.schedule_id = ? AND v.starts_at = ?
+        ORDER BY v.created_at ASC, u.user_id ASC
+    `
+	rows, err := r.DB.Query(query, scheduleID, startsAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rsvp users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []RSVPUser
+	for rows.Next() {
+		var user RSVPUser
+		if err := rows.Scan(&user.UserID, &user.UserName, &user.Email); err != nil {
+			return nil, fmt.Errorf("failed to scan rsvp user: %w", err)
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list rsvp users: %w", err)
+	}
+	return users, nil
+}
@@ -0,0 +1,246 @@
+package repositories
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// RoomTemplate は、保存したルームの設定です。既存のルームを複製するときの設定の読み込みにも使う。
+type RoomTemplate struct {
+	TemplateID int `json:"templateId"`
+	// UserID はテンプレートの持ち主（ルームから読み込んだ場合はホスト）
+	UserID       int    `json:"userId"`
+	TemplateName string `json:"templateName"`
+	RoomName     string `json:"roomName"`
+	IsPublic     bool   `json:"isPublic"`
+	// PasswordRequired は、ルーム作成時にパスワードの指定が必要か（パスワードそのものは保存しない）
+	PasswordRequired    bool      `json:"passwordRequired"`
+	Genre               string    `json:"genre"`
+	Tags                []string  `json:"tags"`
+	MaxParticipants     int       `json:"maxParticipants"`
+	HostUserName        string    `json:"hostUserName"`
+	PlayingPlaylistName string    `json:"playingPlaylistName"`
+	SongCount           int       `json:"songCount"`
+	CreatedAt           time.Time `json:"createdAt"`
+	// Songs は曲順。一覧では読み込まない
+	Songs []Song `json:"songs,omitempty"`
+}
+
+type RoomTemplateRepository interface {
+	// CreateTemplate は、テンプレートを曲一覧とあわせて保存し、template_id を返します。
+	CreateTemplate(template RoomTemplate) (int, error)
+	// ListTemplates は、ユーザーのテンプレートを新しい順に返します（曲一覧は含まない）。
+	ListTemplates(userID int) ([]RoomTemplate, error)
+	// GetTemplate は、曲一覧を含むテンプレートを返します。ない場合は found=false を返します。
+	GetTemplate(templateID int) (*RoomTemplate, bool, error)
+	// DeleteTemplate は、テンプレートを論理削除します。
+	DeleteTemplate(templateID int) error
+	// GetRoomAsTemplate は、ルーム（閉じたものを含む）の設定と曲一覧（trx_rooms_songs）を返します。ない場合は found=false を返します。
+	GetRoomAsTemplate(roomID int) (*RoomTemplate, bool, error)
+}
+
+type roomTemplateRepository struct {
+	DB *sql.DB
+}
+
+func NewRoomTemplateRepository(db *sql.DB) RoomTemplateRepository {
+	return &roomTemplateRepository{DB: db}
+}
+
+func (r *roomTemplateRepository) CreateTemplate(template RoomTemplate) (int, error) {
+	tags, err := json.Marshal(template.Tags)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal tags: %w", err)
+	}
+
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+        INSERT INTO trx_room_templates
+        (user_id, template_name, room_name, is_public, password_required, genre, tags, max_participants, host_user_name, playing_playlist_name)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+    `
+	result, err := tx.Exec(query,
+		template.UserID, template.TemplateName, template.RoomName, template.IsPublic, template.PasswordRequired,
+		template.Genre, tags, template.MaxParticipants, template.HostUserName, template.PlayingPlaylistName,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert room template: %w", err)
+	}
+	templateID, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get template id: %w", err)
+	}
+
+	insertSongQuery := `
+        INSERT INTO trx_room_template_songs
+        (template_id, song_index, song_id, isrc, track_id, song_name, artist, song_length, song_image_url)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+    `
+	for idx, song := range template.Songs {
+		if _, err := tx.Exec(insertSongQuery, templateID, idx, song.SongId, song.ISRC, song.TrackID, song.SongName, song.Artist, song.SongLength, song.SongImageUrl); err != nil {
+			return 0, fmt.Errorf("failed to insert template song: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit room template: %w", err)
+	}
+	return int(templateID), nil
+}
+
+const roomTemplateColumns = `
+        t.template_id, t.user_id, t.template_name, t.room_name, t.is_public, t.password_required, t.genre, t.tags,
+        t.max_participants, t.host_user_name, t.playing_playlist_name, t.created_at,
+        (SELECT COUNT(*) FROM trx_room_template_songs s WHERE s.template_id = t.template_id)`
+
+func scanRoomTemplate(scanner interface{ Scan(...interface{}) error }) (*RoomTemplate, error) {
+	var template RoomTemplate
+	var tags []byte
+	if err := scanner.Scan(
+		&template.TemplateID, &template.UserID, &template.TemplateName, &template.RoomName, &template.IsPublic, &template.PasswordRequired,
+		&template.Genre, &tags, &template.MaxParticipants, &template.HostUserName, &template.PlayingPlaylistName, &template.CreatedAt,
+		&template.SongCount,
+	); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(tags, &template.Tags); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal tags: %w", err)
+	}
+	if template.Tags == nil {
+		template.Tags = []string{}
+	}
+	return &template, nil
+}
+
+func (r *roomTemplateRepository) ListTemplates(userID int) ([]RoomTemplate, error) {
+	query := `SELECT` + roomTemplateColumns + `
+        FROM trx_room_templates t
+        WHERE t.user_id = ? AND t.deleted_at IS NULL
+        ORDER BY t.created_at DESC, t.template_id DESC
+    `
+	rows, err := r.DB.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list room templates: %w", err)
+	}
+	defer rows.Close()
+
+	templates := []RoomTemplate{}
+	for rows.Next() {
+		template, err := scanRoomTemplate(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan room template: %w", err)
+		}
+		templates = append(templates, *template)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list room templates: %w", err)
+	}
+	return templates, nil
+}
+
+func (r *roomTemplateRepository) GetTemplate(templateID int) (*RoomTemplate, bool, error) {
+	query := `SELECT` + roomTemplateColumns + `
+        FROM trx_room_templates t
+        WHERE t.template_id = ? AND t.deleted_at IS NULL
+    `
+	template, err := scanRoomTemplate(r.DB.QueryRow(query, templateID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get room template: %w", err)
+	}
+
+	songsQuery := `
+        SELECT song_id, isrc, track_id, song_name, artist, song_length, song_image_url
+        FROM trx_room_template_songs
+        WHERE template_id = ?
+        ORDER BY song_index ASC
+    `
+	if template.Songs, err = r.listSongs(songsQuery, templateID); err != nil {
+		return nil, false, fmt.Errorf("failed to get template songs: %w", err)
+	}
+	return template, true, nil
+}
+
+func (r *roomTemplateRepository) DeleteTemplate(templateID int) error {
+	query := `UPDATE trx_room_templates SET deleted_at = CURRENT_TIMESTAMP WHERE template_id = ? AND deleted_at IS NULL`
+	if _, err := r.DB.Exec(query, templateID); err != nil {
+		return fmt.Errorf("failed to delete room template: %w", err)
+	}
+	return nil
+}
+
+func (r *roomTemplateRepository) GetRoomAsTemplate(roomID int) (*RoomTemplate, bool, error) {
+	template := RoomTemplate{Tags: []string{}}
+	query := `
+        SELECT room_name, is_public, COALESCE(room_password, '') <> '', COALESCE(genre, ''), max_participants,
+               host_user_id, host_user_name, COALESCE(playing_playlist_name, ''), created_at
+        FROM trx_rooms
+        WHERE room_id = ?
+    `
+	err := r.DB.QueryRow(query, roomID).Scan(
+		&template.RoomName, &template.IsPublic, &template.PasswordRequired, &template.Genre, &template.MaxParticipants,
+		&template.UserID, &template.HostUserName, &template.PlayingPlaylistName, &template.CreatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get room: %w", err)
+	}
+
+	rows, err := r.DB.Query(`SELECT tag FROM trx_room_tags WHERE room_id = ? ORDER BY created_at ASC, tag ASC`, roomID)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get room tags: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, false, fmt.Errorf("failed to scan room tag: %w", err)
+		}
+		template.Tags = append(template.Tags, tag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, fmt.Errorf("failed to get room tags: %w", err)
+	}
+
+	songsQuery := `
+        SELECT song_id, isrc, track_id, song_name, artist, song_length, COALESCE(song_image_url, '')
+        FROM trx_rooms_songs
+        WHERE room_id = ?
+        ORDER BY song_index ASC
+    `
+	if template.Songs, err = r.listSongs(songsQuery, roomID); err != nil {
+		return nil, false, fmt.Errorf("failed to get room songs: %w", err)
+	}
+	template.SongCount = len(template.Songs)
+	return &template, true, nil
+}
+
+func (r *roomTemplateRepository) listSongs(query string, id int) ([]Song, error) {
+	rows, err := r.DB.Query(query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	songs := []Song{}
+	for rows.Next() {
+		var song Song
+		if err := rows.Scan(&song.SongId, &song.ISRC, &song.TrackID, &song.SongName, &song.Artist, &song.SongLength, &song.SongImageUrl); err != nil {
+			return nil, err
+		}
+		songs = append(songs, song)
+	}
+	return songs, rows.Err()
+}
@@ -4,7 +4,9 @@ import (
     "database/sql"
     "fmt"
     "log"
+    "strings"
     "time"
+    "unicode/utf8"
 )
 
 // Room はルーム情報を表します
@@ -22,10 +24,40 @@ type Room struct {
     CreateAt            time.Time    `db:"created_at" json:"createAt"`
     UpdateAt            time.Time    `db:"updated_at" json:"updateAt"`
     DeletedAt           sql.NullTime `db:"deleted_at" json:"deletedAt"`
+    Tags                []string     `json:"tags"`
+}
+
+// 公開ルーム一覧の並び順
+// ページをまたいでも安定するのは created だけ。participants・activity はページを読む間に参加者の増減などで
+// 並び順のキーが変わると、ルームが前後のページに移って重複・欠落することがある（一覧を眺める用途として許容している）。
+const (
+    PublicRoomsSortParticipants = "participants"
+    PublicRoomsSortCreated      = "created"
+    PublicRoomsSortActivity     = "activity"
+)
+
+// PublicRoomsCursor は、前のページの最後のルームの位置です（並び順のキーとルームID）。
+type PublicRoomsCursor struct {
+    Participants int       `json:"p,omitempty"`
+    Time         time.Time `json:"t,omitempty"`
+    RoomID       int       `json:"id"`
+}
+
+// PublicRoomsQuery は、公開ルーム一覧の検索条件です。
+type PublicRoomsQuery struct {
+    // Keyword はルーム名・ホスト名の部分一致（2文字以上は全文検索インデックスを使う）
+    Keyword      string
+    Genre        string
+    // Tags はすべてを持つルームに絞り込む
+    Tags         []string
+    HasFreeSlots bool
+    Sort         string
+    After        *PublicRoomsCursor
+    Limit        int
 }
 
 type RoomsRepository interface {
-    GetPublicRooms() ([]Room, error)
+    GetPublicRooms(query PublicRoomsQuery) ([]Room, error)
 }
 
 type roomsRepository struct {
@@ -36,21 +68,72 @@ func NewRoomsRepository(db *sql.DB) RoomsRepository {
     return &roomsRepository{DB: db}
 }
 
-func (r *roomsRepository) GetPublicRooms() ([]Room, error) {
-    query := `
+// GetPublicRooms は、条件に合う公開ルームを並び順のキーとルームIDの降順で返します。
+// ルームIDを第2キーにすることで、同じ値のルームがあってもページの境界がずれないようにしている。
+func (r *roomsRepository) GetPublicRooms(q PublicRoomsQuery) ([]Room, error) {
+    var sortColumn string
+    switch q.Sort {
+    case PublicRoomsSortParticipants:
+        sortColumn = "now_participants"
+    case PublicRoomsSortActivity:
+        sortColumn = "updated_at"
+    default:
+        sortColumn = "created_at"
+    }
+
+    conditions := []string{"is_public = ?", "deleted_at IS NULL"}
+    args := []interface{}{true}
+    if phrase := fullTextPhrase(q.Keyword); phrase != "" {
+        conditions = append(conditions, "MATCH(room_name, host_user_name) AGAINST (? IN BOOLEAN MODE)")
+        args = append(args, phrase)
+    } else if q.Keyword != "" {
+        // ngram の単位（2文字）より短いキーワードは全文検索インデックスで探せないため部分一致で探す
+        pattern := "%" + escapeLike(q.Keyword) + "%"
+        conditions = append(conditions, "(room_name LIKE ? OR host_user_name LIKE ?)")
+        args = append(args, pattern, pattern)
+    }
+    if q.Genre != "" {
+        conditions = append(conditions, "genre = ?")
+        args = append(args, q.Genre)
+    }
+    if len(q.Tags) > 0 {
+        placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(q.Tags)), ", ")
+        conditions = append(conditions, fmt.Sprintf(
+            "room_id IN (SELECT room_id FROM trx_room_tags WHERE tag IN (%s) GROUP BY room_id HAVING COUNT(*) = ?)", placeholders))
+        for _, tag := range q.Tags {
+            args = append(args, tag)
+        }
+        args = append(args, len(q.Tags))
+    }
+    if q.HasFreeSlots {
+        conditions = append(conditions, "now_participants < max_participants")
+    }
+    if q.After != nil {
+        var value interface{} = q.After.Time
+        if q.Sort == PublicRoomsSortParticipants {
+            value = q.After.Participants
+        }
+        conditions = append(conditions, fmt.Sprintf("(%[1]s < ? OR (%[1]s = ? AND room_id < ?))", sortColumn))
+        args = append(args, value, value, q.After.RoomID)
+    }
+    args = append(args, q.Limit)
+
+    query := fmt.Sprintf(`
         SELECT room_id, room_name, is_public, genre, playing_playlist_name, playing_song_name,
                max_participants, now_participants, host_user_id, host_user_name, created_at, updated_at, deleted_at
         FROM trx_rooms
-        WHERE is_public = ? AND deleted_at IS NULL
-    `
-    rows, err := r.DB.Query(query, true)
+        WHERE %s
+        ORDER BY %s DESC, room_id DESC
+        LIMIT ?
+    `, strings.Join(conditions, " AND "), sortColumn)
+    rows, err := r.DB.Query(query, args...)
     if err != nil {
 		log.Printf("DB query error: %v", err)
         return nil, fmt.Errorf("query error: %v", err)
     }
     defer rows.Close()
 
-    var rooms []Room
+    rooms := []Room{}
     for rows.Next() {
         var room Room
         if err := rows.Scan(
@@ -79,5 +162,57 @@ func (r *roomsRepository) GetPublicRooms() ([]Room, error) {
         return nil, fmt.Errorf("rows error: %v", err)
     }
 
+    if err := r.attachTags(rooms); err != nil {
+        return nil, err
+    }
     return rooms, nil
+}
+
+// attachTags は、ページ内のルームのタグをまとめて取得して設定します。
+func (r *roomsRepository) attachTags(rooms []Room) error {
+    if len(rooms) == 0 {
+        return nil
+    }
+    indexes := make(map[int]int, len(rooms))
+    args := make([]interface{}, 0, len(rooms))
+    for i := range rooms {
+        rooms[i].Tags = []string{}
+        indexes[rooms[i].RoomID] = i
+        args = append(args, rooms[i].RoomID)
+    }
+    placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(rooms)), ", ")
+    rows, err := r.DB.Query(fmt.Sprintf(
+        `SELECT room_id, tag FROM trx_room_tags WHERE room_id IN (%s) ORDER BY created_at ASC, tag ASC`, placeholders), args...)
+    if err != nil {
+        return fmt.Errorf("failed to get room tags: %w", err)
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        var roomID int
+        var tag string
+        if err := rows.Scan(&roomID, &tag); err != nil {
+            return fmt.Errorf("failed to scan room tag: %w", err)
+        }
+        rooms[indexes[roomID]].Tags = append(rooms[indexes[roomID]].Tags, tag)
+    }
+    if err := rows.Err(); err != nil {
+        return fmt.Errorf("failed to get room tags: %w", err)
+    }
+    return nil
+}
+
+// fullTextPhrase は、キーワードを全文検索（BOOLEAN MODE）のフレーズにします。
+// 演算子として扱われないよう全体を "" で囲む。2文字未満（ngram で探せない）の場合は空文字列を返します。
+func fullTextPhrase(keyword string) string {
+    keyword = strings.TrimSpace(strings.ReplaceAll(keyword, `"`, " "))
+    if utf8.RuneCountInString(keyword) < 2 {
+        return ""
+    }
+    return `"` + keyword + `"`
+}
+
+// escapeLike は、LIKE のワイルドカードとして扱われる文字をエスケープします。
+func escapeLike(s string) string {
+    return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
 }
\ No newline at end of file
@@ -0,0 +1,95 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+type SearchRepository interface {
+	// GetCachedSearch は、キャッシュされた検索結果を返します。キャッシュがない場合は found=false を返します。
+	GetCachedSearch(cacheKey string) ([]Song, bool, error)
+	SetCachedSearch(cacheKey string, songs []Song, ttl time.Duration) error
+	// IncrementSearchCount は、window 内の検索回数をカウントアップし、現在の回数を返します。
+	IncrementSearchCount(cacheKey string, window time.Duration) (int64, error)
+	// GetCachedMarket は、キャッシュされたユーザーの検索の market を返します。キャッシュがない場合は found=false を返します。
+	GetCachedMarket(provider string, userID int) (string, bool, error)
+	SetCachedMarket(provider string, userID int, market string, ttl time.Duration) error
+}
+
+type searchRepository struct {
+	RedisClient *redis.Client
+}
+
+func NewSearchRepository(redisClient *redis.Client) SearchRepository {
+	return &searchRepository{RedisClient: redisClient}
+}
+
+func (r *searchRepository) GetCachedSearch(cacheKey string) ([]Song, bool, error) {
+	ctx := context.Background()
+	val, err := r.RedisClient.Get(ctx, fmt.Sprintf("search:result:%s", cacheKey)).Result()
+	if err == redis.Nil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get search cache: %w", err)
+	}
+
+	var songs []Song
+	if err := json.Unmarshal([]byte(val), &songs); err != nil {
+		return nil, false, fmt.Errorf("failed to unmarshal search cache: %w", err)
+	}
+	return songs, true, nil
+}
+
+func (r *searchRepository) SetCachedSearch(cacheKey string, songs []Song, ttl time.Duration) error {
+	ctx := context.Background()
+	data, err := json.Marshal(songs)
+	if err != nil {
+		return fmt.Errorf("failed to marshal search cache: %w", err)
+	}
+	if err := r.RedisClient.Set(ctx, fmt.Sprintf("search:result:%s", cacheKey), data, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to set search cache: %w", err)
+	}
+	return nil
+}
+
+func (r *searchRepository) IncrementSearchCount(cacheKey string, window time.Duration) (int64, error) {
+	ctx := context.Background()
+	key := fmt.Sprintf("search:count:%s", cacheKey)
+
+	count, err := r.RedisClient.Incr(ctx, key).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to increment search count: %w", err)
+	}
+	// 最初の検索から window の間だけ数える
+	if count == 1 {
+		if err := r.RedisClient.Expire(ctx, key, window).Err(); err != nil {
+			return 0, fmt.Errorf("failed to set search count expiry: %w", err)
+		}
+	}
+	return count, nil
+}
+
+func (r *searchRepository) GetCachedMarket(provider string, userID int) (string, bool, error) {
+	ctx := context.Background()
+	market, err := r.RedisClient.Get(ctx, fmt.Sprintf("search:market:%s:%d", provider, userID)).Result()
+	if err == redis.Nil {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to get search market: %w", err)
+	}
+	return market, true, nil
+}
+
+func (r *searchRepository) SetCachedMarket(provider string, userID int, market string, ttl time.Duration) error {
+	ctx := context.Background()
+	if err := r.RedisClient.Set(ctx, fmt.Sprintf("search:market:%s:%d", provider, userID), market, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to set search market: %w", err)
+	}
+	return nil
+}
@@ -1,26 +1,79 @@
 package repositories
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"time"
+
+	"music-share-api/internal/utils"
+
+	"github.com/go-redis/redis/v8"
 )
 
+// EncryptedTokenRow は鍵ローテーション用に取得する trx_users_services の暗号化トークンです。
+type EncryptedTokenRow struct {
+	ServiceID             int
+	EncryptedAccessToken  string
+	EncryptedRefreshToken string
+}
+
+// OAuthState は認可リクエスト時にサーバー側で保持する state と PKCE の情報です。
+type OAuthState struct {
+	Provider string `json:"provider"`
+	// UserID は連携フロー（purpose=connect）を開始したユーザー。ログインフローでは 0
+	UserID       int    `json:"userId"`
+	Purpose      string `json:"purpose"`
+	CodeVerifier string `json:"codeVerifier"`
+	RedirectURI  string `json:"redirectUri"`
+}
+
 type ServiceRepository interface {
+	// InsertUserService は、連携を保存します。同じユーザー・サービスの連携がすでにあれば（別のアカウントの再連携を含む）置き換えます。
 	InsertUserService(userID int, serviceName, serviceUserID, serviceUserName, encryptedAccessToken, encryptedRefreshToken string, expiresAt time.Time) error
 	DeleteUserService(userID int, serviceName string) error
-	// 新規追加：Spotifyのリフレッシュトークンを取得する
-	GetSpotifyRefreshToken(userID int) (string, error)
-	// 新規追加：Spotifyのアクセストークン・リフレッシュトークン・有効期限を更新する
-	UpdateSpotifyToken(userID int, newAccessToken, newRefreshToken string, newExpiresAt time.Time) error
+	// GetRefreshToken は、指定サービスの暗号化済みリフレッシュトークンを取得します。
+	GetRefreshToken(userID int, serviceName string) (string, error)
+	// GetAccessToken は、指定サービスの暗号化済みアクセストークンを取得します。
+	GetAccessToken(userID int, serviceName string) (string, error)
+	// UpdateServiceToken は、指定サービスのアクセストークン・リフレッシュトークン・有効期限を更新します。
+	UpdateServiceToken(userID int, serviceName, newAccessToken, newRefreshToken string, newExpiresAt time.Time) error
+	// GetUserIDByServiceUserID は、サービス側のユーザーIDから連携しているユーザーIDを取得します。
+	GetUserIDByServiceUserID(serviceName, serviceUserID string) (int, error)
+	SaveOAuthState(state string, data OAuthState, ttl time.Duration) error
+	// ConsumeOAuthState は state を取得すると同時に削除します（1回限り有効）。
+	ConsumeOAuthState(state string) (*OAuthState, error)
+	// ListEncryptedTokens は、service_id が afterServiceID より大きい行を最大 limit 件取得します。
+	ListEncryptedTokens(afterServiceID, limit int) ([]EncryptedTokenRow, error)
+	// UpdateEncryptedTokens は、トークンが current を読んだ時点から変わっていない場合のみ書き換えます。
+	// 間にトークンの更新・再連携があった場合は書き換えずに false を返します。
+	UpdateEncryptedTokens(current EncryptedTokenRow, encryptedAccessToken, encryptedRefreshToken string) (bool, error)
+	// ListExpiringServiceUsers は、expiresBefore より前に期限切れになる（壊れていない）連携のユーザーIDを返します。
+	// 更新に失敗して次の再試行の時刻（next_refresh_at）になっていない連携は除きます。
+	ListExpiringServiceUsers(serviceName string, expiresBefore time.Time, limit int) ([]int, error)
+	// RecordRefreshFailure は、トークンの更新の失敗を記録し、次の再試行を baseBackoff から倍々に（最大 maxBackoff）遅らせます。
+	RecordRefreshFailure(userID int, serviceName string, baseBackoff, maxBackoff time.Duration) error
+	GetServiceExpiresAt(userID int, serviceName string) (time.Time, error)
+	// MarkServiceBroken は、リフレッシュトークンが失効した連携を「要再連携」状態にします。
+	MarkServiceBroken(userID int, serviceName, reason string) error
+	// MarkReauthorizationRequired は、許可されたスコープが足りない連携を「要再連携」状態にします（再連携するまでは他の操作には使える）。
+	MarkReauthorizationRequired(userID int, serviceName string) error
+	// AcquireRefreshLock は、ユーザー単位のトークン更新ロックを取得します。取得できた場合はロック解除用のトークンを返します。
+	AcquireRefreshLock(userID int, serviceName string, ttl time.Duration) (string, bool, error)
+	ReleaseRefreshLock(userID int, serviceName, lockToken string) error
 }
 
 type serviceRepository struct {
-	DB *sql.DB
+	DB          *sql.DB
+	RedisClient *redis.Client
 }
 
-func NewServiceRepository(db *sql.DB) ServiceRepository {
-	return &serviceRepository{DB: db}
+func NewServiceRepository(db *sql.DB, redisClient *redis.Client) ServiceRepository {
+	return &serviceRepository{
+		DB:          db,
+		RedisClient: redisClient,
+	}
 }
 
 func (r *serviceRepository) InsertUserService(userID int, serviceName, serviceUserID, serviceUserName, encryptedAccessToken, encryptedRefreshToken string, expiresAt time.Time) error {
@@ -36,6 +89,19 @@ func (r *serviceRepository) InsertUserService(userID int, serviceName, serviceUs
         INSERT INTO trx_users_services
         (user_id, service_name, service_user_id, service_user_name, encrypted_access_token, encrypted_refresh_token, expires_at, created_at, updated_at)
         VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+        ON DUPLICATE KEY UPDATE
+            service_user_id = VALUES(service_user_id),
+            service_user_name = VALUES(service_user_name),
+            encrypted_access_token = VALUES(encrypted_access_token),
+            encrypted_refresh_token = VALUES(encrypted_refresh_token),
+            expires_at = VALUES(expires_at),
+            updated_at = VALUES(updated_at),
+            deleted_at = NULL,
+            broken_at = NULL,
+            broken_reason = NULL,
+            refresh_failures = 0,
+            next_refresh_at = NULL,
+            reauthorize_required_at = NULL
     `
 	// expiresAt, currentTimeのフォーマットは "2006-01-02 15:04:05" を使用
 	formattedExpiresAt := expiresAt.Format("2006-01-02 15:04:05")
@@ -45,17 +111,6 @@ func (r *serviceRepository) InsertUserService(userID int, serviceName, serviceUs
 	if err != nil {
 		return fmt.Errorf("failed to insert user service: %w", err)
 	}
-
-	// trx_users の is_spotify を更新（必要な場合）
-	updateQuery := `
-        UPDATE trx_users 
-        SET is_spotify = ? 
-        WHERE user_id = ?
-    `
-	_, err = r.DB.Exec(updateQuery, true, userID)
-	if err != nil {
-		return fmt.Errorf("failed to update is_spotify status: %w", err)
-	}
 	return nil
 }
 
@@ -68,37 +123,43 @@ func (r *serviceRepository) DeleteUserService(userID int, serviceName string) er
 	if err != nil {
 		return fmt.Errorf("failed to delete user service: %w", err)
 	}
-
-	updateQuery := `
-        UPDATE trx_users 
-        SET is_spotify = ? 
-        WHERE user_id = ?
-    `
-	_, err = r.DB.Exec(updateQuery, false, userID)
-	if err != nil {
-		return fmt.Errorf("failed to update is_spotify: %w", err)
-	}
 	return nil
 }
 
-// GetSpotifyRefreshToken userIdから refresh token を取得します。
-func (r *serviceRepository) GetSpotifyRefreshToken(userID int) (string, error) {
+// GetRefreshToken userIdとサービス名から refresh token を取得します。
+func (r *serviceRepository) GetRefreshToken(userID int, serviceName string) (string, error) {
 	query := `
         SELECT encrypted_refresh_token
         FROM trx_users_services
-        WHERE user_id = ? AND service_name = ? AND deleted_at IS NULL
+        WHERE user_id = ? AND service_name = ? AND deleted_at IS NULL AND broken_at IS NULL
         LIMIT 1
     `
 	var encryptedRefreshToken string
-	err := r.DB.QueryRow(query, userID, "spotify").Scan(&encryptedRefreshToken)
+	err := r.DB.QueryRow(query, userID, serviceName).Scan(&encryptedRefreshToken)
 	if err != nil {
 		return "", fmt.Errorf("failed to get refresh token: %w", err)
 	}
 	return encryptedRefreshToken, nil
 }
 
-// UpdateSpotifyToken は、trx_users_services内のアクセストークン、リフレッシュトークン、有効期限を更新します。
-func (r *serviceRepository) UpdateSpotifyToken(userID int, newAccessToken, newRefreshToken string, newExpiresAt time.Time) error {
+// GetAccessToken userIdとサービス名から access token を取得します。
+func (r *serviceRepository) GetAccessToken(userID int, serviceName string) (string, error) {
+	query := `
+        SELECT encrypted_access_token
+        FROM trx_users_services
+        WHERE user_id = ? AND service_name = ? AND deleted_at IS NULL AND broken_at IS NULL
+        LIMIT 1
+    `
+	var encryptedAccessToken string
+	err := r.DB.QueryRow(query, userID, serviceName).Scan(&encryptedAccessToken)
+	if err != nil {
+		return "", fmt.Errorf("failed to get access token: %w", err)
+	}
+	return encryptedAccessToken, nil
+}
+
+// UpdateServiceToken は、trx_users_services内のアクセストークン、リフレッシュトークン、有効期限を更新します。
+func (r *serviceRepository) UpdateServiceToken(userID int, serviceName, newAccessToken, newRefreshToken string, newExpiresAt time.Time) error {
 	// JSTの日時文字列（例："2006-01-02 15:04:05"）
 	formattedExpiresAt := newExpiresAt.Format("2006-01-02 15:04:05")
 
@@ -106,12 +167,227 @@ func (r *serviceRepository) UpdateSpotifyToken(userID int, newAccessToken, newRe
          UPDATE trx_users_services
          SET encrypted_access_token = ?,
              encrypted_refresh_token = ?,
-             expires_at = ?
+             expires_at = ?,
+             broken_at = NULL,
+             broken_reason = NULL,
+             refresh_failures = 0,
+             next_refresh_at = NULL
          WHERE user_id = ? AND service_name = ?
     `
-	_, err := r.DB.Exec(query, newAccessToken, newRefreshToken, formattedExpiresAt, userID, "spotify")
+	_, err := r.DB.Exec(query, newAccessToken, newRefreshToken, formattedExpiresAt, userID, serviceName)
+	if err != nil {
+		return fmt.Errorf("failed to update service token: %w", err)
+	}
+	return nil
+}
+
+// GetUserIDByServiceUserID は、連携先が見つからない場合 sql.ErrNoRows をそのまま返します。
+func (r *serviceRepository) GetUserIDByServiceUserID(serviceName, serviceUserID string) (int, error) {
+	query := `
+        SELECT user_id
+        FROM trx_users_services
+        WHERE service_name = ? AND service_user_id = ? AND deleted_at IS NULL
+        LIMIT 1
+    `
+	var userID int
+	err := r.DB.QueryRow(query, serviceName, serviceUserID).Scan(&userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, err
+		}
+		return 0, fmt.Errorf("failed to get user by service user id: %w", err)
+	}
+	return userID, nil
+}
+
+func (r *serviceRepository) SaveOAuthState(state string, data OAuthState, ttl time.Duration) error {
+	ctx := context.Background()
+	key := fmt.Sprintf("oauth_state:%s", state)
+	stateJSON, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal oauth state: %w", err)
+	}
+	if err := r.RedisClient.Set(ctx, key, stateJSON, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to save oauth state: %w", err)
+	}
+	return nil
+}
+
+func (r *serviceRepository) ConsumeOAuthState(state string) (*OAuthState, error) {
+	ctx := context.Background()
+	key := fmt.Sprintf("oauth_state:%s", state)
+	val, err := r.RedisClient.GetDel(ctx, key).Result()
+	if err == redis.Nil {
+		return nil, fmt.Errorf("invalid or expired state")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get oauth state: %w", err)
+	}
+
+	var data OAuthState
+	if err := json.Unmarshal([]byte(val), &data); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal oauth state: %w", err)
+	}
+	return &data, nil
+}
+
+func (r *serviceRepository) ListEncryptedTokens(afterServiceID, limit int) ([]EncryptedTokenRow, error) {
+	query := `
+        SELECT service_id, encrypted_access_token, encrypted_refresh_token
+        FROM trx_users_services
+        WHERE service_id > ?
+        ORDER BY service_id ASC
+        LIMIT ?
+    `
+	rows, err := r.DB.Query(query, afterServiceID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query encrypted tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []EncryptedTokenRow
+	for rows.Next() {
+		var row EncryptedTokenRow
+		if err := rows.Scan(&row.ServiceID, &row.EncryptedAccessToken, &row.EncryptedRefreshToken); err != nil {
+			return nil, fmt.Errorf("failed to scan encrypted token: %w", err)
+		}
+		tokens = append(tokens, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return tokens, nil
+}
+
+func (r *serviceRepository) UpdateEncryptedTokens(current EncryptedTokenRow, encryptedAccessToken, encryptedRefreshToken string) (bool, error) {
+	query := `
+        UPDATE trx_users_services
+        SET encrypted_access_token = ?, encrypted_refresh_token = ?
+        WHERE service_id = ? AND encrypted_access_token = ? AND encrypted_refresh_token = ?
+    `
+	result, err := r.DB.Exec(query, encryptedAccessToken, encryptedRefreshToken, current.ServiceID, current.EncryptedAccessToken, current.EncryptedRefreshToken)
+	if err != nil {
+		return false, fmt.Errorf("failed to update encrypted tokens: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	return affected > 0, nil
+}
+
+func (r *serviceRepository) ListExpiringServiceUsers(serviceName string, expiresBefore time.Time, limit int) ([]int, error) {
+	// expires_at は JST の日時文字列で保存しているため、同じ形式で比較する
+	formattedExpiresBefore := expiresBefore.Format("2006-01-02 15:04:05")
+
+	query := `
+        SELECT user_id
+        FROM trx_users_services
+        WHERE service_name = ? AND expires_at < ? AND deleted_at IS NULL AND broken_at IS NULL
+          AND (next_refresh_at IS NULL OR next_refresh_at <= ?)
+        ORDER BY expires_at ASC
+        LIMIT ?
+    `
+	rows, err := r.DB.Query(query, serviceName, formattedExpiresBefore, time.Now(), limit)
 	if err != nil {
-		return fmt.Errorf("failed to update spotify token: %w", err)
+		return nil, fmt.Errorf("failed to query expiring services: %w", err)
+	}
+	defer rows.Close()
+
+	var userIDs []int
+	for rows.Next() {
+		var userID int
+		if err := rows.Scan(&userID); err != nil {
+			return nil, fmt.Errorf("failed to scan user id: %w", err)
+		}
+		userIDs = append(userIDs, userID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return userIDs, nil
+}
+
+func (r *serviceRepository) RecordRefreshFailure(userID int, serviceName string, baseBackoff, maxBackoff time.Duration) error {
+	// SET は左から順に評価されるため、next_refresh_at は更新前の refresh_failures で計算する
+	query := `
+        UPDATE trx_users_services
+        SET next_refresh_at = DATE_ADD(?, INTERVAL LEAST(? * POW(2, LEAST(refresh_failures, 20)), ?) SECOND),
+            refresh_failures = refresh_failures + 1
+        WHERE user_id = ? AND service_name = ? AND deleted_at IS NULL
+    `
+	_, err := r.DB.Exec(query, time.Now(), int64(baseBackoff.Seconds()), int64(maxBackoff.Seconds()), userID, serviceName)
+	if err != nil {
+		return fmt.Errorf("failed to record refresh failure: %w", err)
+	}
+	return nil
+}
+
+func (r *serviceRepository) GetServiceExpiresAt(userID int, serviceName string) (time.Time, error) {
+	query := `
+        SELECT expires_at
+        FROM trx_users_services
+        WHERE user_id = ? AND service_name = ? AND deleted_at IS NULL
+        LIMIT 1
+    `
+	var expiresAt time.Time
+	if err := r.DB.QueryRow(query, userID, serviceName).Scan(&expiresAt); err != nil {
+		return time.Time{}, fmt.Errorf("failed to get expires_at: %w", err)
+	}
+	return expiresAt, nil
+}
+
+func (r *serviceRepository) MarkServiceBroken(userID int, serviceName, reason string) error {
+	query := `
+        UPDATE trx_users_services
+        SET broken_at = ?, broken_reason = ?
+        WHERE user_id = ? AND service_name = ? AND deleted_at IS NULL
+    `
+	if _, err := r.DB.Exec(query, time.Now(), reason, userID, serviceName); err != nil {
+		return fmt.Errorf("failed to mark service broken: %w", err)
+	}
+	return nil
+}
+
+func (r *serviceRepository) MarkReauthorizationRequired(userID int, serviceName string) error {
+	query := `
+        UPDATE trx_users_services
+        SET reauthorize_required_at = ?
+        WHERE user_id = ? AND service_name = ? AND deleted_at IS NULL AND reauthorize_required_at IS NULL
+    `
+	if _, err := r.DB.Exec(query, time.Now(), userID, serviceName); err != nil {
+		return fmt.Errorf("failed to mark reauthorization required: %w", err)
+	}
+	return nil
+}
+
+// releaseLockScript は、自分が取得したロックのみを削除する（期限切れ後に他者が取得したロックを消さない）。
+var releaseLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+    return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+func (r *serviceRepository) AcquireRefreshLock(userID int, serviceName string, ttl time.Duration) (string, bool, error) {
+	ctx := context.Background()
+	key := fmt.Sprintf("lock:token_refresh:%s:%d", serviceName, userID)
+	lockToken, err := utils.GenerateRandomToken(16)
+	if err != nil {
+		return "", false, err
+	}
+	ok, err := r.RedisClient.SetNX(ctx, key, lockToken, ttl).Result()
+	if err != nil {
+		return "", false, fmt.Errorf("failed to acquire refresh lock: %w", err)
+	}
+	return lockToken, ok, nil
+}
+
+func (r *serviceRepository) ReleaseRefreshLock(userID int, serviceName, lockToken string) error {
+	ctx := context.Background()
+	key := fmt.Sprintf("lock:token_refresh:%s:%d", serviceName, userID)
+	if err := releaseLockScript.Run(ctx, r.RedisClient, []string{key}, lockToken).Err(); err != nil && err != redis.Nil {
+		return fmt.Errorf("failed to release refresh lock: %w", err)
 	}
 	return nil
 }
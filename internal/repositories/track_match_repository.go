@@ -0,0 +1,72 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// TrackMatch は、プロバイダーに依存しない曲IDとプロバイダーの曲IDの対応付けです。
+type TrackMatch struct {
+	TrackID  string `json:"trackId"`
+	Provider string `json:"provider"`
+	// ProviderTrackID が空の場合は、対応する曲が見つからなかったことを表す
+	ProviderTrackID string  `json:"providerTrackId"`
+	Method          string  `json:"method"`
+	Score           float64 `json:"score"`
+	// Age は対応付けてからの経過時間（DB の時計で計算する）
+	Age time.Duration `json:"-"`
+}
+
+type TrackMatchRepository interface {
+	// GetTrackMatch は、キャッシュされた対応付けを返します。キャッシュがない場合は found=false を返します。
+	GetTrackMatch(trackID, provider string) (*TrackMatch, bool, error)
+	SaveTrackMatch(match TrackMatch) error
+}
+
+type trackMatchRepository struct {
+	DB *sql.DB
+}
+
+func NewTrackMatchRepository(db *sql.DB) TrackMatchRepository {
+	return &trackMatchRepository{DB: db}
+}
+
+func (r *trackMatchRepository) GetTrackMatch(trackID, provider string) (*TrackMatch, bool, error) {
+	query := `
+        SELECT track_id, provider, provider_track_id, match_method, score,
+               TIMESTAMPDIFF(SECOND, matched_at, CURRENT_TIMESTAMP)
+        FROM trx_track_matches
+        WHERE track_id = ? AND provider = ?
+    `
+	var match TrackMatch
+	var ageSeconds int64
+	err := r.DB.QueryRow(query, trackID, provider).Scan(
+		&match.TrackID, &match.Provider, &match.ProviderTrackID, &match.Method, &match.Score, &ageSeconds,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get track match: %w", err)
+	}
+	match.Age = time.Duration(ageSeconds) * time.Second
+	return &match, true, nil
+}
+
+func (r *trackMatchRepository) SaveTrackMatch(match TrackMatch) error {
+	query := `
+        INSERT INTO trx_track_matches (track_id, provider, provider_track_id, match_method, score, matched_at)
+        VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+        ON DUPLICATE KEY UPDATE
+            provider_track_id = VALUES(provider_track_id),
+            match_method = VALUES(match_method),
+            score = VALUES(score),
+            matched_at = CURRENT_TIMESTAMP
+    `
+	if _, err := r.DB.Exec(query, match.TrackID, match.Provider, match.ProviderTrackID, match.Method, match.Score); err != nil {
+		return fmt.Errorf("failed to save track match: %w", err)
+	}
+	return nil
+}
@@ -2,27 +2,92 @@ package services
 
 import (
 	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"time"
+
+	"music-share-api/internal/mailer"
 	"music-share-api/internal/repositories"
+	"music-share-api/internal/utils"
 )
 
 type AuthService interface {
-	// 新規：ユーザー基本情報と連携サービス情報を返す
-	GetUserInfo(userID int) (string, string, string, bool, map[string]repositories.UserServiceData, error)
+	// 新規：ユーザー基本情報と連携サービス情報、プロバイダーごとの連携状態を返す
+	GetUserInfo(userID int) (string, string, string, map[string]repositories.UserServiceData, map[string]ConnectionStatus, error)
 	RegisterUser(userName, email, hashPassword string) (int, string, string, error)
-	LoginUser(email, hashPassword string) (int, string, string, string, bool, error)
-	UpdateProfile(userID int, userName, email string) error
+	LoginUser(email, hashPassword string) (int, string, string, string, error)
+	// UpdateProfile は、ユーザー名とメールアドレスを更新します。メールアドレスを変更する場合は現在のパスワードが必要です。
+	UpdateProfile(userID int, userName, email, currentHashPassword string) error
+	SendVerificationEmail(userID int) error
+	VerifyEmail(token string) error
+	IsEmailVerified(userID int) (bool, error)
+	// IsAdmin は、ユーザーが管理者（role が "admin"）かどうかを返します。
+	IsAdmin(userID int) (bool, error)
+	RequestPasswordReset(email string) error
+	ResetPassword(token, newHashPassword string) error
+	ChangePassword(userID int, currentHashPassword, newHashPassword string) error
+	// ValidateSession は、指定時刻に発行されたセッションが失効していないかを確認します。
+	ValidateSession(userID int, issuedAt time.Time) error
+	IsTOTPEnabled(userID int) (bool, error)
+	// EnrollTOTP は、otpauth URI と平文のリカバリーコード（この時だけ返す）を返します。
+	EnrollTOTP(userID int) (string, []string, error)
+	ActivateTOTP(userID int, code string) error
+	DisableTOTP(userID int, code, recoveryCode string) error
+	// VerifyTwoFactor は、サインイン時のチャレンジトークンとコードを検証し、userID を返します。
+	VerifyTwoFactor(challengeToken, code, recoveryCode string) (int, error)
+	// SignInWithSpotify は、Spotifyの認証コードでサインイン（未登録ならユーザー作成）し、userID と新規作成かどうかを返します。
+	SignInWithSpotify(code, state string) (int, bool, error)
+	BuildSpotifyLoginURL() (string, error)
 }
 
+// ErrAccountLinkRequired は、Spotifyのメールアドレスが既存ユーザーと一致するが未連携の場合に返されます。
+// 乗っ取り防止のため自動では連携せず、既存アカウントでサインインしてから連携してもらう。
+var ErrAccountLinkRequired = errors.New("an account with this email already exists; sign in and connect spotify from your account")
+
+// ErrTooManyTwoFactorAttempts は、二要素認証のコードの確認に続けて失敗し、一時的にロックされている場合に返されます。
+var ErrTooManyTwoFactorAttempts = errors.New("too many verification attempts; please try again later")
+
+// ErrInvalidCurrentPassword は、メールアドレスの変更時に現在のパスワードが一致しない場合に返されます。
+// パスワードを持たないユーザー（Spotifyサインインで作成）は、パスワードを設定するまでメールアドレスを変更できない。
+var ErrInvalidCurrentPassword = errors.New("current password is incorrect")
+
+// spotifyProviderName は、サインインに使用するプロバイダー名です。
+const spotifyProviderName = "spotify"
+
 type authService struct {
-	repo repositories.AuthRepository
+	repo         repositories.AuthRepository
+	mailer       mailer.Mailer
+	musicService MusicService
+	// keyring は TOTP シークレットの暗号化に使う（外部サービスのトークンと同じ鍵束）
+	keyring *utils.TokenKeyring
+	// maxTwoFactorAttempts は twoFactorLockout の間に確認できる二要素認証のコードの回数
+	maxTwoFactorAttempts int
+	twoFactorLockout     time.Duration
+	// allowPlaintextTOTPSecrets は、暗号化されていない TOTP シークレットを受け付けるかどうか
+	allowPlaintextTOTPSecrets bool
 }
 
-func NewAuthService(r repositories.AuthRepository) AuthService {
-	return &authService{repo: r}
+func NewAuthService(r repositories.AuthRepository, m mailer.Mailer, musicService MusicService, keyring *utils.TokenKeyring) AuthService {
+	return &authService{
+		repo:                 r,
+		mailer:               m,
+		musicService:         musicService,
+		keyring:              keyring,
+		maxTwoFactorAttempts: utils.GetEnvInt("TWO_FACTOR_MAX_ATTEMPTS", 5),
+		twoFactorLockout:     utils.GetEnvDuration("TWO_FACTOR_LOCKOUT", 15*time.Minute),
+		// 暗号化導入前の平文の TOTP シークレットは、rotate-token-keys で暗号化し終えるまでの移行期間だけ受け付ける
+		allowPlaintextTOTPSecrets: utils.GetEnvBool("TOTP_ALLOW_PLAINTEXT_SECRETS", false),
+	}
 }
 
-func (s *authService) GetUserInfo(userID int) (string, string, string, bool, map[string]repositories.UserServiceData, error) {
-	return s.repo.GetUserInfo(userID)
+func (s *authService) GetUserInfo(userID int) (string, string, string, map[string]repositories.UserServiceData, map[string]ConnectionStatus, error) {
+	userName, email, role, userServices, err := s.repo.GetUserInfo(userID)
+	if err != nil {
+		return "", "", "", nil, nil, err
+	}
+	return userName, email, role, userServices, s.musicService.ConnectionStatuses(userServices), nil
 }
 
 // RegisterUser：パスワードは既にハッシュ化されている前提
@@ -31,21 +96,371 @@ func (s *authService) RegisterUser(userName, email, hashPassword string) (int, s
 	if err != nil {
 		return 0, "", "", err
 	}
+
+	// 確認メールの送信失敗で登録自体は失敗させない（再送エンドポイントで再送可能）
+	if err := s.SendVerificationEmail(id); err != nil {
+		log.Printf("Failed to send verification email to user %d: %v", id, err)
+	}
 	return id, userName, email, nil
 }
 
 // LoginUser：受け取ったhashPasswordとDBのものを直接比較
-func (s *authService) LoginUser(email, hashPassword string) (int, string, string, string, bool, error) {
-	id, name, storedHash, role, isSpotify, err := s.repo.GetUserByEmail(email)
+func (s *authService) LoginUser(email, hashPassword string) (int, string, string, string, error) {
+	id, name, storedHash, role, err := s.repo.GetUserByEmail(email)
+	if err != nil {
+		return 0, "", "", "", err
+	}
+	// Spotifyサインインで作成されたユーザーはパスワードを持たない
+	if storedHash == "" || storedHash != hashPassword {
+		return 0, "", "", "", errors.New("invalid credentials")
+	}
+	return id, name, email, role, nil
+}
+
+func (s *authService) UpdateProfile(userID int, userName, email, currentHashPassword string) error {
+	currentEmail, _, err := s.repo.GetEmailVerification(userID)
+	if err != nil {
+		return err
+	}
+	// パスワードの再設定はメールアドレス宛てに送るため、乗っ取りを防ぐようメールアドレスの変更は本人のパスワードで確認する
+	if currentEmail != email {
+		storedHash, err := s.repo.GetPasswordHash(userID)
+		if err != nil {
+			return err
+		}
+		if storedHash == "" || storedHash != currentHashPassword {
+			return ErrInvalidCurrentPassword
+		}
+	}
+	if err := s.repo.UpdateUserProfile(userID, userName, email); err != nil {
+		return err
+	}
+
+	// メールアドレスが変更された場合は確認済み状態がリセットされるため、確認メールを再送する
+	if currentEmail != email {
+		if err := s.SendVerificationEmail(userID); err != nil {
+			log.Printf("Failed to send verification email to user %d: %v", userID, err)
+		}
+	}
+	return nil
+}
+
+// SendVerificationEmail は、メールアドレス確認用のリンクをユーザーに送信します。
+func (s *authService) SendVerificationEmail(userID int) error {
+	email, verifiedAt, err := s.repo.GetEmailVerification(userID)
+	if err != nil {
+		return err
+	}
+	if verifiedAt.Valid {
+		return errors.New("email is already verified")
+	}
+
+	token, err := utils.GenerateEmailVerificationToken(userID, email)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/verify-email?token=%s", utils.GetEnv("APP_BASE_URL", "http://localhost:3000"), url.QueryEscape(token))
+	body := fmt.Sprintf("以下のリンクからメールアドレスの確認を完了してください。\n\n%s\n", link)
+	if err := s.mailer.Send(email, "メールアドレスの確認", body); err != nil {
+		return fmt.Errorf("failed to send verification email: %w", err)
+	}
+	return nil
+}
+
+// VerifyEmail は、確認用トークンを検証してメールアドレスを確認済みにします。
+func (s *authService) VerifyEmail(token string) error {
+	userID, email, err := utils.ParseEmailVerificationToken(token)
+	if err != nil {
+		return err
+	}
+
+	currentEmail, verifiedAt, err := s.repo.GetEmailVerification(userID)
+	if err != nil {
+		return err
+	}
+	if currentEmail != email {
+		return errors.New("email has been changed since the token was issued")
+	}
+	// 既に確認済みの場合は成功として扱う
+	if verifiedAt.Valid {
+		return nil
+	}
+	return s.repo.MarkEmailVerified(userID, email)
+}
+
+func (s *authService) IsEmailVerified(userID int) (bool, error) {
+	_, verifiedAt, err := s.repo.GetEmailVerification(userID)
+	if err != nil {
+		return false, err
+	}
+	return verifiedAt.Valid, nil
+}
+
+func (s *authService) IsAdmin(userID int) (bool, error) {
+	role, err := s.repo.GetUserRole(userID)
+	if err != nil {
+		return false, err
+	}
+	return role == "admin", nil
+}
+
+// RequestPasswordReset は、パスワードリセット用のリンクをメールで送信します。
+// メールアドレスの登録有無を推測されないよう、ユーザーが存在しない場合もエラーにしない。
+func (s *authService) RequestPasswordReset(email string) error {
+	userID, _, _, _, err := s.repo.GetUserByEmail(email)
+	if err != nil {
+		log.Printf("Password reset requested for unknown email: %v", err)
+		return nil
+	}
+
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().Add(utils.GetEnvDuration("PASSWORD_RESET_TOKEN_TTL", 30*time.Minute))
+	if err := s.repo.CreatePasswordReset(userID, utils.HashToken(token), expiresAt); err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", utils.GetEnv("APP_BASE_URL", "http://localhost:3000"), url.QueryEscape(token))
+	body := fmt.Sprintf("以下のリンクからパスワードを再設定してください（有効期限: %s）。\n\n%s\n\n心当たりがない場合はこのメールを破棄してください。\n", expiresAt.Format("2006-01-02 15:04"), link)
+	if err := s.mailer.Send(email, "パスワードの再設定", body); err != nil {
+		return fmt.Errorf("failed to send password reset email: %w", err)
+	}
+	return nil
+}
+
+// ResetPassword は、リセットトークンを消費してパスワードを更新します。既存セッションは全て失効します。
+func (s *authService) ResetPassword(token, newHashPassword string) error {
+	if newHashPassword == "" {
+		return errors.New("new password is empty")
+	}
+	userID, err := s.repo.ConsumePasswordReset(utils.HashToken(token))
+	if err != nil {
+		return err
+	}
+	return s.repo.UpdatePassword(userID, newHashPassword)
+}
+
+// ChangePassword は、現在のパスワードを確認したうえでパスワードを更新します。既存セッションは全て失効します。
+func (s *authService) ChangePassword(userID int, currentHashPassword, newHashPassword string) error {
+	if newHashPassword == "" {
+		return errors.New("new password is empty")
+	}
+	storedHash, err := s.repo.GetPasswordHash(userID)
+	if err != nil {
+		return err
+	}
+	if storedHash != currentHashPassword {
+		return errors.New("invalid credentials")
+	}
+	return s.repo.UpdatePassword(userID, newHashPassword)
+}
+
+func (s *authService) ValidateSession(userID int, issuedAt time.Time) error {
+	revokedAt, err := s.repo.GetSessionsRevokedAt(userID)
+	if err != nil {
+		return err
+	}
+	if revokedAt.Valid && issuedAt.Before(revokedAt.Time) {
+		return errors.New("session has been revoked")
+	}
+	return nil
+}
+
+func (s *authService) IsTOTPEnabled(userID int) (bool, error) {
+	_, enabledAt, _, err := s.repo.GetTOTPState(userID)
 	if err != nil {
-		return 0, "", "", "", false, err
+		return false, err
 	}
-	if storedHash != hashPassword {
-		return 0, "", "", "", false, errors.New("invalid credentials")
+	return enabledAt.Valid, nil
+}
+
+// EnrollTOTP は、新しい TOTP シークレットとリカバリーコードを発行します。
+// ActivateTOTP でコードを確認するまでサインインには影響しません。
+func (s *authService) EnrollTOTP(userID int) (string, []string, error) {
+	enabled, err := s.IsTOTPEnabled(userID)
+	if err != nil {
+		return "", nil, err
+	}
+	if enabled {
+		return "", nil, errors.New("two-factor authentication is already enabled")
+	}
+
+	email, _, err := s.repo.GetEmailVerification(userID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return "", nil, err
+	}
+	recoveryCodes, err := utils.GenerateRecoveryCodes(10)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// リカバリーコードはハッシュ化して保存する
+	codeHashes := make([]string, 0, len(recoveryCodes))
+	for _, code := range recoveryCodes {
+		codeHashes = append(codeHashes, utils.HashToken(utils.NormalizeRecoveryCode(code)))
+	}
+	encryptedSecret, err := s.keyring.Encrypt(secret)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := s.repo.StartTOTPEnrollment(userID, encryptedSecret, codeHashes); err != nil {
+		return "", nil, err
+	}
+
+	uri := utils.BuildTOTPURI(utils.GetEnv("TOTP_ISSUER", "music-share"), email, secret)
+	return uri, recoveryCodes, nil
+}
+
+// ActivateTOTP は、登録中のシークレットで生成されたコードを確認して二要素認証を有効化します。
+func (s *authService) ActivateTOTP(userID int, code string) error {
+	secret, enabledAt, _, err := s.repo.GetTOTPState(userID)
+	if err != nil {
+		return err
+	}
+	if enabledAt.Valid {
+		return errors.New("two-factor authentication is already enabled")
+	}
+	if secret == "" {
+		return errors.New("two-factor authentication enrollment has not been started")
+	}
+	if secret, err = utils.DecryptTOTPSecret(s.keyring, secret, s.allowPlaintextTOTPSecrets); err != nil {
+		return err
+	}
+
+	step, ok := utils.ValidateTOTP(secret, code, time.Now())
+	if !ok {
+		return errors.New("invalid verification code")
+	}
+	return s.repo.EnableTOTP(userID, step)
+}
+
+// DisableTOTP は、TOTP コードまたはリカバリーコードを確認して二要素認証を無効化します。
+func (s *authService) DisableTOTP(userID int, code, recoveryCode string) error {
+	if err := s.verifySecondFactor(userID, code, recoveryCode); err != nil {
+		return err
+	}
+	return s.repo.DisableTOTP(userID)
+}
+
+func (s *authService) VerifyTwoFactor(challengeToken, code, recoveryCode string) (int, error) {
+	userID, err := utils.ParseTwoFactorChallengeToken(challengeToken)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.verifySecondFactor(userID, code, recoveryCode); err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
+
+// verifySecondFactor は、有効化済みの TOTP コード、またはリカバリーコードを検証します。
+// 総当たりを防ぐため、ユーザーごとに twoFactorLockout の間に確認できる回数を制限します（チャレンジを取り直しても数える）。
+func (s *authService) verifySecondFactor(userID int, code, recoveryCode string) error {
+	secret, enabledAt, lastStep, err := s.repo.GetTOTPState(userID)
+	if err != nil {
+		return err
+	}
+	if !enabledAt.Valid {
+		return errors.New("two-factor authentication is not enabled")
+	}
+
+	attempts, err := s.repo.IncrementTwoFactorAttempts(userID, s.twoFactorLockout)
+	if err != nil {
+		return err
+	}
+	if attempts > int64(s.maxTwoFactorAttempts) {
+		return ErrTooManyTwoFactorAttempts
+	}
+
+	if err := s.checkSecondFactor(userID, secret, lastStep, code, recoveryCode); err != nil {
+		return err
+	}
+	if err := s.repo.ResetTwoFactorAttempts(userID); err != nil {
+		log.Printf("Failed to reset two-factor attempts of user %d: %v", userID, err)
+	}
+	return nil
+}
+
+func (s *authService) checkSecondFactor(userID int, secret string, lastStep int64, code, recoveryCode string) error {
+	if recoveryCode != "" {
+		return s.repo.ConsumeRecoveryCode(userID, utils.HashToken(utils.NormalizeRecoveryCode(recoveryCode)))
+	}
+
+	secret, err := utils.DecryptTOTPSecret(s.keyring, secret, s.allowPlaintextTOTPSecrets)
+	if err != nil {
+		return err
+	}
+	step, ok := utils.ValidateTOTP(secret, code, time.Now())
+	if !ok || step <= lastStep {
+		return errors.New("invalid verification code")
+	}
+	return s.repo.MarkTOTPStepUsed(userID, step)
+}
+
+// SignInWithSpotify は、次のルールでユーザーを決定します。
+//   - Spotifyアカウントが連携済みのユーザーがいれば、そのユーザーとしてサインインする
+//   - 未連携でメールアドレスが既存ユーザーと一致する場合は ErrAccountLinkRequired を返す
+//   - どちらでもなければ、パスワードなしのユーザーを作成して連携する
+func (s *authService) SignInWithSpotify(code, state string) (int, bool, error) {
+	stateData, err := s.musicService.ConsumeState(state, OAuthPurposeLogin)
+	if err != nil {
+		return 0, false, err
+	}
+	if stateData.Provider != spotifyProviderName {
+		return 0, false, errors.New("state was issued for another provider")
+	}
+	token, profile, err := s.musicService.ExchangeCode(spotifyProviderName, code, stateData.RedirectURI, stateData.CodeVerifier)
+	if err != nil {
+		return 0, false, err
+	}
+
+	ownerID, found, err := s.musicService.FindUserByServiceUserID(spotifyProviderName, profile.ID)
+	if err != nil {
+		return 0, false, err
+	}
+	if found {
+		if err := s.musicService.SaveConnection(spotifyProviderName, ownerID, token, profile); err != nil {
+			return 0, false, err
+		}
+		return ownerID, false, nil
+	}
+
+	if profile.Email == "" {
+		return 0, false, errors.New("spotify account has no email address")
+	}
+	if _, _, _, _, err := s.repo.GetUserByEmail(profile.Email); err == nil {
+		return 0, false, ErrAccountLinkRequired
+	}
+
+	userName := profile.DisplayName
+	if userName == "" {
+		userName = profile.ID
+	}
+	userID, err := s.repo.CreateUser(userName, profile.Email, "")
+	if err != nil {
+		return 0, false, err
+	}
+	if err := s.musicService.SaveConnection(spotifyProviderName, userID, token, profile); err != nil {
+		return 0, false, err
+	}
+
+	// Spotify のメールアドレスは確認済みとは限らないため、通常の登録と同様に確認メールを送る
+	if err := s.SendVerificationEmail(userID); err != nil {
+		log.Printf("Failed to send verification email to user %d: %v", userID, err)
 	}
-	return id, name, email, role, isSpotify, nil
+	return userID, true, nil
 }
 
-func (s *authService) UpdateProfile(userID int, userName, email string) error {
-	return s.repo.UpdateUserProfile(userID, userName, email)
+// BuildSpotifyLoginURL は、Spotifyサインイン用の認可URLを返します。
+func (s *authService) BuildSpotifyLoginURL() (string, error) {
+	redirectURI := utils.GetEnv("SPOTIFY_LOGIN_REDIRECT_URI", os.Getenv("SPOTIFY_REDIRECT_URI"))
+	return s.musicService.BuildAuthorizeURL(spotifyProviderName, 0, OAuthPurposeLogin, redirectURI)
 }
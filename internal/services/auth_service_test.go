@@ -0,0 +1,210 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"music-share-api/internal/repositories"
+	"music-share-api/internal/utils"
+)
+
+// memoryAuthRepository は、テスト用のインメモリ AuthRepository です。
+// テストで使わないメソッドは埋め込んだ nil のインターフェースに委ねる（呼ばれると panic する）。
+type memoryAuthRepository struct {
+	repositories.AuthRepository
+	users map[int]*memoryAuthUser
+}
+
+type memoryAuthUser struct {
+	userName        string
+	email           string
+	emailVerifiedAt sql.NullTime
+	hashPassword    string
+	totpSecret      string
+	totpEnabledAt   sql.NullTime
+	totpLastStep    int64
+	// recoveryCodes は、リカバリーコードのハッシュごとの使用済みかどうか
+	recoveryCodes     map[string]bool
+	twoFactorAttempts int64
+}
+
+func newMemoryAuthRepository() *memoryAuthRepository {
+	return &memoryAuthRepository{users: make(map[int]*memoryAuthUser)}
+}
+
+func (r *memoryAuthRepository) user(userID int) (*memoryAuthUser, error) {
+	user, ok := r.users[userID]
+	if !ok {
+		return nil, errors.New("user not found")
+	}
+	return user, nil
+}
+
+func (r *memoryAuthRepository) GetEmailVerification(userID int) (string, sql.NullTime, error) {
+	user, err := r.user(userID)
+	if err != nil {
+		return "", sql.NullTime{}, err
+	}
+	return user.email, user.emailVerifiedAt, nil
+}
+
+func (r *memoryAuthRepository) GetPasswordHash(userID int) (string, error) {
+	user, err := r.user(userID)
+	if err != nil {
+		return "", err
+	}
+	return user.hashPassword, nil
+}
+
+func (r *memoryAuthRepository) UpdateUserProfile(userID int, userName, email string) error {
+	user, err := r.user(userID)
+	if err != nil {
+		return err
+	}
+	if user.email != email {
+		user.emailVerifiedAt = sql.NullTime{}
+	}
+	user.userName = userName
+	user.email = email
+	return nil
+}
+
+func (r *memoryAuthRepository) GetTOTPState(userID int) (string, sql.NullTime, int64, error) {
+	user, err := r.user(userID)
+	if err != nil {
+		return "", sql.NullTime{}, 0, err
+	}
+	return user.totpSecret, user.totpEnabledAt, user.totpLastStep, nil
+}
+
+func (r *memoryAuthRepository) ConsumeRecoveryCode(userID int, codeHash string) error {
+	user, err := r.user(userID)
+	if err != nil {
+		return err
+	}
+	if used, ok := user.recoveryCodes[codeHash]; !ok || used {
+		return errors.New("invalid recovery code")
+	}
+	user.recoveryCodes[codeHash] = true
+	return nil
+}
+
+func (r *memoryAuthRepository) IncrementTwoFactorAttempts(userID int, window time.Duration) (int64, error) {
+	user, err := r.user(userID)
+	if err != nil {
+		return 0, err
+	}
+	user.twoFactorAttempts++
+	return user.twoFactorAttempts, nil
+}
+
+func (r *memoryAuthRepository) ResetTwoFactorAttempts(userID int) error {
+	user, err := r.user(userID)
+	if err != nil {
+		return err
+	}
+	user.twoFactorAttempts = 0
+	return nil
+}
+
+type authServiceFixture struct {
+	repository *memoryAuthRepository
+	mailer     *recordingMailer
+	service    *authService
+}
+
+// newAuthServiceFixture は、メールアドレス確認済みでパスワード "hash" のユーザー 1 を用意します。
+func newAuthServiceFixture(t *testing.T) *authServiceFixture {
+	t.Helper()
+	repository := newMemoryAuthRepository()
+	repository.users[1] = &memoryAuthUser{
+		userName:        "alice",
+		email:           "alice@example.com",
+		emailVerifiedAt: sql.NullTime{Time: time.Now(), Valid: true},
+		hashPassword:    "hash",
+	}
+	mailer := &recordingMailer{}
+	service := NewAuthService(repository, mailer, nil, nil).(*authService)
+	return &authServiceFixture{repository: repository, mailer: mailer, service: service}
+}
+
+func TestAuthServiceUpdateProfileRequiresPasswordToChangeEmail(t *testing.T) {
+	f := newAuthServiceFixture(t)
+
+	// ユーザー名だけの変更はパスワード不要
+	if err := f.service.UpdateProfile(1, "alice2", "alice@example.com", ""); err != nil {
+		t.Fatalf("UpdateProfile: %v", err)
+	}
+
+	// メールアドレスの変更は現在のパスワードが必要で、失敗した場合は何も変えない
+	for _, password := range []string{"", "wrong"} {
+		if err := f.service.UpdateProfile(1, "alice2", "attacker@example.com", password); !errors.Is(err, ErrInvalidCurrentPassword) {
+			t.Fatalf("password %q: err = %v, want ErrInvalidCurrentPassword", password, err)
+		}
+	}
+	if user := f.repository.users[1]; user.email != "alice@example.com" || !user.emailVerifiedAt.Valid || len(f.mailer.sent) != 0 {
+		t.Fatalf("email changed without the password: %+v, sent = %+v", user, f.mailer.sent)
+	}
+
+	if err := f.service.UpdateProfile(1, "alice2", "new@example.com", "hash"); err != nil {
+		t.Fatalf("UpdateProfile: %v", err)
+	}
+	if user := f.repository.users[1]; user.email != "new@example.com" || user.emailVerifiedAt.Valid {
+		t.Fatalf("unexpected user: %+v", user)
+	}
+	if len(f.mailer.sent) != 1 || f.mailer.sent[0].to != "new@example.com" {
+		t.Fatalf("expected a verification email to the new address, got %+v", f.mailer.sent)
+	}
+}
+
+func TestAuthServiceUpdateProfileRejectsUsersWithoutPassword(t *testing.T) {
+	f := newAuthServiceFixture(t)
+	// Spotifyサインインで作成されたユーザーはパスワードを持たない
+	f.repository.users[1].hashPassword = ""
+
+	if err := f.service.UpdateProfile(1, "alice", "attacker@example.com", ""); !errors.Is(err, ErrInvalidCurrentPassword) {
+		t.Fatalf("err = %v, want ErrInvalidCurrentPassword", err)
+	}
+}
+
+func TestAuthServiceRecoveryCodesAreSingleUse(t *testing.T) {
+	f := newAuthServiceFixture(t)
+	user := f.repository.users[1]
+	user.totpEnabledAt = sql.NullTime{Time: time.Now(), Valid: true}
+	user.recoveryCodes = map[string]bool{
+		utils.HashToken("ABCDEFGHIJ"): false,
+		utils.HashToken("KLMNOPQRST"): false,
+	}
+	challenge, err := utils.GenerateTwoFactorChallengeToken(1)
+	if err != nil {
+		t.Fatalf("GenerateTwoFactorChallengeToken: %v", err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		code string
+		ok   bool
+	}{
+		// 入力揺れ（小文字・ハイフンなし・空白）は吸収する
+		{"first use", "abcde-fghij", true},
+		{"reuse", "ABCDEFGHIJ", false},
+		{"reuse with different format", " abcde fghij ", false},
+		{"unknown code", "ZZZZZ-ZZZZZ", false},
+		{"another code", "klmnopqrst", true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			userID, err := f.service.VerifyTwoFactor(challenge, "", tt.code)
+			if tt.ok && (err != nil || userID != 1) {
+				t.Fatalf("VerifyTwoFactor = (%d, %v), want user 1", userID, err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("VerifyTwoFactor accepted a used or unknown recovery code")
+			}
+		})
+	}
+	if used := user.recoveryCodes[utils.HashToken("ABCDEFGHIJ")]; !used {
+		t.Fatal("recovery code was not marked as used")
+	}
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"music-share-api/internal/repositories"
+	"music-share-api/internal/utils"
+)
+
+// maxTagLength は、タグ1つあたりの最大文字数です（trx_room_tags.tag の長さ）。
+const maxTagLength = 32
+
+var (
+	// ErrInvalidGenre は、マスタにないジャンルが指定された場合に返されます。
+	ErrInvalidGenre = errors.New("unknown genre")
+	// ErrInvalidTags は、タグの数・長さ・文字が制限を超えた場合に返されます。
+	ErrInvalidTags = errors.New("invalid tags")
+)
+
+type GenreService interface {
+	// ListGenres は、ロケールに合わせた表示名と公開中のルーム数付きでジャンルを返します。
+	ListGenres(locale string) ([]repositories.Genre, error)
+	// NormalizeGenre は、表記揺れ（大文字小文字・空白・記号）を吸収してジャンルコードを返します。空文字はそのまま返します。
+	NormalizeGenre(genre string) (string, error)
+	// NormalizeTags は、タグを小文字に揃えて重複を除きます。
+	NormalizeTags(tags []string) ([]string, error)
+}
+
+type genreService struct {
+	genreRepository repositories.GenreRepository
+	defaultLocale   string
+	maxTags         int
+}
+
+func NewGenreService(genreRepository repositories.GenreRepository) GenreService {
+	return &genreService{
+		genreRepository: genreRepository,
+		defaultLocale:   utils.GetEnv("GENRE_DEFAULT_LOCALE", "ja"),
+		maxTags:         utils.GetEnvInt("ROOM_MAX_TAGS", 10),
+	}
+}
+
+func (s *genreService) ListGenres(locale string) ([]repositories.Genre, error) {
+	// "ja-JP" などは言語部分だけを使う
+	locale = strings.ToLower(strings.TrimSpace(locale))
+	if i := strings.IndexAny(locale, "-_"); i >= 0 {
+		locale = locale[:i]
+	}
+	if locale == "" {
+		locale = s.defaultLocale
+	}
+	return s.genreRepository.ListGenres(locale, s.defaultLocale)
+}
+
+func (s *genreService) NormalizeGenre(genre string) (string, error) {
+	key := genreKey(genre)
+	if key == "" {
+		return "", nil
+	}
+	codes, err := s.genreRepository.ListGenreCodes()
+	if err != nil {
+		return "", err
+	}
+	for _, code := range codes {
+		if genreKey(code) == key {
+			return code, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %q", ErrInvalidGenre, genre)
+}
+
+// genreKey は、比較用に英数字以外を除いて小文字にしたジャンル名を返します（"J-POP"・"jpop" はどちらも "jpop"）。
+// "&" は "and" として扱う（"R&B" と "r-and-b" を同じにする）。
+func genreKey(genre string) string {
+	genre = strings.ReplaceAll(strings.ToLower(genre), "&", "and")
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, genre)
+}
+
+func (s *genreService) NormalizeTags(tags []string) ([]string, error) {
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "#")
+		tag = strings.Join(strings.Fields(strings.ToLower(tag)), "-")
+		if tag == "" {
+			continue
+		}
+		if utf8.RuneCountInString(tag) > maxTagLength {
+			return nil, fmt.Errorf("%w: %q is longer than %d characters", ErrInvalidTags, tag, maxTagLength)
+		}
+		for _, r := range tag {
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_' {
+				return nil, fmt.Errorf("%w: %q contains an unsupported character", ErrInvalidTags, tag)
+			}
+		}
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	if len(normalized) > s.maxTags {
+		return nil, fmt.Errorf("%w: at most %d tags are allowed", ErrInvalidTags, s.maxTags)
+	}
+	return normalized, nil
+}
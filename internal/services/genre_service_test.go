@@ -0,0 +1,71 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestGenreServiceNormalizeGenre(t *testing.T) {
+	service := newTestGenreService()
+
+	for input, want := range map[string]string{
+		"J-POP":  "j-pop",
+		"jpop":   "j-pop",
+		" Jpop ": "j-pop",
+		"R&B":    "r-and-b",
+		"ROCK":   "rock",
+		"":       "",
+	} {
+		got, err := service.NormalizeGenre(input)
+		if err != nil || got != want {
+			t.Errorf("NormalizeGenre(%q) = %q, %v; want %q", input, got, err, want)
+		}
+	}
+	if _, err := service.NormalizeGenre("city pop"); !errors.Is(err, ErrInvalidGenre) {
+		t.Fatalf("err = %v, want ErrInvalidGenre", err)
+	}
+}
+
+func TestGenreServiceNormalizeTags(t *testing.T) {
+	service := newTestGenreService()
+
+	tags, err := service.NormalizeTags([]string{" #Chill ", "chill", "作業用", "late night", ""})
+	if err != nil {
+		t.Fatalf("NormalizeTags: %v", err)
+	}
+	if strings.Join(tags, ",") != "chill,作業用,late-night" {
+		t.Fatalf("tags = %v", tags)
+	}
+
+	for name, input := range map[string][]string{
+		"too long": {strings.Repeat("a", maxTagLength+1)},
+		"symbol":   {"rock!"},
+		"too many": strings.Split("a,b,c,d,e,f,g,h,i,j,k", ","),
+	} {
+		if _, err := service.NormalizeTags(input); !errors.Is(err, ErrInvalidTags) {
+			t.Errorf("%s: err = %v, want ErrInvalidTags", name, err)
+		}
+	}
+}
+
+func TestGenreServiceListGenresFallsBackToDefaultLocale(t *testing.T) {
+	service := newTestGenreService()
+
+	genres, err := service.ListGenres("en-US")
+	if err != nil {
+		t.Fatalf("ListGenres: %v", err)
+	}
+	if genres[1].Name != "Rock" {
+		t.Fatalf("genres = %+v", genres)
+	}
+
+	// 表示名のないロケールは既定のロケール（ja）、それもなければコードを使う
+	genres, err = service.ListGenres("fr")
+	if err != nil {
+		t.Fatalf("ListGenres: %v", err)
+	}
+	if genres[0].Name != "J-POP" || genres[2].Name != "r-and-b" {
+		t.Fatalf("genres = %+v", genres)
+	}
+}
@@ -0,0 +1,240 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"music-share-api/internal/repositories"
+	"music-share-api/internal/utils"
+)
+
+// ListeningWindowAll は、期間を区切らずに全期間を集計する指定です。
+const ListeningWindowAll = "all"
+
+const (
+	defaultListeningHistoryLimit = 50
+	maxListeningHistoryLimit     = 200
+	defaultListeningStatsLimit   = 10
+	maxListeningStatsLimit       = 50
+)
+
+// ErrInvalidListeningQuery は、視聴履歴・統計の取得条件が不正な場合に返されます。
+var ErrInvalidListeningQuery = errors.New("invalid listening query")
+
+// ListeningHistory は、視聴履歴の1ページ分です。NextCursor が空なら最後のページです。
+type ListeningHistory struct {
+	// Entries は新しい順
+	Entries    []repositories.ListeningEntry `json:"entries"`
+	NextCursor string                        `json:"nextCursor"`
+}
+
+// ListeningRank は、統計のランキングの1行です。
+type ListeningRank struct {
+	Name string `json:"name"`
+	// TrackID は曲のランキングのみ（Spotify 以外から追加された曲などでは空）
+	TrackID string `json:"trackId,omitempty"`
+	// Plays は一定時間以上聴いた回数
+	Plays      int `json:"plays"`
+	ListenedMs int `json:"listenedMs"`
+}
+
+// ListeningStats は、期間内の視聴の統計です。
+type ListeningStats struct {
+	Window string `json:"window"`
+	// Since は集計の開始時刻（全期間なら null）
+	Since            *time.Time               `json:"since"`
+	TotalListeningMs int                      `json:"totalListeningMs"`
+	TopArtists       []ListeningRank          `json:"topArtists"`
+	TopTracks        []ListeningRank          `json:"topTracks"`
+	TopRooms         []repositories.RoomVisit `json:"topRooms"`
+	FavoriteGenres   []ListeningRank          `json:"favoriteGenres"`
+}
+
+type ListeningService interface {
+	// GetListeningHistory は、ユーザーが参加中に再生された曲と聴いていた時間を新しい順に返します。
+	// window は集計期間（空なら既定の期間）、before は前のページの NextCursor（空なら最新から）。
+	GetListeningHistory(userID int, window, before string, limit int) (*ListeningHistory, error)
+	// GetListeningStats は、期間内のよく聴いたアーティスト・曲・ルーム・ジャンルと合計の視聴時間を返します。
+	GetListeningStats(userID int, window string, limit int) (*ListeningStats, error)
+}
+
+type listeningService struct {
+	listeningRepository repositories.ListeningRepository
+	// windows は指定できる集計期間（"7d" のような日数か "all"）
+	windows       []string
+	defaultWindow string
+	// minPlay より短い視聴は、再生回数に数えない
+	minPlay time.Duration
+	now     func() time.Time
+}
+
+func NewListeningService(listeningRepository repositories.ListeningRepository) ListeningService {
+	return &listeningService{
+		listeningRepository: listeningRepository,
+		windows:             utils.GetEnvList("LISTENING_STATS_WINDOWS", []string{"7d", "30d", "90d", "365d", ListeningWindowAll}),
+		defaultWindow:       utils.GetEnv("LISTENING_STATS_DEFAULT_WINDOW", "30d"),
+		minPlay:             utils.GetEnvDuration("LISTENING_MIN_PLAY", 30*time.Second),
+		now:                 time.Now,
+	}
+}
+
+// resolveWindow は、window（空なら既定の期間）を正規化して集計の開始時刻とあわせて返します。
+// 全期間の場合、since には TIMESTAMP 型で表せる最小の時刻を、sinceForResponse には nil を返す。
+func (s *listeningService) resolveWindow(window string) (normalized string, since time.Time, sinceForResponse *time.Time, err error) {
+	window = strings.ToLower(strings.TrimSpace(window))
+	if window == "" {
+		window = s.defaultWindow
+	}
+	allowed := false
+	for _, w := range s.windows {
+		if strings.EqualFold(strings.TrimSpace(w), window) {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return "", time.Time{}, nil, fmt.Errorf("%w: window must be one of %s", ErrInvalidListeningQuery, strings.Join(s.windows, ", "))
+	}
+	if window == ListeningWindowAll {
+		return window, time.Unix(1, 0).UTC(), nil, nil
+	}
+
+	days, err := strconv.Atoi(strings.TrimSuffix(window, "d"))
+	if err != nil || days < 1 || !strings.HasSuffix(window, "d") {
+		return "", time.Time{}, nil, fmt.Errorf("%w: invalid window %q", ErrInvalidListeningQuery, window)
+	}
+	since = s.now().AddDate(0, 0, -days)
+	return window, since, &since, nil
+}
+
+func (s *listeningService) GetListeningHistory(userID int, window, before string, limit int) (*ListeningHistory, error) {
+	if limit == 0 {
+		limit = defaultListeningHistoryLimit
+	}
+	if limit < 1 || limit > maxListeningHistoryLimit {
+		return nil, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidListeningQuery, maxListeningHistoryLimit)
+	}
+	var beforeID int64
+	if before != "" {
+		parsed, err := strconv.ParseInt(before, 10, 64)
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("%w: invalid cursor", ErrInvalidListeningQuery)
+		}
+		beforeID = parsed
+	}
+	_, since, _, err := s.resolveWindow(window)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := s.listeningRepository.ListListeningHistory(userID, since, beforeID, limit)
+	if err != nil {
+		return nil, err
+	}
+	history := &ListeningHistory{Entries: entries}
+	if len(entries) == limit {
+		history.NextCursor = strconv.FormatInt(entries[len(entries)-1].PlayID, 10)
+	}
+	return history, nil
+}
+
+func (s *listeningService) GetListeningStats(userID int, window string, limit int) (*ListeningStats, error) {
+	if limit == 0 {
+		limit = defaultListeningStatsLimit
+	}
+	if limit < 1 || limit > maxListeningStatsLimit {
+		return nil, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidListeningQuery, maxListeningStatsLimit)
+	}
+	window, since, sincePtr, err := s.resolveWindow(window)
+	if err != nil {
+		return nil, err
+	}
+	minListenMs := int(s.minPlay / time.Millisecond)
+
+	stats := &ListeningStats{Window: window, Since: sincePtr}
+	if stats.TotalListeningMs, err = s.listeningRepository.GetTotalListeningMs(userID, since); err != nil {
+		return nil, err
+	}
+
+	artists, err := s.listeningRepository.CountListeningByArtist(userID, since, minListenMs)
+	if err != nil {
+		return nil, err
+	}
+	stats.TopArtists = rankListening(mergeArtistCounts(artists), limit, false)
+
+	tracks, err := s.listeningRepository.CountListeningByTrack(userID, since, minListenMs)
+	if err != nil {
+		return nil, err
+	}
+	stats.TopTracks = rankListening(tracks, limit, true)
+
+	genres, err := s.listeningRepository.CountListeningByGenre(userID, since, minListenMs)
+	if err != nil {
+		return nil, err
+	}
+	stats.FavoriteGenres = rankListening(genres, limit, false)
+
+	if stats.TopRooms, err = s.listeningRepository.ListRoomVisits(userID, since, limit); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// mergeArtistCounts は、"Band A, Band B" のような連名を1人ずつに分けて数え直します。
+// 大文字・小文字だけが違う名前は同じアーティストとして扱い、最初に現れた表記を使う。
+func mergeArtistCounts(counts []repositories.ListeningCount) []repositories.ListeningCount {
+	var merged []repositories.ListeningCount
+	indexes := make(map[string]int)
+	for _, count := range counts {
+		for _, name := range splitArtists(count.Label) {
+			key := strings.ToLower(name)
+			i, ok := indexes[key]
+			if !ok {
+				i = len(merged)
+				indexes[key] = i
+				merged = append(merged, repositories.ListeningCount{Key: key, Label: name})
+			}
+			merged[i].Plays += count.Plays
+			merged[i].ListenedMs += count.ListenedMs
+		}
+	}
+	return merged
+}
+
+// rankListening は、聴いていた時間の長い順（同じなら再生回数の多い順）に最大 limit 件を返します。
+// 聴いていた時間が0のものは含めない。
+func rankListening(counts []repositories.ListeningCount, limit int, withTrackID bool) []ListeningRank {
+	sorted := make([]repositories.ListeningCount, 0, len(counts))
+	for _, count := range counts {
+		if count.ListenedMs > 0 {
+			sorted = append(sorted, count)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].ListenedMs != sorted[j].ListenedMs {
+			return sorted[i].ListenedMs > sorted[j].ListenedMs
+		}
+		if sorted[i].Plays != sorted[j].Plays {
+			return sorted[i].Plays > sorted[j].Plays
+		}
+		return sorted[i].Label < sorted[j].Label
+	})
+	if len(sorted) > limit {
+		sorted = sorted[:limit]
+	}
+
+	ranks := make([]ListeningRank, 0, len(sorted))
+	for _, count := range sorted {
+		rank := ListeningRank{Name: count.Label, Plays: count.Plays, ListenedMs: count.ListenedMs}
+		// track_id がない曲は、キーに曲名とアーティストを使っている
+		if withTrackID && count.Key != count.Label {
+			rank.TrackID = count.Key
+		}
+		ranks = append(ranks, rank)
+	}
+	return ranks
+}
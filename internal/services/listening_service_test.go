@@ -0,0 +1,248 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"music-share-api/internal/repositories"
+)
+
+// memoryListeningRepository は、テスト用のインメモリ ListeningRepository です。
+// entries の ListenedMs を、参加期間と再生期間が重なった時間として扱う。
+type memoryListeningRepository struct {
+	entries []repositories.ListeningEntry
+	genres  map[int]string
+	visits  []repositories.RoomVisit
+	since   time.Time
+}
+
+func (r *memoryListeningRepository) listens(since time.Time) []repositories.ListeningEntry {
+	r.since = since
+	var listens []repositories.ListeningEntry
+	for _, entry := range r.entries {
+		if !entry.StartedAt.Before(since) {
+			listens = append(listens, entry)
+		}
+	}
+	return listens
+}
+
+func (r *memoryListeningRepository) ListListeningHistory(userID int, since time.Time, beforeID int64, limit int) ([]repositories.ListeningEntry, error) {
+	entries := []repositories.ListeningEntry{}
+	listens := r.listens(since)
+	for i := len(listens) - 1; i >= 0 && len(entries) < limit; i-- {
+		if beforeID == 0 || listens[i].PlayID < beforeID {
+			entries = append(entries, listens[i])
+		}
+	}
+	return entries, nil
+}
+
+func (r *memoryListeningRepository) GetTotalListeningMs(userID int, since time.Time) (int, error) {
+	total := 0
+	for _, entry := range r.listens(since) {
+		total += entry.ListenedMs
+	}
+	return total, nil
+}
+
+func (r *memoryListeningRepository) count(since time.Time, minListenMs int, key func(repositories.ListeningEntry) (string, string)) []repositories.ListeningCount {
+	var counts []repositories.ListeningCount
+	indexes := make(map[string]int)
+	for _, entry := range r.listens(since) {
+		k, label := key(entry)
+		if k == "" {
+			continue
+		}
+		i, ok := indexes[k]
+		if !ok {
+			i = len(counts)
+			indexes[k] = i
+			counts = append(counts, repositories.ListeningCount{Key: k, Label: label})
+		}
+		if entry.ListenedMs >= minListenMs {
+			counts[i].Plays++
+		}
+		counts[i].ListenedMs += entry.ListenedMs
+	}
+	return counts
+}
+
+func (r *memoryListeningRepository) CountListeningByTrack(userID int, since time.Time, minListenMs int) ([]repositories.ListeningCount, error) {
+	return r.count(since, minListenMs, func(entry repositories.ListeningEntry) (string, string) {
+		label := entry.SongName + " - " + entry.Artist
+		if entry.TrackID != "" {
+			return entry.TrackID, label
+		}
+		return label, label
+	}), nil
+}
+
+func (r *memoryListeningRepository) CountListeningByArtist(userID int, since time.Time, minListenMs int) ([]repositories.ListeningCount, error) {
+	return r.count(since, minListenMs, func(entry repositories.ListeningEntry) (string, string) {
+		return entry.Artist, entry.Artist
+	}), nil
+}
+
+func (r *memoryListeningRepository) CountListeningByGenre(userID int, since time.Time, minListenMs int) ([]repositories.ListeningCount, error) {
+	return r.count(since, minListenMs, func(entry repositories.ListeningEntry) (string, string) {
+		return r.genres[entry.RoomID], r.genres[entry.RoomID]
+	}), nil
+}
+
+func (r *memoryListeningRepository) ListRoomVisits(userID int, since time.Time, limit int) ([]repositories.RoomVisit, error) {
+	if len(r.visits) > limit {
+		return r.visits[:limit], nil
+	}
+	return r.visits, nil
+}
+
+func newListeningFixture(t *testing.T) (*memoryListeningRepository, *listeningService, time.Time) {
+	t.Helper()
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	at := func(daysAgo int) time.Time { return now.AddDate(0, 0, -daysAgo) }
+	repository := &memoryListeningRepository{
+		entries: []repositories.ListeningEntry{
+			{PlayID: 1, RoomID: 1, TrackID: "t-old", SongName: "Old Song", Artist: "Band Z", StartedAt: at(60), ListenedMs: 600000},
+			{PlayID: 2, RoomID: 1, TrackID: "t1", SongName: "Blue Sky", Artist: "Band A, Band B", StartedAt: at(5), ListenedMs: 200000},
+			{PlayID: 3, RoomID: 2, TrackID: "t2", SongName: "Red Sun", Artist: "band a", StartedAt: at(4), ListenedMs: 150000},
+			// 途中で抜けたため、再生回数には数えない
+			{PlayID: 4, RoomID: 2, TrackID: "t1", SongName: "Blue Sky", Artist: "Band A, Band B", StartedAt: at(3), ListenedMs: 10000},
+			{PlayID: 5, RoomID: 2, SongName: "Local Demo", Artist: "Band C", StartedAt: at(2), ListenedMs: 90000},
+		},
+		genres: map[int]string{1: "j-pop", 2: "rock"},
+		visits: []repositories.RoomVisit{
+			{RoomID: 2, RoomName: "Rock Room", Visits: 3, ListenedMs: 250000},
+			{RoomID: 1, RoomName: "Pop Room", Visits: 1, ListenedMs: 200000},
+		},
+	}
+	service := NewListeningService(repository).(*listeningService)
+	service.now = func() time.Time { return now }
+	return repository, service, now
+}
+
+func TestListeningServiceStats(t *testing.T) {
+	repository, service, now := newListeningFixture(t)
+
+	stats, err := service.GetListeningStats(1, "", 0)
+	if err != nil {
+		t.Fatalf("GetListeningStats failed: %v", err)
+	}
+	if stats.Window != "30d" || stats.Since == nil || !stats.Since.Equal(now.AddDate(0, 0, -30)) || !repository.since.Equal(*stats.Since) {
+		t.Fatalf("unexpected window: %q since %v (repository %v)", stats.Window, stats.Since, repository.since)
+	}
+	if stats.TotalListeningMs != 450000 {
+		t.Fatalf("expected 450000ms in total, got %d", stats.TotalListeningMs)
+	}
+
+	// 連名は分けて数え、大文字・小文字の違いは同じアーティストとしてまとめる
+	wantArtists := []ListeningRank{
+		{Name: "Band A", Plays: 2, ListenedMs: 360000},
+		{Name: "Band B", Plays: 1, ListenedMs: 210000},
+		{Name: "Band C", Plays: 1, ListenedMs: 90000},
+	}
+	if len(stats.TopArtists) != len(wantArtists) {
+		t.Fatalf("unexpected artists: %+v", stats.TopArtists)
+	}
+	for i, want := range wantArtists {
+		if stats.TopArtists[i] != want {
+			t.Fatalf("artist %d: expected %+v, got %+v", i, want, stats.TopArtists[i])
+		}
+	}
+
+	wantTracks := []ListeningRank{
+		{Name: "Blue Sky - Band A, Band B", TrackID: "t1", Plays: 1, ListenedMs: 210000},
+		{Name: "Red Sun - band a", TrackID: "t2", Plays: 1, ListenedMs: 150000},
+		{Name: "Local Demo - Band C", Plays: 1, ListenedMs: 90000},
+	}
+	if len(stats.TopTracks) != len(wantTracks) {
+		t.Fatalf("unexpected tracks: %+v", stats.TopTracks)
+	}
+	for i, want := range wantTracks {
+		if stats.TopTracks[i] != want {
+			t.Fatalf("track %d: expected %+v, got %+v", i, want, stats.TopTracks[i])
+		}
+	}
+
+	if len(stats.FavoriteGenres) != 2 || stats.FavoriteGenres[0].Name != "rock" || stats.FavoriteGenres[0].ListenedMs != 250000 {
+		t.Fatalf("unexpected genres: %+v", stats.FavoriteGenres)
+	}
+	if len(stats.TopRooms) != 2 || stats.TopRooms[0].RoomID != 2 {
+		t.Fatalf("unexpected rooms: %+v", stats.TopRooms)
+	}
+}
+
+func TestListeningServiceStatsWindowsAndLimit(t *testing.T) {
+	_, service, _ := newListeningFixture(t)
+
+	stats, err := service.GetListeningStats(1, "ALL", 1)
+	if err != nil {
+		t.Fatalf("GetListeningStats failed: %v", err)
+	}
+	if stats.Window != ListeningWindowAll || stats.Since != nil {
+		t.Fatalf("expected the whole period, got %q since %v", stats.Window, stats.Since)
+	}
+	if stats.TotalListeningMs != 1050000 {
+		t.Fatalf("expected 1050000ms in total, got %d", stats.TotalListeningMs)
+	}
+	if len(stats.TopArtists) != 1 || stats.TopArtists[0].Name != "Band Z" {
+		t.Fatalf("expected only the top artist, got %+v", stats.TopArtists)
+	}
+	if len(stats.TopRooms) != 1 {
+		t.Fatalf("expected only the top room, got %+v", stats.TopRooms)
+	}
+
+	for _, tc := range []struct {
+		window string
+		limit  int
+	}{
+		{window: "14d"},
+		{window: "month"},
+		{window: "30d", limit: -1},
+		{window: "30d", limit: maxListeningStatsLimit + 1},
+	} {
+		if _, err := service.GetListeningStats(1, tc.window, tc.limit); !errors.Is(err, ErrInvalidListeningQuery) {
+			t.Fatalf("window %q limit %d: expected ErrInvalidListeningQuery, got %v", tc.window, tc.limit, err)
+		}
+	}
+
+	// 期間の候補は設定で変えられる
+	service.windows = []string{"14d", ListeningWindowAll}
+	if stats, err := service.GetListeningStats(1, "14d", 0); err != nil || stats.TotalListeningMs != 450000 {
+		t.Fatalf("expected the configured window to be accepted, got %+v, %v", stats, err)
+	}
+}
+
+func TestListeningServiceHistoryPagination(t *testing.T) {
+	_, service, _ := newListeningFixture(t)
+
+	first, err := service.GetListeningHistory(1, "", "", 2)
+	if err != nil {
+		t.Fatalf("GetListeningHistory failed: %v", err)
+	}
+	if len(first.Entries) != 2 || first.Entries[0].PlayID != 5 || first.Entries[1].PlayID != 4 || first.NextCursor != "4" {
+		t.Fatalf("unexpected first page: %+v", first)
+	}
+
+	second, err := service.GetListeningHistory(1, "", first.NextCursor, 2)
+	if err != nil {
+		t.Fatalf("GetListeningHistory failed: %v", err)
+	}
+	if len(second.Entries) != 2 || second.Entries[0].PlayID != 3 || second.NextCursor != "2" {
+		t.Fatalf("unexpected second page: %+v", second)
+	}
+
+	// 30日より前の再生は含めない
+	last, err := service.GetListeningHistory(1, "", second.NextCursor, 2)
+	if err != nil {
+		t.Fatalf("GetListeningHistory failed: %v", err)
+	}
+	if len(last.Entries) != 0 || last.NextCursor != "" {
+		t.Fatalf("expected an empty last page, got %+v", last)
+	}
+
+	if _, err := service.GetListeningHistory(1, "", "abc", 0); !errors.Is(err, ErrInvalidListeningQuery) {
+		t.Fatalf("expected ErrInvalidListeningQuery for a bad cursor, got %v", err)
+	}
+}
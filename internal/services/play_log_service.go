@@ -0,0 +1,173 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"music-share-api/internal/repositories"
+	"music-share-api/internal/utils"
+)
+
+// 再生記録の終わり方（trx_room_plays.outcome）
+const (
+	RoomPlayCompleted = "completed"
+	RoomPlaySkipped   = "skipped"
+	RoomPlayStopped   = "stopped"
+)
+
+// roomPlayCompletedRatio 以上再生してから次の曲に進んだ場合は、最後まで再生したとみなす
+const roomPlayCompletedRatio = 0.9
+
+const (
+	defaultRoomHistoryLimit = 50
+	maxRoomHistoryLimit     = 200
+)
+
+// ErrInvalidHistoryQuery は、再生履歴の取得条件が不正な場合に返されます。
+var ErrInvalidHistoryQuery = errors.New("invalid history query")
+
+// RoomSession は、間を空けずに続けて再生された曲のまとまりです。
+type RoomSession struct {
+	StartedAt time.Time `json:"startedAt"`
+	// EndedAt は最後の曲の終了時刻（再生中なら null）
+	EndedAt *time.Time `json:"endedAt"`
+	// Plays は再生した順
+	Plays []repositories.RoomPlay `json:"plays"`
+}
+
+// RoomHistory は、ルームの再生履歴の1ページ分です。NextCursor が空なら最後のページです。
+type RoomHistory struct {
+	// Sessions は新しい順
+	Sessions   []RoomSession `json:"sessions"`
+	NextCursor string        `json:"nextCursor"`
+}
+
+type PlayLogService interface {
+	// RecordPlayback は、再生状態の変更（変更前のルーム room と変更後の state）から再生記録を更新します。
+	RecordPlayback(userID int, room *repositories.RoomAllInfo, state repositories.PlaybackState) error
+	// GetRoomHistory は、ルームの再生履歴をセッションごとにまとめて返します（ホストと参加したことのあるユーザーのみ）。
+	// before は前のページの NextCursor（空なら最新から）。
+	GetRoomHistory(userID, roomID int, before string, limit int) (*RoomHistory, error)
+}
+
+type playLogService struct {
+	playLogRepository repositories.PlayLogRepository
+	// sessionGap より長く再生が途切れたら、別のセッションとして扱う
+	sessionGap time.Duration
+	now        func() time.Time
+}
+
+func NewPlayLogService(playLogRepository repositories.PlayLogRepository) PlayLogService {
+	return &playLogService{
+		playLogRepository: playLogRepository,
+		sessionGap:        utils.GetEnvDuration("ROOM_SESSION_GAP", 30*time.Minute),
+		now:               time.Now,
+	}
+}
+
+func (s *playLogService) RecordPlayback(userID int, room *repositories.RoomAllInfo, state repositories.PlaybackState) error {
+	// 一時停止・シークでは記録を区切らない
+	if state.RoomStatus != RoomStatusPlaying {
+		return nil
+	}
+	song, ok := room.Songs[strconv.Itoa(state.PlayingSongIndex)]
+	if !ok {
+		return nil
+	}
+
+	current, found, err := s.playLogRepository.GetCurrentPlay(room.RoomID)
+	if err != nil {
+		return err
+	}
+	if found && current.SongIndex == state.PlayingSongIndex && current.SongID == song.SongId {
+		// 同じ曲の再開
+		return nil
+	}
+	if found {
+		playedMs := currentPositionMs(room.RedisData, s.now())
+		if current.SongLength > 0 && playedMs > current.SongLength {
+			playedMs = current.SongLength
+		}
+		outcome := RoomPlaySkipped
+		if current.SongLength > 0 && float64(playedMs) >= float64(current.SongLength)*roomPlayCompletedRatio {
+			outcome = RoomPlayCompleted
+		}
+		if err := s.playLogRepository.EndPlay(current.PlayID, outcome, playedMs); err != nil {
+			return err
+		}
+	}
+
+	_, err = s.playLogRepository.StartPlay(repositories.RoomPlay{
+		RoomID:     room.RoomID,
+		SongIndex:  state.PlayingSongIndex,
+		SongID:     song.SongId,
+		TrackID:    song.TrackID,
+		SongName:   song.SongName,
+		Artist:     song.Artist,
+		SongLength: song.SongLength,
+		StartedBy:  userID,
+		// ホストは参加者リストに含まれないため1を足す
+		ListenerCount: len(room.RedisData.Participants) + 1,
+	})
+	return err
+}
+
+func (s *playLogService) GetRoomHistory(userID, roomID int, before string, limit int) (*RoomHistory, error) {
+	if limit == 0 {
+		limit = defaultRoomHistoryLimit
+	}
+	if limit < 1 || limit > maxRoomHistoryLimit {
+		return nil, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidHistoryQuery, maxRoomHistoryLimit)
+	}
+	var beforeID int64
+	if before != "" {
+		parsed, err := strconv.ParseInt(before, 10, 64)
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("%w: invalid cursor", ErrInvalidHistoryQuery)
+		}
+		beforeID = parsed
+	}
+
+	allowed, err := s.playLogRepository.CanViewRoomHistory(roomID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, ErrNotRoomMember
+	}
+
+	plays, err := s.playLogRepository.ListRoomPlays(roomID, beforeID, limit)
+	if err != nil {
+		return nil, err
+	}
+	history := &RoomHistory{Sessions: s.groupSessions(plays)}
+	if len(plays) == limit {
+		history.NextCursor = strconv.FormatInt(plays[len(plays)-1].PlayID, 10)
+	}
+	return history, nil
+}
+
+// groupSessions は、新しい順の再生記録をセッションにまとめ、新しいセッションから順に返します。
+func (s *playLogService) groupSessions(plays []repositories.RoomPlay) []RoomSession {
+	sessions := []RoomSession{}
+	var lastEnd time.Time
+	for i := len(plays) - 1; i >= 0; i-- {
+		play := plays[i]
+		if len(sessions) == 0 || play.StartedAt.Sub(lastEnd) > s.sessionGap {
+			sessions = append(sessions, RoomSession{StartedAt: play.StartedAt})
+		}
+		session := &sessions[len(sessions)-1]
+		session.Plays = append(session.Plays, play)
+		session.EndedAt = play.EndedAt
+		lastEnd = s.now()
+		if play.EndedAt != nil {
+			lastEnd = *play.EndedAt
+		}
+	}
+	for i, j := 0, len(sessions)-1; i < j; i, j = i+1, j-1 {
+		sessions[i], sessions[j] = sessions[j], sessions[i]
+	}
+	return sessions
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"music-share-api/internal/repositories"
+)
+
+func TestPlayLogServiceRecordsPlaybackChanges(t *testing.T) {
+	f := newPlaybackServiceFixture(t)
+	room := f.roomRepository.rooms[f.roomID]
+	room.Songs["0"] = repositories.Song{SongId: "t1", SongName: "Blue Sky", SongLength: 200000}
+	room.Songs["1"] = repositories.Song{SongId: "t2", SongName: "Red Sun", SongLength: 180000}
+
+	if _, err := f.service.UpdatePlayback(1, f.roomID, PlaybackInput{Action: "play", SongIndex: intPtr(0)}); err != nil {
+		t.Fatalf("UpdatePlayback: %v", err)
+	}
+	// 一時停止・再開・シークでは区切らない
+	for _, input := range []PlaybackInput{{Action: "pause"}, {Action: "play"}, {Action: "seek", PositionMs: intPtr(190000)}} {
+		if _, err := f.service.UpdatePlayback(1, f.roomID, input); err != nil {
+			t.Fatalf("UpdatePlayback(%s): %v", input.Action, err)
+		}
+	}
+	if got := len(f.playLogRepository.plays); got != 1 {
+		t.Fatalf("plays = %d, want 1", got)
+	}
+
+	// 9割以上再生してから次の曲へ進んだ場合は completed、途中なら skipped
+	if _, err := f.service.UpdatePlayback(1, f.roomID, PlaybackInput{Action: "play", SongIndex: intPtr(1)}); err != nil {
+		t.Fatalf("UpdatePlayback: %v", err)
+	}
+	if _, err := f.service.UpdatePlayback(1, f.roomID, PlaybackInput{Action: "play", SongIndex: intPtr(0)}); err != nil {
+		t.Fatalf("UpdatePlayback: %v", err)
+	}
+
+	plays := f.playLogRepository.plays
+	if len(plays) != 3 {
+		t.Fatalf("plays = %+v", plays)
+	}
+	if plays[0].SongID != "t1" || plays[0].Outcome != RoomPlayCompleted || plays[0].PlayedMs < 190000 || plays[0].StartedBy != 1 {
+		t.Fatalf("first play = %+v", plays[0])
+	}
+	// ホストと参加者4人
+	if plays[0].ListenerCount != 5 {
+		t.Fatalf("listener count = %d, want 5", plays[0].ListenerCount)
+	}
+	if plays[1].SongID != "t2" || plays[1].Outcome != RoomPlaySkipped {
+		t.Fatalf("second play = %+v", plays[1])
+	}
+	if plays[2].EndedAt != nil {
+		t.Fatalf("current play = %+v, want open", plays[2])
+	}
+}
+
+func TestPlayLogServiceGetRoomHistory(t *testing.T) {
+	repository := newMemoryPlayLogRepository()
+	repository.viewers[1] = map[int]bool{1: true, 2: true}
+	base := time.Date(2026, 10, 18, 20, 0, 0, 0, time.UTC)
+	// 1時間あけて2回のセッション
+	for i, startedAt := range []time.Time{base, base.Add(4 * time.Minute), base.Add(time.Hour + 8*time.Minute), base.Add(time.Hour + 12*time.Minute)} {
+		endedAt := startedAt.Add(4 * time.Minute)
+		repository.plays = append(repository.plays, repositories.RoomPlay{
+			PlayID: int64(i + 1), RoomID: 1, SongID: "t1", StartedAt: startedAt, EndedAt: &endedAt, Outcome: RoomPlayCompleted,
+		})
+	}
+	service := NewPlayLogService(repository)
+
+	if _, err := service.GetRoomHistory(3, 1, "", 0); !errors.Is(err, ErrNotRoomMember) {
+		t.Fatalf("err = %v, want ErrNotRoomMember", err)
+	}
+	if _, err := service.GetRoomHistory(2, 1, "abc", 0); !errors.Is(err, ErrInvalidHistoryQuery) {
+		t.Fatalf("err = %v, want ErrInvalidHistoryQuery", err)
+	}
+
+	history, err := service.GetRoomHistory(2, 1, "", 0)
+	if err != nil {
+		t.Fatalf("GetRoomHistory: %v", err)
+	}
+	if len(history.Sessions) != 2 || history.NextCursor != "" {
+		t.Fatalf("history = %+v", history)
+	}
+	latest := history.Sessions[0]
+	if len(latest.Plays) != 2 || latest.Plays[0].PlayID != 3 || !latest.StartedAt.Equal(base.Add(time.Hour+8*time.Minute)) || !latest.EndedAt.Equal(base.Add(time.Hour+16*time.Minute)) {
+		t.Fatalf("latest session = %+v", latest)
+	}
+
+	// ページを分けて取得しても、すべての記録を1回ずつ返す
+	var ids []int64
+	cursor := ""
+	for {
+		page, err := service.GetRoomHistory(1, 1, cursor, 3)
+		if err != nil {
+			t.Fatalf("GetRoomHistory: %v", err)
+		}
+		for _, session := range page.Sessions {
+			for _, play := range session.Plays {
+				ids = append(ids, play.PlayID)
+			}
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	if len(ids) != 4 || ids[0] != 1 || ids[3] != 4 {
+		t.Fatalf("ids = %v", ids)
+	}
+}
@@ -0,0 +1,303 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"music-share-api/internal/providers"
+	"music-share-api/internal/repositories"
+	"music-share-api/internal/utils"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ルームの再生状態（RedisRoomData.RoomStatus）
+const (
+	RoomStatusPlaying = "playing"
+	RoomStatusPaused  = "paused"
+)
+
+// 再生同期に失敗した理由
+const (
+	PlaybackFailureNoActiveDevice  = "no_active_device"
+	PlaybackFailurePremiumRequired = "premium_required"
+	PlaybackFailureNotConnected    = "not_connected"
+	PlaybackFailureRateLimited     = "rate_limited"
+	PlaybackFailureProviderError   = "provider_error"
+	// PlaybackFailureUnavailable は、プロバイダーへのリクエストが続けて失敗しており、送らなかったことを表します。
+	PlaybackFailureUnavailable = "provider_unavailable"
+	// PlaybackFailureRelinkRequired は、連携時に再生操作のスコープを許可しておらず、再連携が必要なことを表します。
+	PlaybackFailureRelinkRequired = "relink_required"
+)
+
+type PlaybackService interface {
+	// SetPlaybackSync は、ルームの再生状態を自分の Spotify デバイスに同期するかどうかを設定します。
+	SetPlaybackSync(userID int, roomID int, enabled bool) error
+	// UpdatePlayback は、ホストがルームの再生状態を変更し、再生同期を有効にしている参加者のデバイスに反映します。
+	UpdatePlayback(userID int, roomID int, input PlaybackInput) (*repositories.RedisRoomData, error)
+}
+
+// PlaybackInput は、再生状態の変更内容です。
+type PlaybackInput struct {
+	// Action は "play"・"pause"・"seek" のいずれか
+	Action string
+	// SongIndex は play で曲を切り替える場合に指定する
+	SongIndex *int
+	// PositionMs は再生位置（seek では必須。play で曲を切り替える場合の省略時は先頭）
+	PositionMs *int
+}
+
+// PlaybackResult は、参加者1人分の再生同期の結果です。
+type PlaybackResult struct {
+	UserID   int    `json:"userId"`
+	Success  bool   `json:"success"`
+	Reason   string `json:"reason,omitempty"`
+	Attempts int    `json:"attempts"`
+}
+
+// ErrInvalidPlayback は、再生状態の変更内容が不正な場合に返されます。
+var ErrInvalidPlayback = errors.New("invalid playback request")
+
+type playbackService struct {
+	roomRepository   repositories.RoomRepository
+	roomEventService RoomEventService
+	musicService     MusicService
+	playLogService   PlayLogService
+	maxAttempts      int
+	baseBackoff      time.Duration
+	maxBackoff       time.Duration
+	// now・sleep・dispatch はテストで差し替えられるようにしている
+	now      func() time.Time
+	sleep    func(time.Duration)
+	dispatch func(func())
+}
+
+func NewPlaybackService(roomRepository repositories.RoomRepository, roomEventService RoomEventService, musicService MusicService, playLogService PlayLogService) PlaybackService {
+	return &playbackService{
+		roomRepository:   roomRepository,
+		roomEventService: roomEventService,
+		musicService:     musicService,
+		playLogService:   playLogService,
+		maxAttempts:      utils.GetEnvInt("PLAYBACK_SYNC_MAX_ATTEMPTS", 3),
+		baseBackoff:      utils.GetEnvDuration("PLAYBACK_SYNC_BASE_BACKOFF", 500*time.Millisecond),
+		maxBackoff:       utils.GetEnvDuration("PLAYBACK_SYNC_MAX_BACKOFF", 5*time.Second),
+		now:              time.Now,
+		sleep:            time.Sleep,
+		dispatch:         func(f func()) { go f() },
+	}
+}
+
+func (s *playbackService) SetPlaybackSync(userID int, roomID int, enabled bool) error {
+	room, err := s.roomRepository.GetRoomByID(roomID)
+	if err != nil {
+		return fmt.Errorf("failed to get room: %w", err)
+	}
+	if !isRoomMember(room, userID) {
+		return ErrNotRoomMember
+	}
+	// 同期にはサーバー側で保持しているトークンを使うため、連携済みであることを確認しておく
+	if enabled {
+		if _, err := s.musicService.AccessToken(spotifyProviderName, userID); err != nil {
+			return err
+		}
+	}
+
+	if err := s.roomRepository.SetPlaybackSync(roomID, userID, enabled); err != nil {
+		return err
+	}
+
+	// 再生中のルームで有効にした場合は、現在の曲と位置にすぐ合わせる
+	if enabled && room.RedisData.RoomStatus == RoomStatusPlaying {
+		song, ok := room.Songs[strconv.Itoa(room.RedisData.PlayingSongIndex)]
+		if ok {
+			command := providers.PlaybackCommand{Action: providers.PlaybackActionPlay, TrackID: song.SongId}
+			s.dispatch(func() { s.syncParticipants(roomID, []int{userID}, command, room.RedisData) })
+		}
+	}
+	return nil
+}
+
+func (s *playbackService) UpdatePlayback(userID int, roomID int, input PlaybackInput) (*repositories.RedisRoomData, error) {
+	room, err := s.roomRepository.GetRoomByID(roomID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get room: %w", err)
+	}
+	if room.HostUserID != userID {
+		return nil, ErrNotRoomHost
+	}
+	if input.PositionMs != nil && *input.PositionMs < 0 {
+		return nil, fmt.Errorf("%w: positionMs must not be negative", ErrInvalidPlayback)
+	}
+
+	state := repositories.PlaybackState{
+		RoomStatus:       room.RedisData.RoomStatus,
+		PlayingSongIndex: room.RedisData.PlayingSongIndex,
+		PositionMs:       currentPositionMs(room.RedisData, s.now()),
+	}
+	command := providers.PlaybackCommand{Action: input.Action}
+
+	switch input.Action {
+	case providers.PlaybackActionPlay:
+		state.RoomStatus = RoomStatusPlaying
+		if input.SongIndex != nil && *input.SongIndex != state.PlayingSongIndex {
+			state.PlayingSongIndex = *input.SongIndex
+			state.PositionMs = 0
+		}
+		if input.PositionMs != nil {
+			state.PositionMs = *input.PositionMs
+		}
+	case providers.PlaybackActionPause:
+		state.RoomStatus = RoomStatusPaused
+		if input.PositionMs != nil {
+			state.PositionMs = *input.PositionMs
+		}
+	case providers.PlaybackActionSeek:
+		if input.PositionMs == nil {
+			return nil, fmt.Errorf("%w: positionMs is required for seek", ErrInvalidPlayback)
+		}
+		state.PositionMs = *input.PositionMs
+	default:
+		return nil, fmt.Errorf("%w: unsupported action %q", ErrInvalidPlayback, input.Action)
+	}
+
+	song, ok := room.Songs[strconv.Itoa(state.PlayingSongIndex)]
+	if !ok {
+		return nil, fmt.Errorf("%w: song index %d does not exist", ErrInvalidPlayback, state.PlayingSongIndex)
+	}
+	state.PlayingSongName = song.SongName
+	// デバイス側が別の曲を再生していても揃うよう、play では常に曲を指定する
+	command.TrackID = song.SongId
+
+	updated, err := s.roomRepository.UpdatePlaybackState(roomID, state)
+	if err != nil {
+		return nil, err
+	}
+	s.roomEventService.Publish(roomID, RoomEventPlaybackState, updated)
+	// 再生記録は付加機能のため、失敗しても再生状態の更新は成功として扱う
+	if err := s.playLogService.RecordPlayback(userID, room, state); err != nil {
+		log.Printf("Failed to record playback for room %d: %v", roomID, err)
+	}
+
+	userIDs, err := s.roomRepository.ListPlaybackSyncUsers(roomID)
+	if err != nil {
+		// 同期は付加機能のため、ルームの再生状態の更新は成功として扱う
+		log.Printf("Failed to list playback sync users for room %d: %v", roomID, err)
+		return updated, nil
+	}
+	// 退出済みのユーザーには送らない
+	members := make([]int, 0, len(userIDs))
+	for _, syncUserID := range userIDs {
+		if isRoomMember(room, syncUserID) {
+			members = append(members, syncUserID)
+		}
+	}
+	if len(members) > 0 {
+		s.dispatch(func() { s.syncParticipants(roomID, members, command, *updated) })
+	}
+	return updated, nil
+}
+
+// syncParticipants は、各ユーザーのデバイスに並行して再生操作を送り、結果をルームに配信します。
+// 再生位置は送るたびに state から計算します。
+func (s *playbackService) syncParticipants(roomID int, userIDs []int, command providers.PlaybackCommand, state repositories.RedisRoomData) []PlaybackResult {
+	results := make([]PlaybackResult, len(userIDs))
+	var wg sync.WaitGroup
+	for i, userID := range userIDs {
+		wg.Add(1)
+		go func(i, userID int) {
+			defer wg.Done()
+			results[i] = s.syncParticipant(userID, command, state)
+		}(i, userID)
+	}
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool { return results[i].UserID < results[j].UserID })
+	s.roomEventService.Publish(roomID, RoomEventPlaybackResults, map[string]interface{}{
+		"action":  command.Action,
+		"results": results,
+	})
+	return results
+}
+
+// syncParticipant は、1人のデバイスに再生操作を送ります。
+// 一時的な失敗（5xx・通信エラー）はバックオフしながら再試行し、レート制限時は Retry-After に従って待ちます。
+// 再試行はここでのみ行い（プロバイダーの HTTP クライアントは再生操作を再試行しない）、待った分だけ再生位置を進めて送り直します。
+func (s *playbackService) syncParticipant(userID int, command providers.PlaybackCommand, state repositories.RedisRoomData) PlaybackResult {
+	result := PlaybackResult{UserID: userID}
+	for {
+		result.Attempts++
+		command.PositionMs = currentPositionMs(state, s.now())
+		err := s.musicService.ControlPlayback(spotifyProviderName, userID, command)
+		if err == nil {
+			result.Success = true
+			result.Reason = ""
+			return result
+		}
+
+		reason, wait, retryable := s.classifyPlaybackError(err, result.Attempts)
+		result.Reason = reason
+		if !retryable || result.Attempts >= s.maxAttempts {
+			log.Printf("Playback sync failed for user %d after %d attempts: %v", userID, result.Attempts, err)
+			return result
+		}
+		s.sleep(wait)
+	}
+}
+
+// classifyPlaybackError は、失敗の理由と、再試行する場合の待ち時間を返します。
+func (s *playbackService) classifyPlaybackError(err error, attempt int) (string, time.Duration, bool) {
+	var apiErr *providers.APIError
+	switch {
+	case errors.Is(err, providers.ErrNoActiveDevice):
+		return PlaybackFailureNoActiveDevice, 0, false
+	case errors.Is(err, providers.ErrPremiumRequired):
+		return PlaybackFailurePremiumRequired, 0, false
+	case errors.Is(err, providers.ErrInsufficientScope):
+		return PlaybackFailureRelinkRequired, 0, false
+	case errors.Is(err, ErrServiceNotConnected), errors.Is(err, ErrConnectionBroken):
+		return PlaybackFailureNotConnected, 0, false
+	case errors.Is(err, providers.ErrCircuitOpen):
+		return PlaybackFailureUnavailable, 0, false
+	case providers.IsRateLimited(err):
+		wait := s.backoff(attempt)
+		if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+			wait = apiErr.RetryAfter
+		}
+		if wait > s.maxBackoff {
+			wait = s.maxBackoff
+		}
+		return PlaybackFailureRateLimited, wait, true
+	case errors.As(err, &apiErr):
+		return PlaybackFailureProviderError, s.backoff(attempt), apiErr.StatusCode >= 500
+	default:
+		// 通信エラーなど
+		return PlaybackFailureProviderError, s.backoff(attempt), true
+	}
+}
+
+// backoff は、試行回数に応じた指数バックオフにジッターを加えた待ち時間を返します。
+func (s *playbackService) backoff(attempt int) time.Duration {
+	wait := s.baseBackoff << uint(attempt-1)
+	if wait <= 0 || wait > s.maxBackoff {
+		wait = s.maxBackoff
+	}
+	if half := int64(wait / 2); half > 0 {
+		wait = wait/2 + time.Duration(rand.Int63n(half+1))
+	}
+	return wait
+}
+
+// currentPositionMs は、最後に再生状態が更新されてからの経過時間を加味した現在の再生位置を返します。
+func currentPositionMs(data repositories.RedisRoomData, now time.Time) int {
+	if data.RoomStatus != RoomStatusPlaying {
+		return data.PositionMs
+	}
+	updatedAt, err := time.Parse(time.RFC3339Nano, data.PositionUpdatedAt)
+	if err != nil {
+		return data.PositionMs
+	}
+	return data.PositionMs + int(now.Sub(updatedAt)/time.Millisecond)
+}
@@ -0,0 +1,230 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"music-share-api/internal/providers/spotifytest"
+	"music-share-api/internal/repositories"
+)
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func decodePlaybackResults(t *testing.T, event repositories.RoomEvent) []PlaybackResult {
+	t.Helper()
+	var data struct {
+		Action  string           `json:"action"`
+		Results []PlaybackResult `json:"results"`
+	}
+	if err := json.Unmarshal(event.Data, &data); err != nil {
+		t.Fatalf("failed to decode playback results: %v", err)
+	}
+	return data.Results
+}
+
+func TestPlaybackServiceUpdatePlaybackSyncsParticipants(t *testing.T) {
+	f := newPlaybackServiceFixture(t)
+	for _, userID := range []int{2, 3, 4} {
+		if err := f.service.SetPlaybackSync(userID, f.roomID, true); err != nil {
+			t.Fatalf("SetPlaybackSync(%d): %v", userID, err)
+		}
+	}
+
+	if _, err := f.service.UpdatePlayback(2, f.roomID, PlaybackInput{Action: "play"}); !errors.Is(err, ErrNotRoomHost) {
+		t.Fatalf("err = %v, want ErrNotRoomHost", err)
+	}
+
+	state, err := f.service.UpdatePlayback(1, f.roomID, PlaybackInput{Action: "play", SongIndex: intPtr(1), PositionMs: intPtr(3000)})
+	if err != nil {
+		t.Fatalf("UpdatePlayback: %v", err)
+	}
+	if state.RoomStatus != RoomStatusPlaying || state.PlayingSongIndex != 1 || state.PositionMs != 3000 {
+		t.Fatalf("unexpected state: %+v", state)
+	}
+	if got := f.roomRepository.rooms[f.roomID].PlayingSongName; got != "Red Sun" {
+		t.Fatalf("playing song name = %q, want Red Sun", got)
+	}
+	// 再生中のため、送るまでに経過した分だけ再生位置が進むことがある
+	guest := f.fake.Player("sp-guest")
+	if guest.TrackID != "t2" || !guest.IsPlaying || guest.PositionMs < 3000 || guest.PositionMs > 3100 {
+		t.Fatalf("guest player = %+v", guest)
+	}
+	// ホストは同期を有効にしていないため操作しない
+	if got := f.fake.Player("sp-host"); got != (spotifytest.PlayerState{}) {
+		t.Fatalf("host player was changed: %+v", got)
+	}
+
+	f.eventRepository.last(t, RoomEventPlaybackState)
+	want := []PlaybackResult{
+		{UserID: 2, Success: true, Attempts: 1},
+		{UserID: 3, Reason: PlaybackFailureNoActiveDevice, Attempts: 1},
+		{UserID: 4, Reason: PlaybackFailurePremiumRequired, Attempts: 1},
+	}
+	results := decodePlaybackResults(t, f.eventRepository.last(t, RoomEventPlaybackResults))
+	if len(results) != len(want) {
+		t.Fatalf("results = %+v", results)
+	}
+	for i := range want {
+		if results[i] != want[i] {
+			t.Fatalf("results[%d] = %+v, want %+v", i, results[i], want[i])
+		}
+	}
+	if len(f.sleeps) != 0 {
+		t.Fatalf("permanent failures were retried: %v", f.sleeps)
+	}
+
+	if _, err := f.service.UpdatePlayback(1, f.roomID, PlaybackInput{Action: "pause", PositionMs: intPtr(4000)}); err != nil {
+		t.Fatalf("pause: %v", err)
+	}
+	if got := f.fake.Player("sp-guest"); got.IsPlaying {
+		t.Fatalf("guest player is still playing: %+v", got)
+	}
+
+	// 同期を無効にしたユーザーには送らない
+	if err := f.service.SetPlaybackSync(2, f.roomID, false); err != nil {
+		t.Fatalf("SetPlaybackSync: %v", err)
+	}
+	if _, err := f.service.UpdatePlayback(1, f.roomID, PlaybackInput{Action: "seek", PositionMs: intPtr(9000)}); err != nil {
+		t.Fatalf("seek: %v", err)
+	}
+	if got := f.fake.Player("sp-guest"); got.PositionMs != guest.PositionMs {
+		t.Fatalf("guest player was changed after opting out: %+v", got)
+	}
+}
+
+func TestPlaybackServiceSetPlaybackSync(t *testing.T) {
+	f := newPlaybackServiceFixture(t)
+
+	if err := f.service.SetPlaybackSync(9, f.roomID, true); !errors.Is(err, ErrNotRoomMember) {
+		t.Fatalf("err = %v, want ErrNotRoomMember", err)
+	}
+	if err := f.service.SetPlaybackSync(5, f.roomID, true); !errors.Is(err, ErrServiceNotConnected) {
+		t.Fatalf("err = %v, want ErrServiceNotConnected", err)
+	}
+
+	// 再生中のルームで有効にすると、現在の曲にすぐ合わせる
+	room := f.roomRepository.rooms[f.roomID]
+	room.RedisData.RoomStatus = RoomStatusPlaying
+	room.RedisData.PlayingSongIndex = 1
+	room.RedisData.PositionMs = 1000
+	room.RedisData.PositionUpdatedAt = time.Now().Format(time.RFC3339Nano)
+	if err := f.service.SetPlaybackSync(2, f.roomID, true); err != nil {
+		t.Fatalf("SetPlaybackSync: %v", err)
+	}
+	got := f.fake.Player("sp-guest")
+	if got.TrackID != "t2" || !got.IsPlaying || got.PositionMs < 1000 {
+		t.Fatalf("guest player was not synced: %+v", got)
+	}
+}
+
+func TestPlaybackServiceRetriesTransientFailures(t *testing.T) {
+	f := newPlaybackServiceFixture(t)
+	if err := f.service.SetPlaybackSync(2, f.roomID, true); err != nil {
+		t.Fatalf("SetPlaybackSync: %v", err)
+	}
+
+	f.fake.RateLimitNext("/v1/me/player/pause", 2)
+	f.fake.FailNext("/v1/me/player/pause", http.StatusBadGateway, `{"error":{"status":502}}`)
+	if _, err := f.service.UpdatePlayback(1, f.roomID, PlaybackInput{Action: "pause"}); err != nil {
+		t.Fatalf("UpdatePlayback: %v", err)
+	}
+	results := decodePlaybackResults(t, f.eventRepository.last(t, RoomEventPlaybackResults))
+	if len(results) != 1 || !results[0].Success || results[0].Attempts != 3 {
+		t.Fatalf("results = %+v", results)
+	}
+	// レート制限は Retry-After、5xx は指数バックオフ（2回目の失敗なので 200ms にジッターを加えた 100〜200ms）で待つ
+	if len(f.sleeps) != 2 || f.sleeps[0] != 2*time.Second || f.sleeps[1] < 100*time.Millisecond || f.sleeps[1] > 200*time.Millisecond {
+		t.Fatalf("sleeps = %v", f.sleeps)
+	}
+
+	// Retry-After が長すぎる場合は上限まで、試行回数を使い切ったら失敗として報告する
+	f.sleeps = nil
+	for i := 0; i < 3; i++ {
+		f.fake.RateLimitNext("/v1/me/player/pause", 60)
+	}
+	if _, err := f.service.UpdatePlayback(1, f.roomID, PlaybackInput{Action: "pause"}); err != nil {
+		t.Fatalf("UpdatePlayback: %v", err)
+	}
+	results = decodePlaybackResults(t, f.eventRepository.last(t, RoomEventPlaybackResults))
+	if len(results) != 1 || results[0].Success || results[0].Reason != PlaybackFailureRateLimited || results[0].Attempts != 3 {
+		t.Fatalf("results = %+v", results)
+	}
+	if len(f.sleeps) != 2 || f.sleeps[0] != 5*time.Second || f.sleeps[1] != 5*time.Second {
+		t.Fatalf("sleeps = %v", f.sleeps)
+	}
+}
+
+func TestPlaybackServiceAdvancesPositionOnRetry(t *testing.T) {
+	f := newPlaybackServiceFixture(t)
+	if err := f.service.SetPlaybackSync(2, f.roomID, true); err != nil {
+		t.Fatalf("SetPlaybackSync: %v", err)
+	}
+
+	// Retry-After の2秒を待って送り直すときは、その間に進んだ位置から再生させる
+	f.fake.RateLimitNext("/v1/me/player/play", 2)
+	if _, err := f.service.UpdatePlayback(1, f.roomID, PlaybackInput{Action: "play", SongIndex: intPtr(1), PositionMs: intPtr(3000)}); err != nil {
+		t.Fatalf("UpdatePlayback: %v", err)
+	}
+	results := decodePlaybackResults(t, f.eventRepository.last(t, RoomEventPlaybackResults))
+	if len(results) != 1 || !results[0].Success || results[0].Attempts != 2 {
+		t.Fatalf("results = %+v", results)
+	}
+	// 再生操作はプロバイダーの HTTP クライアントでは再試行しないため、リクエストは試行回数と同じ
+	if got := f.fake.RequestCount("/v1/me/player/play"); got != 2 {
+		t.Fatalf("play requests = %d, want 2", got)
+	}
+	if got := f.fake.Player("sp-guest"); got.TrackID != "t2" || got.PositionMs < 5000 || got.PositionMs > 5100 {
+		t.Fatalf("guest player = %+v, want t2 at about 5000ms", got)
+	}
+}
+
+func TestPlaybackServiceReportsMissingScopeAsRelinkRequired(t *testing.T) {
+	f := newPlaybackServiceFixture(t)
+	if err := f.service.SetPlaybackSync(2, f.roomID, true); err != nil {
+		t.Fatalf("SetPlaybackSync: %v", err)
+	}
+
+	// 再生操作のスコープを許可する前に連携したユーザーは 403 になり、再試行せずに再連携を促す
+	f.fake.SetPlaybackScopeMissing("sp-guest")
+	if _, err := f.service.UpdatePlayback(1, f.roomID, PlaybackInput{Action: "pause"}); err != nil {
+		t.Fatalf("UpdatePlayback: %v", err)
+	}
+	results := decodePlaybackResults(t, f.eventRepository.last(t, RoomEventPlaybackResults))
+	if len(results) != 1 || results[0].Success || results[0].Reason != PlaybackFailureRelinkRequired || results[0].Attempts != 1 {
+		t.Fatalf("results = %+v", results)
+	}
+	if !f.repo.get(2, "spotify").reauthorizeRequired {
+		t.Fatal("connection was not marked as reauthorization required")
+	}
+
+	// 再連携すると要再連携の状態は解除される
+	if err := f.connect(t, 2, "sp-guest"); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	if f.repo.get(2, "spotify").reauthorizeRequired {
+		t.Fatal("reauthorization required was not cleared by relinking")
+	}
+}
+
+func TestPlaybackServiceRejectsInvalidInput(t *testing.T) {
+	f := newPlaybackServiceFixture(t)
+
+	for _, input := range []PlaybackInput{
+		{Action: "stop"},
+		{Action: "seek"},
+		{Action: "seek", PositionMs: intPtr(-1)},
+		{Action: "play", SongIndex: intPtr(5)},
+	} {
+		if _, err := f.service.UpdatePlayback(1, f.roomID, input); !errors.Is(err, ErrInvalidPlayback) {
+			t.Fatalf("UpdatePlayback(%+v): err = %v, want ErrInvalidPlayback", input, err)
+		}
+	}
+	if got := f.roomRepository.rooms[f.roomID].RedisData.RoomStatus; got != RoomStatusPaused {
+		t.Fatalf("room status changed to %q by an invalid request", got)
+	}
+}
@@ -0,0 +1,257 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"music-share-api/internal/repositories"
+	"music-share-api/internal/utils"
+)
+
+// おすすめの理由の種類
+const (
+	RecommendationReasonGenre    = "genre"
+	RecommendationReasonArtist   = "artist"
+	RecommendationReasonFriends  = "friends"
+	RecommendationReasonActivity = "activity"
+)
+
+// 各シグナルの最大スコア。合計がルームのスコアになる
+const (
+	recommendationGenreWeight    = 3.0
+	recommendationArtistWeight   = 2.0
+	recommendationFriendWeight   = 1.5
+	recommendationMaxFriends     = 2
+	recommendationActivityWeight = 1.0
+	// recommendationArtistSaturation 人の一致で、アーティストのスコアが最大になる
+	recommendationArtistSaturation = 3
+	// recommendationBusyListeners 人以上の参加者で、参加者数によるスコアが最大になる
+	recommendationBusyListeners = 5
+)
+
+const (
+	defaultRecommendationLimit = 10
+	maxRecommendationLimit     = 50
+)
+
+// ErrInvalidRecommendationLimit は、件数の指定が範囲外の場合に返されます。
+var ErrInvalidRecommendationLimit = errors.New("invalid recommendation limit")
+
+// RecommendationReason は、おすすめした理由の1つです。
+type RecommendationReason struct {
+	Type    string  `json:"type"`
+	Message string  `json:"message"`
+	Score   float64 `json:"score"`
+}
+
+// RecommendedRoom は、おすすめのルームとスコア・理由です。
+type RecommendedRoom struct {
+	repositories.Room
+	Score   float64                `json:"score"`
+	Reasons []RecommendationReason `json:"reasons"`
+}
+
+type RecommendationService interface {
+	// RecommendRooms は、ユーザーの参加履歴をもとに空きのある公開ルームをスコア順に返します（limit が 0 なら既定の件数）。
+	RecommendRooms(userID int, limit int) ([]RecommendedRoom, error)
+}
+
+type recommendationService struct {
+	recommendationRepository repositories.RecommendationRepository
+	// historyWindow は好みの集計に使う参加履歴の期間、activeWindow は「活動中」とみなす最終更新からの時間
+	historyWindow time.Duration
+	activeWindow  time.Duration
+	candidates    int
+	now           func() time.Time
+}
+
+func NewRecommendationService(recommendationRepository repositories.RecommendationRepository) RecommendationService {
+	return &recommendationService{
+		recommendationRepository: recommendationRepository,
+		historyWindow:            utils.GetEnvDuration("RECOMMENDATION_HISTORY_WINDOW", 90*24*time.Hour),
+		activeWindow:             utils.GetEnvDuration("RECOMMENDATION_ACTIVE_WINDOW", 30*time.Minute),
+		candidates:               utils.GetEnvInt("RECOMMENDATION_CANDIDATES", 200),
+		now:                      time.Now,
+	}
+}
+
+func (s *recommendationService) RecommendRooms(userID int, limit int) ([]RecommendedRoom, error) {
+	if limit == 0 {
+		limit = defaultRecommendationLimit
+	}
+	if limit < 1 || limit > maxRecommendationLimit {
+		return nil, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidRecommendationLimit, maxRecommendationLimit)
+	}
+
+	now := s.now()
+	affinity, err := s.recommendationRepository.GetUserAffinity(userID, now.Add(-s.historyWindow))
+	if err != nil {
+		return nil, err
+	}
+	candidates, err := s.recommendationRepository.ListRecommendationCandidates(s.candidates)
+	if err != nil {
+		return nil, err
+	}
+
+	genreTotal := 0
+	for _, count := range affinity.Genres {
+		genreTotal += count
+	}
+	// ルームのアーティストは "Band A, Band B" のように連名のことがあるため、1人ずつに分けて数え直す
+	artists := make(map[string]int)
+	for artist, count := range affinity.Artists {
+		for _, name := range splitArtists(artist) {
+			artists[strings.ToLower(name)] += count
+		}
+	}
+
+	recommended := make([]RecommendedRoom, 0, len(candidates))
+	for _, candidate := range candidates {
+		if candidate.Room.HostUserID == userID || slices.Contains(candidate.MemberIDs, userID) {
+			continue
+		}
+		room := RecommendedRoom{Room: candidate.Room, Reasons: []RecommendationReason{}}
+		if reason, ok := genreReason(candidate, affinity.Genres, genreTotal); ok {
+			room.Reasons = append(room.Reasons, reason)
+		}
+		if reason, ok := artistReason(candidate, artists); ok {
+			room.Reasons = append(room.Reasons, reason)
+		}
+		if reason, ok := friendsReason(candidate, affinity.Companions); ok {
+			room.Reasons = append(room.Reasons, reason)
+		}
+		if reason, ok := s.activityReason(candidate, now); ok {
+			room.Reasons = append(room.Reasons, reason)
+		}
+		// 理由はスコアの大きい順に並べ、先頭が主な理由になるようにする
+		sort.SliceStable(room.Reasons, func(i, j int) bool { return room.Reasons[i].Score > room.Reasons[j].Score })
+		for _, reason := range room.Reasons {
+			room.Score += reason.Score
+		}
+		room.Score = roundScore(room.Score)
+		recommended = append(recommended, room)
+	}
+
+	sort.SliceStable(recommended, func(i, j int) bool {
+		if recommended[i].Score != recommended[j].Score {
+			return recommended[i].Score > recommended[j].Score
+		}
+		if !recommended[i].UpdateAt.Equal(recommended[j].UpdateAt) {
+			return recommended[i].UpdateAt.After(recommended[j].UpdateAt)
+		}
+		return recommended[i].RoomID > recommended[j].RoomID
+	})
+	if len(recommended) > limit {
+		recommended = recommended[:limit]
+	}
+	return recommended, nil
+}
+
+// genreReason は、よく参加しているジャンルのルームほど高いスコアを付けます（参加したルームに占める割合）。
+func genreReason(candidate repositories.RecommendationCandidate, genres map[string]int, total int) (RecommendationReason, bool) {
+	count := genres[candidate.Room.Genre]
+	if candidate.Room.Genre == "" || count == 0 {
+		return RecommendationReason{}, false
+	}
+	return RecommendationReason{
+		Type:    RecommendationReasonGenre,
+		Message: fmt.Sprintf("because you often join %s rooms", candidate.Room.Genre),
+		Score:   roundScore(recommendationGenreWeight * float64(count) / float64(total)),
+	}, true
+}
+
+// artistReason は、これまでに聴いたアーティストがルームの曲に多く含まれるほど高いスコアを付けます。
+// 理由には、一致したアーティストのうち最もよく聴いたものを挙げる。
+func artistReason(candidate repositories.RecommendationCandidate, listened map[string]int) (RecommendationReason, bool) {
+	matched := make(map[string]bool)
+	top, topCount := "", 0
+	for _, artist := range candidate.Artists {
+		for _, name := range splitArtists(artist) {
+			key := strings.ToLower(name)
+			count := listened[key]
+			if count == 0 || matched[key] {
+				continue
+			}
+			matched[key] = true
+			if count > topCount || (count == topCount && name < top) {
+				top, topCount = name, count
+			}
+		}
+	}
+	if len(matched) == 0 {
+		return RecommendationReason{}, false
+	}
+	ratio := math.Min(1, float64(len(matched))/recommendationArtistSaturation)
+	return RecommendationReason{
+		Type:    RecommendationReasonArtist,
+		Message: fmt.Sprintf("because you listened to %s", top),
+		Score:   roundScore(recommendationArtistWeight * ratio),
+	}, true
+}
+
+// friendsReason は、過去に一緒に聴いたことのあるユーザーが参加しているルームにスコアを付けます。
+func friendsReason(candidate repositories.RecommendationCandidate, companions map[int]repositories.Companion) (RecommendationReason, bool) {
+	var present []repositories.Companion
+	for _, memberID := range candidate.MemberIDs {
+		if companion, ok := companions[memberID]; ok {
+			present = append(present, companion)
+		}
+	}
+	if len(present) == 0 {
+		return RecommendationReason{}, false
+	}
+	// 一緒に聴いた回数が多い人を理由に挙げる
+	sort.Slice(present, func(i, j int) bool {
+		if present[i].Rooms != present[j].Rooms {
+			return present[i].Rooms > present[j].Rooms
+		}
+		return present[i].UserID < present[j].UserID
+	})
+	message := fmt.Sprintf("because %s, who you have listened with before, is here", present[0].UserName)
+	if len(present) > 1 {
+		message = fmt.Sprintf("because %s and %d other people you have listened with are here", present[0].UserName, len(present)-1)
+	}
+	return RecommendationReason{
+		Type:    RecommendationReasonFriends,
+		Message: message,
+		Score:   roundScore(recommendationFriendWeight * float64(min(len(present), recommendationMaxFriends))),
+	}, true
+}
+
+// activityReason は、最近更新され（曲の切り替え・参加など）、参加者の多いルームにスコアを付けます。
+func (s *recommendationService) activityReason(candidate repositories.RecommendationCandidate, now time.Time) (RecommendationReason, bool) {
+	age := now.Sub(candidate.Room.UpdateAt)
+	if age < 0 {
+		age = 0
+	}
+	if age >= s.activeWindow {
+		return RecommendationReason{}, false
+	}
+	recency := 1 - float64(age)/float64(s.activeWindow)
+	busy := math.Min(1, float64(candidate.Room.NowParticipants)/recommendationBusyListeners)
+	return RecommendationReason{
+		Type:    RecommendationReasonActivity,
+		Message: fmt.Sprintf("active now with %d listeners", candidate.Room.NowParticipants),
+		Score:   roundScore(recommendationActivityWeight * (recency + busy) / 2),
+	}, true
+}
+
+// splitArtists は、"Band A, Band B" のような連名を1人ずつに分けます。
+func splitArtists(artist string) []string {
+	var names []string
+	for _, name := range strings.Split(artist, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func roundScore(score float64) float64 {
+	return math.Round(score*1000) / 1000
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"music-share-api/internal/repositories"
+)
+
+// memoryRecommendationRepository は、テスト用のインメモリ RecommendationRepository です。
+type memoryRecommendationRepository struct {
+	candidates []repositories.RecommendationCandidate
+	affinity   repositories.UserAffinity
+	since      time.Time
+}
+
+func (r *memoryRecommendationRepository) ListRecommendationCandidates(limit int) ([]repositories.RecommendationCandidate, error) {
+	if len(r.candidates) > limit {
+		return r.candidates[:limit], nil
+	}
+	return r.candidates, nil
+}
+
+func (r *memoryRecommendationRepository) GetUserAffinity(userID int, since time.Time) (*repositories.UserAffinity, error) {
+	r.since = since
+	return &r.affinity, nil
+}
+
+func newRecommendationFixture(t *testing.T) (*memoryRecommendationRepository, *recommendationService, time.Time) {
+	t.Helper()
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	repository := &memoryRecommendationRepository{
+		affinity: repositories.UserAffinity{
+			Genres:  map[string]int{"j-pop": 3, "rock": 1},
+			Artists: map[string]int{"Band A, Band B": 4, "Band C": 1},
+			Companions: map[int]repositories.Companion{
+				7: {UserID: 7, UserName: "alice", Rooms: 3},
+				8: {UserID: 8, UserName: "bob", Rooms: 1},
+			},
+		},
+	}
+	service := NewRecommendationService(repository).(*recommendationService)
+	service.now = func() time.Time { return now }
+	return repository, service, now
+}
+
+func candidate(roomID int, genre string, updatedAt time.Time, artists []string, members ...int) repositories.RecommendationCandidate {
+	return repositories.RecommendationCandidate{
+		Room:      repositories.Room{RoomID: roomID, Genre: genre, HostUserID: 100 + roomID, NowParticipants: len(members) + 1, UpdateAt: updatedAt},
+		Artists:   artists,
+		MemberIDs: members,
+	}
+}
+
+func TestRecommendationServiceRanksAndExplains(t *testing.T) {
+	repository, service, now := newRecommendationFixture(t)
+	old := now.Add(-24 * time.Hour)
+	repository.candidates = []repositories.RecommendationCandidate{
+		candidate(1, "rock", old, nil),
+		candidate(2, "j-pop", old, []string{"Band B", "Band X"}),
+		candidate(3, "", old, nil, 7, 8),
+		candidate(4, "", now.Add(-time.Minute), nil, 20, 21, 22, 23),
+		candidate(5, "classical", old, nil),
+		// 参加中のルームは除く
+		candidate(6, "j-pop", now, []string{"Band A"}, 1),
+	}
+
+	rooms, err := service.RecommendRooms(1, 0)
+	if err != nil {
+		t.Fatalf("RecommendRooms: %v", err)
+	}
+	want := []int{3, 2, 4, 1, 5}
+	if len(rooms) != len(want) {
+		t.Fatalf("rooms = %+v, want ids %v", rooms, want)
+	}
+	for i, room := range rooms {
+		if room.RoomID != want[i] {
+			t.Fatalf("room %d = %d, want %d (scores: %+v)", i, room.RoomID, want[i], rooms)
+		}
+	}
+
+	// 理由は主な理由から順に並び、説明文で根拠を示す
+	jpop := rooms[1]
+	if jpop.Score != 2.917 || len(jpop.Reasons) != 2 {
+		t.Fatalf("unexpected recommendation: %+v", jpop)
+	}
+	if jpop.Reasons[0].Type != RecommendationReasonGenre || jpop.Reasons[1].Message != "because you listened to Band B" {
+		t.Fatalf("unexpected reasons: %+v", jpop.Reasons)
+	}
+	if got := rooms[0].Reasons[0].Message; got != "because alice and 1 other people you have listened with are here" {
+		t.Fatalf("friends reason = %q", got)
+	}
+	if got := rooms[2].Reasons[0]; got.Type != RecommendationReasonActivity || got.Message != "active now with 5 listeners" {
+		t.Fatalf("activity reason = %+v", got)
+	}
+	if len(rooms[4].Reasons) != 0 || rooms[4].Score != 0 {
+		t.Fatalf("unexpected recommendation: %+v", rooms[4])
+	}
+	if !repository.since.Equal(now.Add(-service.historyWindow)) {
+		t.Fatalf("since = %v", repository.since)
+	}
+}
+
+func TestRecommendationServiceLimit(t *testing.T) {
+	repository, service, now := newRecommendationFixture(t)
+	for i := 1; i <= 5; i++ {
+		repository.candidates = append(repository.candidates, candidate(i, "", now, nil))
+	}
+
+	rooms, err := service.RecommendRooms(1, 2)
+	if err != nil {
+		t.Fatalf("RecommendRooms: %v", err)
+	}
+	// 同じスコアなら新しく更新されたルームID順
+	if len(rooms) != 2 || rooms[0].RoomID != 5 || rooms[1].RoomID != 4 {
+		t.Fatalf("unexpected rooms: %+v", rooms)
+	}
+	if _, err := service.RecommendRooms(1, maxRecommendationLimit+1); !errors.Is(err, ErrInvalidRecommendationLimit) {
+		t.Fatalf("err = %v, want ErrInvalidRecommendationLimit", err)
+	}
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"music-share-api/internal/repositories"
+	"time"
+)
+
+// ルームイベントの種類
+const (
+	// RoomEventPlaybackState は、ホストが再生状態（再生・一時停止・シーク）を変更したときに配信されます。
+	RoomEventPlaybackState = "playback_state"
+	// RoomEventPlaybackResults は、参加者のデバイスへの再生同期の結果です。
+	RoomEventPlaybackResults = "playback_results"
+	// RoomEventRoomClosed は、ルームが閉じられたときに配信されます（data.reason に理由）。
+	RoomEventRoomClosed = "room_closed"
+	// RoomEventChatMessage は、チャットのメッセージが送信されたときに配信されます（data にメッセージ）。
+	RoomEventChatMessage = "chat_message"
+	// RoomEventChatMessageDeleted は、チャットのメッセージが削除されたときに配信されます（data.messageId に削除したメッセージ）。
+	RoomEventChatMessageDeleted = "chat_message_deleted"
+)
+
+type RoomEventService interface {
+	// Publish は、ルームの参加者にイベントを配信します。配信の失敗はログに残すのみで、呼び出し元の処理は止めません。
+	Publish(roomID int, eventType string, data interface{})
+	// Subscribe は、ルームのイベントを受け取るチャネルを返します（公開ルーム、またはホスト・参加者のみ）。
+	Subscribe(ctx context.Context, userID, roomID int) (<-chan repositories.RoomEvent, error)
+}
+
+type roomEventService struct {
+	eventRepository repositories.RoomEventRepository
+	roomRepository  repositories.RoomRepository
+}
+
+func NewRoomEventService(eventRepository repositories.RoomEventRepository, roomRepository repositories.RoomRepository) RoomEventService {
+	return &roomEventService{eventRepository: eventRepository, roomRepository: roomRepository}
+}
+
+func (s *roomEventService) Publish(roomID int, eventType string, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("Failed to marshal %s event for room %d: %v", eventType, roomID, err)
+		return
+	}
+	event := repositories.RoomEvent{
+		Type:      eventType,
+		RoomID:    roomID,
+		Data:      payload,
+		CreatedAt: time.Now(),
+	}
+	if err := s.eventRepository.PublishRoomEvent(event); err != nil {
+		log.Printf("Failed to publish %s event for room %d: %v", eventType, roomID, err)
+	}
+}
+
+func (s *roomEventService) Subscribe(ctx context.Context, userID, roomID int) (<-chan repositories.RoomEvent, error) {
+	room, err := s.roomRepository.GetRoomByID(roomID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get room: %w", err)
+	}
+	if !room.IsPublic && !isRoomMember(room, userID) {
+		return nil, ErrNotRoomMember
+	}
+	return s.eventRepository.SubscribeRoomEvents(ctx, roomID)
+}
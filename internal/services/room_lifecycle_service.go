@@ -0,0 +1,170 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"music-share-api/internal/repositories"
+	"music-share-api/internal/utils"
+)
+
+// ルームを閉じた理由
+const (
+	RoomCloseReasonEmpty = "empty"
+	RoomCloseReasonIdle  = "idle"
+	// RoomCloseReasonDeleted は、ルームが削除された場合の理由です。
+	RoomCloseReasonDeleted = "deleted"
+)
+
+// ErrRoomNotDeleted は、削除されていないルームを復元しようとした場合に返されます。
+var ErrRoomNotDeleted = errors.New("room has not been deleted")
+
+// ClosedRoom は、自動で閉じたルームです。
+type ClosedRoom struct {
+	RoomID int
+	Reason string
+}
+
+type RoomLifecycleService interface {
+	// CloseInactiveRooms は、参加者がいない状態や再生操作のない状態が続いたルームを閉じ、閉じたルームを返します。
+	CloseInactiveRooms() ([]ClosedRoom, error)
+	// DeleteRoom は、ルームを削除して Redis の状態を消し、参加者に room_closed イベントで通知します。
+	// 削除できるのはホストと管理者（admin=true）のみ。
+	DeleteRoom(userID, roomID int, admin bool) error
+	// RestoreRoom は、削除された（閉じられた）ルームを参加者がいない状態で開き直します。
+	RestoreRoom(roomID int) error
+}
+
+type roomLifecycleService struct {
+	lifecycleRepository repositories.RoomLifecycleRepository
+	roomEventService    RoomEventService
+	// emptyTimeout は参加者がいない状態、idleTimeout は再生操作がない状態が続いたら閉じるまでの時間（0 なら閉じない）
+	emptyTimeout time.Duration
+	idleTimeout  time.Duration
+	// stateTTL は閉じたルームの Redis のデータを残しておく時間
+	stateTTL  time.Duration
+	batchSize int
+	now       func() time.Time
+}
+
+func NewRoomLifecycleService(lifecycleRepository repositories.RoomLifecycleRepository, roomEventService RoomEventService) RoomLifecycleService {
+	return &roomLifecycleService{
+		lifecycleRepository: lifecycleRepository,
+		roomEventService:    roomEventService,
+		emptyTimeout:        utils.GetEnvDuration("ROOM_EMPTY_TIMEOUT", 15*time.Minute),
+		idleTimeout:         utils.GetEnvDuration("ROOM_IDLE_TIMEOUT", 2*time.Hour),
+		stateTTL:            utils.GetEnvDuration("ROOM_CLOSED_STATE_TTL", 24*time.Hour),
+		batchSize:           utils.GetEnvInt("ROOM_LIFECYCLE_BATCH_SIZE", 100),
+		now:                 time.Now,
+	}
+}
+
+func (s *roomLifecycleService) CloseInactiveRooms() ([]ClosedRoom, error) {
+	// 短い方のしきい値より前から更新されていないルームだけを候補として読み込む
+	threshold := s.emptyTimeout
+	if threshold <= 0 || (s.idleTimeout > 0 && s.idleTimeout < threshold) {
+		threshold = s.idleTimeout
+	}
+	if threshold <= 0 {
+		return nil, nil
+	}
+
+	now := s.now()
+	var closed []ClosedRoom
+	// 再生操作（Redis のみ更新）で使われているルームは updated_at が古いまま先頭に残るため、
+	// 閉じなかったルームの後ろへカーソルで読み進める
+	var after *repositories.LifecycleRoom
+	for {
+		rooms, err := s.lifecycleRepository.ListStaleRooms(now.Add(-threshold), after, s.batchSize)
+		if err != nil {
+			return closed, err
+		}
+
+		for _, room := range rooms {
+			reason := s.closeReason(room, now)
+			if reason == "" {
+				continue
+			}
+			ok, err := s.lifecycleRepository.CloseRoom(room.RoomID, reason, s.stateTTL)
+			if err != nil {
+				log.Printf("Failed to close room %d (%s): %v", room.RoomID, reason, err)
+			}
+			if !ok {
+				continue
+			}
+			// 接続中のクライアントに通知し、退出できるようにする
+			s.roomEventService.Publish(room.RoomID, RoomEventRoomClosed, map[string]string{"reason": reason})
+			closed = append(closed, ClosedRoom{RoomID: room.RoomID, Reason: reason})
+		}
+
+		if len(rooms) == 0 || len(rooms) < s.batchSize {
+			return closed, nil
+		}
+		after = &rooms[len(rooms)-1]
+	}
+}
+
+// closeReason は、ルームを閉じる理由を返します。閉じない場合は空文字を返します。
+func (s *roomLifecycleService) closeReason(room repositories.LifecycleRoom, now time.Time) string {
+	lastActivity := room.UpdatedAt
+	if room.LastPlaybackAt.After(lastActivity) {
+		lastActivity = room.LastPlaybackAt
+	}
+	// 退出で参加者数が 0 になると updated_at が更新されるため、updated_at からの経過時間を空室の時間とみなす
+	if s.emptyTimeout > 0 && room.NowParticipants <= 0 && now.Sub(room.UpdatedAt) >= s.emptyTimeout {
+		return RoomCloseReasonEmpty
+	}
+	if s.idleTimeout > 0 && now.Sub(lastActivity) >= s.idleTimeout {
+		return RoomCloseReasonIdle
+	}
+	return ""
+}
+
+func (s *roomLifecycleService) DeleteRoom(userID, roomID int, admin bool) error {
+	hostUserID, found, err := s.lifecycleRepository.GetRoomHostUserID(roomID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrRoomNotFound
+	}
+	// 削除すると参加者は退出させられ、元に戻せるのは管理者のみのため、ホストと管理者に限る
+	if hostUserID != userID && !admin {
+		return ErrNotRoomHost
+	}
+
+	// 削除したルームの状態は trx_room_archives に保存し、Redis からはすぐに消す
+	ok, err := s.lifecycleRepository.CloseRoom(roomID, RoomCloseReasonDeleted, 0)
+	if err != nil && !ok {
+		return err
+	}
+	if !ok {
+		return ErrRoomDeleted
+	}
+	// Redis の後片付けに失敗しても削除は済んでいるため、参加者への通知は行う
+	if err != nil {
+		log.Printf("Failed to clean up deleted room %d: %v", roomID, err)
+	}
+	s.roomEventService.Publish(roomID, RoomEventRoomClosed, map[string]string{"reason": RoomCloseReasonDeleted})
+	return nil
+}
+
+func (s *roomLifecycleService) RestoreRoom(roomID int) error {
+	ok, err := s.lifecycleRepository.RestoreRoom(roomID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		// 復元の対象にならなかったルームは、存在しなければ ErrRoomNotFound、存在すれば削除されていない
+		_, found, err := s.lifecycleRepository.GetRoomHostUserID(roomID)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return ErrRoomNotFound
+		}
+		return ErrRoomNotDeleted
+	}
+	return nil
+}
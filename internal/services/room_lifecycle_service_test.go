@@ -0,0 +1,229 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"music-share-api/internal/repositories"
+)
+
+// memoryRoomLifecycleRepository は、テスト用のインメモリ RoomLifecycleRepository です。
+type memoryRoomLifecycleRepository struct {
+	rooms  []repositories.LifecycleRoom
+	closed map[int]string
+	ttls   map[int]time.Duration
+	// hosts はルームごとのホストの user_id
+	hosts map[int]int
+}
+
+func (r *memoryRoomLifecycleRepository) ListStaleRooms(updatedBefore time.Time, after *repositories.LifecycleRoom, limit int) ([]repositories.LifecycleRoom, error) {
+	// rooms は (UpdatedAt, RoomID) の昇順で用意する
+	var rooms []repositories.LifecycleRoom
+	for _, room := range r.rooms {
+		if after != nil && (room.UpdatedAt.Before(after.UpdatedAt) || (room.UpdatedAt.Equal(after.UpdatedAt) && room.RoomID <= after.RoomID)) {
+			continue
+		}
+		if _, closed := r.closed[room.RoomID]; !closed && room.UpdatedAt.Before(updatedBefore) && len(rooms) < limit {
+			rooms = append(rooms, room)
+		}
+	}
+	return rooms, nil
+}
+
+func (r *memoryRoomLifecycleRepository) CloseRoom(roomID int, reason string, ttl time.Duration) (bool, error) {
+	if _, found, _ := r.GetRoomHostUserID(roomID); !found {
+		return false, nil
+	}
+	if _, closed := r.closed[roomID]; closed {
+		return false, nil
+	}
+	r.closed[roomID] = reason
+	r.ttls[roomID] = ttl
+	return true, nil
+}
+
+func (r *memoryRoomLifecycleRepository) RestoreRoom(roomID int) (bool, error) {
+	if _, closed := r.closed[roomID]; !closed {
+		return false, nil
+	}
+	delete(r.closed, roomID)
+	return true, nil
+}
+
+func (r *memoryRoomLifecycleRepository) GetRoomHostUserID(roomID int) (int, bool, error) {
+	for _, room := range r.rooms {
+		if room.RoomID == roomID {
+			return r.hosts[roomID], true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+func TestRoomLifecycleServiceClosesEmptyAndIdleRooms(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	lifecycleRepository := &memoryRoomLifecycleRepository{
+		closed: make(map[int]string),
+		ttls:   make(map[int]time.Duration),
+		rooms: []repositories.LifecycleRoom{
+			// 20分前から空室
+			{RoomID: 1, NowParticipants: 0, UpdatedAt: now.Add(-20 * time.Minute)},
+			// 空室になってから5分
+			{RoomID: 2, NowParticipants: 0, UpdatedAt: now.Add(-5 * time.Minute)},
+			// 参加者はいるが3時間操作がない
+			{RoomID: 3, NowParticipants: 2, UpdatedAt: now.Add(-3 * time.Hour)},
+			// 参加・退出はないが10分前に一時停止した（Redis のみ更新）
+			{RoomID: 4, NowParticipants: 2, UpdatedAt: now.Add(-3 * time.Hour), LastPlaybackAt: now.Add(-10 * time.Minute)},
+		},
+	}
+	eventRepository := &memoryRoomEventRepository{}
+	service := NewRoomLifecycleService(lifecycleRepository, NewRoomEventService(eventRepository, newMemoryRoomRepository())).(*roomLifecycleService)
+	service.emptyTimeout = 15 * time.Minute
+	service.idleTimeout = 2 * time.Hour
+	service.stateTTL = time.Hour
+	service.now = func() time.Time { return now }
+
+	closed, err := service.CloseInactiveRooms()
+	if err != nil {
+		t.Fatalf("CloseInactiveRooms: %v", err)
+	}
+	if len(closed) != 2 || closed[0] != (ClosedRoom{RoomID: 1, Reason: RoomCloseReasonEmpty}) || closed[1] != (ClosedRoom{RoomID: 3, Reason: RoomCloseReasonIdle}) {
+		t.Fatalf("closed = %+v", closed)
+	}
+	if lifecycleRepository.ttls[1] != time.Hour {
+		t.Fatalf("ttl = %v, want 1h", lifecycleRepository.ttls[1])
+	}
+	// 閉じたルームの参加者に通知する
+	event := eventRepository.last(t, RoomEventRoomClosed)
+	if event.RoomID != 3 || string(event.Data) != `{"reason":"idle"}` {
+		t.Fatalf("unexpected event: %+v", event)
+	}
+
+	// 閉じたルームは次回の対象にならない
+	closed, err = service.CloseInactiveRooms()
+	if err != nil || len(closed) != 0 {
+		t.Fatalf("closed = %+v, err = %v", closed, err)
+	}
+}
+
+func TestRoomLifecycleServicePagesPastActiveRooms(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	lifecycleRepository := &memoryRoomLifecycleRepository{
+		closed: make(map[int]string),
+		ttls:   make(map[int]time.Duration),
+		rooms: []repositories.LifecycleRoom{
+			// 参加・退出はないが再生操作が続いている（updated_at が古いまま先頭に並ぶ）
+			{RoomID: 1, NowParticipants: 2, UpdatedAt: now.Add(-5 * time.Hour), LastPlaybackAt: now.Add(-time.Minute)},
+			{RoomID: 2, NowParticipants: 2, UpdatedAt: now.Add(-5 * time.Hour), LastPlaybackAt: now.Add(-time.Minute)},
+			{RoomID: 3, NowParticipants: 2, UpdatedAt: now.Add(-4 * time.Hour), LastPlaybackAt: now.Add(-time.Minute)},
+			// その後ろにある空室
+			{RoomID: 4, NowParticipants: 0, UpdatedAt: now.Add(-time.Hour)},
+		},
+	}
+	service := NewRoomLifecycleService(lifecycleRepository, NewRoomEventService(&memoryRoomEventRepository{}, newMemoryRoomRepository())).(*roomLifecycleService)
+	service.emptyTimeout = 15 * time.Minute
+	service.idleTimeout = 2 * time.Hour
+	service.batchSize = 2
+	service.now = func() time.Time { return now }
+
+	closed, err := service.CloseInactiveRooms()
+	if err != nil {
+		t.Fatalf("CloseInactiveRooms: %v", err)
+	}
+	if len(closed) != 1 || closed[0] != (ClosedRoom{RoomID: 4, Reason: RoomCloseReasonEmpty}) {
+		t.Fatalf("closed = %+v", closed)
+	}
+}
+
+func TestRoomLifecycleServiceDisabledThresholds(t *testing.T) {
+	now := time.Now()
+	lifecycleRepository := &memoryRoomLifecycleRepository{
+		closed: make(map[int]string),
+		ttls:   make(map[int]time.Duration),
+		rooms:  []repositories.LifecycleRoom{{RoomID: 1, NowParticipants: 0, UpdatedAt: now.Add(-24 * time.Hour)}},
+	}
+	service := NewRoomLifecycleService(lifecycleRepository, NewRoomEventService(&memoryRoomEventRepository{}, newMemoryRoomRepository())).(*roomLifecycleService)
+
+	// 空室のみ無効にした場合は、操作がない時間で判定する
+	service.emptyTimeout = 0
+	service.idleTimeout = 48 * time.Hour
+	if closed, _ := service.CloseInactiveRooms(); len(closed) != 0 {
+		t.Fatalf("closed = %+v", closed)
+	}
+
+	// 両方を無効にした場合は何も閉じない
+	service.idleTimeout = 0
+	if closed, _ := service.CloseInactiveRooms(); len(closed) != 0 {
+		t.Fatalf("closed = %+v", closed)
+	}
+}
+
+func TestRoomLifecycleServiceDeleteAndRestoreRoom(t *testing.T) {
+	lifecycleRepository := &memoryRoomLifecycleRepository{
+		closed: make(map[int]string),
+		ttls:   make(map[int]time.Duration),
+		rooms:  []repositories.LifecycleRoom{{RoomID: 1, NowParticipants: 3, UpdatedAt: time.Now()}},
+		hosts:  map[int]int{1: 10},
+	}
+	eventRepository := &memoryRoomEventRepository{}
+	service := NewRoomLifecycleService(lifecycleRepository, NewRoomEventService(eventRepository, newMemoryRoomRepository()))
+
+	if err := service.RestoreRoom(1); !errors.Is(err, ErrRoomNotDeleted) {
+		t.Fatalf("expected ErrRoomNotDeleted, got %v", err)
+	}
+	if err := service.DeleteRoom(10, 1, false); err != nil {
+		t.Fatalf("DeleteRoom: %v", err)
+	}
+	// 削除したルームの Redis の状態はすぐに消し、参加者に通知する
+	if lifecycleRepository.closed[1] != RoomCloseReasonDeleted || lifecycleRepository.ttls[1] != 0 {
+		t.Fatalf("closed = %+v, ttls = %+v", lifecycleRepository.closed, lifecycleRepository.ttls)
+	}
+	event := eventRepository.last(t, RoomEventRoomClosed)
+	if event.RoomID != 1 || string(event.Data) != `{"reason":"deleted"}` {
+		t.Fatalf("unexpected event: %+v", event)
+	}
+
+	if err := service.DeleteRoom(10, 1, false); !errors.Is(err, ErrRoomDeleted) {
+		t.Fatalf("expected ErrRoomDeleted, got %v", err)
+	}
+	if err := service.DeleteRoom(10, 2, false); !errors.Is(err, ErrRoomNotFound) {
+		t.Fatalf("expected ErrRoomNotFound, got %v", err)
+	}
+	if err := service.RestoreRoom(2); !errors.Is(err, ErrRoomNotFound) {
+		t.Fatalf("expected ErrRoomNotFound, got %v", err)
+	}
+
+	if err := service.RestoreRoom(1); err != nil {
+		t.Fatalf("RestoreRoom: %v", err)
+	}
+	if _, closed := lifecycleRepository.closed[1]; closed {
+		t.Fatalf("expected the room to be reopened")
+	}
+}
+
+func TestRoomLifecycleServiceDeleteRoomRequiresHostOrAdmin(t *testing.T) {
+	lifecycleRepository := &memoryRoomLifecycleRepository{
+		closed: make(map[int]string),
+		ttls:   make(map[int]time.Duration),
+		rooms:  []repositories.LifecycleRoom{{RoomID: 1, NowParticipants: 3, UpdatedAt: time.Now()}},
+		hosts:  map[int]int{1: 10},
+	}
+	eventRepository := &memoryRoomEventRepository{}
+	service := NewRoomLifecycleService(lifecycleRepository, NewRoomEventService(eventRepository, newMemoryRoomRepository()))
+
+	// ホスト以外は削除できず、ルームも閉じない
+	if err := service.DeleteRoom(20, 1, false); !errors.Is(err, ErrNotRoomHost) {
+		t.Fatalf("expected ErrNotRoomHost, got %v", err)
+	}
+	if _, closed := lifecycleRepository.closed[1]; closed || len(eventRepository.events) != 0 {
+		t.Fatalf("closed = %+v, events = %+v", lifecycleRepository.closed, eventRepository.events)
+	}
+
+	// 管理者はホストでなくても削除できる
+	if err := service.DeleteRoom(20, 1, true); err != nil {
+		t.Fatalf("DeleteRoom as admin: %v", err)
+	}
+	if lifecycleRepository.closed[1] != RoomCloseReasonDeleted {
+		t.Fatalf("closed = %+v", lifecycleRepository.closed)
+	}
+}
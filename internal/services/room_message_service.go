@@ -0,0 +1,211 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"music-share-api/internal/repositories"
+	"music-share-api/internal/utils"
+)
+
+const (
+	defaultRoomMessageLimit = 50
+	maxRoomMessageLimit     = 100
+)
+
+var (
+	// ErrInvalidMessage は、メッセージが空か長すぎる場合に返されます。
+	ErrInvalidMessage = errors.New("invalid message")
+	// ErrInvalidMessageQuery は、メッセージの取得条件が不正な場合に返されます。
+	ErrInvalidMessageQuery = errors.New("invalid message query")
+	// ErrMessageNotFound は、メッセージが存在しないか、すでに削除されている場合に返されます。
+	ErrMessageNotFound = errors.New("message not found")
+	// ErrNotMessageAuthor は、送信者・ホスト以外がメッセージを削除しようとした場合に返されます。
+	ErrNotMessageAuthor = errors.New("only the author or the host can delete this message")
+	// ErrMessageRateLimited は、短い間に送信できるメッセージの数を超えた場合に返されます。
+	ErrMessageRateLimited = errors.New("too many messages; please wait a moment")
+)
+
+// RoomMessagePage は、ルームのチャットの1ページ分です。NextCursor が空なら最後のページです。
+type RoomMessagePage struct {
+	// Messages は新しい順
+	Messages   []repositories.RoomMessage `json:"messages"`
+	NextCursor string                     `json:"nextCursor"`
+}
+
+type RoomMessageService interface {
+	// SendMessage は、ホスト・参加者のメッセージを保存し、chat_message イベントでルームに配信します。
+	SendMessage(userID, roomID int, body string) (*repositories.RoomMessage, error)
+	// ListMessages は、ルームのメッセージを新しい順に返します（公開ルーム、またはホスト・参加者のみ）。
+	// before は前のページの NextCursor（空なら最新から）。
+	ListMessages(userID, roomID int, before string, limit int) (*RoomMessagePage, error)
+	// DeleteMessage は、送信者またはホストがメッセージを削除し、chat_message_deleted イベントでルームに配信します。
+	DeleteMessage(userID, roomID int, messageID int64) error
+}
+
+type roomMessageService struct {
+	messageRepository repositories.RoomMessageRepository
+	roomRepository    repositories.RoomRepository
+	roomEventService  RoomEventService
+	// maxLength はメッセージの最大文字数
+	maxLength int
+	// rateLimit は rateWindow の間にユーザーが送信できるメッセージの数（0 なら制限しない）
+	rateLimit  int
+	rateWindow time.Duration
+	// recentSize は Redis の Stream に保持する直近のメッセージの数
+	recentSize int
+	now        func() time.Time
+}
+
+func NewRoomMessageService(messageRepository repositories.RoomMessageRepository, roomRepository repositories.RoomRepository, roomEventService RoomEventService) RoomMessageService {
+	return &roomMessageService{
+		messageRepository: messageRepository,
+		roomRepository:    roomRepository,
+		roomEventService:  roomEventService,
+		maxLength:         utils.GetEnvInt("ROOM_CHAT_MAX_LENGTH", 500),
+		rateLimit:         utils.GetEnvInt("ROOM_CHAT_RATE_LIMIT", 5),
+		rateWindow:        utils.GetEnvDuration("ROOM_CHAT_RATE_WINDOW", 10*time.Second),
+		recentSize:        utils.GetEnvInt("ROOM_CHAT_RECENT_SIZE", 200),
+		now:               time.Now,
+	}
+}
+
+func (s *roomMessageService) SendMessage(userID, roomID int, body string) (*repositories.RoomMessage, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return nil, fmt.Errorf("%w: body is empty", ErrInvalidMessage)
+	}
+	if utf8.RuneCountInString(body) > s.maxLength {
+		return nil, fmt.Errorf("%w: body must be at most %d characters", ErrInvalidMessage, s.maxLength)
+	}
+
+	room, err := s.roomRepository.GetRoomByID(roomID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get room: %w", err)
+	}
+	// 公開ルームでも、発言できるのはホストと参加者のみ
+	userName, ok := roomMemberName(room, userID)
+	if !ok {
+		return nil, ErrNotRoomMember
+	}
+
+	if s.rateLimit > 0 {
+		count, err := s.messageRepository.IncrementMessageCount(userID, s.rateWindow)
+		if err != nil {
+			return nil, err
+		}
+		if count > int64(s.rateLimit) {
+			return nil, ErrMessageRateLimited
+		}
+	}
+
+	message := repositories.RoomMessage{
+		RoomID:    roomID,
+		UserID:    userID,
+		UserName:  userName,
+		Body:      body,
+		CreatedAt: s.now(),
+	}
+	if message.MessageID, err = s.messageRepository.SaveMessage(message); err != nil {
+		return nil, err
+	}
+	if err := s.messageRepository.AppendRecentMessage(message, s.recentSize); err != nil {
+		log.Printf("Failed to append message %d to recent messages of room %d: %v", message.MessageID, roomID, err)
+		s.clearRecentMessages(roomID)
+	}
+
+	s.roomEventService.Publish(roomID, RoomEventChatMessage, message)
+	return &message, nil
+}
+
+func (s *roomMessageService) ListMessages(userID, roomID int, before string, limit int) (*RoomMessagePage, error) {
+	if limit == 0 {
+		limit = defaultRoomMessageLimit
+	}
+	if limit < 1 || limit > maxRoomMessageLimit {
+		return nil, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidMessageQuery, maxRoomMessageLimit)
+	}
+	var beforeID int64
+	if before != "" {
+		parsed, err := strconv.ParseInt(before, 10, 64)
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("%w: invalid cursor", ErrInvalidMessageQuery)
+		}
+		beforeID = parsed
+	}
+
+	room, err := s.roomRepository.GetRoomByID(roomID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get room: %w", err)
+	}
+	if !room.IsPublic && !isRoomMember(room, userID) {
+		return nil, ErrNotRoomMember
+	}
+
+	// 最新のページも前のページと同じく MySQL から読む（Stream はリアルタイムの配信用で、保存済みのメッセージと食い違うことがある）
+	// 次のページがあるかを判定するため、1件多く読む
+	messages, err := s.messageRepository.ListMessages(roomID, beforeID, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	page := &RoomMessagePage{Messages: messages}
+	if len(messages) > limit {
+		page.Messages = messages[:limit]
+		page.NextCursor = strconv.FormatInt(page.Messages[limit-1].MessageID, 10)
+	}
+	return page, nil
+}
+
+func (s *roomMessageService) DeleteMessage(userID, roomID int, messageID int64) error {
+	room, err := s.roomRepository.GetRoomByID(roomID)
+	if err != nil {
+		return fmt.Errorf("failed to get room: %w", err)
+	}
+	message, found, err := s.messageRepository.GetMessage(roomID, messageID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrMessageNotFound
+	}
+	if message.UserID != userID && room.HostUserID != userID {
+		return ErrNotMessageAuthor
+	}
+
+	if err := s.messageRepository.DeleteMessage(messageID, userID); err != nil {
+		return err
+	}
+	if err := s.messageRepository.RemoveRecentMessage(roomID, messageID); err != nil {
+		log.Printf("Failed to remove message %d from recent messages of room %d: %v", messageID, roomID, err)
+		s.clearRecentMessages(roomID)
+	}
+
+	s.roomEventService.Publish(roomID, RoomEventChatMessageDeleted, map[string]int64{"messageId": messageID})
+	return nil
+}
+
+// clearRecentMessages は、MySQL と食い違った直近のメッセージの Stream を消します（新しいメッセージから溜め直す）。
+func (s *roomMessageService) clearRecentMessages(roomID int) {
+	if err := s.messageRepository.ClearRecentMessages(roomID); err != nil {
+		log.Printf("Failed to clear recent messages of room %d: %v", roomID, err)
+	}
+}
+
+// roomMemberName は、ホスト・参加者のルームでの表示名を返します。ホスト・参加者でなければ ok=false を返します。
+func roomMemberName(room *repositories.RoomAllInfo, userID int) (string, bool) {
+	if room.HostUserID == userID {
+		return room.HostUserName, true
+	}
+	userIDStr := strconv.Itoa(userID)
+	for _, participant := range room.RedisData.Participants {
+		if participant.UserID == userIDStr {
+			return participant.Username, true
+		}
+	}
+	return "", false
+}
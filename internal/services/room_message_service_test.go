@@ -0,0 +1,320 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"music-share-api/internal/repositories"
+)
+
+// memoryRoomMessageRepository は、テスト用のインメモリ RoomMessageRepository です。
+// recent は Redis の Stream（古い順）、dbReads は MySQL からページを読んだ回数です。
+type memoryRoomMessageRepository struct {
+	messages   []repositories.RoomMessage
+	deleted    map[int64]int
+	recent     []repositories.RoomMessage
+	counts     map[int]int64
+	dbReads    int
+	failAppend bool
+}
+
+func newMemoryRoomMessageRepository() *memoryRoomMessageRepository {
+	return &memoryRoomMessageRepository{deleted: make(map[int64]int), counts: make(map[int]int64)}
+}
+
+func (r *memoryRoomMessageRepository) SaveMessage(message repositories.RoomMessage) (int64, error) {
+	message.MessageID = int64(len(r.messages) + 1)
+	r.messages = append(r.messages, message)
+	return message.MessageID, nil
+}
+
+func (r *memoryRoomMessageRepository) GetMessage(roomID int, messageID int64) (*repositories.RoomMessage, bool, error) {
+	for _, message := range r.messages {
+		if message.RoomID == roomID && message.MessageID == messageID {
+			if _, deleted := r.deleted[messageID]; deleted {
+				return nil, false, nil
+			}
+			copied := message
+			return &copied, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+func (r *memoryRoomMessageRepository) ListMessages(roomID int, beforeID int64, limit int) ([]repositories.RoomMessage, error) {
+	r.dbReads++
+	messages := []repositories.RoomMessage{}
+	for i := len(r.messages) - 1; i >= 0 && len(messages) < limit; i-- {
+		message := r.messages[i]
+		if _, deleted := r.deleted[message.MessageID]; deleted || message.RoomID != roomID {
+			continue
+		}
+		if beforeID == 0 || message.MessageID < beforeID {
+			messages = append(messages, message)
+		}
+	}
+	return messages, nil
+}
+
+func (r *memoryRoomMessageRepository) DeleteMessage(messageID int64, deletedBy int) error {
+	r.deleted[messageID] = deletedBy
+	return nil
+}
+
+func (r *memoryRoomMessageRepository) AppendRecentMessage(message repositories.RoomMessage, keep int) error {
+	if r.failAppend {
+		return errors.New("redis is down")
+	}
+	r.recent = append(r.recent, message)
+	if len(r.recent) > keep {
+		r.recent = r.recent[len(r.recent)-keep:]
+	}
+	return nil
+}
+
+func (r *memoryRoomMessageRepository) ListRecentMessages(roomID int) ([]repositories.RoomMessage, error) {
+	messages := []repositories.RoomMessage{}
+	for i := len(r.recent) - 1; i >= 0; i-- {
+		if r.recent[i].RoomID == roomID {
+			messages = append(messages, r.recent[i])
+		}
+	}
+	return messages, nil
+}
+
+func (r *memoryRoomMessageRepository) RemoveRecentMessage(roomID int, messageID int64) error {
+	recent := r.recent[:0]
+	for _, message := range r.recent {
+		if message.MessageID != messageID {
+			recent = append(recent, message)
+		}
+	}
+	r.recent = recent
+	return nil
+}
+
+func (r *memoryRoomMessageRepository) ClearRecentMessages(roomID int) error {
+	r.recent = nil
+	return nil
+}
+
+func (r *memoryRoomMessageRepository) IncrementMessageCount(userID int, window time.Duration) (int64, error) {
+	r.counts[userID]++
+	return r.counts[userID], nil
+}
+
+type roomMessageServiceFixture struct {
+	repository      *memoryRoomMessageRepository
+	eventRepository *memoryRoomEventRepository
+	service         *roomMessageService
+}
+
+// newRoomMessageServiceFixture は、ホストが 1、参加者が 2 の非公開ルーム 1 を用意します。
+func newRoomMessageServiceFixture(t *testing.T) *roomMessageServiceFixture {
+	t.Helper()
+	roomRepository := newMemoryRoomRepository()
+	roomRepository.rooms[1] = &repositories.RoomAllInfo{
+		RoomID:       1,
+		HostUserID:   1,
+		HostUserName: "host",
+		RedisData: repositories.RedisRoomData{
+			Participants: []repositories.RedisRoomParticipant{{UserID: "2", Username: "guest"}},
+		},
+	}
+	repository := newMemoryRoomMessageRepository()
+	eventRepository := &memoryRoomEventRepository{}
+	service := NewRoomMessageService(repository, roomRepository, NewRoomEventService(eventRepository, roomRepository)).(*roomMessageService)
+	service.maxLength = 10
+	service.rateLimit = 0
+	service.recentSize = 3
+	return &roomMessageServiceFixture{repository: repository, eventRepository: eventRepository, service: service}
+}
+
+func TestRoomMessageServiceSendMessage(t *testing.T) {
+	f := newRoomMessageServiceFixture(t)
+
+	message, err := f.service.SendMessage(2, 1, "  hello  ")
+	if err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	if message.MessageID != 1 || message.UserName != "guest" || message.Body != "hello" {
+		t.Fatalf("unexpected message: %+v", message)
+	}
+	// ルームのイベントで配信し、直近のメッセージにも残す
+	event := f.eventRepository.last(t, RoomEventChatMessage)
+	if event.RoomID != 1 || !strings.Contains(string(event.Data), `"body":"hello"`) {
+		t.Fatalf("unexpected event: %+v", event)
+	}
+	if len(f.repository.recent) != 1 {
+		t.Fatalf("expected the message in recent messages, got %+v", f.repository.recent)
+	}
+
+	if _, err := f.service.SendMessage(1, 1, "   "); !errors.Is(err, ErrInvalidMessage) {
+		t.Fatalf("expected ErrInvalidMessage for an empty message, got %v", err)
+	}
+	// 最大文字数はバイト数ではなく文字数で数える
+	if _, err := f.service.SendMessage(1, 1, "こんにちは、みなさん"); err != nil {
+		t.Fatalf("expected a 10-character message to be accepted, got %v", err)
+	}
+	if _, err := f.service.SendMessage(1, 1, "こんにちは、みなさん!"); !errors.Is(err, ErrInvalidMessage) {
+		t.Fatalf("expected ErrInvalidMessage for a long message, got %v", err)
+	}
+	if _, err := f.service.SendMessage(3, 1, "hi"); !errors.Is(err, ErrNotRoomMember) {
+		t.Fatalf("expected ErrNotRoomMember, got %v", err)
+	}
+	if _, err := f.service.SendMessage(1, 99, "hi"); !errors.Is(err, ErrRoomNotFound) {
+		t.Fatalf("expected ErrRoomNotFound, got %v", err)
+	}
+}
+
+func TestRoomMessageServiceRateLimit(t *testing.T) {
+	f := newRoomMessageServiceFixture(t)
+	f.service.rateLimit = 2
+
+	for i := 0; i < 2; i++ {
+		if _, err := f.service.SendMessage(2, 1, "hi"); err != nil {
+			t.Fatalf("SendMessage #%d failed: %v", i+1, err)
+		}
+	}
+	if _, err := f.service.SendMessage(2, 1, "hi"); !errors.Is(err, ErrMessageRateLimited) {
+		t.Fatalf("expected ErrMessageRateLimited, got %v", err)
+	}
+	// 制限はユーザーごと
+	if _, err := f.service.SendMessage(1, 1, "hi"); err != nil {
+		t.Fatalf("expected another user to be able to send, got %v", err)
+	}
+	if len(f.repository.messages) != 3 {
+		t.Fatalf("expected the rate-limited message not to be saved, got %d messages", len(f.repository.messages))
+	}
+}
+
+func TestRoomMessageServiceListMessages(t *testing.T) {
+	f := newRoomMessageServiceFixture(t)
+	for _, body := range []string{"m1", "m2", "m3", "m4", "m5"} {
+		if _, err := f.service.SendMessage(1, 1, body); err != nil {
+			t.Fatalf("SendMessage failed: %v", err)
+		}
+	}
+
+	// 最新のページも MySQL から読む
+	page, err := f.service.ListMessages(2, 1, "", 2)
+	if err != nil {
+		t.Fatalf("ListMessages failed: %v", err)
+	}
+	if len(page.Messages) != 2 || page.Messages[0].Body != "m5" || page.Messages[1].Body != "m4" || page.NextCursor != "4" {
+		t.Fatalf("unexpected first page: %+v", page)
+	}
+	if f.repository.dbReads != 1 {
+		t.Fatalf("expected the first page to be read from MySQL, got %d reads", f.repository.dbReads)
+	}
+
+	// 古いページは MySQL から読む
+	page, err = f.service.ListMessages(2, 1, page.NextCursor, 2)
+	if err != nil {
+		t.Fatalf("ListMessages failed: %v", err)
+	}
+	if len(page.Messages) != 2 || page.Messages[0].Body != "m3" || page.Messages[1].Body != "m2" || page.NextCursor != "2" {
+		t.Fatalf("unexpected second page: %+v", page)
+	}
+	page, err = f.service.ListMessages(2, 1, page.NextCursor, 2)
+	if err != nil {
+		t.Fatalf("ListMessages failed: %v", err)
+	}
+	if len(page.Messages) != 1 || page.Messages[0].Body != "m1" || page.NextCursor != "" {
+		t.Fatalf("unexpected last page: %+v", page)
+	}
+
+	if _, err := f.service.ListMessages(3, 1, "", 0); !errors.Is(err, ErrNotRoomMember) {
+		t.Fatalf("expected ErrNotRoomMember for a private room, got %v", err)
+	}
+	if _, err := f.service.ListMessages(2, 1, "abc", 0); !errors.Is(err, ErrInvalidMessageQuery) {
+		t.Fatalf("expected ErrInvalidMessageQuery, got %v", err)
+	}
+	if _, err := f.service.ListMessages(2, 1, "", maxRoomMessageLimit+1); !errors.Is(err, ErrInvalidMessageQuery) {
+		t.Fatalf("expected ErrInvalidMessageQuery, got %v", err)
+	}
+}
+
+func TestRoomMessageServiceListMessagesIncludesMessagesMissingFromStream(t *testing.T) {
+	f := newRoomMessageServiceFixture(t)
+	for _, body := range []string{"m1", "m2", "m3"} {
+		if _, err := f.service.SendMessage(1, 1, body); err != nil {
+			t.Fatalf("SendMessage failed: %v", err)
+		}
+	}
+	// MySQL には保存済みだが、まだ Stream に追加されていないメッセージ
+	f.repository.SaveMessage(repositories.RoomMessage{RoomID: 1, UserID: 1, UserName: "host", Body: "m4"})
+
+	page, err := f.service.ListMessages(2, 1, "", 2)
+	if err != nil {
+		t.Fatalf("ListMessages failed: %v", err)
+	}
+	if len(page.Messages) != 2 || page.Messages[0].Body != "m4" || page.Messages[1].Body != "m3" {
+		t.Fatalf("unexpected first page: %+v", page)
+	}
+	if f.repository.dbReads != 1 {
+		t.Fatalf("expected the first page to be read from MySQL, got %d reads", f.repository.dbReads)
+	}
+}
+
+func TestRoomMessageServiceClearsRecentMessagesOnFailure(t *testing.T) {
+	f := newRoomMessageServiceFixture(t)
+	if _, err := f.service.SendMessage(1, 1, "m1"); err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+
+	// Stream への追加に失敗しても送信は成功し、食い違った Stream は消して MySQL から読む
+	f.repository.failAppend = true
+	if _, err := f.service.SendMessage(1, 1, "m2"); err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	if len(f.repository.recent) != 0 {
+		t.Fatalf("expected recent messages to be cleared, got %+v", f.repository.recent)
+	}
+	page, err := f.service.ListMessages(1, 1, "", 0)
+	if err != nil {
+		t.Fatalf("ListMessages failed: %v", err)
+	}
+	if len(page.Messages) != 2 || page.Messages[0].Body != "m2" {
+		t.Fatalf("unexpected page: %+v", page)
+	}
+}
+
+func TestRoomMessageServiceDeleteMessage(t *testing.T) {
+	f := newRoomMessageServiceFixture(t)
+	guestMessage, _ := f.service.SendMessage(2, 1, "guest")
+	hostMessage, _ := f.service.SendMessage(1, 1, "host")
+
+	// 他の参加者のメッセージは削除できない
+	if err := f.service.DeleteMessage(2, 1, hostMessage.MessageID); !errors.Is(err, ErrNotMessageAuthor) {
+		t.Fatalf("expected ErrNotMessageAuthor, got %v", err)
+	}
+	// ホストは参加者のメッセージを削除できる
+	if err := f.service.DeleteMessage(1, 1, guestMessage.MessageID); err != nil {
+		t.Fatalf("DeleteMessage failed: %v", err)
+	}
+	if f.repository.deleted[guestMessage.MessageID] != 1 {
+		t.Fatalf("expected the message to be deleted by the host, got %+v", f.repository.deleted)
+	}
+	event := f.eventRepository.last(t, RoomEventChatMessageDeleted)
+	if string(event.Data) != `{"messageId":1}` {
+		t.Fatalf("unexpected event: %+v", event)
+	}
+	if err := f.service.DeleteMessage(1, 1, guestMessage.MessageID); !errors.Is(err, ErrMessageNotFound) {
+		t.Fatalf("expected ErrMessageNotFound, got %v", err)
+	}
+
+	// 送信者は自分のメッセージを削除できる
+	if err := f.service.DeleteMessage(1, 1, hostMessage.MessageID); err != nil {
+		t.Fatalf("DeleteMessage failed: %v", err)
+	}
+	page, err := f.service.ListMessages(1, 1, "", 0)
+	if err != nil {
+		t.Fatalf("ListMessages failed: %v", err)
+	}
+	if len(page.Messages) != 0 || len(f.repository.recent) != 0 {
+		t.Fatalf("expected deleted messages to be hidden, got %+v (recent %+v)", page.Messages, f.repository.recent)
+	}
+}
@@ -0,0 +1,293 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"music-share-api/internal/mailer"
+	"music-share-api/internal/repositories"
+	"music-share-api/internal/utils"
+)
+
+// 予約したルームの繰り返し
+const (
+	RoomRecurrenceNone   = ""
+	RoomRecurrenceDaily  = "daily"
+	RoomRecurrenceWeekly = "weekly"
+)
+
+const (
+	defaultUpcomingRoomsLimit = 20
+	maxUpcomingRoomsLimit     = 100
+)
+
+var (
+	// ErrInvalidSchedule は、開始時刻・繰り返しの指定が不正な場合に返されます。
+	ErrInvalidSchedule = errors.New("invalid room schedule")
+	// ErrScheduleNotFound は、予約が存在しないか、非公開の予約にホスト以外がアクセスした場合に返されます。
+	ErrScheduleNotFound = errors.New("room schedule not found")
+	// ErrScheduleNotOpen は、開いた・取り消された予約に参加表明や取り消しをした場合に返されます。
+	ErrScheduleNotOpen = errors.New("room schedule is no longer upcoming")
+)
+
+// ScheduleRoomInput は、ルームの予約の内容です。ルームの設定は CreateRoom と同じものを使う。
+type ScheduleRoomInput struct {
+	repositories.RoomCreateInput
+	StartsAt time.Time `json:"startsAt"`
+	// Recurrence は ""（繰り返しなし）・"daily"・"weekly"
+	Recurrence string `json:"recurrence"`
+	// RecurrenceUntil より後の回は開かない（null なら取り消すまで繰り返す）
+	RecurrenceUntil *time.Time `json:"recurrenceUntil"`
+}
+
+// OpenedSchedule は、開始時刻になって開いたルームです。
+type OpenedSchedule struct {
+	ScheduleID int
+	RoomID     int
+	StartsAt   time.Time
+	// Notified は通知した参加表明済みのユーザー数
+	Notified int
+}
+
+type RoomScheduleService interface {
+	// ScheduleRoom は、userID をホストとしてルームを予約します。プレイリストの取り込みは予約時に行う。
+	ScheduleRoom(userID int, input ScheduleRoomInput) (*repositories.RoomSchedule, error)
+	// ListUpcoming は、開始待ちの公開ルームと自分がホストの予約を開始時刻の早い順に返します（limit が 0 なら既定の件数）。
+	ListUpcoming(userID int, limit int) ([]repositories.RoomSchedule, error)
+	// CancelSchedule は、ホストが予約を取り消します。
+	CancelSchedule(userID, scheduleID int) error
+	// RSVP・CancelRSVP は、次の回への参加表明を記録・取り消し、更新後の予約を返します。
+	RSVP(userID, scheduleID int) (*repositories.RoomSchedule, error)
+	CancelRSVP(userID, scheduleID int) (*repositories.RoomSchedule, error)
+	// OpenDueRooms は、開始時刻になった予約のルームを作成し、参加表明したユーザーに通知します。
+	OpenDueRooms() ([]OpenedSchedule, error)
+}
+
+type roomScheduleService struct {
+	scheduleRepository repositories.RoomScheduleRepository
+	roomService        RoomService
+	mailer             mailer.Mailer
+	// maxAhead より先の開始時刻は予約できない
+	maxAhead  time.Duration
+	batchSize int
+	now       func() time.Time
+}
+
+func NewRoomScheduleService(scheduleRepository repositories.RoomScheduleRepository, roomService RoomService, m mailer.Mailer) RoomScheduleService {
+	return &roomScheduleService{
+		scheduleRepository: scheduleRepository,
+		roomService:        roomService,
+		mailer:             m,
+		maxAhead:           utils.GetEnvDuration("ROOM_SCHEDULE_MAX_AHEAD", 90*24*time.Hour),
+		batchSize:          utils.GetEnvInt("ROOM_SCHEDULE_BATCH_SIZE", 100),
+		now:                time.Now,
+	}
+}
+
+func (s *roomScheduleService) ScheduleRoom(userID int, input ScheduleRoomInput) (*repositories.RoomSchedule, error) {
+	now := s.now()
+	// 参加表明は回（starts_at）ごとに記録するため、DB に保存できる秒単位に揃える
+	startsAt := input.StartsAt.Truncate(time.Second)
+	if !startsAt.After(now) {
+		return nil, fmt.Errorf("%w: startsAt must be in the future", ErrInvalidSchedule)
+	}
+	if s.maxAhead > 0 && startsAt.After(now.Add(s.maxAhead)) {
+		return nil, fmt.Errorf("%w: startsAt must be within %s", ErrInvalidSchedule, s.maxAhead)
+	}
+	recurrence := strings.ToLower(strings.TrimSpace(input.Recurrence))
+	switch recurrence {
+	case RoomRecurrenceNone, RoomRecurrenceDaily, RoomRecurrenceWeekly:
+	default:
+		return nil, fmt.Errorf("%w: recurrence must be %q or %q", ErrInvalidSchedule, RoomRecurrenceDaily, RoomRecurrenceWeekly)
+	}
+	if input.RecurrenceUntil != nil {
+		if recurrence == RoomRecurrenceNone {
+			return nil, fmt.Errorf("%w: recurrenceUntil requires recurrence", ErrInvalidSchedule)
+		}
+		if input.RecurrenceUntil.Before(startsAt) {
+			return nil, fmt.Errorf("%w: recurrenceUntil must not be before startsAt", ErrInvalidSchedule)
+		}
+	}
+	if strings.TrimSpace(input.RoomName) == "" {
+		return nil, fmt.Errorf("%w: roomName is required", ErrInvalidSchedule)
+	}
+
+	room := input.RoomCreateInput
+	room.HostUserID = userID
+	room, err := s.roomService.PrepareRoom(room)
+	if err != nil {
+		return nil, err
+	}
+
+	scheduleID, err := s.scheduleRepository.CreateSchedule(repositories.RoomSchedule{
+		HostUserID:      userID,
+		HostUserName:    room.HostUserName,
+		RoomName:        room.RoomName,
+		IsPublic:        room.IsPublic,
+		Genre:           room.Genre,
+		MaxParticipants: room.MaxParticipants,
+		Input:           room,
+		StartsAt:        startsAt,
+		Recurrence:      recurrence,
+		RecurrenceUntil: input.RecurrenceUntil,
+	})
+	if err != nil {
+		return nil, err
+	}
+	schedule, found, err := s.scheduleRepository.GetSchedule(scheduleID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrScheduleNotFound
+	}
+	return schedule, nil
+}
+
+func (s *roomScheduleService) ListUpcoming(userID int, limit int) ([]repositories.RoomSchedule, error) {
+	if limit == 0 {
+		limit = defaultUpcomingRoomsLimit
+	}
+	if limit < 1 || limit > maxUpcomingRoomsLimit {
+		return nil, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidSchedule, maxUpcomingRoomsLimit)
+	}
+	return s.scheduleRepository.ListUpcomingSchedules(userID, limit)
+}
+
+// getUpcoming は、userID から見える開始待ちの予約を返します。
+func (s *roomScheduleService) getUpcoming(userID, scheduleID int) (*repositories.RoomSchedule, error) {
+	schedule, found, err := s.scheduleRepository.GetSchedule(scheduleID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !found || (!schedule.IsPublic && schedule.HostUserID != userID) {
+		return nil, ErrScheduleNotFound
+	}
+	if schedule.Status != repositories.RoomScheduleScheduled {
+		return nil, ErrScheduleNotOpen
+	}
+	return schedule, nil
+}
+
+func (s *roomScheduleService) CancelSchedule(userID, scheduleID int) error {
+	schedule, err := s.getUpcoming(userID, scheduleID)
+	if err != nil {
+		return err
+	}
+	if schedule.HostUserID != userID {
+		return ErrNotRoomHost
+	}
+	return s.scheduleRepository.CancelSchedule(scheduleID)
+}
+
+func (s *roomScheduleService) RSVP(userID, scheduleID int) (*repositories.RoomSchedule, error) {
+	schedule, err := s.getUpcoming(userID, scheduleID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.scheduleRepository.AddRSVP(scheduleID, schedule.StartsAt, userID); err != nil {
+		return nil, err
+	}
+	return s.getUpcoming(userID, scheduleID)
+}
+
+func (s *roomScheduleService) CancelRSVP(userID, scheduleID int) (*repositories.RoomSchedule, error) {
+	schedule, err := s.getUpcoming(userID, scheduleID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.scheduleRepository.RemoveRSVP(scheduleID, schedule.StartsAt, userID); err != nil {
+		return nil, err
+	}
+	return s.getUpcoming(userID, scheduleID)
+}
+
+func (s *roomScheduleService) OpenDueRooms() ([]OpenedSchedule, error) {
+	now := s.now()
+	schedules, err := s.scheduleRepository.ListDueSchedules(now, s.batchSize)
+	if err != nil {
+		return nil, err
+	}
+
+	var opened []OpenedSchedule
+	for _, schedule := range schedules {
+		next := nextOccurrence(schedule, now)
+		// 複数のインスタンスで動いていても、1つの回につきルームは1つだけ作る
+		ok, err := s.scheduleRepository.ClaimOccurrence(schedule.ScheduleID, schedule.StartsAt, next)
+		if err != nil {
+			log.Printf("Failed to claim room schedule %d: %v", schedule.ScheduleID, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		roomID, err := s.roomService.CreateRoom(schedule.Input)
+		if err != nil {
+			// 開始待ちに戻し、次の実行で作り直す
+			log.Printf("Failed to open scheduled room %d: %v", schedule.ScheduleID, err)
+			if err := s.scheduleRepository.ReleaseOccurrence(schedule.ScheduleID, schedule.StartsAt, next); err != nil {
+				log.Printf("Failed to release room schedule %d: %v", schedule.ScheduleID, err)
+			}
+			continue
+		}
+		if err := s.scheduleRepository.RecordOpenedRoom(schedule.ScheduleID, roomID); err != nil {
+			log.Printf("Failed to record opened room for schedule %d: %v", schedule.ScheduleID, err)
+		}
+
+		opened = append(opened, OpenedSchedule{
+			ScheduleID: schedule.ScheduleID,
+			RoomID:     roomID,
+			StartsAt:   schedule.StartsAt,
+			Notified:   s.notifyRSVPs(schedule, roomID),
+		})
+	}
+	return opened, nil
+}
+
+// notifyRSVPs は、開いた回に参加表明したユーザーにルームへのリンクを送り、送れた人数を返します。
+func (s *roomScheduleService) notifyRSVPs(schedule repositories.RoomSchedule, roomID int) int {
+	users, err := s.scheduleRepository.ListRSVPUsers(schedule.ScheduleID, schedule.StartsAt)
+	if err != nil {
+		log.Printf("Failed to list rsvps for schedule %d: %v", schedule.ScheduleID, err)
+		return 0
+	}
+
+	link := fmt.Sprintf("%s/room/%d", utils.GetEnv("APP_BASE_URL", "http://localhost:3000"), roomID)
+	subject := fmt.Sprintf("「%s」が始まりました", schedule.RoomName)
+	notified := 0
+	for _, user := range users {
+		body := fmt.Sprintf("%s さん\n\n参加予定のルーム「%s」が始まりました。以下のリンクから参加できます。\n\n%s\n", user.UserName, schedule.RoomName, link)
+		if err := s.mailer.Send(user.Email, subject, body); err != nil {
+			log.Printf("Failed to notify user %d of schedule %d: %v", user.UserID, schedule.ScheduleID, err)
+			continue
+		}
+		notified++
+	}
+	return notified
+}
+
+// nextOccurrence は、繰り返す予約の now より後の次の回を返します。繰り返さない場合や、終了日を過ぎる場合は nil を返します。
+// サーバーが止まっていたなどで過ぎてしまった回は開かずに飛ばす。
+func nextOccurrence(schedule repositories.RoomSchedule, now time.Time) *time.Time {
+	days := 0
+	switch schedule.Recurrence {
+	case RoomRecurrenceDaily:
+		days = 1
+	case RoomRecurrenceWeekly:
+		days = 7
+	default:
+		return nil
+	}
+	next := schedule.StartsAt.AddDate(0, 0, days)
+	for !next.After(now) {
+		next = next.AddDate(0, 0, days)
+	}
+	if schedule.RecurrenceUntil != nil && next.After(*schedule.RecurrenceUntil) {
+		return nil
+	}
+	return &next
+}
@@ -0,0 +1,356 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"music-share-api/internal/repositories"
+)
+
+// memoryRoomScheduleRepository は、テスト用のインメモリ RoomScheduleRepository です。
+type memoryRoomScheduleRepository struct {
+	schedules map[int]*repositories.RoomSchedule
+	// rsvps は schedule_id・回（starts_at の Unix 秒）ごとの参加表明したユーザー
+	rsvps map[int]map[int64][]int
+	users map[int]repositories.RSVPUser
+}
+
+func newMemoryRoomScheduleRepository() *memoryRoomScheduleRepository {
+	return &memoryRoomScheduleRepository{
+		schedules: make(map[int]*repositories.RoomSchedule),
+		rsvps:     make(map[int]map[int64][]int),
+		users:     make(map[int]repositories.RSVPUser),
+	}
+}
+
+func (r *memoryRoomScheduleRepository) CreateSchedule(schedule repositories.RoomSchedule) (int, error) {
+	schedule.ScheduleID = len(r.schedules) + 1
+	schedule.Status = repositories.RoomScheduleScheduled
+	r.schedules[schedule.ScheduleID] = &schedule
+	return schedule.ScheduleID, nil
+}
+
+func (r *memoryRoomScheduleRepository) view(schedule repositories.RoomSchedule, userID int) repositories.RoomSchedule {
+	users := r.rsvps[schedule.ScheduleID][schedule.StartsAt.Unix()]
+	schedule.RSVPCount = len(users)
+	schedule.RSVPed = false
+	for _, id := range users {
+		schedule.RSVPed = schedule.RSVPed || id == userID
+	}
+	schedule.Tags = schedule.Input.Tags
+	return schedule
+}
+
+func (r *memoryRoomScheduleRepository) GetSchedule(scheduleID, userID int) (*repositories.RoomSchedule, bool, error) {
+	schedule, ok := r.schedules[scheduleID]
+	if !ok {
+		return nil, false, nil
+	}
+	viewed := r.view(*schedule, userID)
+	return &viewed, true, nil
+}
+
+func (r *memoryRoomScheduleRepository) list(limit int, match func(repositories.RoomSchedule) bool, userID int) []repositories.RoomSchedule {
+	schedules := []repositories.RoomSchedule{}
+	for id := 1; id <= len(r.schedules); id++ {
+		if schedule := r.schedules[id]; match(*schedule) {
+			schedules = append(schedules, r.view(*schedule, userID))
+		}
+	}
+	for i := 1; i < len(schedules); i++ {
+		for j := i; j > 0 && schedules[j].StartsAt.Before(schedules[j-1].StartsAt); j-- {
+			schedules[j], schedules[j-1] = schedules[j-1], schedules[j]
+		}
+	}
+	if len(schedules) > limit {
+		schedules = schedules[:limit]
+	}
+	return schedules
+}
+
+func (r *memoryRoomScheduleRepository) ListUpcomingSchedules(userID int, limit int) ([]repositories.RoomSchedule, error) {
+	return r.list(limit, func(schedule repositories.RoomSchedule) bool {
+		return schedule.Status == repositories.RoomScheduleScheduled && (schedule.IsPublic || schedule.HostUserID == userID)
+	}, userID), nil
+}
+
+func (r *memoryRoomScheduleRepository) ListDueSchedules(now time.Time, limit int) ([]repositories.RoomSchedule, error) {
+	return r.list(limit, func(schedule repositories.RoomSchedule) bool {
+		return schedule.Status == repositories.RoomScheduleScheduled && !schedule.StartsAt.After(now)
+	}, 0), nil
+}
+
+func (r *memoryRoomScheduleRepository) ClaimOccurrence(scheduleID int, startsAt time.Time, next *time.Time) (bool, error) {
+	schedule := r.schedules[scheduleID]
+	if schedule.Status != repositories.RoomScheduleScheduled || !schedule.StartsAt.Equal(startsAt) {
+		return false, nil
+	}
+	if next == nil {
+		schedule.Status = repositories.RoomScheduleOpened
+	} else {
+		schedule.StartsAt = *next
+	}
+	return true, nil
+}
+
+func (r *memoryRoomScheduleRepository) ReleaseOccurrence(scheduleID int, startsAt time.Time, next *time.Time) error {
+	schedule := r.schedules[scheduleID]
+	schedule.StartsAt = startsAt
+	schedule.Status = repositories.RoomScheduleScheduled
+	return nil
+}
+
+func (r *memoryRoomScheduleRepository) RecordOpenedRoom(scheduleID, roomID int) error {
+	r.schedules[scheduleID].LastRoomID = &roomID
+	return nil
+}
+
+func (r *memoryRoomScheduleRepository) CancelSchedule(scheduleID int) error {
+	r.schedules[scheduleID].Status = repositories.RoomScheduleCancelled
+	return nil
+}
+
+func (r *memoryRoomScheduleRepository) AddRSVP(scheduleID int, startsAt time.Time, userID int) error {
+	if r.rsvps[scheduleID] == nil {
+		r.rsvps[scheduleID] = make(map[int64][]int)
+	}
+	for _, id := range r.rsvps[scheduleID][startsAt.Unix()] {
+		if id == userID {
+			return nil
+		}
+	}
+	r.rsvps[scheduleID][startsAt.Unix()] = append(r.rsvps[scheduleID][startsAt.Unix()], userID)
+	return nil
+}
+
+func (r *memoryRoomScheduleRepository) RemoveRSVP(scheduleID int, startsAt time.Time, userID int) error {
+	var kept []int
+	for _, id := range r.rsvps[scheduleID][startsAt.Unix()] {
+		if id != userID {
+			kept = append(kept, id)
+		}
+	}
+	r.rsvps[scheduleID][startsAt.Unix()] = kept
+	return nil
+}
+
+func (r *memoryRoomScheduleRepository) ListRSVPUsers(scheduleID int, startsAt time.Time) ([]repositories.RSVPUser, error) {
+	var users []repositories.RSVPUser
+	for _, id := range r.rsvps[scheduleID][startsAt.Unix()] {
+		users = append(users, r.users[id])
+	}
+	return users, nil
+}
+
+type roomScheduleFixture struct {
+	repository     *memoryRoomScheduleRepository
+	roomRepository *memoryRoomRepository
+	mailer         *recordingMailer
+	service        *roomScheduleService
+	now            time.Time
+}
+
+func newRoomScheduleFixture(t *testing.T) *roomScheduleFixture {
+	t.Helper()
+	_, roomRepository, roomService := newRoomServiceFixture(t)
+	f := &roomScheduleFixture{
+		repository:     newMemoryRoomScheduleRepository(),
+		roomRepository: roomRepository,
+		mailer:         &recordingMailer{},
+		now:            time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC),
+	}
+	f.repository.users[2] = repositories.RSVPUser{UserID: 2, UserName: "alice", Email: "alice@example.com"}
+	f.repository.users[3] = repositories.RSVPUser{UserID: 3, UserName: "bob", Email: "bob@example.com"}
+	f.service = NewRoomScheduleService(f.repository, roomService, f.mailer).(*roomScheduleService)
+	f.service.now = func() time.Time { return f.now }
+	return f
+}
+
+func (f *roomScheduleFixture) schedule(t *testing.T, input ScheduleRoomInput) *repositories.RoomSchedule {
+	t.Helper()
+	schedule, err := f.service.ScheduleRoom(1, input)
+	if err != nil {
+		t.Fatalf("ScheduleRoom failed: %v", err)
+	}
+	return schedule
+}
+
+func TestRoomScheduleServiceScheduleRoom(t *testing.T) {
+	f := newRoomScheduleFixture(t)
+
+	schedule := f.schedule(t, ScheduleRoomInput{
+		RoomCreateInput: repositories.RoomCreateInput{
+			RoomName: "Friday Party", IsPublic: true, Genre: "J-POP", Tags: []string{" Chill "}, MaxParticipants: 10,
+			HostUserID: 99, HostUserName: "host", ImportPlaylistID: "pl1",
+		},
+		StartsAt:   f.now.Add(2*time.Hour + 500*time.Millisecond),
+		Recurrence: "Weekly",
+	})
+	if schedule.HostUserID != 1 || schedule.Input.HostUserID != 1 {
+		t.Fatalf("expected the requesting user to be the host, got %+v", schedule)
+	}
+	if !schedule.StartsAt.Equal(f.now.Add(2*time.Hour)) || schedule.Recurrence != RoomRecurrenceWeekly {
+		t.Fatalf("unexpected schedule: %+v", schedule)
+	}
+	// ジャンル・タグの正規化とプレイリストの取り込みは予約時に行う
+	if schedule.Genre != "j-pop" || len(schedule.Tags) != 1 || schedule.Tags[0] != "chill" {
+		t.Fatalf("expected normalized genre and tags, got %q %v", schedule.Genre, schedule.Tags)
+	}
+	if schedule.Input.ImportPlaylistID != "" || schedule.Input.PlayingPlaylistName != "Morning" || len(schedule.Input.Songs) != 2 {
+		t.Fatalf("expected the playlist to be imported, got %+v", schedule.Input)
+	}
+
+	for _, input := range []ScheduleRoomInput{
+		{RoomCreateInput: repositories.RoomCreateInput{RoomName: "Past"}, StartsAt: f.now.Add(-time.Minute)},
+		{RoomCreateInput: repositories.RoomCreateInput{RoomName: "Too far"}, StartsAt: f.now.Add(91 * 24 * time.Hour)},
+		{RoomCreateInput: repositories.RoomCreateInput{RoomName: "Monthly"}, StartsAt: f.now.Add(time.Hour), Recurrence: "monthly"},
+		{RoomCreateInput: repositories.RoomCreateInput{RoomName: "Until"}, StartsAt: f.now.Add(time.Hour), RecurrenceUntil: &f.now},
+		{StartsAt: f.now.Add(time.Hour)},
+	} {
+		if _, err := f.service.ScheduleRoom(1, input); !errors.Is(err, ErrInvalidSchedule) {
+			t.Fatalf("%+v: expected ErrInvalidSchedule, got %v", input, err)
+		}
+	}
+	if _, err := f.service.ScheduleRoom(1, ScheduleRoomInput{
+		RoomCreateInput: repositories.RoomCreateInput{RoomName: "Bad genre", Genre: "polka"},
+		StartsAt:        f.now.Add(time.Hour),
+	}); !errors.Is(err, ErrInvalidGenre) {
+		t.Fatalf("expected ErrInvalidGenre, got %v", err)
+	}
+}
+
+func TestRoomScheduleServiceUpcomingAndRSVP(t *testing.T) {
+	f := newRoomScheduleFixture(t)
+	later := f.schedule(t, ScheduleRoomInput{RoomCreateInput: repositories.RoomCreateInput{RoomName: "Later", IsPublic: true}, StartsAt: f.now.Add(3 * time.Hour)})
+	private := f.schedule(t, ScheduleRoomInput{RoomCreateInput: repositories.RoomCreateInput{RoomName: "Private"}, StartsAt: f.now.Add(2 * time.Hour)})
+	sooner := f.schedule(t, ScheduleRoomInput{RoomCreateInput: repositories.RoomCreateInput{RoomName: "Sooner", IsPublic: true}, StartsAt: f.now.Add(time.Hour)})
+
+	upcoming, err := f.service.ListUpcoming(2, 0)
+	if err != nil {
+		t.Fatalf("ListUpcoming failed: %v", err)
+	}
+	if len(upcoming) != 2 || upcoming[0].ScheduleID != sooner.ScheduleID || upcoming[1].ScheduleID != later.ScheduleID {
+		t.Fatalf("expected public schedules by start time, got %+v", upcoming)
+	}
+	if hosted, _ := f.service.ListUpcoming(1, 0); len(hosted) != 3 {
+		t.Fatalf("expected the host to see the private schedule, got %+v", hosted)
+	}
+
+	schedule, err := f.service.RSVP(2, sooner.ScheduleID)
+	if err != nil {
+		t.Fatalf("RSVP failed: %v", err)
+	}
+	if !schedule.RSVPed || schedule.RSVPCount != 1 {
+		t.Fatalf("expected the rsvp to be counted, got %+v", schedule)
+	}
+	if _, err := f.service.RSVP(2, sooner.ScheduleID); err != nil {
+		t.Fatalf("RSVP twice failed: %v", err)
+	}
+	if _, err := f.service.RSVP(3, sooner.ScheduleID); err != nil {
+		t.Fatalf("RSVP failed: %v", err)
+	}
+	if schedule, err = f.service.CancelRSVP(3, sooner.ScheduleID); err != nil || schedule.RSVPCount != 1 || schedule.RSVPed {
+		t.Fatalf("expected the rsvp to be cancelled, got %+v, %v", schedule, err)
+	}
+
+	if _, err := f.service.RSVP(2, private.ScheduleID); !errors.Is(err, ErrScheduleNotFound) {
+		t.Fatalf("expected ErrScheduleNotFound for a private schedule, got %v", err)
+	}
+	if err := f.service.CancelSchedule(2, later.ScheduleID); !errors.Is(err, ErrNotRoomHost) {
+		t.Fatalf("expected ErrNotRoomHost, got %v", err)
+	}
+	if err := f.service.CancelSchedule(1, later.ScheduleID); err != nil {
+		t.Fatalf("CancelSchedule failed: %v", err)
+	}
+	if _, err := f.service.RSVP(2, later.ScheduleID); !errors.Is(err, ErrScheduleNotOpen) {
+		t.Fatalf("expected ErrScheduleNotOpen for a cancelled schedule, got %v", err)
+	}
+}
+
+func TestRoomScheduleServiceOpensDueRoomsAndNotifies(t *testing.T) {
+	f := newRoomScheduleFixture(t)
+	once := f.schedule(t, ScheduleRoomInput{
+		RoomCreateInput: repositories.RoomCreateInput{
+			RoomName: "Release Party", IsPublic: true, HostUserName: "host",
+			Songs: map[string]repositories.Song{"0": {SongId: "t1", SongName: "Blue Sky"}},
+		},
+		StartsAt: f.now.Add(time.Hour),
+	})
+	until := f.now.Add(10 * 24 * time.Hour)
+	weekly := f.schedule(t, ScheduleRoomInput{
+		RoomCreateInput: repositories.RoomCreateInput{RoomName: "Weekly", IsPublic: true},
+		StartsAt:        f.now.Add(2 * time.Hour),
+		Recurrence:      RoomRecurrenceWeekly,
+		RecurrenceUntil: &until,
+	})
+	if _, err := f.service.RSVP(2, once.ScheduleID); err != nil {
+		t.Fatalf("RSVP failed: %v", err)
+	}
+	if _, err := f.service.RSVP(3, weekly.ScheduleID); err != nil {
+		t.Fatalf("RSVP failed: %v", err)
+	}
+
+	// 開始時刻前は開かない
+	if opened, err := f.service.OpenDueRooms(); err != nil || len(opened) != 0 {
+		t.Fatalf("expected nothing to open yet, got %+v, %v", opened, err)
+	}
+
+	f.now = f.now.Add(3 * time.Hour)
+	opened, err := f.service.OpenDueRooms()
+	if err != nil {
+		t.Fatalf("OpenDueRooms failed: %v", err)
+	}
+	if len(opened) != 2 || opened[0].ScheduleID != once.ScheduleID || opened[1].ScheduleID != weekly.ScheduleID {
+		t.Fatalf("expected both schedules to open, got %+v", opened)
+	}
+	room := f.roomRepository.rooms[opened[0].RoomID]
+	if room == nil || room.RoomName != "Release Party" || room.HostUserID != 1 || room.Songs["0"].TrackID == "" {
+		t.Fatalf("expected the room to be created from the schedule, got %+v", room)
+	}
+	if opened[0].Notified != 1 || opened[1].Notified != 1 || len(f.mailer.sent) != 2 {
+		t.Fatalf("expected each rsvp to be notified once, got %+v", f.mailer.sent)
+	}
+	if f.mailer.sent[0].to != "alice@example.com" || !strings.Contains(f.mailer.sent[0].body, "/room/1") {
+		t.Fatalf("unexpected notification: %+v", f.mailer.sent[0])
+	}
+
+	if f.repository.schedules[once.ScheduleID].Status != repositories.RoomScheduleOpened {
+		t.Fatalf("expected the one-off schedule to be marked opened")
+	}
+	// 繰り返す予約は次の回に進み、参加表明は回ごとにやり直す
+	next := f.repository.schedules[weekly.ScheduleID]
+	if next.Status != repositories.RoomScheduleScheduled || !next.StartsAt.Equal(weekly.StartsAt.AddDate(0, 0, 7)) {
+		t.Fatalf("expected the weekly schedule to move to next week, got %+v", next)
+	}
+	if schedule, _, _ := f.repository.GetSchedule(weekly.ScheduleID, 3); schedule.RSVPCount != 0 || *schedule.LastRoomID != opened[1].RoomID {
+		t.Fatalf("expected a fresh occurrence, got %+v", schedule)
+	}
+
+	// 同じ回を二度開かない
+	if opened, _ := f.service.OpenDueRooms(); len(opened) != 0 {
+		t.Fatalf("expected nothing to reopen, got %+v", opened)
+	}
+
+	// 終了日を過ぎる回はなく、最後の回を開いたら終わる
+	f.now = f.now.Add(7 * 24 * time.Hour)
+	if opened, _ := f.service.OpenDueRooms(); len(opened) != 1 {
+		t.Fatalf("expected the second occurrence to open, got %+v", opened)
+	}
+	if f.repository.schedules[weekly.ScheduleID].Status != repositories.RoomScheduleOpened {
+		t.Fatalf("expected the weekly schedule to end after recurrenceUntil, got %+v", f.repository.schedules[weekly.ScheduleID])
+	}
+}
+
+func TestNextOccurrenceSkipsMissedOccurrences(t *testing.T) {
+	start := time.Date(2026, 10, 1, 20, 0, 0, 0, time.UTC)
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	next := nextOccurrence(repositories.RoomSchedule{StartsAt: start, Recurrence: RoomRecurrenceDaily}, now)
+	if next == nil || !next.Equal(time.Date(2026, 10, 18, 20, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected the next daily occurrence after now, got %v", next)
+	}
+	if next := nextOccurrence(repositories.RoomSchedule{StartsAt: start}, now); next != nil {
+		t.Fatalf("expected no next occurrence without recurrence, got %v", next)
+	}
+}
@@ -1,27 +1,77 @@
 package services
 
 import (
+	"errors"
 	"fmt"
+	"music-share-api/internal/providers"
 	"music-share-api/internal/repositories"
+	"music-share-api/internal/utils"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 type RoomService interface {
 	CreateRoom(input repositories.RoomCreateInput) (int, error)
+	// PrepareRoom は、ジャンル・タグを正規化し、プレイリストの取り込みが指定されていれば曲一覧を取得した作成内容を返します。
+	PrepareRoom(input repositories.RoomCreateInput) (repositories.RoomCreateInput, error)
 	JoinRoom(userID int, userName string, roomID int, roomPassword *string) (error)
 	LeaveRoom(userID int, roomID int) (*repositories.RoomAllInfo, error)
-	DeleteRoom(roomID int) error
 	GetRoom(roomID int) (*repositories.RoomAllInfo, error)
+	// ImportPlaylist は、ホストの Spotify プレイリストでルームの曲一覧を置き換え、プレイリスト名と取り込んだ曲を返します。
+	ImportPlaylist(userID int, roomID int, playlistID string) (string, []repositories.Song, error)
+	// ExportPlaylist は、ルームの曲をリクエストしたユーザーの Spotify にプレイリストとして保存します。
+	// 閉じたルームは、過去のホスト・参加者のみ書き出せます。
+	ExportPlaylist(userID int, roomID int, input ExportPlaylistInput) (*providers.Playlist, error)
 }
 
+// ExportPlaylistInput は、プレイリスト書き出しのオプションです。
+type ExportPlaylistInput struct {
+	// Source は書き出す曲の取得元（"queue": ルームの曲一覧、"history": 実際に再生された曲）
+	Source      string
+	Name        string
+	Description string
+	Public      bool
+}
+
+// プレイリストの書き出し元
+const (
+	// ExportSourceQueue は、ルームの曲一覧（trx_rooms_songs）を書き出し元とします。
+	ExportSourceQueue = "queue"
+	// ExportSourceHistory は、ルームで実際に再生された曲（trx_room_plays）を最初に再生された順に書き出します。
+	ExportSourceHistory = "history"
+)
+
+var (
+	// ErrNotRoomHost は、ホスト以外のユーザーがホスト専用の操作を行った場合に返されます。
+	ErrNotRoomHost = errors.New("only the host can perform this operation")
+	// ErrNotRoomMember は、非公開ルームにホスト・参加者以外がアクセスした場合に返されます。
+	ErrNotRoomMember = errors.New("you are not a member of this room")
+	// ErrNothingToExport は、書き出す曲がない場合に返されます。
+	ErrNothingToExport = errors.New("there are no songs to export")
+	// ErrRoomNotFound は、ルームが存在しない場合に返されます。
+	ErrRoomNotFound = repositories.ErrRoomNotFound
+	// ErrRoomDeleted は、削除された（閉じられた）ルームを操作しようとした場合に返されます。
+	ErrRoomDeleted = repositories.ErrRoomDeleted
+)
+
 type roomService struct {
-	roomRepository repositories.RoomRepository
+	roomRepository    repositories.RoomRepository
+	musicService      MusicService
+	genreService      GenreService
+	playLogRepository repositories.PlayLogRepository
 }
 
-func NewRoomService(roomRepository repositories.RoomRepository) RoomService {
-	return &roomService{roomRepository: roomRepository}
+func NewRoomService(roomRepository repositories.RoomRepository, musicService MusicService, genreService GenreService, playLogRepository repositories.PlayLogRepository) RoomService {
+	return &roomService{roomRepository: roomRepository, musicService: musicService, genreService: genreService, playLogRepository: playLogRepository}
 }
 
 func (s *roomService) CreateRoom(input repositories.RoomCreateInput) (int, error) {
+	input, err := s.PrepareRoom(input)
+	if err != nil {
+		return 0, err
+	}
+
 	roomID, err := s.roomRepository.CreateRoom(input)
 	if err != nil {
 		return 0, fmt.Errorf("failed to create room: %w", err)
@@ -29,6 +79,42 @@ func (s *roomService) CreateRoom(input repositories.RoomCreateInput) (int, error
 	return roomID, nil
 }
 
+func (s *roomService) PrepareRoom(input repositories.RoomCreateInput) (repositories.RoomCreateInput, error) {
+	// ジャンルはマスタのコードに揃え、タグは正規化してから保存する
+	genre, err := s.genreService.NormalizeGenre(input.Genre)
+	if err != nil {
+		return input, err
+	}
+	input.Genre = genre
+	if input.Tags, err = s.genreService.NormalizeTags(input.Tags); err != nil {
+		return input, err
+	}
+
+	// プレイリストの取り込みが指定された場合は、作成前に曲一覧を取得しておく（取得できなければ作成しない）
+	if input.ImportPlaylistID != "" {
+		playlistName, songs, err := s.fetchPlaylistSongs(input.HostUserID, input.ImportPlaylistID)
+		if err != nil {
+			return input, fmt.Errorf("failed to import playlist: %w", err)
+		}
+		input.ImportPlaylistID = ""
+		input.PlayingPlaylistName = playlistName
+		input.PlayingSongIndex = 0
+		input.PlayingSongName = ""
+		input.Songs = make(map[string]repositories.Song, len(songs))
+		for idx, song := range songs {
+			input.Songs[strconv.Itoa(idx)] = song
+		}
+		if len(songs) > 0 {
+			input.PlayingSongName = songs[0].SongName
+		}
+	} else {
+		for key, song := range input.Songs {
+			input.Songs[key] = withTrackID(song)
+		}
+	}
+	return input, nil
+}
+
 func (s *roomService) JoinRoom(userID int, userName string, roomID int, roomPassword *string) (error) {
 	// まず参加処理を実行
 	if err := s.roomRepository.JoinRoom(userID, userName, roomID, roomPassword); err != nil {
@@ -45,17 +131,164 @@ func (s *roomService) LeaveRoom(userID int, roomID int) (*repositories.RoomAllIn
 	return room, nil
 }
 
-func (s *roomService) DeleteRoom(roomID int) error {
-	if err := s.roomRepository.DeleteRoom(roomID); err != nil {
-		return fmt.Errorf("failed to delete room: %w", err)
+func (s *roomService) GetRoom(roomID int) (*repositories.RoomAllInfo, error) {
+	room, err := s.roomRepository.GetRoomByID(roomID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get room: %w", err)
 	}
-	return nil
+	return room, nil
 }
 
-func (s *roomService) GetRoom(roomID int) (*repositories.RoomAllInfo, error) {
+func (s *roomService) ImportPlaylist(userID int, roomID int, playlistID string) (string, []repositories.Song, error) {
 	room, err := s.roomRepository.GetRoomByID(roomID)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get room: %w", err)
+	}
+	if room.HostUserID != userID {
+		return "", nil, ErrNotRoomHost
+	}
+
+	playlistName, songs, err := s.fetchPlaylistSongs(userID, playlistID)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := s.roomRepository.ReplaceRoomSongs(roomID, playlistName, songs); err != nil {
+		return "", nil, fmt.Errorf("failed to import playlist: %w", err)
+	}
+	return playlistName, songs, nil
+}
+
+// fetchPlaylistSongs は、ユーザーが連携している Spotify のトークンでプレイリストを取得し、Song に変換します。
+// 曲数は ROOM_IMPORT_MAX_TRACKS（既定 500）までに制限します。
+func (s *roomService) fetchPlaylistSongs(userID int, playlistID string) (string, []repositories.Song, error) {
+	if playlistID == "" {
+		return "", nil, errors.New("playlist id is empty")
+	}
+	playlist, err := s.musicService.GetPlaylist(spotifyProviderName, userID, playlistID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	tracks := playlist.Tracks
+	if maxTracks := utils.GetEnvInt("ROOM_IMPORT_MAX_TRACKS", 500); len(tracks) > maxTracks {
+		tracks = tracks[:maxTracks]
+	}
+	songs := make([]repositories.Song, 0, len(tracks))
+	for _, track := range tracks {
+		songs = append(songs, songFromTrack(track))
+	}
+	return playlist.Name, songs, nil
+}
+
+// songFromTrack は、プロバイダーの曲情報をルームの Song に変換します。
+func songFromTrack(track providers.Track) repositories.Song {
+	return repositories.Song{
+		SongId:       track.ID,
+		SongName:     track.Name,
+		Artist:       strings.Join(track.Artists, ", "),
+		SongLength:   track.DurationMs,
+		SongImageUrl: track.ImageURL,
+		ISRC:         track.ISRC,
+		TrackID:      providers.TrackID(spotifyProviderName, track.ID, track.ISRC),
+	}
+}
+
+// withTrackID は、クライアントから渡された曲に TrackID がなければ補います。
+func withTrackID(song repositories.Song) repositories.Song {
+	if song.TrackID == "" && (song.SongId != "" || song.ISRC != "") {
+		song.TrackID = providers.TrackID(spotifyProviderName, song.SongId, song.ISRC)
+	}
+	return song
+}
+
+func (s *roomService) ExportPlaylist(userID int, roomID int, input ExportPlaylistInput) (*providers.Playlist, error) {
+	room, err := s.exportableRoom(userID, roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	var trackIDs []string
+	switch input.Source {
+	case "", ExportSourceQueue:
+		trackIDs = queueTrackIDs(room.Songs)
+	case ExportSourceHistory:
+		if trackIDs, err = s.playLogRepository.ListPlayedSongIDs(roomID); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported export source: %s", input.Source)
+	}
+	if len(trackIDs) == 0 {
+		return nil, ErrNothingToExport
+	}
+
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		name = room.RoomName
+	}
+	description := input.Description
+	if description == "" {
+		description = fmt.Sprintf("music-share のルーム「%s」の曲", room.RoomName)
+	}
+
+	return s.musicService.CreatePlaylist(spotifyProviderName, userID, name, description, input.Public, trackIDs)
+}
+
+// exportableRoom は、曲を書き出すルームを返します。
+// 空室になったルームは自動で閉じられるため、閉じたルームもセッションの後から保存できるよう過去のホスト・参加者には返す。
+func (s *roomService) exportableRoom(userID int, roomID int) (*repositories.RoomAllInfo, error) {
+	room, err := s.roomRepository.GetRoomByID(roomID)
+	if errors.Is(err, ErrRoomDeleted) {
+		allowed, err := s.playLogRepository.CanViewRoomHistory(roomID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			return nil, ErrNotRoomMember
+		}
+		return s.roomRepository.GetStoredRoomByID(roomID)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get room: %w", err)
 	}
+	if !room.IsPublic && !isRoomMember(room, userID) {
+		return nil, ErrNotRoomMember
+	}
 	return room, nil
 }
+
+// isRoomMember は、ユーザーがルームのホストまたは参加者かどうかを返します。
+func isRoomMember(room *repositories.RoomAllInfo, userID int) bool {
+	if room.HostUserID == userID {
+		return true
+	}
+	userIDStr := strconv.Itoa(userID)
+	for _, participant := range room.RedisData.Participants {
+		if participant.UserID == userIDStr {
+			return true
+		}
+	}
+	return false
+}
+
+// queueTrackIDs は、song_index の順に曲IDを返します（Songs のキーは song_index の文字列）。
+func queueTrackIDs(songs map[string]repositories.Song) []string {
+	indexes := make([]int, 0, len(songs))
+	for key := range songs {
+		idx, err := strconv.Atoi(key)
+		if err != nil {
+			continue
+		}
+		indexes = append(indexes, idx)
+	}
+	sort.Ints(indexes)
+
+	trackIDs := make([]string, 0, len(indexes))
+	for _, idx := range indexes {
+		// 曲IDのない曲（プロバイダーで見つからなかった曲など）は書き出せないため飛ばす
+		if songID := songs[strconv.Itoa(idx)].SongId; songID != "" {
+			trackIDs = append(trackIDs, songID)
+		}
+	}
+	return trackIDs
+}
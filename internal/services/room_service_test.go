@@ -0,0 +1,157 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"music-share-api/internal/repositories"
+)
+
+func TestRoomServiceCreateRoomImportsPlaylist(t *testing.T) {
+	_, roomRepository, service := newRoomServiceFixture(t)
+
+	roomID, err := service.CreateRoom(repositories.RoomCreateInput{RoomName: "room", HostUserID: 1, ImportPlaylistID: "pl1"})
+	if err != nil {
+		t.Fatalf("CreateRoom: %v", err)
+	}
+
+	room := roomRepository.rooms[roomID]
+	if room.PlayingPlaylistName != "Morning" || room.PlayingSongName != "Blue Sky" {
+		t.Fatalf("unexpected playing info: %q / %q", room.PlayingPlaylistName, room.PlayingSongName)
+	}
+	want := repositories.Song{SongId: "t1", SongName: "Blue Sky", Artist: "Band A, Band B", SongLength: 201000, SongImageUrl: "http://img/1", TrackID: "spotify:t1"}
+	if len(room.Songs) != 2 || room.Songs["0"] != want || room.Songs["1"].SongId != "t2" {
+		t.Fatalf("unexpected songs: %+v", room.Songs)
+	}
+
+	// 連携していないホストのルームは作成しない
+	if _, err := service.CreateRoom(repositories.RoomCreateInput{RoomName: "room", HostUserID: 2, ImportPlaylistID: "pl1"}); !errors.Is(err, ErrServiceNotConnected) {
+		t.Fatalf("err = %v, want ErrServiceNotConnected", err)
+	}
+	if len(roomRepository.rooms) != 1 {
+		t.Fatal("room was created although the import failed")
+	}
+}
+
+func TestRoomServiceCreateRoomNormalizesGenreAndTags(t *testing.T) {
+	_, roomRepository, service := newRoomServiceFixture(t)
+
+	roomID, err := service.CreateRoom(repositories.RoomCreateInput{RoomName: "room", HostUserID: 1, Genre: "JPOP", Tags: []string{"#Chill", "chill", "Late Night"}})
+	if err != nil {
+		t.Fatalf("CreateRoom: %v", err)
+	}
+	room := roomRepository.rooms[roomID]
+	if room.Genre != "j-pop" || len(room.Tags) != 2 || room.Tags[0] != "chill" || room.Tags[1] != "late-night" {
+		t.Fatalf("genre = %q, tags = %v", room.Genre, room.Tags)
+	}
+
+	if _, err := service.CreateRoom(repositories.RoomCreateInput{RoomName: "room", HostUserID: 1, Genre: "city pop"}); !errors.Is(err, ErrInvalidGenre) {
+		t.Fatalf("err = %v, want ErrInvalidGenre", err)
+	}
+	if _, err := service.CreateRoom(repositories.RoomCreateInput{RoomName: "room", HostUserID: 1, Tags: []string{"<script>"}}); !errors.Is(err, ErrInvalidTags) {
+		t.Fatalf("err = %v, want ErrInvalidTags", err)
+	}
+	if len(roomRepository.rooms) != 1 {
+		t.Fatal("room was created with an invalid genre or tag")
+	}
+}
+
+func TestRoomServiceImportPlaylist(t *testing.T) {
+	_, roomRepository, service := newRoomServiceFixture(t)
+	roomID, _ := service.CreateRoom(repositories.RoomCreateInput{RoomName: "room", HostUserID: 1, PlayingPlaylistName: "old"})
+
+	if _, _, err := service.ImportPlaylist(2, roomID, "pl1"); !errors.Is(err, ErrNotRoomHost) {
+		t.Fatalf("err = %v, want ErrNotRoomHost", err)
+	}
+
+	playlistName, songs, err := service.ImportPlaylist(1, roomID, "pl1")
+	if err != nil {
+		t.Fatalf("ImportPlaylist: %v", err)
+	}
+	if playlistName != "Morning" || len(songs) != 2 {
+		t.Fatalf("unexpected result: %q, %d songs", playlistName, len(songs))
+	}
+	if roomRepository.rooms[roomID].PlayingPlaylistName != "Morning" {
+		t.Fatal("playing playlist name was not updated")
+	}
+
+	if _, _, err := service.ImportPlaylist(1, roomID, "missing"); err == nil {
+		t.Fatal("ImportPlaylist succeeded for a missing playlist")
+	}
+}
+
+func TestRoomServiceExportPlaylist(t *testing.T) {
+	f, roomRepository, service := newRoomServiceFixture(t)
+	roomID, _ := service.CreateRoom(repositories.RoomCreateInput{RoomName: "Friday", HostUserID: 1, ImportPlaylistID: "pl1"})
+	roomRepository.rooms[roomID].IsPublic = false
+
+	// 非公開ルームはホスト・参加者のみ書き出せる
+	if _, err := service.ExportPlaylist(2, roomID, ExportPlaylistInput{}); !errors.Is(err, ErrNotRoomMember) {
+		t.Fatalf("err = %v, want ErrNotRoomMember", err)
+	}
+	if _, err := service.ExportPlaylist(1, roomID, ExportPlaylistInput{Source: "unknown"}); err == nil {
+		t.Fatal("ExportPlaylist succeeded for an unknown source")
+	}
+
+	playlist, err := service.ExportPlaylist(1, roomID, ExportPlaylistInput{Description: "good night"})
+	if err != nil {
+		t.Fatalf("ExportPlaylist: %v", err)
+	}
+	name, description, ownerID, trackIDs, ok := f.fake.PlaylistTracks(playlist.ID)
+	if !ok || name != "Friday" || description != "good night" || ownerID != "sp-host" {
+		t.Fatalf("unexpected exported playlist: %q %q %q", name, description, ownerID)
+	}
+	if len(trackIDs) != 2 || trackIDs[0] != "t1" || trackIDs[1] != "t2" {
+		t.Fatalf("track ids = %v", trackIDs)
+	}
+}
+
+func TestRoomServiceExportPlaylistFromHistory(t *testing.T) {
+	f, roomRepository, _ := newRoomServiceFixture(t)
+	playLogRepository := newMemoryPlayLogRepository()
+	service := NewRoomService(roomRepository, f.service, newTestGenreService(), playLogRepository)
+	roomID, _ := service.CreateRoom(repositories.RoomCreateInput{RoomName: "Friday", HostUserID: 1, ImportPlaylistID: "pl1"})
+
+	if _, err := service.ExportPlaylist(1, roomID, ExportPlaylistInput{Source: ExportSourceHistory}); !errors.Is(err, ErrNothingToExport) {
+		t.Fatalf("err = %v, want ErrNothingToExport", err)
+	}
+
+	// 再生された順に、繰り返し再生された曲は1回だけ書き出す
+	for _, songID := range []string{"t2", "t1", "t2"} {
+		playLogRepository.StartPlay(repositories.RoomPlay{RoomID: roomID, SongID: songID})
+	}
+	playlist, err := service.ExportPlaylist(1, roomID, ExportPlaylistInput{Source: ExportSourceHistory})
+	if err != nil {
+		t.Fatalf("ExportPlaylist: %v", err)
+	}
+	_, _, _, trackIDs, _ := f.fake.PlaylistTracks(playlist.ID)
+	if len(trackIDs) != 2 || trackIDs[0] != "t2" || trackIDs[1] != "t1" {
+		t.Fatalf("track ids = %v", trackIDs)
+	}
+}
+
+func TestRoomServiceExportPlaylistFromClosedRoom(t *testing.T) {
+	f, roomRepository, _ := newRoomServiceFixture(t)
+	playLogRepository := newMemoryPlayLogRepository()
+	service := NewRoomService(roomRepository, f.service, newTestGenreService(), playLogRepository)
+	roomID, _ := service.CreateRoom(repositories.RoomCreateInput{RoomName: "Friday", HostUserID: 1, ImportPlaylistID: "pl1"})
+	// 曲IDのない曲は飛ばして書き出す
+	roomRepository.rooms[roomID].Songs["2"] = repositories.Song{SongName: "Unknown"}
+	roomRepository.rooms[roomID].DeletedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	playLogRepository.viewers[roomID] = map[int]bool{1: true}
+
+	// 閉じたルームは過去のホスト・参加者のみ書き出せる
+	if _, err := service.ExportPlaylist(2, roomID, ExportPlaylistInput{}); !errors.Is(err, ErrNotRoomMember) {
+		t.Fatalf("err = %v, want ErrNotRoomMember", err)
+	}
+	playlist, err := service.ExportPlaylist(1, roomID, ExportPlaylistInput{})
+	if err != nil {
+		t.Fatalf("ExportPlaylist: %v", err)
+	}
+	_, _, _, trackIDs, _ := f.fake.PlaylistTracks(playlist.ID)
+	if len(trackIDs) != 2 || trackIDs[0] != "t1" || trackIDs[1] != "t2" {
+		t.Fatalf("track ids = %v", trackIDs)
+	}
+}
@@ -0,0 +1,224 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"music-share-api/internal/repositories"
+)
+
+var (
+	// ErrTemplateNotFound は、テンプレートが存在しないか、他のユーザーのテンプレートにアクセスした場合に返されます。
+	ErrTemplateNotFound = errors.New("room template not found")
+	// ErrInvalidTemplate は、テンプレートの内容が不正な場合に返されます。
+	ErrInvalidTemplate = errors.New("invalid room template")
+	// ErrPasswordPolicy は、パスワードの指定がテンプレート（複製元のルーム）の設定と合わない場合に返されます。
+	ErrPasswordPolicy = errors.New("room password does not match the password policy")
+)
+
+// SaveTemplateInput は、テンプレートの保存内容です。RoomID を指定した場合はそのルームの設定と曲一覧を保存し、Room は使わない。
+type SaveTemplateInput struct {
+	TemplateName string                       `json:"templateName"`
+	RoomID       int                          `json:"roomId"`
+	Room         repositories.RoomCreateInput `json:"room"`
+}
+
+// RoomFromTemplateInput は、テンプレート・既存のルームからルームを作成するときに上書きする項目です。
+type RoomFromTemplateInput struct {
+	// RoomName が空ならテンプレートのルーム名を使う
+	RoomName string `json:"roomName"`
+	// RoomPassword は、テンプレートがパスワードを必須にしている場合だけ指定する
+	RoomPassword *string `json:"roomPassword"`
+	// HostUserName が空ならテンプレートのホスト名を使う
+	HostUserName string `json:"hostUserName"`
+}
+
+type RoomTemplateService interface {
+	// SaveTemplate は、ルームの設定をテンプレートとして保存します。ルームから保存できるのはホストのみ。
+	SaveTemplate(userID int, input SaveTemplateInput) (*repositories.RoomTemplate, error)
+	// ListTemplates は、自分のテンプレートを新しい順に返します。
+	ListTemplates(userID int) ([]repositories.RoomTemplate, error)
+	// DeleteTemplate は、自分のテンプレートを削除します。
+	DeleteTemplate(userID, templateID int) error
+	// CreateRoomFromTemplate は、テンプレートの設定と曲一覧で userID をホストとするルームを作成し、room_id を返します。
+	CreateRoomFromTemplate(userID, templateID int, input RoomFromTemplateInput) (int, error)
+	// CloneRoom は、ルーム（閉じたものを含む）の設定と曲一覧を複製したルームを作成し、room_id を返します。複製できるのはホストのみ。
+	CloneRoom(userID, roomID int, input RoomFromTemplateInput) (int, error)
+}
+
+type roomTemplateService struct {
+	templateRepository repositories.RoomTemplateRepository
+	roomService        RoomService
+}
+
+func NewRoomTemplateService(templateRepository repositories.RoomTemplateRepository, roomService RoomService) RoomTemplateService {
+	return &roomTemplateService{templateRepository: templateRepository, roomService: roomService}
+}
+
+func (s *roomTemplateService) SaveTemplate(userID int, input SaveTemplateInput) (*repositories.RoomTemplate, error) {
+	var template repositories.RoomTemplate
+	if input.RoomID != 0 {
+		room, err := s.getOwnRoom(userID, input.RoomID)
+		if err != nil {
+			return nil, err
+		}
+		template = *room
+	} else {
+		room := input.Room
+		room.HostUserID = userID
+		room, err := s.roomService.PrepareRoom(room)
+		if err != nil {
+			return nil, err
+		}
+		template = repositories.RoomTemplate{
+			RoomName:            room.RoomName,
+			IsPublic:            room.IsPublic,
+			PasswordRequired:    room.RoomPassword != nil && *room.RoomPassword != "",
+			Genre:               room.Genre,
+			Tags:                room.Tags,
+			MaxParticipants:     room.MaxParticipants,
+			HostUserName:        room.HostUserName,
+			PlayingPlaylistName: room.PlayingPlaylistName,
+			Songs:               songsInOrder(room.Songs),
+		}
+	}
+	template.UserID = userID
+	template.TemplateName = strings.TrimSpace(input.TemplateName)
+	if template.TemplateName == "" {
+		template.TemplateName = template.RoomName
+	}
+	if template.TemplateName == "" {
+		return nil, fmt.Errorf("%w: templateName is required", ErrInvalidTemplate)
+	}
+	if template.Tags == nil {
+		template.Tags = []string{}
+	}
+
+	templateID, err := s.templateRepository.CreateTemplate(template)
+	if err != nil {
+		return nil, err
+	}
+	saved, found, err := s.templateRepository.GetTemplate(templateID)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrTemplateNotFound
+	}
+	return saved, nil
+}
+
+func (s *roomTemplateService) ListTemplates(userID int) ([]repositories.RoomTemplate, error) {
+	return s.templateRepository.ListTemplates(userID)
+}
+
+// getTemplate は、userID のテンプレートを返します。
+func (s *roomTemplateService) getTemplate(userID, templateID int) (*repositories.RoomTemplate, error) {
+	template, found, err := s.templateRepository.GetTemplate(templateID)
+	if err != nil {
+		return nil, err
+	}
+	if !found || template.UserID != userID {
+		return nil, ErrTemplateNotFound
+	}
+	return template, nil
+}
+
+// getOwnRoom は、userID がホストのルームの設定と曲一覧を返します。
+func (s *roomTemplateService) getOwnRoom(userID, roomID int) (*repositories.RoomTemplate, error) {
+	room, found, err := s.templateRepository.GetRoomAsTemplate(roomID)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrRoomNotFound
+	}
+	if room.UserID != userID {
+		return nil, ErrNotRoomHost
+	}
+	return room, nil
+}
+
+func (s *roomTemplateService) DeleteTemplate(userID, templateID int) error {
+	if _, err := s.getTemplate(userID, templateID); err != nil {
+		return err
+	}
+	return s.templateRepository.DeleteTemplate(templateID)
+}
+
+func (s *roomTemplateService) CreateRoomFromTemplate(userID, templateID int, input RoomFromTemplateInput) (int, error) {
+	template, err := s.getTemplate(userID, templateID)
+	if err != nil {
+		return 0, err
+	}
+	return s.createRoom(userID, template, input)
+}
+
+func (s *roomTemplateService) CloneRoom(userID, roomID int, input RoomFromTemplateInput) (int, error) {
+	room, err := s.getOwnRoom(userID, roomID)
+	if err != nil {
+		return 0, err
+	}
+	return s.createRoom(userID, room, input)
+}
+
+// createRoom は、テンプレートの設定に input を反映したルームを作成します。
+func (s *roomTemplateService) createRoom(userID int, template *repositories.RoomTemplate, input RoomFromTemplateInput) (int, error) {
+	hasPassword := input.RoomPassword != nil && *input.RoomPassword != ""
+	if template.PasswordRequired != hasPassword {
+		if template.PasswordRequired {
+			return 0, fmt.Errorf("%w: roomPassword is required", ErrPasswordPolicy)
+		}
+		return 0, fmt.Errorf("%w: this room does not use a password", ErrPasswordPolicy)
+	}
+
+	room := repositories.RoomCreateInput{
+		RoomName:            template.RoomName,
+		IsPublic:            template.IsPublic,
+		Genre:               template.Genre,
+		Tags:                append([]string{}, template.Tags...),
+		MaxParticipants:     template.MaxParticipants,
+		HostUserID:          userID,
+		HostUserName:        template.HostUserName,
+		PlayingPlaylistName: template.PlayingPlaylistName,
+		Songs:               make(map[string]repositories.Song, len(template.Songs)),
+	}
+	if name := strings.TrimSpace(input.RoomName); name != "" {
+		room.RoomName = name
+	}
+	if input.HostUserName != "" {
+		room.HostUserName = input.HostUserName
+	}
+	if hasPassword {
+		room.RoomPassword = input.RoomPassword
+	}
+	for idx, song := range template.Songs {
+		room.Songs[strconv.Itoa(idx)] = song
+	}
+	if len(template.Songs) > 0 {
+		room.PlayingSongName = template.Songs[0].SongName
+	}
+	return s.roomService.CreateRoom(room)
+}
+
+// songsInOrder は、song_index をキーにした曲一覧を曲順のスライスにします。
+func songsInOrder(songs map[string]repositories.Song) []repositories.Song {
+	indexes := make([]int, 0, len(songs))
+	for key := range songs {
+		idx, err := strconv.Atoi(key)
+		if err != nil {
+			continue
+		}
+		indexes = append(indexes, idx)
+	}
+	sort.Ints(indexes)
+
+	ordered := make([]repositories.Song, 0, len(indexes))
+	for _, idx := range indexes {
+		ordered = append(ordered, songs[strconv.Itoa(idx)])
+	}
+	return ordered
+}
@@ -0,0 +1,183 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"music-share-api/internal/repositories"
+)
+
+// memoryRoomTemplateRepository は、テスト用のインメモリ RoomTemplateRepository です。
+// rooms は GetRoomAsTemplate で読み込むルーム（閉じたものを含む）の設定です。
+type memoryRoomTemplateRepository struct {
+	templates map[int]*repositories.RoomTemplate
+	rooms     map[int]*repositories.RoomTemplate
+}
+
+func newMemoryRoomTemplateRepository() *memoryRoomTemplateRepository {
+	return &memoryRoomTemplateRepository{
+		templates: make(map[int]*repositories.RoomTemplate),
+		rooms:     make(map[int]*repositories.RoomTemplate),
+	}
+}
+
+func (r *memoryRoomTemplateRepository) CreateTemplate(template repositories.RoomTemplate) (int, error) {
+	template.TemplateID = len(r.templates) + 1
+	template.SongCount = len(template.Songs)
+	r.templates[template.TemplateID] = &template
+	return template.TemplateID, nil
+}
+
+func (r *memoryRoomTemplateRepository) ListTemplates(userID int) ([]repositories.RoomTemplate, error) {
+	templates := []repositories.RoomTemplate{}
+	for id := len(r.templates); id >= 1; id-- {
+		if template := r.templates[id]; template != nil && template.UserID == userID {
+			listed := *template
+			listed.Songs = nil
+			templates = append(templates, listed)
+		}
+	}
+	return templates, nil
+}
+
+func (r *memoryRoomTemplateRepository) GetTemplate(templateID int) (*repositories.RoomTemplate, bool, error) {
+	template, ok := r.templates[templateID]
+	if !ok || template == nil {
+		return nil, false, nil
+	}
+	copied := *template
+	return &copied, true, nil
+}
+
+func (r *memoryRoomTemplateRepository) DeleteTemplate(templateID int) error {
+	r.templates[templateID] = nil
+	return nil
+}
+
+func (r *memoryRoomTemplateRepository) GetRoomAsTemplate(roomID int) (*repositories.RoomTemplate, bool, error) {
+	room, ok := r.rooms[roomID]
+	if !ok {
+		return nil, false, nil
+	}
+	copied := *room
+	return &copied, true, nil
+}
+
+func newRoomTemplateFixture(t *testing.T) (*memoryRoomTemplateRepository, *memoryRoomRepository, RoomTemplateService) {
+	t.Helper()
+	_, roomRepository, roomService := newRoomServiceFixture(t)
+	repository := newMemoryRoomTemplateRepository()
+	// ホストが 1 の閉じたルーム（パスワードあり）
+	repository.rooms[10] = &repositories.RoomTemplate{
+		UserID: 1, RoomName: "Weekly Jam", IsPublic: false, PasswordRequired: true, Genre: "rock", Tags: []string{"chill"},
+		MaxParticipants: 8, HostUserName: "host", PlayingPlaylistName: "Jam",
+		Songs: []repositories.Song{
+			{SongId: "t1", SongName: "Blue Sky", Artist: "Band A"},
+			{SongId: "t2", SongName: "Red Sun", Artist: "Band C"},
+		},
+	}
+	return repository, roomRepository, NewRoomTemplateService(repository, roomService)
+}
+
+func strPtr(v string) *string {
+	return &v
+}
+
+func TestRoomTemplateServiceSaveAndCreateFromTemplate(t *testing.T) {
+	_, roomRepository, service := newRoomTemplateFixture(t)
+
+	// 入力した設定から保存する（曲は song_index の順に並べる）
+	template, err := service.SaveTemplate(1, SaveTemplateInput{
+		TemplateName: " Friday ",
+		Room: repositories.RoomCreateInput{
+			RoomName: "Friday Party", IsPublic: true, Genre: "J-POP", MaxParticipants: 20, HostUserName: "host",
+			Songs: map[string]repositories.Song{
+				"1":  {SongId: "t2", SongName: "Red Sun"},
+				"0":  {SongId: "t1", SongName: "Blue Sky"},
+				"10": {SongId: "t3", SongName: "Green Field"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SaveTemplate failed: %v", err)
+	}
+	if template.TemplateName != "Friday" || template.Genre != "j-pop" || template.PasswordRequired || template.UserID != 1 {
+		t.Fatalf("unexpected template: %+v", template)
+	}
+	if len(template.Songs) != 3 || template.Songs[0].SongId != "t1" || template.Songs[2].SongId != "t3" || template.Songs[0].TrackID == "" {
+		t.Fatalf("expected songs in queue order, got %+v", template.Songs)
+	}
+
+	if templates, _ := service.ListTemplates(1); len(templates) != 1 {
+		t.Fatalf("expected one template, got %+v", templates)
+	}
+	if templates, _ := service.ListTemplates(2); len(templates) != 0 {
+		t.Fatalf("expected other users not to see the template, got %+v", templates)
+	}
+
+	roomID, err := service.CreateRoomFromTemplate(1, template.TemplateID, RoomFromTemplateInput{RoomName: "Friday Party #2"})
+	if err != nil {
+		t.Fatalf("CreateRoomFromTemplate failed: %v", err)
+	}
+	room := roomRepository.rooms[roomID]
+	if room.RoomName != "Friday Party #2" || room.HostUserID != 1 || room.Genre != "j-pop" || len(room.Songs) != 3 {
+		t.Fatalf("unexpected room: %+v", room)
+	}
+	if room.Songs["2"].SongId != "t3" || room.PlayingSongName != "Blue Sky" {
+		t.Fatalf("expected the queue to be renumbered from 0, got %+v", room.Songs)
+	}
+
+	if _, err := service.CreateRoomFromTemplate(2, template.TemplateID, RoomFromTemplateInput{}); !errors.Is(err, ErrTemplateNotFound) {
+		t.Fatalf("expected ErrTemplateNotFound for another user's template, got %v", err)
+	}
+	if _, err := service.CreateRoomFromTemplate(1, template.TemplateID, RoomFromTemplateInput{RoomPassword: strPtr("secret")}); !errors.Is(err, ErrPasswordPolicy) {
+		t.Fatalf("expected ErrPasswordPolicy for a template without a password, got %v", err)
+	}
+
+	if err := service.DeleteTemplate(2, template.TemplateID); !errors.Is(err, ErrTemplateNotFound) {
+		t.Fatalf("expected ErrTemplateNotFound, got %v", err)
+	}
+	if err := service.DeleteTemplate(1, template.TemplateID); err != nil {
+		t.Fatalf("DeleteTemplate failed: %v", err)
+	}
+	if _, err := service.CreateRoomFromTemplate(1, template.TemplateID, RoomFromTemplateInput{}); !errors.Is(err, ErrTemplateNotFound) {
+		t.Fatalf("expected ErrTemplateNotFound after delete, got %v", err)
+	}
+}
+
+func TestRoomTemplateServiceSaveFromRoomAndClone(t *testing.T) {
+	_, roomRepository, service := newRoomTemplateFixture(t)
+
+	template, err := service.SaveTemplate(1, SaveTemplateInput{RoomID: 10})
+	if err != nil {
+		t.Fatalf("SaveTemplate failed: %v", err)
+	}
+	if template.TemplateName != "Weekly Jam" || !template.PasswordRequired || len(template.Songs) != 2 || template.Tags[0] != "chill" {
+		t.Fatalf("expected the room's settings to be saved, got %+v", template)
+	}
+	if _, err := service.SaveTemplate(2, SaveTemplateInput{RoomID: 10}); !errors.Is(err, ErrNotRoomHost) {
+		t.Fatalf("expected ErrNotRoomHost, got %v", err)
+	}
+	if _, err := service.SaveTemplate(1, SaveTemplateInput{RoomID: 99}); !errors.Is(err, ErrRoomNotFound) {
+		t.Fatalf("expected ErrRoomNotFound, got %v", err)
+	}
+
+	// パスワードが必要なルームは、複製時に新しいパスワードを指定する
+	if _, err := service.CloneRoom(1, 10, RoomFromTemplateInput{}); !errors.Is(err, ErrPasswordPolicy) {
+		t.Fatalf("expected ErrPasswordPolicy, got %v", err)
+	}
+	if _, err := service.CloneRoom(2, 10, RoomFromTemplateInput{RoomPassword: strPtr("secret")}); !errors.Is(err, ErrNotRoomHost) {
+		t.Fatalf("expected ErrNotRoomHost, got %v", err)
+	}
+	roomID, err := service.CloneRoom(1, 10, RoomFromTemplateInput{RoomPassword: strPtr("secret"), HostUserName: "renamed"})
+	if err != nil {
+		t.Fatalf("CloneRoom failed: %v", err)
+	}
+	room := roomRepository.rooms[roomID]
+	if room.RoomName != "Weekly Jam" || room.Genre != "rock" || len(room.Tags) != 1 || room.PlayingPlaylistName != "Jam" {
+		t.Fatalf("unexpected clone: %+v", room)
+	}
+	if len(room.Songs) != 2 || room.Songs["0"].SongId != "t1" || room.Songs["1"].TrackID == "" {
+		t.Fatalf("expected the queue to be cloned, got %+v", room.Songs)
+	}
+}
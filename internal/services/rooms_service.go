@@ -1,23 +1,152 @@
 package services
 
 import (
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "strings"
+
     "music-share-api/internal/repositories"
 )
 
+// 公開ルーム一覧の1ページあたりの件数
+const (
+    defaultPublicRoomsLimit = 20
+    maxPublicRoomsLimit     = 100
+)
+
+// ErrInvalidRoomsQuery は、公開ルーム一覧の検索条件が不正な場合に返されます。
+var ErrInvalidRoomsQuery = errors.New("invalid rooms query")
+
+// PublicRoomsInput は、公開ルーム一覧の検索条件です。
+type PublicRoomsInput struct {
+    Keyword      string
+    Genre        string
+    Tags         []string
+    HasFreeSlots bool
+    // Sort は "participants"・"created"・"activity" のいずれか（省略時は "created"）
+    Sort string
+    // Cursor は前のページの nextCursor（省略時は先頭から）
+    Cursor string
+    Limit  int
+}
+
+// PublicRoomsPage は、公開ルーム一覧の1ページ分です。NextCursor が空なら最後のページです。
+type PublicRoomsPage struct {
+    Rooms      []repositories.Room
+    NextCursor string
+}
+
 type RoomsService interface {
-    GetPublicRooms() ([]repositories.Room, error)
+    GetPublicRooms(input PublicRoomsInput) (*PublicRoomsPage, error)
 }
 
 type roomsService struct {
     roomsRepository repositories.RoomsRepository
+    genreService    GenreService
 }
 
-func NewRoomsService(roomsRepository repositories.RoomsRepository) RoomsService {
+func NewRoomsService(roomsRepository repositories.RoomsRepository, genreService GenreService) RoomsService {
     return &roomsService{
         roomsRepository: roomsRepository,
+        genreService:    genreService,
     }
 }
 
-func (s *roomsService) GetPublicRooms() ([]repositories.Room, error) {
-    return s.roomsRepository.GetPublicRooms()
-}
\ No newline at end of file
+// publicRoomsCursor は、カーソルの中身です。並び順を変えて前のカーソルを使えないよう、並び順も含める。
+type publicRoomsCursor struct {
+    Sort string `json:"s"`
+    repositories.PublicRoomsCursor
+}
+
+func (s *roomsService) GetPublicRooms(input PublicRoomsInput) (*PublicRoomsPage, error) {
+    query := repositories.PublicRoomsQuery{
+        Keyword:      strings.TrimSpace(input.Keyword),
+        HasFreeSlots: input.HasFreeSlots,
+        Sort:         input.Sort,
+        Limit:        input.Limit,
+    }
+    genre, err := s.genreService.NormalizeGenre(input.Genre)
+    if err != nil {
+        if errors.Is(err, ErrInvalidGenre) {
+            return nil, fmt.Errorf("%w: %v", ErrInvalidRoomsQuery, err)
+        }
+        return nil, err
+    }
+    query.Genre = genre
+    if query.Tags, err = s.genreService.NormalizeTags(input.Tags); err != nil {
+        return nil, fmt.Errorf("%w: %v", ErrInvalidRoomsQuery, err)
+    }
+
+    switch query.Sort {
+    case "":
+        query.Sort = repositories.PublicRoomsSortCreated
+    case repositories.PublicRoomsSortParticipants, repositories.PublicRoomsSortCreated, repositories.PublicRoomsSortActivity:
+    default:
+        return nil, fmt.Errorf("%w: unsupported sort %q", ErrInvalidRoomsQuery, input.Sort)
+    }
+    if query.Limit == 0 {
+        query.Limit = defaultPublicRoomsLimit
+    }
+    if query.Limit < 1 || query.Limit > maxPublicRoomsLimit {
+        return nil, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidRoomsQuery, maxPublicRoomsLimit)
+    }
+    if input.Cursor != "" {
+        cursor, err := decodePublicRoomsCursor(input.Cursor)
+        if err != nil || cursor.Sort != query.Sort {
+            return nil, fmt.Errorf("%w: invalid cursor", ErrInvalidRoomsQuery)
+        }
+        query.After = &cursor.PublicRoomsCursor
+    }
+
+    // 次のページがあるかを判定するため、1件多く取得する
+    limit := query.Limit
+    query.Limit++
+    rooms, err := s.roomsRepository.GetPublicRooms(query)
+    if err != nil {
+        return nil, err
+    }
+
+    page := &PublicRoomsPage{Rooms: rooms}
+    if len(rooms) > limit {
+        page.Rooms = rooms[:limit]
+        last := page.Rooms[limit-1]
+        cursor := publicRoomsCursor{Sort: query.Sort, PublicRoomsCursor: repositories.PublicRoomsCursor{RoomID: last.RoomID}}
+        switch query.Sort {
+        case repositories.PublicRoomsSortParticipants:
+            cursor.Participants = last.NowParticipants
+        case repositories.PublicRoomsSortActivity:
+            cursor.Time = last.UpdateAt
+        default:
+            cursor.Time = last.CreateAt
+        }
+        if page.NextCursor, err = encodePublicRoomsCursor(cursor); err != nil {
+            return nil, err
+        }
+    }
+    return page, nil
+}
+
+func encodePublicRoomsCursor(cursor publicRoomsCursor) (string, error) {
+    data, err := json.Marshal(cursor)
+    if err != nil {
+        return "", fmt.Errorf("failed to encode cursor: %w", err)
+    }
+    return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodePublicRoomsCursor(encoded string) (publicRoomsCursor, error) {
+    var cursor publicRoomsCursor
+    data, err := base64.RawURLEncoding.DecodeString(encoded)
+    if err != nil {
+        return cursor, err
+    }
+    if err := json.Unmarshal(data, &cursor); err != nil {
+        return cursor, err
+    }
+    if cursor.RoomID <= 0 {
+        return cursor, errors.New("cursor has no room id")
+    }
+    return cursor, nil
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"music-share-api/internal/repositories"
+)
+
+// memoryRoomsRepository は、テスト用のインメモリ RoomsRepository です（並び順・カーソル・件数のみ扱う）。
+type memoryRoomsRepository struct {
+	rooms   []repositories.Room
+	queries []repositories.PublicRoomsQuery
+}
+
+func (r *memoryRoomsRepository) GetPublicRooms(q repositories.PublicRoomsQuery) ([]repositories.Room, error) {
+	r.queries = append(r.queries, q)
+	key := func(room repositories.Room) int64 {
+		switch q.Sort {
+		case repositories.PublicRoomsSortParticipants:
+			return int64(room.NowParticipants)
+		case repositories.PublicRoomsSortActivity:
+			return room.UpdateAt.UnixNano()
+		default:
+			return room.CreateAt.UnixNano()
+		}
+	}
+	rooms := append([]repositories.Room(nil), r.rooms...)
+	sort.Slice(rooms, func(i, j int) bool {
+		if key(rooms[i]) != key(rooms[j]) {
+			return key(rooms[i]) > key(rooms[j])
+		}
+		return rooms[i].RoomID > rooms[j].RoomID
+	})
+	result := []repositories.Room{}
+	for _, room := range rooms {
+		if q.After != nil {
+			after := q.After.Time.UnixNano()
+			if q.Sort == repositories.PublicRoomsSortParticipants {
+				after = int64(q.After.Participants)
+			}
+			if key(room) > after || (key(room) == after && room.RoomID >= q.After.RoomID) {
+				continue
+			}
+		}
+		if len(result) == q.Limit {
+			break
+		}
+		result = append(result, room)
+	}
+	return result, nil
+}
+
+func TestRoomsServicePaginatesPublicRooms(t *testing.T) {
+	base := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	repository := &memoryRoomsRepository{}
+	// 参加者数が同じルームを含めて、ページの境界で重複・欠落しないことを確かめる
+	for i, participants := range []int{3, 5, 3, 3, 1} {
+		repository.rooms = append(repository.rooms, repositories.Room{
+			RoomID:          i + 1,
+			NowParticipants: participants,
+			CreateAt:        base.Add(time.Duration(i) * time.Hour),
+			UpdateAt:        base,
+		})
+	}
+	service := NewRoomsService(repository, newTestGenreService())
+
+	var got []int
+	cursor := ""
+	for pages := 0; pages < 10; pages++ {
+		page, err := service.GetPublicRooms(PublicRoomsInput{Sort: "participants", Limit: 2, Cursor: cursor})
+		if err != nil {
+			t.Fatalf("GetPublicRooms: %v", err)
+		}
+		for _, room := range page.Rooms {
+			got = append(got, room.RoomID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	want := []int{2, 4, 3, 1, 5}
+	if len(got) != len(want) {
+		t.Fatalf("rooms = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("rooms = %v, want %v", got, want)
+		}
+	}
+
+	// 既定は作成日時の新しい順
+	page, err := service.GetPublicRooms(PublicRoomsInput{Keyword: "  jazz ", Genre: "Jpop", Tags: []string{"Chill"}, HasFreeSlots: true})
+	if err != nil {
+		t.Fatalf("GetPublicRooms: %v", err)
+	}
+	if len(page.Rooms) != 5 || page.Rooms[0].RoomID != 5 || page.NextCursor != "" {
+		t.Fatalf("unexpected page: %+v", page)
+	}
+	last := repository.queries[len(repository.queries)-1]
+	if last.Keyword != "jazz" || last.Genre != "j-pop" || len(last.Tags) != 1 || last.Tags[0] != "chill" || !last.HasFreeSlots || last.Sort != repositories.PublicRoomsSortCreated || last.Limit != defaultPublicRoomsLimit+1 {
+		t.Fatalf("unexpected query: %+v", last)
+	}
+}
+
+func TestRoomsServiceRejectsInvalidQuery(t *testing.T) {
+	repository := &memoryRoomsRepository{}
+	for i := 1; i <= 3; i++ {
+		repository.rooms = append(repository.rooms, repositories.Room{RoomID: i})
+	}
+	service := NewRoomsService(repository, newTestGenreService())
+
+	page, err := service.GetPublicRooms(PublicRoomsInput{Limit: 1})
+	if err != nil {
+		t.Fatalf("GetPublicRooms: %v", err)
+	}
+
+	for name, input := range map[string]PublicRoomsInput{
+		"unknown sort":   {Sort: "popular"},
+		"unknown genre":  {Genre: "city pop"},
+		"invalid tag":    {Tags: []string{"a;b"}},
+		"limit too big":  {Limit: maxPublicRoomsLimit + 1},
+		"broken cursor":  {Cursor: "not-a-cursor"},
+		"other sort key": {Sort: "activity", Cursor: page.NextCursor},
+	} {
+		if _, err := service.GetPublicRooms(input); !errors.Is(err, ErrInvalidRoomsQuery) {
+			t.Errorf("%s: err = %v, want ErrInvalidRoomsQuery", name, err)
+		}
+	}
+}
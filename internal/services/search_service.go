@@ -0,0 +1,112 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"music-share-api/internal/repositories"
+	"music-share-api/internal/utils"
+)
+
+type SearchService interface {
+	// SearchTracks は、ユーザーのトークンで曲を検索し、Song 形式の結果とキャッシュから返したかどうかを返します。
+	SearchTracks(userID int, query string, limit int) ([]repositories.Song, bool, error)
+}
+
+// ErrEmptySearchQuery は、検索キーワードが空の場合に返されます。
+var ErrEmptySearchQuery = errors.New("search query is empty")
+
+type searchService struct {
+	searchRepository repositories.SearchRepository
+	musicService     MusicService
+	// cacheTTL はキャッシュの有効期間、popularityWindow と minHits は「よく検索されるクエリ」の判定条件
+	cacheTTL         time.Duration
+	popularityWindow time.Duration
+	minHits          int64
+	// marketTTL は、ユーザーの国（検索の market）をキャッシュする期間
+	marketTTL time.Duration
+}
+
+func NewSearchService(searchRepository repositories.SearchRepository, musicService MusicService) SearchService {
+	return &searchService{
+		searchRepository: searchRepository,
+		musicService:     musicService,
+		cacheTTL:         utils.GetEnvDuration("SEARCH_CACHE_TTL", 10*time.Minute),
+		popularityWindow: utils.GetEnvDuration("SEARCH_POPULARITY_WINDOW", 10*time.Minute),
+		minHits:          int64(utils.GetEnvInt("SEARCH_CACHE_MIN_HITS", 2)),
+		marketTTL:        utils.GetEnvDuration("SEARCH_MARKET_TTL", 24*time.Hour),
+	}
+}
+
+// SearchTracks は、popularityWindow 内に minHits 回以上検索されたクエリの結果を Redis にキャッシュします。
+// 一度しか検索されないクエリでキャッシュを埋めないようにするため、最初の検索はキャッシュしない。
+// 聴ける曲は国ごとに異なるため、検索はユーザーの国を market に指定し、キャッシュも国ごとに分ける。
+func (s *searchService) SearchTracks(userID int, query string, limit int) ([]repositories.Song, bool, error) {
+	normalizedQuery := normalizeSearchQuery(query)
+	if normalizedQuery == "" {
+		return nil, false, ErrEmptySearchQuery
+	}
+	market, err := s.market(userID)
+	if err != nil {
+		return nil, false, err
+	}
+	cacheKey := fmt.Sprintf("%s:%s:%d:%s", spotifyProviderName, market, limit, normalizedQuery)
+
+	// キャッシュの読み書きに失敗しても検索自体は続行する
+	songs, found, err := s.searchRepository.GetCachedSearch(cacheKey)
+	if err != nil {
+		log.Printf("Failed to read search cache: %v", err)
+	}
+	if found {
+		return songs, true, nil
+	}
+
+	tracks, err := s.musicService.SearchTracks(spotifyProviderName, userID, normalizedQuery, market, limit)
+	if err != nil {
+		return nil, false, err
+	}
+	songs = make([]repositories.Song, 0, len(tracks))
+	for _, track := range tracks {
+		songs = append(songs, songFromTrack(track))
+	}
+
+	hits, err := s.searchRepository.IncrementSearchCount(cacheKey, s.popularityWindow)
+	if err != nil {
+		log.Printf("Failed to count search query: %v", err)
+		return songs, false, nil
+	}
+	if hits >= s.minHits {
+		if err := s.searchRepository.SetCachedSearch(cacheKey, songs, s.cacheTTL); err != nil {
+			log.Printf("Failed to write search cache: %v", err)
+		}
+	}
+	return songs, false, nil
+}
+
+// market は、ユーザーの国を返します。/me への問い合わせを検索ごとに行わないよう、marketTTL の間キャッシュする。
+func (s *searchService) market(userID int) (string, error) {
+	market, found, err := s.searchRepository.GetCachedMarket(spotifyProviderName, userID)
+	if err != nil {
+		log.Printf("Failed to read search market: %v", err)
+	}
+	if found {
+		return market, nil
+	}
+
+	market, err = s.musicService.Market(spotifyProviderName, userID)
+	if err != nil {
+		return "", err
+	}
+	if err := s.searchRepository.SetCachedMarket(spotifyProviderName, userID, market, s.marketTTL); err != nil {
+		log.Printf("Failed to write search market: %v", err)
+	}
+	return market, nil
+}
+
+// normalizeSearchQuery は、大文字小文字と空白の違いで別のキャッシュにならないようクエリを正規化します。
+func normalizeSearchQuery(query string) string {
+	return strings.ToLower(strings.Join(strings.Fields(query), " "))
+}
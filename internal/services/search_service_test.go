@@ -0,0 +1,133 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"music-share-api/internal/providers/spotifytest"
+	"music-share-api/internal/repositories"
+)
+
+// memorySearchRepository は、テスト用のインメモリ SearchRepository です（有効期限は扱わない）。
+type memorySearchRepository struct {
+	results map[string][]repositories.Song
+	counts  map[string]int64
+	markets map[string]string
+}
+
+func newMemorySearchRepository() *memorySearchRepository {
+	return &memorySearchRepository{
+		results: make(map[string][]repositories.Song),
+		counts:  make(map[string]int64),
+		markets: make(map[string]string),
+	}
+}
+
+func (r *memorySearchRepository) GetCachedSearch(cacheKey string) ([]repositories.Song, bool, error) {
+	songs, ok := r.results[cacheKey]
+	return songs, ok, nil
+}
+
+func (r *memorySearchRepository) SetCachedSearch(cacheKey string, songs []repositories.Song, ttl time.Duration) error {
+	r.results[cacheKey] = songs
+	return nil
+}
+
+func (r *memorySearchRepository) IncrementSearchCount(cacheKey string, window time.Duration) (int64, error) {
+	r.counts[cacheKey]++
+	return r.counts[cacheKey], nil
+}
+
+func (r *memorySearchRepository) GetCachedMarket(provider string, userID int) (string, bool, error) {
+	market, ok := r.markets[fmt.Sprintf("%s:%d", provider, userID)]
+	return market, ok, nil
+}
+
+func (r *memorySearchRepository) SetCachedMarket(provider string, userID int, market string, ttl time.Duration) error {
+	r.markets[fmt.Sprintf("%s:%d", provider, userID)] = market
+	return nil
+}
+
+func TestSearchServiceCachesPopularQueries(t *testing.T) {
+	f := newMusicServiceFixture(t)
+	f.fake.AddUser(spotifytest.User{ID: "sp-alice"})
+	f.fake.AddTrack(spotifytest.Track{ID: "t1", Name: "Blue Sky", Artists: []string{"Band A"}, DurationMs: 201000})
+	if err := f.connect(t, 1, "sp-alice"); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	service := NewSearchService(newMemorySearchRepository(), f.service)
+	profileRequests := f.fake.RequestCount("/v1/me")
+
+	// 1回目・2回目はプロバイダーに問い合わせ、2回目で人気クエリとしてキャッシュされる
+	for i, query := range []string{"Blue Sky", "  blue   SKY "} {
+		songs, cached, err := service.SearchTracks(1, query, 10)
+		if err != nil {
+			t.Fatalf("SearchTracks #%d: %v", i+1, err)
+		}
+		if cached {
+			t.Fatalf("SearchTracks #%d was served from cache", i+1)
+		}
+		if len(songs) != 1 || songs[0].SongId != "t1" || songs[0].SongLength != 201000 {
+			t.Fatalf("unexpected songs: %+v", songs)
+		}
+	}
+
+	songs, cached, err := service.SearchTracks(1, "blue sky", 10)
+	if err != nil {
+		t.Fatalf("SearchTracks: %v", err)
+	}
+	if !cached || len(songs) != 1 {
+		t.Fatalf("popular query was not served from cache: cached=%v songs=%+v", cached, songs)
+	}
+	if got := f.fake.RequestCount("/v1/search"); got != 2 {
+		t.Fatalf("provider search requests = %d, want 2", got)
+	}
+	// 国は最初の検索で一度だけ問い合わせる
+	if got := f.fake.RequestCount("/v1/me") - profileRequests; got != 1 {
+		t.Fatalf("profile requests = %d, want 1", got)
+	}
+}
+
+func TestSearchServiceSeparatesCacheByMarket(t *testing.T) {
+	f := newMusicServiceFixture(t)
+	f.fake.AddUser(spotifytest.User{ID: "sp-alice", Country: "JP"})
+	f.fake.AddUser(spotifytest.User{ID: "sp-bob", Country: "US"})
+	f.fake.AddTrack(spotifytest.Track{ID: "t1", Name: "Blue Sky", Artists: []string{"Band A"}, Markets: []string{"JP"}})
+	f.fake.AddTrack(spotifytest.Track{ID: "t2", Name: "Blue Sky", Artists: []string{"Band B"}, Markets: []string{"US"}})
+	for userID, spotifyUserID := range map[int]string{1: "sp-alice", 2: "sp-bob"} {
+		if err := f.connect(t, userID, spotifyUserID); err != nil {
+			t.Fatalf("Connect: %v", err)
+		}
+	}
+	service := NewSearchService(newMemorySearchRepository(), f.service)
+
+	// JP のユーザーの検索を人気クエリとしてキャッシュしても、US のユーザーには US の結果を返す
+	for i := 0; i < 3; i++ {
+		if _, _, err := service.SearchTracks(1, "blue sky", 10); err != nil {
+			t.Fatalf("SearchTracks: %v", err)
+		}
+	}
+	for userID, want := range map[int]string{1: "t1", 2: "t2"} {
+		songs, _, err := service.SearchTracks(userID, "blue sky", 10)
+		if err != nil {
+			t.Fatalf("SearchTracks: %v", err)
+		}
+		if len(songs) != 1 || songs[0].SongId != want {
+			t.Fatalf("user %d: songs = %+v, want %s", userID, songs, want)
+		}
+	}
+}
+
+func TestSearchServiceErrors(t *testing.T) {
+	f := newMusicServiceFixture(t)
+	service := NewSearchService(newMemorySearchRepository(), f.service)
+
+	if _, _, err := service.SearchTracks(1, "   ", 10); !errors.Is(err, ErrEmptySearchQuery) {
+		t.Fatalf("err = %v, want ErrEmptySearchQuery", err)
+	}
+	if _, _, err := service.SearchTracks(1, "blue", 10); !errors.Is(err, ErrServiceNotConnected) {
+		t.Fatalf("err = %v, want ErrServiceNotConnected", err)
+	}
+}
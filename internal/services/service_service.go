@@ -1,127 +1,208 @@
 package services
 
 import (
-	"bytes"
-	"encoding/base64"
-	"encoding/json"
+	"database/sql"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"log"
-	"net/http"
-	"os"
 	"time"
 
+	"music-share-api/internal/providers"
 	"music-share-api/internal/repositories"
+	"music-share-api/internal/utils"
 )
 
-type SpotifyService interface {
-	ConnectSpotify(userID int, code string) error
-	DeleteSpotify(userID int) error
-	RefreshSpotifyToken(userID int) (string, time.Time, error)
-}
+// OAuth フローの用途。state に保存し、コールバック側で用途の取り違えを防ぐ。
+const (
+	OAuthPurposeConnect = "connect"
+	OAuthPurposeLogin   = "login"
+)
 
-type spotifyService struct {
-	repo repositories.ServiceRepository
+// MusicService は、音楽配信サービス（プロバイダー）との連携を管理します。
+// provider には providers.MusicProvider.Name() の値（例: "spotify"）を指定します。
+type MusicService interface {
+	// ProviderNames は、利用可能なプロバイダー名を返します。
+	ProviderNames() []string
+	// BuildAuthorizeURL は、state と PKCE verifier をサーバー側に保存し、プロバイダーの認可URLを返します。
+	BuildAuthorizeURL(provider string, userID int, purpose, redirectURI string) (string, error)
+	// ConsumeState は、state を検証・消費し、保存されていた情報を返します。
+	ConsumeState(state, purpose string) (*repositories.OAuthState, error)
+	Connect(provider string, userID int, code, state string) error
+	ExchangeCode(provider, code, redirectURI, codeVerifier string) (*providers.Token, *providers.Profile, error)
+	SaveConnection(provider string, userID int, token *providers.Token, profile *providers.Profile) error
+	FindUserByServiceUserID(provider, serviceUserID string) (int, bool, error)
+	Disconnect(provider string, userID int) error
+	// RefreshToken は、トークンを更新して新しい有効期限を返します（トークン自体は返さない）。
+	RefreshToken(provider string, userID int) (time.Time, error)
+	// RefreshTokenIfExpiring は、有効期限が within 以内の場合のみ更新し、更新したかどうかを返します。
+	RefreshTokenIfExpiring(provider string, userID int, within time.Duration) (bool, error)
+	// ConnectionStatuses は、連携情報からプロバイダーごとの連携状態を導出します。
+	ConnectionStatuses(userServices map[string]repositories.UserServiceData) map[string]ConnectionStatus
+	// AccessToken は、サーバー側で保持しているユーザーのアクセストークンを返します（期限が近ければ更新してから返す）。
+	AccessToken(provider string, userID int) (string, error)
+	// GetPlaylist は、ユーザーのトークンでプレイリストを全曲取得します。
+	GetPlaylist(provider string, userID int, playlistID string) (*providers.Playlist, error)
+	// SearchTracks は、ユーザーのトークンで market（空ならユーザーの国）で聴ける曲を検索します。
+	SearchTracks(provider string, userID int, query, market string, limit int) ([]providers.Track, error)
+	// Market は、ユーザーの連携アカウントの国（検索の market）を返します。
+	Market(provider string, userID int) (string, error)
+	// FindTracksByISRC は、ユーザーのトークンで ISRC が一致する曲を探します。
+	FindTracksByISRC(provider string, userID int, isrc string) ([]providers.Track, error)
+	// CreatePlaylist は、ユーザーの連携アカウントにプレイリストを作成します。
+	CreatePlaylist(provider string, userID int, name, description string, public bool, trackIDs []string) (*providers.Playlist, error)
+	// ControlPlayback は、ユーザーのアクティブなデバイスで再生操作を行います。
+	ControlPlayback(provider string, userID int, command providers.PlaybackCommand) error
 }
 
-func NewSpotifyService(repo repositories.ServiceRepository) SpotifyService {
-	return &spotifyService{repo: repo}
+// ConnectionStatus は、プロバイダーごとの連携状態です。
+type ConnectionStatus struct {
+	Connected bool `json:"connected"`
+	// Broken は、リフレッシュトークンが失効しており再連携が必要なことを表します。
+	Broken bool `json:"broken"`
+	// ReauthorizeRequired は、許可されたスコープが足りず、再連携が必要なことを表します。
+	ReauthorizeRequired bool `json:"reauthorizeRequired"`
 }
 
-// SpotifyTokenResponse はSpotifyのトークンレスポンスを表します。
-type SpotifyTokenResponse struct {
-	AccessToken  string `json:"access_token"`
-	TokenType    string `json:"token_type"`
-	RefreshToken string `json:"refresh_token"`
-	ExpiresIn    int    `json:"expires_in"`
+var (
+	// ErrConnectionBroken は、リフレッシュトークンが失効しており再連携が必要な場合に返されます。
+	ErrConnectionBroken = errors.New("service connection is broken; please reconnect")
+	// ErrRefreshInProgress は、同じユーザーのトークン更新が別のリクエストで実行中の場合に返されます。
+	ErrRefreshInProgress = errors.New("token refresh is already in progress")
+	// ErrServiceNotConnected は、ユーザーがプロバイダーと連携していない（または要再連携の）場合に返されます。
+	ErrServiceNotConnected = errors.New("service is not connected")
+)
+
+// accessTokenRefreshMargin は、AccessToken が事前に更新する残り有効期間です。
+const accessTokenRefreshMargin = time.Minute
+
+type musicService struct {
+	repo     repositories.ServiceRepository
+	registry *providers.Registry
+	keyring  *utils.TokenKeyring
+	// refreshRetryBase・refreshRetryMax は、更新に失敗した連携を定期更新で再試行するまでの間隔（失敗ごとに倍にする）
+	refreshRetryBase time.Duration
+	refreshRetryMax  time.Duration
 }
 
-// SpotifyUserProfile はSpotifyのユーザー情報レスポンスを表します。
-// ここで display_name を追加して、アカウント名を取得します。
-type SpotifyUserProfile struct {
-	ID          string `json:"id"`
-	DisplayName string `json:"display_name"`
-	// 必要に応じて追加フィールドを定義可能
+func NewMusicService(repo repositories.ServiceRepository, registry *providers.Registry, keyring *utils.TokenKeyring) MusicService {
+	return &musicService{
+		repo:             repo,
+		registry:         registry,
+		keyring:          keyring,
+		refreshRetryBase: utils.GetEnvDuration("TOKEN_REFRESH_RETRY_BASE", time.Minute),
+		refreshRetryMax:  utils.GetEnvDuration("TOKEN_REFRESH_RETRY_MAX", time.Hour),
+	}
 }
 
-// encodeToken は、トークンのエンコード（例: Base64エンコード）を実施するヘルパー関数です。
-func encodeToken(token string) string {
-	return base64.StdEncoding.EncodeToString([]byte(token))
+func (s *musicService) ProviderNames() []string {
+	return s.registry.Names()
 }
 
-// ConnectSpotify は、Spotifyの認証コード(code)を使用して
-// 外部APIを呼び出し、アクセストークン、リフレッシュトークン、有効期限、
-// SpotifyユーザーIDおよびアカウント名を取得しDBへ保存します。
-func (s *spotifyService) ConnectSpotify(userID int, code string) error {
-	if code == "" {
-		return errors.New("code is empty")
+// BuildAuthorizeURL は、CSRF 対策の state と PKCE の code_verifier を生成して Redis に保存し、
+// code_challenge 付きの認可URLを返します。
+func (s *musicService) BuildAuthorizeURL(provider string, userID int, purpose, redirectURI string) (string, error) {
+	musicProvider, err := s.registry.Get(provider)
+	if err != nil {
+		return "", err
 	}
-
-	// 必要な環境変数の取得
-	clientID := os.Getenv("SPOTIFY_CLIENT_ID")
-	clientSecret := os.Getenv("SPOTIFY_CLIENT_SECRET")
-	redirectURI := os.Getenv("SPOTIFY_REDIRECT_URI")
-	if clientID == "" || clientSecret == "" || redirectURI == "" {
-		return errors.New("missing spotify credentials")
+	if redirectURI == "" {
+		return "", errors.New("missing redirect uri")
 	}
 
-	// Spotifyのトークンエンドポイント
-	tokenURL := "https://accounts.spotify.com/api/token"
-	formData := fmt.Sprintf("grant_type=authorization_code&code=%s&redirect_uri=%s", code, redirectURI)
-	req, err := http.NewRequest("POST", tokenURL, bytes.NewBufferString(formData))
+	state, err := utils.GenerateRandomToken(32)
 	if err != nil {
-		return fmt.Errorf("failed to create token request: %w", err)
+		return "", err
 	}
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	// Basic認証ヘッダーの設定
-	authStr := fmt.Sprintf("%s:%s", clientID, clientSecret)
-	encodedAuth := base64.StdEncoding.EncodeToString([]byte(authStr))
-	req.Header.Set("Authorization", "Basic "+encodedAuth)
-
-	// codeからアクセストークン、リフレッシュトークンを取得
-	httpClient := &http.Client{Timeout: 10 * time.Second}
-	resp, err := httpClient.Do(req)
+	verifier, err := utils.GeneratePKCEVerifier()
 	if err != nil {
-		return fmt.Errorf("failed to execute token request: %w", err)
+		return "", err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := ioutil.ReadAll(resp.Body)
-		return fmt.Errorf("token request failed, status %d: %s", resp.StatusCode, string(body))
+	stateData := repositories.OAuthState{
+		Provider:     provider,
+		UserID:       userID,
+		Purpose:      purpose,
+		CodeVerifier: verifier,
+		RedirectURI:  redirectURI,
+	}
+	if err := s.repo.SaveOAuthState(state, stateData, utils.GetEnvDuration("OAUTH_STATE_TTL", 10*time.Minute)); err != nil {
+		return "", err
 	}
 
-	var tokenResp SpotifyTokenResponse
-	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
-		return fmt.Errorf("failed to decode token response: %w", err)
+	return musicProvider.AuthorizeURL(state, utils.PKCEChallenge(verifier), redirectURI), nil
+}
+
+// ConsumeState は、state が存在し用途が一致する場合のみ保存内容を返します。
+func (s *musicService) ConsumeState(state, purpose string) (*repositories.OAuthState, error) {
+	if state == "" {
+		return nil, errors.New("state is empty")
+	}
+	stateData, err := s.repo.ConsumeOAuthState(state)
+	if err != nil {
+		return nil, err
 	}
+	if stateData.Purpose != purpose {
+		return nil, errors.New("state purpose mismatch")
+	}
+	return stateData, nil
+}
 
-	// Spotifyユーザー情報取得 (/v1/me)
-	userURL := "https://api.spotify.com/v1/me"
-	reqUser, err := http.NewRequest("GET", userURL, nil)
+// Connect は、認証コード(code)を使用してプロバイダーのAPIを呼び出し、
+// アクセストークン、リフレッシュトークン、有効期限、サービス側のユーザーIDおよびアカウント名を取得しDBへ保存します。
+// state は BuildAuthorizeURL で同じユーザー・同じプロバイダーに発行されたものでなければなりません。
+func (s *musicService) Connect(provider string, userID int, code, state string) error {
+	stateData, err := s.ConsumeState(state, OAuthPurposeConnect)
 	if err != nil {
-		return fmt.Errorf("failed to create spotify user request: %w", err)
+		return err
+	}
+	if stateData.UserID != userID {
+		return errors.New("state was issued for another user")
+	}
+	if stateData.Provider != provider {
+		return errors.New("state was issued for another provider")
 	}
-	reqUser.Header.Set("Authorization", "Bearer "+tokenResp.AccessToken)
 
-	// アクセストークンからspotifyユーザー情報を取得
-	userResp, err := httpClient.Do(reqUser)
+	token, profile, err := s.ExchangeCode(provider, code, stateData.RedirectURI, stateData.CodeVerifier)
 	if err != nil {
-		return fmt.Errorf("failed to execute spotify user request: %w", err)
+		return err
 	}
-	defer userResp.Body.Close()
 
-	if userResp.StatusCode != http.StatusOK {
-		body, _ := ioutil.ReadAll(userResp.Body)
-		return fmt.Errorf("spotify user request failed, status %d: %s", userResp.StatusCode, string(body))
+	// 既に別のユーザーに連携されているアカウントは連携できない
+	ownerID, found, err := s.FindUserByServiceUserID(provider, profile.ID)
+	if err != nil {
+		return err
+	}
+	if found && ownerID != userID {
+		return fmt.Errorf("this %s account is already linked to another user", provider)
 	}
 
-	var userProfile SpotifyUserProfile
-	if err := json.NewDecoder(userResp.Body).Decode(&userProfile); err != nil {
-		return fmt.Errorf("failed to decode spotify user response: %w", err)
+	return s.SaveConnection(provider, userID, token, profile)
+}
+
+// ExchangeCode は、認証コードを PKCE の code_verifier とともにトークンに交換し、ユーザー情報と合わせて返します。
+func (s *musicService) ExchangeCode(provider, code, redirectURI, codeVerifier string) (*providers.Token, *providers.Profile, error) {
+	if code == "" {
+		return nil, nil, errors.New("code is empty")
+	}
+	musicProvider, err := s.registry.Get(provider)
+	if err != nil {
+		return nil, nil, err
 	}
 
+	token, err := musicProvider.ExchangeCode(code, redirectURI, codeVerifier)
+	if err != nil {
+		return nil, nil, err
+	}
+	profile, err := musicProvider.GetProfile(token.AccessToken)
+	if err != nil {
+		return nil, nil, err
+	}
+	return token, profile, nil
+}
+
+// SaveConnection は、取得したトークンとユーザー情報をユーザーの連携情報としてDBへ保存します。
+// 既に連携済みの場合は置き換え、要再連携の状態も解除します。
+func (s *musicService) SaveConnection(provider string, userID int, token *providers.Token, profile *providers.Profile) error {
 	// JSTのタイムゾーンを取得
 	loc, err := time.LoadLocation("Asia/Tokyo")
 	if err != nil {
@@ -129,109 +210,299 @@ func (s *spotifyService) ConnectSpotify(userID int, code string) error {
 	}
 	// 有効期限を日本時刻で計算
 	currentTime := time.Now().In(loc)
-	expiresAt := currentTime.Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
+	expiresAt := currentTime.Add(time.Duration(token.ExpiresIn) * time.Second)
 
-	// 暗号化処理が必要な場合はここで実施（今回はそのまま）
-	encryptedAccessToken := encodeToken(tokenResp.AccessToken)
-	encryptedRefreshToken := encodeToken(tokenResp.RefreshToken)
+	// トークンは暗号化してから保存する
+	encryptedAccessToken, err := s.keyring.Encrypt(token.AccessToken)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt access token: %w", err)
+	}
+	encryptedRefreshToken, err := s.keyring.Encrypt(token.RefreshToken)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt refresh token: %w", err)
+	}
 
-	// DBへ保存
-	// InsertUserService の第4引数として Spotify のアカウント名 (DisplayName) を渡す
-	if err := s.repo.InsertUserService(userID, "spotify", userProfile.ID, userProfile.DisplayName, encryptedAccessToken, encryptedRefreshToken, expiresAt); err != nil {
-		return fmt.Errorf("failed to insert spotify service data: %w", err)
+	// DBへ保存（別のアカウントで再連携した場合は既存の連携を置き換える）
+	// InsertUserService の第4引数としてサービス側のアカウント名 (DisplayName) を渡す
+	if err := s.repo.InsertUserService(userID, provider, profile.ID, profile.DisplayName, encryptedAccessToken, encryptedRefreshToken, expiresAt); err != nil {
+		return fmt.Errorf("failed to insert %s service data: %w", provider, err)
 	}
 
 	return nil
 }
 
+// FindUserByServiceUserID は、サービス側のアカウントが連携されているユーザーIDを返します。
+func (s *musicService) FindUserByServiceUserID(provider, serviceUserID string) (int, bool, error) {
+	userID, err := s.repo.GetUserIDByServiceUserID(provider, serviceUserID)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to find %s owner: %w", provider, err)
+	}
+	return userID, true, nil
+}
 
-// DeleteSpotify は、Spotifyのサービスデータを削除します。
-func (s *spotifyService) DeleteSpotify(userID int) error {
-	// "spotify" を指定してレコードを削除
-	if err := s.repo.DeleteUserService(userID, "spotify"); err != nil {
-		return fmt.Errorf("failed to delete spotify service data: %w", err)
+// Disconnect は、プロバイダーの連携データを削除します。
+func (s *musicService) Disconnect(provider string, userID int) error {
+	if _, err := s.registry.Get(provider); err != nil {
+		return err
+	}
+	if err := s.repo.DeleteUserService(userID, provider); err != nil {
+		return fmt.Errorf("failed to delete %s service data: %w", provider, err)
 	}
 	return nil
 }
 
+// RefreshToken は、ユーザー単位のロックを取得してからトークンを更新します。
+// ワーカーとクライアントからの更新が同時に走ってリフレッシュトークンを取り違えないようにする。
+func (s *musicService) RefreshToken(provider string, userID int) (time.Time, error) {
+	unlock, err := s.lockRefresh(provider, userID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer unlock()
+
+	return s.refreshToken(provider, userID)
+}
 
-// RefreshSpotifyToken は、DBからエンコード済みの refresh token を取得し、デコード後にSpotify API を呼び出して
-// 新しいアクセストークンを取得、エンコードしてDBを更新します。
-func (s *spotifyService) RefreshSpotifyToken(userID int) (string, time.Time, error) {
-	// DBからエンコード済みのリフレッシュトークンを取得
-	encryptedStoredToken, err := s.repo.GetSpotifyRefreshToken(userID)
+func (s *musicService) RefreshTokenIfExpiring(provider string, userID int, within time.Duration) (bool, error) {
+	unlock, err := s.lockRefresh(provider, userID)
 	if err != nil {
-		return "", time.Time{}, fmt.Errorf("failed to retrieve refresh token: %w", err)
+		return false, err
 	}
+	defer unlock()
 
-	// 取得したリフレッシュトークンをデコードする
-	decodedBytes, err := base64.StdEncoding.DecodeString(encryptedStoredToken)
+	// ロック待ちの間に他のリクエストが更新済みの場合はスキップする
+	loc, err := time.LoadLocation("Asia/Tokyo")
 	if err != nil {
-		return "", time.Time{}, fmt.Errorf("failed to decode stored refresh token: %w", err)
+		return false, fmt.Errorf("failed to load JST location: %w", err)
+	}
+	expiresAt, err := s.repo.GetServiceExpiresAt(userID, provider)
+	if err != nil {
+		return false, err
+	}
+	// expires_at は JST の日時文字列で保存しているため、JST の壁時計時刻同士で比較する
+	threshold := time.Now().In(loc).Add(within).Format("2006-01-02 15:04:05")
+	if expiresAt.Format("2006-01-02 15:04:05") > threshold {
+		return false, nil
+	}
+
+	if _, err := s.refreshToken(provider, userID); err != nil {
+		return false, err
 	}
-	refreshToken := string(decodedBytes)
+	return true, nil
+}
 
-	// Spotifyのクライアント情報の取得
-	clientID := os.Getenv("SPOTIFY_CLIENT_ID")
-	clientSecret := os.Getenv("SPOTIFY_CLIENT_SECRET")
-	if clientID == "" || clientSecret == "" {
-		return "", time.Time{}, errors.New("missing spotify credentials")
+// lockRefresh は、ユーザー単位のトークン更新ロックを取得し、解除用の関数を返します。
+func (s *musicService) lockRefresh(provider string, userID int) (func(), error) {
+	lockToken, ok, err := s.repo.AcquireRefreshLock(userID, provider, 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrRefreshInProgress
 	}
+	return func() {
+		if err := s.repo.ReleaseRefreshLock(userID, provider, lockToken); err != nil {
+			log.Printf("Failed to release refresh lock for user %d: %v", userID, err)
+		}
+	}, nil
+}
 
-	// トークンリフレッシュ用エンドポイント
-	tokenURL := "https://accounts.spotify.com/api/token"
-	// POSTパラメータ
-	formData := fmt.Sprintf("grant_type=refresh_token&refresh_token=%s", refreshToken)
-	req, err := http.NewRequest("POST", tokenURL, bytes.NewBufferString(formData))
+// refreshToken は、DBから暗号化済みの refresh token を取得し、復号後にプロバイダーの API を呼び出して
+// 新しいアクセストークンを取得、暗号化してDBを更新します。
+// 呼び出し元でロックを取得していること。
+func (s *musicService) refreshToken(provider string, userID int) (time.Time, error) {
+	musicProvider, err := s.registry.Get(provider)
 	if err != nil {
-		return "", time.Time{}, fmt.Errorf("failed to create token refresh request: %w", err)
+		return time.Time{}, err
 	}
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	authStr := fmt.Sprintf("%s:%s", clientID, clientSecret)
-	encodedAuth := base64.StdEncoding.EncodeToString([]byte(authStr))
-	req.Header.Set("Authorization", "Basic "+encodedAuth)
 
-	httpClient := &http.Client{Timeout: 10 * time.Second}
-	resp, err := httpClient.Do(req)
+	// DBから暗号化済みのリフレッシュトークンを取得
+	encryptedStoredToken, err := s.repo.GetRefreshToken(userID, provider)
 	if err != nil {
-		return "", time.Time{}, fmt.Errorf("failed to execute token refresh request: %w", err)
+		return time.Time{}, fmt.Errorf("failed to retrieve refresh token: %w", err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := ioutil.ReadAll(resp.Body)
-		return "", time.Time{}, fmt.Errorf("token refresh request failed, status %d: %s", resp.StatusCode, string(body))
+	// 取得したリフレッシュトークンを復号する
+	refreshToken, err := s.keyring.Decrypt(encryptedStoredToken)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to decrypt stored refresh token: %w", err)
 	}
 
-	var tokenResp SpotifyTokenResponse
-	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
-		return "", time.Time{}, fmt.Errorf("failed to decode refresh token response: %w", err)
+	token, err := musicProvider.RefreshToken(refreshToken)
+	if err != nil {
+		// ユーザーが連携を解除した等でリフレッシュトークンが失効している。
+		// 再試行しても回復しないため、要再連携として記録する
+		if errors.Is(err, providers.ErrInvalidGrant) {
+			if err := s.repo.MarkServiceBroken(userID, provider, "invalid_grant"); err != nil {
+				return time.Time{}, err
+			}
+			return time.Time{}, ErrConnectionBroken
+		}
+		// プロバイダーの障害などで失敗し続ける連携が定期更新のスキャンの先頭に残らないよう、再試行を遅らせる
+		if recordErr := s.repo.RecordRefreshFailure(userID, provider, s.refreshRetryBase, s.refreshRetryMax); recordErr != nil {
+			log.Printf("Failed to record %s refresh failure for user %d: %v", provider, userID, recordErr)
+		}
+		return time.Time{}, err
 	}
 
 	// DB更新前の新しい有効期限を日本時刻で計算
 	loc, err := time.LoadLocation("Asia/Tokyo")
 	if err != nil {
-		return "", time.Time{}, fmt.Errorf("failed to load JST location: %w", err)
+		return time.Time{}, fmt.Errorf("failed to load JST location: %w", err)
 	}
-	newExpiresAt := time.Now().In(loc).Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
+	newExpiresAt := time.Now().In(loc).Add(time.Duration(token.ExpiresIn) * time.Second)
 
 	log.Printf("Current JST time: %s", time.Now().In(loc).Format(time.RFC3339))
 	log.Printf("expiresAt: %s", newExpiresAt.Format(time.RFC3339))
 
 	// 通常はリフレッシュトークンは再発行されないが、新しい値が返ってくる場合もある
 	newRefreshToken := refreshToken
-	if tokenResp.RefreshToken != "" {
-		newRefreshToken = tokenResp.RefreshToken
+	if token.RefreshToken != "" {
+		newRefreshToken = token.RefreshToken
 	}
 
-	// ConnectSpotify と同様にエンコードしてから repository に入れる
-	encryptedAccessToken := encodeToken(tokenResp.AccessToken)
-	encryptedRefreshToken := encodeToken(newRefreshToken)
+	// Connect と同様に暗号化してから repository に入れる
+	encryptedAccessToken, err := s.keyring.Encrypt(token.AccessToken)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to encrypt access token: %w", err)
+	}
+	encryptedRefreshToken, err := s.keyring.Encrypt(newRefreshToken)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to encrypt refresh token: %w", err)
+	}
 
 	// DBのトークン情報を更新する
-	if err := s.repo.UpdateSpotifyToken(userID, encryptedAccessToken, encryptedRefreshToken, newExpiresAt); err != nil {
-		return "", time.Time{}, fmt.Errorf("failed to update spotify token in db: %w", err)
+	if err := s.repo.UpdateServiceToken(userID, provider, encryptedAccessToken, encryptedRefreshToken, newExpiresAt); err != nil {
+		return time.Time{}, fmt.Errorf("failed to update %s token in db: %w", provider, err)
 	}
 
-	return encryptedAccessToken, newExpiresAt, nil
+	return newExpiresAt, nil
+}
+
+// ConnectionStatuses は、登録済みの全プロバイダーについて連携状態を返します（未連携は connected=false）。
+func (s *musicService) ConnectionStatuses(userServices map[string]repositories.UserServiceData) map[string]ConnectionStatus {
+	statuses := make(map[string]ConnectionStatus)
+	for _, name := range s.registry.Names() {
+		data, ok := userServices[name]
+		statuses[name] = ConnectionStatus{
+			Connected:           ok,
+			Broken:              ok && data.Broken,
+			ReauthorizeRequired: ok && data.ReauthorizeRequired,
+		}
+	}
+	return statuses
+}
+
+func (s *musicService) AccessToken(provider string, userID int) (string, error) {
+	if _, err := s.registry.Get(provider); err != nil {
+		return "", err
+	}
+
+	// 期限切れ直前のトークンで API を呼ばないよう、必要なら先に更新する。
+	// 別のリクエストが更新中の場合は、現在のトークンがまだ有効なのでそのまま使う
+	_, err := s.RefreshTokenIfExpiring(provider, userID, accessTokenRefreshMargin)
+	if err != nil && !errors.Is(err, ErrRefreshInProgress) {
+		if errors.Is(err, sql.ErrNoRows) || errors.Is(err, ErrConnectionBroken) {
+			return "", ErrServiceNotConnected
+		}
+		return "", err
+	}
+
+	encryptedAccessToken, err := s.repo.GetAccessToken(userID, provider)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrServiceNotConnected
+	}
+	if err != nil {
+		return "", err
+	}
+	accessToken, err := s.keyring.Decrypt(encryptedAccessToken)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt stored access token: %w", err)
+	}
+	return accessToken, nil
+}
+
+func (s *musicService) GetPlaylist(provider string, userID int, playlistID string) (*providers.Playlist, error) {
+	musicProvider, err := s.registry.Get(provider)
+	if err != nil {
+		return nil, err
+	}
+	accessToken, err := s.AccessToken(provider, userID)
+	if err != nil {
+		return nil, err
+	}
+	return musicProvider.GetPlaylist(accessToken, playlistID)
+}
+
+func (s *musicService) SearchTracks(provider string, userID int, query, market string, limit int) ([]providers.Track, error) {
+	musicProvider, err := s.registry.Get(provider)
+	if err != nil {
+		return nil, err
+	}
+	accessToken, err := s.AccessToken(provider, userID)
+	if err != nil {
+		return nil, err
+	}
+	return musicProvider.SearchTracks(accessToken, query, market, limit)
+}
+
+func (s *musicService) Market(provider string, userID int) (string, error) {
+	musicProvider, err := s.registry.Get(provider)
+	if err != nil {
+		return "", err
+	}
+	accessToken, err := s.AccessToken(provider, userID)
+	if err != nil {
+		return "", err
+	}
+	profile, err := musicProvider.GetProfile(accessToken)
+	if err != nil {
+		return "", err
+	}
+	return profile.Country, nil
+}
+
+func (s *musicService) CreatePlaylist(provider string, userID int, name, description string, public bool, trackIDs []string) (*providers.Playlist, error) {
+	musicProvider, err := s.registry.Get(provider)
+	if err != nil {
+		return nil, err
+	}
+	accessToken, err := s.AccessToken(provider, userID)
+	if err != nil {
+		return nil, err
+	}
+	return musicProvider.CreatePlaylist(accessToken, name, description, public, trackIDs)
+}
+
+func (s *musicService) ControlPlayback(provider string, userID int, command providers.PlaybackCommand) error {
+	musicProvider, err := s.registry.Get(provider)
+	if err != nil {
+		return err
+	}
+	accessToken, err := s.AccessToken(provider, userID)
+	if err != nil {
+		return err
+	}
+	err = musicProvider.ControlPlayback(accessToken, command)
+	if errors.Is(err, providers.ErrInsufficientScope) {
+		if markErr := s.repo.MarkReauthorizationRequired(userID, provider); markErr != nil {
+			log.Printf("Failed to mark %s connection of user %d as reauthorization required: %v", provider, userID, markErr)
+		}
+	}
+	return err
+}
+
+func (s *musicService) FindTracksByISRC(provider string, userID int, isrc string) ([]providers.Track, error) {
+	musicProvider, err := s.registry.Get(provider)
+	if err != nil {
+		return nil, err
+	}
+	accessToken, err := s.AccessToken(provider, userID)
+	if err != nil {
+		return nil, err
+	}
+	return musicProvider.FindTracksByISRC(accessToken, isrc)
 }
@@ -0,0 +1,240 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"music-share-api/internal/providers"
+	"music-share-api/internal/providers/spotifytest"
+	"music-share-api/internal/repositories"
+)
+
+func TestMusicServiceConnectStoresEncryptedTokens(t *testing.T) {
+	f := newMusicServiceFixture(t)
+	f.fake.AddUser(spotifytest.User{ID: "sp-alice", DisplayName: "Alice"})
+
+	if err := f.connect(t, 1, "sp-alice"); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+
+	stored := f.repo.get(1, "spotify")
+	if stored == nil {
+		t.Fatal("connection was not stored")
+	}
+	if stored.serviceUserID != "sp-alice" || stored.serviceUserName != "Alice" {
+		t.Fatalf("unexpected stored profile: %+v", stored)
+	}
+	if strings.HasPrefix(stored.encryptedAccessToken, "access-") || strings.HasPrefix(stored.encryptedRefreshToken, "refresh-") {
+		t.Fatal("tokens were stored in plaintext")
+	}
+	if got := f.decrypt(t, stored.encryptedAccessToken); !strings.HasPrefix(got, "access-") {
+		t.Fatalf("decrypted access token = %q", got)
+	}
+
+	statuses := f.service.ConnectionStatuses(map[string]repositories.UserServiceData{"spotify": {ServiceUserID: "sp-alice"}})
+	if !statuses["spotify"].Connected || statuses["spotify"].Broken {
+		t.Fatalf("unexpected connection status: %+v", statuses["spotify"])
+	}
+}
+
+func TestMusicServiceConnectValidatesState(t *testing.T) {
+	f := newMusicServiceFixture(t)
+	f.fake.AddUser(spotifytest.User{ID: "sp-alice"})
+
+	authorizeURL, err := f.service.BuildAuthorizeURL("spotify", 1, OAuthPurposeConnect, "http://localhost/callback")
+	if err != nil {
+		t.Fatalf("BuildAuthorizeURL: %v", err)
+	}
+	code, state, err := f.fake.Approve(authorizeURL, "sp-alice")
+	if err != nil {
+		t.Fatalf("Approve: %v", err)
+	}
+
+	// 別ユーザーに発行された state では連携できない
+	if err := f.service.Connect("spotify", 2, code, state); err == nil {
+		t.Fatal("Connect succeeded with a state issued for another user")
+	}
+	// state は1回限り有効
+	if err := f.service.Connect("spotify", 1, code, state); err == nil {
+		t.Fatal("Connect succeeded with a consumed state")
+	}
+	if f.repo.get(1, "spotify") != nil || f.repo.get(2, "spotify") != nil {
+		t.Fatal("connection was stored despite invalid state")
+	}
+
+	if _, err := f.service.BuildAuthorizeURL("unknown", 1, OAuthPurposeConnect, "http://localhost/callback"); err == nil {
+		t.Fatal("BuildAuthorizeURL succeeded for an unknown provider")
+	}
+}
+
+func TestMusicServiceConnectRejectsAccountLinkedToAnotherUser(t *testing.T) {
+	f := newMusicServiceFixture(t)
+	f.fake.AddUser(spotifytest.User{ID: "sp-alice"})
+
+	if err := f.connect(t, 1, "sp-alice"); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	if err := f.connect(t, 2, "sp-alice"); err == nil {
+		t.Fatal("Connect succeeded for an account linked to another user")
+	}
+	// 同じユーザーの再連携はトークンの更新として扱う
+	if err := f.connect(t, 1, "sp-alice"); err != nil {
+		t.Fatalf("reconnect: %v", err)
+	}
+}
+
+func TestMusicServiceRefreshToken(t *testing.T) {
+	f := newMusicServiceFixture(t)
+	f.fake.AddUser(spotifytest.User{ID: "sp-alice"})
+	if err := f.connect(t, 1, "sp-alice"); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	before := *f.repo.get(1, "spotify")
+
+	expiresAt, err := f.service.RefreshToken("spotify", 1)
+	if err != nil {
+		t.Fatalf("RefreshToken: %v", err)
+	}
+	if until := time.Until(expiresAt); until < 59*time.Minute || until > time.Hour {
+		t.Fatalf("expiresAt is %v from now, want about 1h", until)
+	}
+
+	after := f.repo.get(1, "spotify")
+	if f.decrypt(t, after.encryptedAccessToken) == f.decrypt(t, before.encryptedAccessToken) {
+		t.Fatal("access token was not updated")
+	}
+	// Spotify が再発行しなかった場合は既存のリフレッシュトークンを保持する
+	if f.decrypt(t, after.encryptedRefreshToken) != f.decrypt(t, before.encryptedRefreshToken) {
+		t.Fatal("refresh token changed although none was reissued")
+	}
+}
+
+func TestMusicServiceRefreshTokenMarksRevokedConnectionBroken(t *testing.T) {
+	f := newMusicServiceFixture(t)
+	f.fake.AddUser(spotifytest.User{ID: "sp-alice"})
+	if err := f.connect(t, 1, "sp-alice"); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	f.fake.RevokeUser("sp-alice")
+
+	if _, err := f.service.RefreshToken("spotify", 1); !errors.Is(err, ErrConnectionBroken) {
+		t.Fatalf("err = %v, want ErrConnectionBroken", err)
+	}
+	if reason := f.repo.get(1, "spotify").brokenReason; reason != "invalid_grant" {
+		t.Fatalf("broken reason = %q, want invalid_grant", reason)
+	}
+
+	// 壊れた連携は再試行しない
+	requests := f.fake.RequestCount("/api/token")
+	if _, err := f.service.RefreshToken("spotify", 1); err == nil {
+		t.Fatal("RefreshToken succeeded for a broken connection")
+	}
+	if f.fake.RequestCount("/api/token") != requests {
+		t.Fatal("broken connection was retried against the provider")
+	}
+}
+
+func TestMusicServiceRefreshTokenPropagatesProviderErrors(t *testing.T) {
+	f := newMusicServiceFixture(t)
+	f.fake.AddUser(spotifytest.User{ID: "sp-alice"})
+	if err := f.connect(t, 1, "sp-alice"); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+
+	f.fake.RateLimitNext("/api/token", 3)
+	if _, err := f.service.RefreshToken("spotify", 1); !providers.IsRateLimited(err) {
+		t.Fatalf("err = %v, want rate limited", err)
+	}
+	// レート制限では連携を壊れた扱いにしない
+	if reason := f.repo.get(1, "spotify").brokenReason; reason != "" {
+		t.Fatalf("connection marked broken on rate limit: %q", reason)
+	}
+	// 失敗した連携は、再試行の時刻まで定期更新の対象から外す
+	expiresBefore := time.Now().Add(24 * time.Hour)
+	if userIDs, _ := f.repo.ListExpiringServiceUsers("spotify", expiresBefore, 10); len(userIDs) != 0 {
+		t.Fatalf("failed connection was listed for refresh: %v", userIDs)
+	}
+
+	if _, err := f.service.RefreshToken("spotify", 1); err != nil {
+		t.Fatalf("RefreshToken after rate limit: %v", err)
+	}
+	if userIDs, _ := f.repo.ListExpiringServiceUsers("spotify", expiresBefore, 10); len(userIDs) != 1 {
+		t.Fatalf("refreshed connection was not listed: %v", userIDs)
+	}
+}
+
+func TestMusicServiceRefreshTokenIfExpiring(t *testing.T) {
+	f := newMusicServiceFixture(t)
+	f.fake.AddUser(spotifytest.User{ID: "sp-alice"})
+	if err := f.connect(t, 1, "sp-alice"); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+
+	refreshed, err := f.service.RefreshTokenIfExpiring("spotify", 1, 10*time.Minute)
+	if err != nil {
+		t.Fatalf("RefreshTokenIfExpiring: %v", err)
+	}
+	if refreshed {
+		t.Fatal("token valid for 1h was refreshed with a 10m window")
+	}
+
+	refreshed, err = f.service.RefreshTokenIfExpiring("spotify", 1, 2*time.Hour)
+	if err != nil {
+		t.Fatalf("RefreshTokenIfExpiring: %v", err)
+	}
+	if !refreshed {
+		t.Fatal("token expiring within the window was not refreshed")
+	}
+}
+
+func TestMusicServiceRefreshTokenRespectsLock(t *testing.T) {
+	f := newMusicServiceFixture(t)
+	f.fake.AddUser(spotifytest.User{ID: "sp-alice"})
+	if err := f.connect(t, 1, "sp-alice"); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+
+	lockToken, ok, _ := f.repo.AcquireRefreshLock(1, "spotify", time.Minute)
+	if !ok {
+		t.Fatal("failed to acquire lock")
+	}
+	if _, err := f.service.RefreshToken("spotify", 1); !errors.Is(err, ErrRefreshInProgress) {
+		t.Fatalf("err = %v, want ErrRefreshInProgress", err)
+	}
+	f.repo.ReleaseRefreshLock(1, "spotify", lockToken)
+
+	if _, err := f.service.RefreshToken("spotify", 1); err != nil {
+		t.Fatalf("RefreshToken after unlock: %v", err)
+	}
+}
+
+func TestMusicServiceGetPlaylistUsesStoredToken(t *testing.T) {
+	f := newMusicServiceFixture(t)
+	f.fake.AddUser(spotifytest.User{ID: "sp-alice"})
+	f.fake.AddTrack(spotifytest.Track{ID: "t1", Name: "Blue Sky", Artists: []string{"Band A"}})
+	f.fake.AddPlaylist("pl1", "Morning", "t1")
+
+	if _, err := f.service.GetPlaylist("spotify", 1, "pl1"); !errors.Is(err, ErrServiceNotConnected) {
+		t.Fatalf("err = %v, want ErrServiceNotConnected", err)
+	}
+
+	if err := f.connect(t, 1, "sp-alice"); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	playlist, err := f.service.GetPlaylist("spotify", 1, "pl1")
+	if err != nil {
+		t.Fatalf("GetPlaylist: %v", err)
+	}
+	if playlist.Name != "Morning" || len(playlist.Tracks) != 1 || playlist.Tracks[0].ID != "t1" {
+		t.Fatalf("unexpected playlist: %+v", playlist)
+	}
+
+	// 連携が壊れている場合は未連携として扱う
+	f.fake.RevokeUser("sp-alice")
+	f.repo.MarkServiceBroken(1, "spotify", "invalid_grant")
+	if _, err := f.service.AccessToken("spotify", 1); !errors.Is(err, ErrServiceNotConnected) {
+		t.Fatalf("err = %v, want ErrServiceNotConnected", err)
+	}
+}
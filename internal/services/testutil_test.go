@@ -0,0 +1,630 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"music-share-api/internal/providers"
+	"music-share-api/internal/providers/spotifytest"
+	"music-share-api/internal/repositories"
+	"music-share-api/internal/utils"
+)
+
+// 複数のテストファイルで共有するインメモリのリポジトリとフィクスチャ
+
+// memoryServiceRepository は、テスト用のインメモリ ServiceRepository です。
+// expires_at は本番と同様に JST の日時文字列として保持する。
+type memoryServiceRepository struct {
+	mu       sync.Mutex
+	services map[string]*memoryUserService
+	states   map[string]repositories.OAuthState
+	locks    map[string]string
+}
+
+type memoryUserService struct {
+	userID                int
+	serviceName           string
+	serviceUserID         string
+	serviceUserName       string
+	encryptedAccessToken  string
+	encryptedRefreshToken string
+	expiresAt             string
+	brokenReason          string
+	reauthorizeRequired   bool
+	refreshFailures       int
+	nextRefreshAt         time.Time
+}
+
+func newMemoryServiceRepository() *memoryServiceRepository {
+	return &memoryServiceRepository{
+		services: make(map[string]*memoryUserService),
+		states:   make(map[string]repositories.OAuthState),
+		locks:    make(map[string]string),
+	}
+}
+
+func serviceKey(userID int, serviceName string) string {
+	return fmt.Sprintf("%s:%d", serviceName, userID)
+}
+
+func (r *memoryServiceRepository) get(userID int, serviceName string) *memoryUserService {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.services[serviceKey(userID, serviceName)]
+}
+
+func (r *memoryServiceRepository) InsertUserService(userID int, serviceName, serviceUserID, serviceUserName, encryptedAccessToken, encryptedRefreshToken string, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.services[serviceKey(userID, serviceName)] = &memoryUserService{
+		userID:                userID,
+		serviceName:           serviceName,
+		serviceUserID:         serviceUserID,
+		serviceUserName:       serviceUserName,
+		encryptedAccessToken:  encryptedAccessToken,
+		encryptedRefreshToken: encryptedRefreshToken,
+		expiresAt:             expiresAt.Format("2006-01-02 15:04:05"),
+	}
+	return nil
+}
+
+func (r *memoryServiceRepository) DeleteUserService(userID int, serviceName string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.services, serviceKey(userID, serviceName))
+	return nil
+}
+
+func (r *memoryServiceRepository) GetRefreshToken(userID int, serviceName string) (string, error) {
+	service := r.get(userID, serviceName)
+	if service == nil || service.brokenReason != "" {
+		return "", sql.ErrNoRows
+	}
+	return service.encryptedRefreshToken, nil
+}
+
+func (r *memoryServiceRepository) GetAccessToken(userID int, serviceName string) (string, error) {
+	service := r.get(userID, serviceName)
+	if service == nil || service.brokenReason != "" {
+		return "", sql.ErrNoRows
+	}
+	return service.encryptedAccessToken, nil
+}
+
+func (r *memoryServiceRepository) UpdateServiceToken(userID int, serviceName, newAccessToken, newRefreshToken string, newExpiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	service := r.services[serviceKey(userID, serviceName)]
+	if service == nil {
+		return sql.ErrNoRows
+	}
+	service.encryptedAccessToken = newAccessToken
+	service.encryptedRefreshToken = newRefreshToken
+	service.expiresAt = newExpiresAt.Format("2006-01-02 15:04:05")
+	service.brokenReason = ""
+	service.refreshFailures = 0
+	service.nextRefreshAt = time.Time{}
+	return nil
+}
+
+func (r *memoryServiceRepository) GetUserIDByServiceUserID(serviceName, serviceUserID string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, service := range r.services {
+		if service.serviceName == serviceName && service.serviceUserID == serviceUserID {
+			return service.userID, nil
+		}
+	}
+	return 0, sql.ErrNoRows
+}
+
+func (r *memoryServiceRepository) SaveOAuthState(state string, data repositories.OAuthState, ttl time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.states[state] = data
+	return nil
+}
+
+func (r *memoryServiceRepository) ConsumeOAuthState(state string) (*repositories.OAuthState, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	data, ok := r.states[state]
+	if !ok {
+		return nil, errors.New("invalid or expired state")
+	}
+	delete(r.states, state)
+	return &data, nil
+}
+
+func (r *memoryServiceRepository) ListEncryptedTokens(afterServiceID, limit int) ([]repositories.EncryptedTokenRow, error) {
+	return nil, nil
+}
+
+func (r *memoryServiceRepository) UpdateEncryptedTokens(current repositories.EncryptedTokenRow, encryptedAccessToken, encryptedRefreshToken string) (bool, error) {
+	return false, nil
+}
+
+func (r *memoryServiceRepository) ListExpiringServiceUsers(serviceName string, expiresBefore time.Time, limit int) ([]int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var userIDs []int
+	for _, service := range r.services {
+		if service.serviceName == serviceName && service.brokenReason == "" && service.expiresAt < expiresBefore.Format("2006-01-02 15:04:05") && !service.nextRefreshAt.After(time.Now()) {
+			userIDs = append(userIDs, service.userID)
+		}
+	}
+	return userIDs, nil
+}
+
+func (r *memoryServiceRepository) RecordRefreshFailure(userID int, serviceName string, baseBackoff, maxBackoff time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if service := r.services[serviceKey(userID, serviceName)]; service != nil {
+		backoff := baseBackoff << service.refreshFailures
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+		service.nextRefreshAt = time.Now().Add(backoff)
+		service.refreshFailures++
+	}
+	return nil
+}
+
+// GetServiceExpiresAt は、MySQL ドライバーと同様に JST の日時文字列を UTC として読み込みます。
+func (r *memoryServiceRepository) GetServiceExpiresAt(userID int, serviceName string) (time.Time, error) {
+	service := r.get(userID, serviceName)
+	if service == nil {
+		return time.Time{}, sql.ErrNoRows
+	}
+	return time.Parse("2006-01-02 15:04:05", service.expiresAt)
+}
+
+func (r *memoryServiceRepository) MarkServiceBroken(userID int, serviceName, reason string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if service := r.services[serviceKey(userID, serviceName)]; service != nil {
+		service.brokenReason = reason
+	}
+	return nil
+}
+
+func (r *memoryServiceRepository) MarkReauthorizationRequired(userID int, serviceName string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if service := r.services[serviceKey(userID, serviceName)]; service != nil {
+		service.reauthorizeRequired = true
+	}
+	return nil
+}
+
+func (r *memoryServiceRepository) AcquireRefreshLock(userID int, serviceName string, ttl time.Duration) (string, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := serviceKey(userID, serviceName)
+	if _, locked := r.locks[key]; locked {
+		return "", false, nil
+	}
+	r.locks[key] = "lock-" + key
+	return r.locks[key], true, nil
+}
+
+func (r *memoryServiceRepository) ReleaseRefreshLock(userID int, serviceName, lockToken string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := serviceKey(userID, serviceName)
+	if r.locks[key] == lockToken {
+		delete(r.locks, key)
+	}
+	return nil
+}
+
+type musicServiceFixture struct {
+	fake    *spotifytest.Server
+	repo    *memoryServiceRepository
+	keyring *utils.TokenKeyring
+	service MusicService
+}
+
+func newMusicServiceFixture(t *testing.T) *musicServiceFixture {
+	t.Helper()
+	fake := spotifytest.NewServer()
+	t.Cleanup(fake.Close)
+
+	keyring, err := utils.NewTokenKeyring("test:"+base64.StdEncoding.EncodeToString(make([]byte, 32)), "test")
+	if err != nil {
+		t.Fatalf("NewTokenKeyring: %v", err)
+	}
+	registry := providers.NewRegistry(providers.NewSpotifyProvider(providers.SpotifyConfig{
+		ClientID:        spotifytest.ClientID,
+		ClientSecret:    spotifytest.ClientSecret,
+		AccountsBaseURL: fake.AccountsBaseURL(),
+		APIBaseURL:      fake.APIBaseURL(),
+		HTTPClient:      fake.Client(),
+	}))
+	repo := newMemoryServiceRepository()
+
+	return &musicServiceFixture{
+		fake:    fake,
+		repo:    repo,
+		keyring: keyring,
+		service: NewMusicService(repo, registry, keyring),
+	}
+}
+
+// connect は、認可URLの発行から Connect までの連携フローを実行します。
+func (f *musicServiceFixture) connect(t *testing.T, userID int, spotifyUserID string) error {
+	t.Helper()
+	authorizeURL, err := f.service.BuildAuthorizeURL("spotify", userID, OAuthPurposeConnect, "http://localhost/callback")
+	if err != nil {
+		t.Fatalf("BuildAuthorizeURL: %v", err)
+	}
+	code, state, err := f.fake.Approve(authorizeURL, spotifyUserID)
+	if err != nil {
+		t.Fatalf("Approve: %v", err)
+	}
+	return f.service.Connect("spotify", userID, code, state)
+}
+
+func (f *musicServiceFixture) decrypt(t *testing.T, value string) string {
+	t.Helper()
+	plaintext, err := f.keyring.Decrypt(value)
+	if err != nil {
+		t.Fatalf("Decrypt: %v", err)
+	}
+	return plaintext
+}
+
+// memoryRoomRepository は、テスト用のインメモリ RoomRepository です。
+type memoryRoomRepository struct {
+	rooms     map[int]*repositories.RoomAllInfo
+	syncUsers map[int]map[int]bool
+	nextID    int
+}
+
+func newMemoryRoomRepository() *memoryRoomRepository {
+	return &memoryRoomRepository{
+		rooms:     make(map[int]*repositories.RoomAllInfo),
+		syncUsers: make(map[int]map[int]bool),
+		nextID:    1,
+	}
+}
+
+func (r *memoryRoomRepository) CreateRoom(input repositories.RoomCreateInput) (int, error) {
+	roomID := r.nextID
+	r.nextID++
+	r.rooms[roomID] = &repositories.RoomAllInfo{
+		RoomID:              roomID,
+		RoomName:            input.RoomName,
+		Genre:               input.Genre,
+		Tags:                input.Tags,
+		HostUserID:          input.HostUserID,
+		PlayingPlaylistName: input.PlayingPlaylistName,
+		PlayingSongName:     input.PlayingSongName,
+		RedisData:           repositories.RedisRoomData{PlayingSongIndex: input.PlayingSongIndex},
+		Songs:               input.Songs,
+	}
+	return roomID, nil
+}
+
+func (r *memoryRoomRepository) JoinRoom(userID int, userName string, roomID int, roomPassword *string) error {
+	return nil
+}
+
+func (r *memoryRoomRepository) LeaveRoom(userID int, roomID int) (*repositories.RoomAllInfo, error) {
+	return r.rooms[roomID], nil
+}
+
+func (r *memoryRoomRepository) GetRoomByID(roomID int) (*repositories.RoomAllInfo, error) {
+	room, ok := r.rooms[roomID]
+	if !ok {
+		return nil, repositories.ErrRoomNotFound
+	}
+	if room.DeletedAt.Valid {
+		return nil, repositories.ErrRoomDeleted
+	}
+	// MySQL・Redis から読み直す実装と同じく、呼び出し元には複製を返す
+	copied := *room
+	return &copied, nil
+}
+
+func (r *memoryRoomRepository) GetStoredRoomByID(roomID int) (*repositories.RoomAllInfo, error) {
+	room, ok := r.rooms[roomID]
+	if !ok {
+		return nil, repositories.ErrRoomNotFound
+	}
+	// Redis のデータは含まない
+	copied := *room
+	copied.RedisData = repositories.RedisRoomData{}
+	return &copied, nil
+}
+
+func (r *memoryRoomRepository) ReplaceRoomSongs(roomID int, playlistName string, songs []repositories.Song) error {
+	room := r.rooms[roomID]
+	room.PlayingPlaylistName = playlistName
+	room.RedisData.PlayingSongIndex = 0
+	room.Songs = make(map[string]repositories.Song)
+	for idx, song := range songs {
+		room.Songs[strconv.Itoa(idx)] = song
+	}
+	return nil
+}
+
+func (r *memoryRoomRepository) UpdatePlaybackState(roomID int, state repositories.PlaybackState) (*repositories.RedisRoomData, error) {
+	room, ok := r.rooms[roomID]
+	if !ok {
+		return nil, errors.New("room not found")
+	}
+	room.RedisData.RoomStatus = state.RoomStatus
+	room.RedisData.PlayingSongIndex = state.PlayingSongIndex
+	room.RedisData.PositionMs = state.PositionMs
+	room.RedisData.PositionUpdatedAt = time.Now().Format(time.RFC3339Nano)
+	room.PlayingSongName = state.PlayingSongName
+	updated := room.RedisData
+	return &updated, nil
+}
+
+func (r *memoryRoomRepository) SetPlaybackSync(roomID, userID int, enabled bool) error {
+	if r.syncUsers[roomID] == nil {
+		r.syncUsers[roomID] = make(map[int]bool)
+	}
+	if enabled {
+		r.syncUsers[roomID][userID] = true
+	} else {
+		delete(r.syncUsers[roomID], userID)
+	}
+	return nil
+}
+
+func (r *memoryRoomRepository) ListPlaybackSyncUsers(roomID int) ([]int, error) {
+	userIDs := make([]int, 0, len(r.syncUsers[roomID]))
+	for userID := range r.syncUsers[roomID] {
+		userIDs = append(userIDs, userID)
+	}
+	sort.Ints(userIDs)
+	return userIDs, nil
+}
+
+func newRoomServiceFixture(t *testing.T) (*musicServiceFixture, *memoryRoomRepository, RoomService) {
+	t.Helper()
+	f := newMusicServiceFixture(t)
+	f.fake.AddUser(spotifytest.User{ID: "sp-host"})
+	f.fake.AddTrack(spotifytest.Track{ID: "t1", Name: "Blue Sky", Artists: []string{"Band A", "Band B"}, DurationMs: 201000, ImageURL: "http://img/1"})
+	f.fake.AddTrack(spotifytest.Track{ID: "t2", Name: "Red Sun", Artists: []string{"Band C"}, DurationMs: 180000})
+	f.fake.AddPlaylist("pl1", "Morning", "t1", "t2")
+	if err := f.connect(t, 1, "sp-host"); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+
+	roomRepository := newMemoryRoomRepository()
+	return f, roomRepository, NewRoomService(roomRepository, f.service, newTestGenreService(), newMemoryPlayLogRepository())
+}
+
+// memoryRoomEventRepository は、発行されたイベントを記録するテスト用の RoomEventRepository です。
+type memoryRoomEventRepository struct {
+	mu     sync.Mutex
+	events []repositories.RoomEvent
+}
+
+func (r *memoryRoomEventRepository) PublishRoomEvent(event repositories.RoomEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+	return nil
+}
+
+func (r *memoryRoomEventRepository) SubscribeRoomEvents(ctx context.Context, roomID int) (<-chan repositories.RoomEvent, error) {
+	events := make(chan repositories.RoomEvent)
+	go func() {
+		<-ctx.Done()
+		close(events)
+	}()
+	return events, nil
+}
+
+// last は、eventType の最後のイベントを返します。
+func (r *memoryRoomEventRepository) last(t *testing.T, eventType string) repositories.RoomEvent {
+	t.Helper()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := len(r.events) - 1; i >= 0; i-- {
+		if r.events[i].Type == eventType {
+			return r.events[i]
+		}
+	}
+	t.Fatalf("no %s event was published", eventType)
+	return repositories.RoomEvent{}
+}
+
+type playbackServiceFixture struct {
+	*musicServiceFixture
+	roomRepository  *memoryRoomRepository
+	eventRepository *memoryRoomEventRepository
+	// playLogRepository は再生記録
+	playLogRepository *memoryPlayLogRepository
+	service           *playbackService
+	roomID            int
+
+	mu     sync.Mutex
+	sleeps []time.Duration
+	// slept は sleeps の合計で、service.now はこの分だけ進む
+	slept time.Duration
+}
+
+// newPlaybackServiceFixture は、ホスト（ユーザー1）と参加者2〜5のいるルームを用意します。
+// 参加者2は通常、3はアクティブなデバイスなし、4は無料プラン、5は未連携です。
+func newPlaybackServiceFixture(t *testing.T) *playbackServiceFixture {
+	t.Helper()
+	f, roomRepository, roomService := newRoomServiceFixture(t)
+	for userID, spotifyUserID := range map[int]string{2: "sp-guest", 3: "sp-nodevice", 4: "sp-free"} {
+		f.fake.AddUser(spotifytest.User{ID: spotifyUserID})
+		if err := f.connect(t, userID, spotifyUserID); err != nil {
+			t.Fatalf("Connect: %v", err)
+		}
+	}
+	f.fake.SetNoActiveDevice("sp-nodevice")
+	f.fake.SetFreeAccount("sp-free")
+
+	roomID, err := roomService.CreateRoom(repositories.RoomCreateInput{RoomName: "room", HostUserID: 1, ImportPlaylistID: "pl1"})
+	if err != nil {
+		t.Fatalf("CreateRoom: %v", err)
+	}
+	room := roomRepository.rooms[roomID]
+	room.RedisData.RoomStatus = RoomStatusPaused
+	for _, userID := range []string{"2", "3", "4", "5"} {
+		room.RedisData.Participants = append(room.RedisData.Participants, repositories.RedisRoomParticipant{UserID: userID})
+	}
+
+	eventRepository := &memoryRoomEventRepository{}
+	playLogRepository := newMemoryPlayLogRepository()
+	pf := &playbackServiceFixture{
+		musicServiceFixture: f,
+		roomRepository:      roomRepository,
+		eventRepository:     eventRepository,
+		playLogRepository:   playLogRepository,
+		roomID:              roomID,
+	}
+	service := NewPlaybackService(roomRepository, NewRoomEventService(eventRepository, roomRepository), f.service, NewPlayLogService(playLogRepository)).(*playbackService)
+	service.maxAttempts = 3
+	service.baseBackoff = 100 * time.Millisecond
+	service.maxBackoff = 5 * time.Second
+	service.now = func() time.Time {
+		pf.mu.Lock()
+		defer pf.mu.Unlock()
+		return time.Now().Add(pf.slept)
+	}
+	service.sleep = func(d time.Duration) {
+		pf.mu.Lock()
+		defer pf.mu.Unlock()
+		pf.sleeps = append(pf.sleeps, d)
+		pf.slept += d
+	}
+	// 同期処理の完了を待てるよう、テストでは同じゴルーチンで実行する
+	service.dispatch = func(f func()) { f() }
+	pf.service = service
+	return pf
+}
+
+// memoryPlayLogRepository は、テスト用のインメモリ PlayLogRepository です。
+type memoryPlayLogRepository struct {
+	plays   []repositories.RoomPlay
+	viewers map[int]map[int]bool
+	now     func() time.Time
+}
+
+func newMemoryPlayLogRepository() *memoryPlayLogRepository {
+	return &memoryPlayLogRepository{viewers: make(map[int]map[int]bool), now: time.Now}
+}
+
+func (r *memoryPlayLogRepository) StartPlay(play repositories.RoomPlay) (int64, error) {
+	play.PlayID = int64(len(r.plays) + 1)
+	play.StartedAt = r.now()
+	r.plays = append(r.plays, play)
+	return play.PlayID, nil
+}
+
+func (r *memoryPlayLogRepository) GetCurrentPlay(roomID int) (*repositories.RoomPlay, bool, error) {
+	for i := len(r.plays) - 1; i >= 0; i-- {
+		if r.plays[i].RoomID == roomID && r.plays[i].EndedAt == nil {
+			play := r.plays[i]
+			return &play, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+func (r *memoryPlayLogRepository) EndPlay(playID int64, outcome string, playedMs int) error {
+	play := &r.plays[playID-1]
+	endedAt := r.now()
+	play.EndedAt = &endedAt
+	play.Outcome = outcome
+	play.PlayedMs = playedMs
+	return nil
+}
+
+func (r *memoryPlayLogRepository) ListRoomPlays(roomID int, beforeID int64, limit int) ([]repositories.RoomPlay, error) {
+	plays := []repositories.RoomPlay{}
+	for i := len(r.plays) - 1; i >= 0 && len(plays) < limit; i-- {
+		if r.plays[i].RoomID == roomID && (beforeID == 0 || r.plays[i].PlayID < beforeID) {
+			plays = append(plays, r.plays[i])
+		}
+	}
+	return plays, nil
+}
+
+func (r *memoryPlayLogRepository) ListPlayedSongIDs(roomID int) ([]string, error) {
+	var songIDs []string
+	seen := make(map[string]bool)
+	for _, play := range r.plays {
+		if play.RoomID == roomID && play.SongID != "" && !seen[play.SongID] {
+			seen[play.SongID] = true
+			songIDs = append(songIDs, play.SongID)
+		}
+	}
+	return songIDs, nil
+}
+
+func (r *memoryPlayLogRepository) CanViewRoomHistory(roomID, userID int) (bool, error) {
+	return r.viewers[roomID][userID], nil
+}
+
+// sentMail は、recordingMailer が受け取ったメールです。
+type sentMail struct {
+	to, subject, body string
+}
+
+// recordingMailer は、送信したメールを記録するテスト用の Mailer です。
+type recordingMailer struct {
+	sent []sentMail
+}
+
+func (m *recordingMailer) Send(to, subject, body string) error {
+	m.sent = append(m.sent, sentMail{to: to, subject: subject, body: body})
+	return nil
+}
+
+// memoryGenreRepository は、テスト用のインメモリ GenreRepository です。
+type memoryGenreRepository struct {
+	codes []string
+	names map[string]map[string]string
+}
+
+func newMemoryGenreRepository() *memoryGenreRepository {
+	return &memoryGenreRepository{
+		codes: []string{"j-pop", "rock", "r-and-b"},
+		names: map[string]map[string]string{
+			"ja": {"j-pop": "J-POP", "rock": "ロック"},
+			"en": {"j-pop": "J-Pop", "rock": "Rock", "r-and-b": "R&B"},
+		},
+	}
+}
+
+func (r *memoryGenreRepository) ListGenres(locale, defaultLocale string) ([]repositories.Genre, error) {
+	genres := []repositories.Genre{}
+	for _, code := range r.codes {
+		name, ok := r.names[locale][code]
+		if !ok {
+			name, ok = r.names[defaultLocale][code]
+		}
+		if !ok {
+			name = code
+		}
+		genres = append(genres, repositories.Genre{Code: code, Name: name})
+	}
+	return genres, nil
+}
+
+func (r *memoryGenreRepository) ListGenreCodes() ([]string, error) {
+	return r.codes, nil
+}
+
+func newTestGenreService() GenreService {
+	return NewGenreService(newMemoryGenreRepository())
+}
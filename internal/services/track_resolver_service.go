@@ -0,0 +1,224 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"music-share-api/internal/providers"
+	"music-share-api/internal/repositories"
+	"music-share-api/internal/utils"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// 曲の対応付けの方法
+const (
+	// TrackMatchSource は、曲の取り込み元と同じプロバイダーのため、曲IDをそのまま使ったことを表します。
+	TrackMatchSource = "source"
+	TrackMatchISRC   = "isrc"
+	TrackMatchFuzzy  = "fuzzy"
+	// TrackMatchNone は、対応する曲が見つからなかったことを表します。
+	TrackMatchNone = "none"
+)
+
+// trackMatchMinScore は、曖昧一致で同じ曲とみなす一致度の下限です。
+const trackMatchMinScore = 0.8
+
+type TrackResolverService interface {
+	// ResolveTrack は、曲を provider の曲に対応付けます（ISRC で検索し、見つからなければ曲名・アーティスト・長さで曖昧一致）。
+	// 検索にはユーザーのトークンを使い、結果は trx_track_matches にキャッシュします。
+	ResolveTrack(provider string, userID int, song repositories.Song) (*repositories.TrackMatch, error)
+	// ResolveRoomSongs は、ルームの曲一覧をユーザーの provider の曲に対応付けます（キーは song_index の文字列）。
+	ResolveRoomSongs(userID int, roomID int, provider string) (map[string]*repositories.TrackMatch, error)
+}
+
+type trackResolverService struct {
+	trackMatchRepository repositories.TrackMatchRepository
+	roomRepository       repositories.RoomRepository
+	musicService         MusicService
+	missTTL              time.Duration
+}
+
+func NewTrackResolverService(trackMatchRepository repositories.TrackMatchRepository, roomRepository repositories.RoomRepository, musicService MusicService) TrackResolverService {
+	return &trackResolverService{
+		trackMatchRepository: trackMatchRepository,
+		roomRepository:       roomRepository,
+		musicService:         musicService,
+		// 見つからなかった結果は、配信側に曲が追加されることがあるため期限付きでキャッシュする
+		missTTL: utils.GetEnvDuration("TRACK_MATCH_MISS_TTL", 24*time.Hour),
+	}
+}
+
+func (s *trackResolverService) ResolveTrack(provider string, userID int, song repositories.Song) (*repositories.TrackMatch, error) {
+	song = withTrackID(song)
+
+	// Song.SongId は Spotify の曲IDのため、Spotify へはそのまま対応付ける
+	if provider == spotifyProviderName && song.SongId != "" {
+		return &repositories.TrackMatch{
+			TrackID:         song.TrackID,
+			Provider:        provider,
+			ProviderTrackID: song.SongId,
+			Method:          TrackMatchSource,
+			Score:           1,
+		}, nil
+	}
+
+	// 曲IDも ISRC もない曲（手入力された曲など）は、キャッシュのキーがないため毎回検索する
+	if song.TrackID == "" {
+		return s.findMatch(provider, userID, song)
+	}
+
+	if cached, found, err := s.trackMatchRepository.GetTrackMatch(song.TrackID, provider); err != nil {
+		log.Printf("Failed to get track match cache for %s: %v", song.TrackID, err)
+	} else if found && (cached.ProviderTrackID != "" || cached.Age < s.missTTL) {
+		return cached, nil
+	}
+
+	match, err := s.findMatch(provider, userID, song)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.trackMatchRepository.SaveTrackMatch(*match); err != nil {
+		log.Printf("Failed to save track match for %s: %v", song.TrackID, err)
+	}
+	return match, nil
+}
+
+func (s *trackResolverService) findMatch(provider string, userID int, song repositories.Song) (*repositories.TrackMatch, error) {
+	match := &repositories.TrackMatch{TrackID: song.TrackID, Provider: provider, Method: TrackMatchNone}
+
+	if song.ISRC != "" {
+		tracks, err := s.musicService.FindTracksByISRC(provider, userID, song.ISRC)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find tracks by isrc: %w", err)
+		}
+		// 同じ ISRC の曲が複数ある場合（アルバム版とシングル版など）は、曲名などが最も近いものを選ぶ
+		if best, _ := bestTrack(song, tracks); best != nil {
+			match.ProviderTrackID = best.ID
+			match.Method = TrackMatchISRC
+			match.Score = 1
+			return match, nil
+		}
+	}
+
+	if song.SongName == "" {
+		return match, nil
+	}
+	query := strings.TrimSpace(normalizeTitle(song.SongName) + " " + normalizeName(strings.Split(song.Artist, ",")[0]))
+	tracks, err := s.musicService.SearchTracks(provider, userID, query, "", 10)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search tracks: %w", err)
+	}
+	if best, score := bestTrack(song, tracks); best != nil && score >= trackMatchMinScore {
+		match.ProviderTrackID = best.ID
+		match.Method = TrackMatchFuzzy
+		match.Score = score
+	}
+	return match, nil
+}
+
+func (s *trackResolverService) ResolveRoomSongs(userID int, roomID int, provider string) (map[string]*repositories.TrackMatch, error) {
+	if provider == "" {
+		provider = spotifyProviderName
+	}
+	room, err := s.roomRepository.GetRoomByID(roomID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get room: %w", err)
+	}
+	if !room.IsPublic && !isRoomMember(room, userID) {
+		return nil, ErrNotRoomMember
+	}
+
+	matches := make(map[string]*repositories.TrackMatch, len(room.Songs))
+	for key, song := range room.Songs {
+		match, err := s.ResolveTrack(provider, userID, song)
+		if err != nil {
+			return nil, err
+		}
+		matches[key] = match
+	}
+	return matches, nil
+}
+
+// bestTrack は、song に最も近い曲とそのスコア（0〜1）を返します。
+func bestTrack(song repositories.Song, tracks []providers.Track) (*providers.Track, float64) {
+	var best *providers.Track
+	bestScore := -1.0
+	for i := range tracks {
+		if score := matchScore(song, tracks[i]); score > bestScore {
+			best, bestScore = &tracks[i], score
+		}
+	}
+	return best, bestScore
+}
+
+// matchScore は、曲名（60%）・アーティスト（30%）・曲の長さ（10%）の近さから一致度を計算します。
+func matchScore(song repositories.Song, track providers.Track) float64 {
+	titleScore := similarity(normalizeTitle(song.SongName), normalizeTitle(track.Name))
+
+	artistScore := 0.0
+	for _, songArtist := range strings.Split(song.Artist, ",") {
+		for _, trackArtist := range track.Artists {
+			artistScore = math.Max(artistScore, similarity(normalizeName(songArtist), normalizeName(trackArtist)))
+		}
+	}
+
+	// 長さが分からない場合は中立とし、2秒以内の差は一致、10秒以上の差は不一致とみなす
+	durationScore := 0.5
+	if song.SongLength > 0 && track.DurationMs > 0 {
+		diff := math.Abs(float64(song.SongLength - track.DurationMs))
+		durationScore = math.Min(1, math.Max(0, (10000-diff)/8000))
+	}
+
+	return 0.6*titleScore + 0.3*artistScore + 0.1*durationScore
+}
+
+// titleDecorations は、曲名の "(feat. ...)"・"[Remastered]"・" - 2011 Remaster" のような付記にマッチします。
+var titleDecorations = regexp.MustCompile(`\([^)]*\)|\[[^\]]*\]| - .*$`)
+
+func normalizeTitle(title string) string {
+	return normalizeName(titleDecorations.ReplaceAllString(title, ""))
+}
+
+// normalizeName は、小文字化し、記号を除いて空白を1つにまとめます。
+func normalizeName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return ' '
+	}, name)
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// similarity は、編集距離をもとにした2つの文字列の類似度（0〜1）を返します。
+func similarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 && len(rb) == 0 {
+		return 1
+	}
+	maxLen := math.Max(float64(len(ra)), float64(len(rb)))
+	return 1 - float64(levenshtein(ra, rb))/maxLen
+}
+
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
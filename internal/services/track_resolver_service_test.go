@@ -0,0 +1,145 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"music-share-api/internal/providers/spotifytest"
+	"music-share-api/internal/repositories"
+)
+
+// memoryTrackMatchRepository は、テスト用のインメモリ TrackMatchRepository です。
+type memoryTrackMatchRepository struct {
+	matches map[string]repositories.TrackMatch
+}
+
+func newMemoryTrackMatchRepository() *memoryTrackMatchRepository {
+	return &memoryTrackMatchRepository{matches: make(map[string]repositories.TrackMatch)}
+}
+
+func (r *memoryTrackMatchRepository) GetTrackMatch(trackID, provider string) (*repositories.TrackMatch, bool, error) {
+	match, ok := r.matches[provider+"|"+trackID]
+	if !ok {
+		return nil, false, nil
+	}
+	return &match, true, nil
+}
+
+func (r *memoryTrackMatchRepository) SaveTrackMatch(match repositories.TrackMatch) error {
+	match.Age = 0
+	r.matches[match.Provider+"|"+match.TrackID] = match
+	return nil
+}
+
+func newTrackResolverFixture(t *testing.T) (*musicServiceFixture, *memoryRoomRepository, *memoryTrackMatchRepository, TrackResolverService) {
+	t.Helper()
+	f, roomRepository, _ := newRoomServiceFixture(t)
+	f.fake.AddTrack(spotifytest.Track{ID: "t3", Name: "Green Field", Artists: []string{"Band D"}, DurationMs: 240000, ISRC: "JPAB01234567"})
+	matchRepository := newMemoryTrackMatchRepository()
+	return f, roomRepository, matchRepository, NewTrackResolverService(matchRepository, roomRepository, f.service)
+}
+
+func TestTrackResolverResolvesByISRCAndCaches(t *testing.T) {
+	f, _, matchRepository, resolver := newTrackResolverFixture(t)
+
+	// 取り込み元が Spotify の曲は、そのまま対応付ける
+	match, err := resolver.ResolveTrack("spotify", 1, repositories.Song{SongId: "t1", SongName: "Blue Sky"})
+	if err != nil {
+		t.Fatalf("ResolveTrack: %v", err)
+	}
+	if match.ProviderTrackID != "t1" || match.Method != TrackMatchSource || match.TrackID != "spotify:t1" {
+		t.Fatalf("unexpected match: %+v", match)
+	}
+	if got := f.fake.RequestCount("/v1/search"); got != 0 {
+		t.Fatalf("search requests = %d, want 0", got)
+	}
+
+	song := repositories.Song{SongName: "Green Field", Artist: "Band D", ISRC: "jpab01234567"}
+	match, err = resolver.ResolveTrack("spotify", 1, song)
+	if err != nil {
+		t.Fatalf("ResolveTrack: %v", err)
+	}
+	if match.ProviderTrackID != "t3" || match.Method != TrackMatchISRC || match.TrackID != "isrc:JPAB01234567" {
+		t.Fatalf("unexpected match: %+v", match)
+	}
+	if _, ok := matchRepository.matches["spotify|isrc:JPAB01234567"]; !ok {
+		t.Fatal("match was not cached")
+	}
+
+	if _, err := resolver.ResolveTrack("spotify", 1, song); err != nil {
+		t.Fatalf("ResolveTrack: %v", err)
+	}
+	if got := f.fake.RequestCount("/v1/search"); got != 1 {
+		t.Fatalf("search requests = %d, want 1 (second lookup should hit the cache)", got)
+	}
+}
+
+func TestTrackResolverFuzzyMatch(t *testing.T) {
+	f, _, matchRepository, resolver := newTrackResolverFixture(t)
+
+	// 付記の違いと1秒の長さの違いは許容する（他のプロバイダーから取り込んだ曲を想定し、TrackID のみ持たせる）
+	match, err := resolver.ResolveTrack("spotify", 1, repositories.Song{SongName: "Red Sun (2020 Remaster)", Artist: "Band C", SongLength: 181000, TrackID: "other:red-sun"})
+	if err != nil {
+		t.Fatalf("ResolveTrack: %v", err)
+	}
+	if match.ProviderTrackID != "t2" || match.Method != TrackMatchFuzzy || match.Score < trackMatchMinScore {
+		t.Fatalf("unexpected match: %+v", match)
+	}
+
+	// 別の曲は一致とみなさない
+	missing := repositories.Song{SongName: "Red Moon", Artist: "Someone Else", SongLength: 300000, TrackID: "other:red-moon"}
+	match, err = resolver.ResolveTrack("spotify", 1, missing)
+	if err != nil {
+		t.Fatalf("ResolveTrack: %v", err)
+	}
+	if match.ProviderTrackID != "" || match.Method != TrackMatchNone {
+		t.Fatalf("unexpected match: %+v", match)
+	}
+
+	// 見つからなかった結果は期限内はキャッシュを使い、期限を過ぎたら検索し直す
+	searches := f.fake.RequestCount("/v1/search")
+	if _, err := resolver.ResolveTrack("spotify", 1, missing); err != nil {
+		t.Fatalf("ResolveTrack: %v", err)
+	}
+	if got := f.fake.RequestCount("/v1/search"); got != searches {
+		t.Fatalf("search requests = %d, want %d", got, searches)
+	}
+	key := "spotify|other:red-moon"
+	cached := matchRepository.matches[key]
+	cached.Age = 48 * time.Hour
+	matchRepository.matches[key] = cached
+	if _, err := resolver.ResolveTrack("spotify", 1, missing); err != nil {
+		t.Fatalf("ResolveTrack: %v", err)
+	}
+	if got := f.fake.RequestCount("/v1/search"); got != searches+1 {
+		t.Fatalf("search requests = %d, want %d", got, searches+1)
+	}
+}
+
+func TestTrackResolverResolveRoomSongs(t *testing.T) {
+	_, roomRepository, _, resolver := newTrackResolverFixture(t)
+	roomID, _ := roomRepository.CreateRoom(repositories.RoomCreateInput{
+		RoomName:   "room",
+		HostUserID: 1,
+		Songs: map[string]repositories.Song{
+			"0": {SongId: "t1", SongName: "Blue Sky"},
+			"1": {SongName: "Green Field", Artist: "Band D", ISRC: "JPAB01234567"},
+		},
+	})
+
+	if _, err := resolver.ResolveRoomSongs(2, roomID, ""); !errors.Is(err, ErrNotRoomMember) {
+		t.Fatalf("err = %v, want ErrNotRoomMember", err)
+	}
+	if _, err := resolver.ResolveRoomSongs(1, roomID, "unknown"); err == nil {
+		t.Fatal("ResolveRoomSongs succeeded for an unknown provider")
+	}
+
+	matches, err := resolver.ResolveRoomSongs(1, roomID, "")
+	if err != nil {
+		t.Fatalf("ResolveRoomSongs: %v", err)
+	}
+	if len(matches) != 2 || matches["0"].ProviderTrackID != "t1" || matches["1"].ProviderTrackID != "t3" {
+		t.Fatalf("unexpected matches: %+v", matches)
+	}
+}
@@ -45,13 +45,13 @@ func SetAuthCookie(w http.ResponseWriter, userID int) error {
 }
 
 
-// cookieの有効期限の確認をし、userIDを返す。
-func CheckAuthCookie(r *http.Request) (int, error) {
+// cookieの有効期限の確認をし、userIDとトークンの発行時刻を返す。
+func CheckAuthCookie(r *http.Request) (int, time.Time, error) {
 	// jwt_token クッキーを取得
 	cookie, err := r.Cookie("jwt_token")
 	if err != nil {
 		log.Println("No jwt_token cookie found:", err)
-		return 0, fmt.Errorf("no jwt_token cookie found")
+		return 0, time.Time{}, fmt.Errorf("no jwt_token cookie found")
 	}
 	log.Printf("jwt_token cookie: %s\n", cookie.Value)
 
@@ -63,38 +63,51 @@ func CheckAuthCookie(r *http.Request) (int, error) {
 	})
 	if err != nil {
 		log.Println("Failed to parse JWT:", err)
-		return 0, fmt.Errorf("failed to parse JWT: %v", err)
+		return 0, time.Time{}, fmt.Errorf("failed to parse JWT: %v", err)
 	}
 
 	// トークンが無効な場合
 	if !token.Valid {
 		log.Println("Invalid JWT token")
-		return 0, fmt.Errorf("token is not valid")
+		return 0, time.Time{}, fmt.Errorf("token is not valid")
+	}
+
+	// 用途付きトークン（メール確認用など）はセッションとして扱わない
+	if _, hasPurpose := claims["purpose"]; hasPurpose {
+		log.Println("JWT is not a session token")
+		return 0, time.Time{}, fmt.Errorf("token is not a session token")
 	}
 
 	// 有効期限 (exp) を確認
 	expVal, ok := claims["exp"].(float64)
 	if !ok {
 		log.Println("JWT does not have an expiration claim")
-		return 0, fmt.Errorf("token does not have an expiration claim")
+		return 0, time.Time{}, fmt.Errorf("token does not have an expiration claim")
 	}
 	if time.Unix(int64(expVal), 0).Before(time.Now()) {
 		log.Println("JWT token has expired")
-		return 0, fmt.Errorf("token has expired")
+		return 0, time.Time{}, fmt.Errorf("token has expired")
 	}
 
 	// userId を取得
 	userIDFloat, ok := claims["userId"].(float64)
 	if !ok {
 		log.Println("Failed to get userId from JWT")
-		return 0, fmt.Errorf("failed to get userId from JWT")
+		return 0, time.Time{}, fmt.Errorf("failed to get userId from JWT")
 	}
 	userID := int(userIDFloat)
 	log.Printf("Authenticated user ID: %d\n", userID)
 
 	log.Println("userId", userID)
 
-	return userID, nil
+	// 発行時刻 (iat) はセッション失効の判定に利用する
+	iatVal, ok := claims["iat"].(float64)
+	if !ok {
+		log.Println("JWT does not have an issued-at claim")
+		return 0, time.Time{}, fmt.Errorf("token does not have an issued-at claim")
+	}
+
+	return userID, time.Unix(int64(iatVal), 0), nil
 }
 
 
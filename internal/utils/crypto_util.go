@@ -0,0 +1,169 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// TokenKeyring は、外部サービスのトークンを保存時に暗号化するための鍵束です。
+//
+// 値ごとにランダムなデータ鍵(DEK)で AES-256-GCM 暗号化し、DEK 自体を設定された
+// マスター鍵(KEK)で暗号化して一緒に保存します（エンベロープ暗号化）。
+// 保存形式は "<keyId>:<暗号化されたDEK>:<暗号文>"（いずれも base64url）で、
+// keyId により鍵のローテーション後も古い値を復号できます。
+type TokenKeyring struct {
+	keys        map[string][]byte
+	activeKeyID string
+}
+
+var keyIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// LoadTokenKeyringFromEnv は、次の環境変数から鍵束を読み込みます。
+//   - TOKEN_ENCRYPTION_KEYS: "keyId:base64(32byte鍵),keyId2:..." 形式のカンマ区切り
+//   - TOKEN_ENCRYPTION_ACTIVE_KEY_ID: 新規の暗号化に使用する keyId
+func LoadTokenKeyringFromEnv() (*TokenKeyring, error) {
+	return NewTokenKeyring(os.Getenv("TOKEN_ENCRYPTION_KEYS"), os.Getenv("TOKEN_ENCRYPTION_ACTIVE_KEY_ID"))
+}
+
+func NewTokenKeyring(keysSpec, activeKeyID string) (*TokenKeyring, error) {
+	keys := make(map[string][]byte)
+	for _, entry := range strings.Split(keysSpec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 2)
+		if len(parts) != 2 || !keyIDPattern.MatchString(parts[0]) {
+			return nil, fmt.Errorf("invalid token encryption key entry")
+		}
+		key, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("token encryption key %q must be 32 bytes base64", parts[0])
+		}
+		keys[parts[0]] = key
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("no token encryption keys configured")
+	}
+	if _, ok := keys[activeKeyID]; !ok {
+		return nil, fmt.Errorf("active token encryption key %q is not configured", activeKeyID)
+	}
+	return &TokenKeyring{keys: keys, activeKeyID: activeKeyID}, nil
+}
+
+// ActiveKeyID は新規の暗号化に使われる keyId を返します。
+func (k *TokenKeyring) ActiveKeyID() string {
+	return k.activeKeyID
+}
+
+// Encrypt は、アクティブな鍵でトークンを暗号化します。
+func (k *TokenKeyring) Encrypt(plaintext string) (string, error) {
+	dek := make([]byte, 32)
+	if _, err := rand.Read(dek); err != nil {
+		return "", fmt.Errorf("failed to generate data key: %v", err)
+	}
+
+	ciphertext, err := sealAESGCM(dek, []byte(plaintext), nil)
+	if err != nil {
+		return "", err
+	}
+	// DEK は keyId を追加認証データとして暗号化し、keyId の書き換えを検知できるようにする
+	wrappedKey, err := sealAESGCM(k.keys[k.activeKeyID], dek, []byte(k.activeKeyID))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Join([]string{
+		k.activeKeyID,
+		base64.RawURLEncoding.EncodeToString(wrappedKey),
+		base64.RawURLEncoding.EncodeToString(ciphertext),
+	}, ":"), nil
+}
+
+// Decrypt は、Encrypt で暗号化された値を復号します。
+// 暗号化導入前に Base64 エンコードのみで保存された値も復号できます。
+func (k *TokenKeyring) Decrypt(value string) (string, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) == 1 {
+		legacy, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return "", fmt.Errorf("failed to decode legacy token: %v", err)
+		}
+		return string(legacy), nil
+	}
+	if len(parts) != 3 {
+		return "", errors.New("malformed encrypted token")
+	}
+
+	kek, ok := k.keys[parts[0]]
+	if !ok {
+		return "", fmt.Errorf("token encryption key %q is not configured", parts[0])
+	}
+	wrappedKey, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", errors.New("malformed encrypted token")
+	}
+	ciphertext, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", errors.New("malformed encrypted token")
+	}
+
+	dek, err := openAESGCM(kek, wrappedKey, []byte(parts[0]))
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := openAESGCM(dek, ciphertext, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// NeedsRotation は、値がアクティブな鍵以外（または未暗号化）で保存されているかを返します。
+func (k *TokenKeyring) NeedsRotation(value string) bool {
+	return !strings.HasPrefix(value, k.activeKeyID+":")
+}
+
+// sealAESGCM は nonce を先頭に付与した AES-GCM 暗号文を返します。
+func sealAESGCM(key, plaintext, additionalData []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %v", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gcm: %v", err)
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %v", err)
+	}
+	return gcm.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func openAESGCM(key, sealed, additionalData []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %v", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gcm: %v", err)
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("malformed encrypted token")
+	}
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], additionalData)
+	if err != nil {
+		return nil, errors.New("failed to decrypt token")
+	}
+	return plaintext, nil
+}
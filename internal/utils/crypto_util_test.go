@@ -0,0 +1,148 @@
+package utils
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+var (
+	testKeyOld = base64.StdEncoding.EncodeToString([]byte(strings.Repeat("o", 32)))
+	testKeyNew = base64.StdEncoding.EncodeToString([]byte(strings.Repeat("n", 32)))
+)
+
+func mustKeyring(t *testing.T, keysSpec, activeKeyID string) *TokenKeyring {
+	t.Helper()
+	keyring, err := NewTokenKeyring(keysSpec, activeKeyID)
+	if err != nil {
+		t.Fatalf("NewTokenKeyring: %v", err)
+	}
+	return keyring
+}
+
+func TestNewTokenKeyringValidatesKeys(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		keysSpec string
+		activeID string
+	}{
+		{"no keys", "", "k1"},
+		{"missing active key", "k1:" + testKeyOld, "k2"},
+		{"short key", "k1:" + base64.StdEncoding.EncodeToString([]byte("short")), "k1"},
+		{"invalid key id", "k 1:" + testKeyOld, "k 1"},
+		{"not base64", "k1:!!!", "k1"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewTokenKeyring(tt.keysSpec, tt.activeID); err == nil {
+				t.Fatal("NewTokenKeyring accepted an invalid configuration")
+			}
+		})
+	}
+}
+
+func TestTokenKeyringEncryptDecrypt(t *testing.T) {
+	keyring := mustKeyring(t, "k1:"+testKeyOld, "k1")
+	for _, plaintext := range []string{"", "access-token", "トークン:with:colons"} {
+		encrypted, err := keyring.Encrypt(plaintext)
+		if err != nil {
+			t.Fatalf("Encrypt(%q): %v", plaintext, err)
+		}
+		if !strings.HasPrefix(encrypted, "k1:") {
+			t.Fatalf("Encrypt(%q) = %q, want the active key id as prefix", plaintext, encrypted)
+		}
+		decrypted, err := keyring.Decrypt(encrypted)
+		if err != nil || decrypted != plaintext {
+			t.Fatalf("Decrypt = (%q, %v), want %q", decrypted, err, plaintext)
+		}
+	}
+
+	// 同じ値でも暗号化のたびに異なる暗号文になる
+	a, _ := keyring.Encrypt("same")
+	b, _ := keyring.Encrypt("same")
+	if a == b {
+		t.Fatal("Encrypt returned the same ciphertext twice")
+	}
+}
+
+func TestTokenKeyringRejectsTamperedValues(t *testing.T) {
+	keyring := mustKeyring(t, "k1:"+testKeyOld+",k2:"+testKeyNew, "k1")
+	encrypted, err := keyring.Encrypt("access-token")
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	parts := strings.Split(encrypted, ":")
+
+	for _, tt := range []struct {
+		name  string
+		value string
+	}{
+		// keyId は DEK の追加認証データのため、別の鍵の ID に書き換えると復号できない
+		{"swapped key id", "k2:" + parts[1] + ":" + parts[2]},
+		{"unknown key id", "k3:" + parts[1] + ":" + parts[2]},
+		{"modified ciphertext", parts[0] + ":" + parts[1] + ":" + flipLastByte(t, parts[2])},
+		{"modified wrapped key", parts[0] + ":" + flipLastByte(t, parts[1]) + ":" + parts[2]},
+		{"too many parts", encrypted + ":extra"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := keyring.Decrypt(tt.value); err == nil {
+				t.Fatal("Decrypt accepted a tampered value")
+			}
+		})
+	}
+}
+
+func TestTokenKeyringRotation(t *testing.T) {
+	oldKeyring := mustKeyring(t, "old:"+testKeyOld, "old")
+	encryptedWithOld, err := oldKeyring.Encrypt("refresh-token")
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	legacy := base64.StdEncoding.EncodeToString([]byte("legacy-token"))
+
+	// 新しい鍵を追加してアクティブにした後も、古い鍵の値を復号できる
+	rotating := mustKeyring(t, "old:"+testKeyOld+",new:"+testKeyNew, "new")
+	encryptedWithNew, err := rotating.Encrypt("refresh-token")
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	for _, tt := range []struct {
+		name          string
+		value         string
+		want          string
+		needsRotation bool
+	}{
+		{"old key", encryptedWithOld, "refresh-token", true},
+		{"new key", encryptedWithNew, "refresh-token", false},
+		{"legacy base64", legacy, "legacy-token", true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rotating.NeedsRotation(tt.value); got != tt.needsRotation {
+				t.Fatalf("NeedsRotation = %t, want %t", got, tt.needsRotation)
+			}
+			decrypted, err := rotating.Decrypt(tt.value)
+			if err != nil || decrypted != tt.want {
+				t.Fatalf("Decrypt = (%q, %v), want %q", decrypted, err, tt.want)
+			}
+		})
+	}
+
+	// 古い鍵を設定から削除すると、再暗号化していない値は復号できない
+	rotated := mustKeyring(t, "new:"+testKeyNew, "new")
+	if _, err := rotated.Decrypt(encryptedWithOld); err == nil {
+		t.Fatal("Decrypt succeeded without the old key")
+	}
+	if decrypted, err := rotated.Decrypt(encryptedWithNew); err != nil || decrypted != "refresh-token" {
+		t.Fatalf("Decrypt = (%q, %v)", decrypted, err)
+	}
+}
+
+// flipLastByte は、base64url でエンコードされたデータの最後のバイトを反転します。
+func flipLastByte(t *testing.T, s string) string {
+	t.Helper()
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatalf("DecodeString: %v", err)
+	}
+	data[len(data)-1] ^= 0xff
+	return base64.RawURLEncoding.EncodeToString(data)
+}
@@ -0,0 +1,17 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+)
+
+// GeneratePKCEVerifier は PKCE (RFC 7636) の code_verifier を生成します（43文字）。
+func GeneratePKCEVerifier() (string, error) {
+	return GenerateRandomToken(32)
+}
+
+// PKCEChallenge は code_verifier から S256 方式の code_challenge を計算します。
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,40 @@
+package utils
+
+import "testing"
+
+func TestPKCEChallenge(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		verifier string
+		want     string
+	}{
+		// RFC 7636 付録 B
+		{"rfc7636", "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk", "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"},
+		{"empty", "", "47DEQpj8HBSa-_TImW-5JCeuQeRkm5NMpJWZG3hSuFU"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PKCEChallenge(tt.verifier); got != tt.want {
+				t.Fatalf("PKCEChallenge(%q) = %q, want %q", tt.verifier, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGeneratePKCEVerifier(t *testing.T) {
+	verifier, err := GeneratePKCEVerifier()
+	if err != nil {
+		t.Fatalf("GeneratePKCEVerifier: %v", err)
+	}
+	// RFC 7636 の code_verifier は 43〜128 文字の unreserved 文字
+	if len(verifier) != 43 {
+		t.Fatalf("len(verifier) = %d, want 43", len(verifier))
+	}
+	for _, r := range verifier {
+		if !(r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '.' || r == '_' || r == '~') {
+			t.Fatalf("verifier %q contains %q", verifier, r)
+		}
+	}
+	if other, _ := GeneratePKCEVerifier(); other == verifier {
+		t.Fatal("GeneratePKCEVerifier returned the same verifier twice")
+	}
+}
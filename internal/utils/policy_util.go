@@ -0,0 +1,19 @@
+package utils
+
+// メールアドレス未確認ユーザーに制限をかけられる操作
+const (
+	ActionCreateRoom = "create_room"
+)
+
+// IsRestrictedForUnverifiedUser は、メールアドレス未確認のユーザーに対して
+// 指定された操作が制限されているかを返します。
+// 制限対象は UNVERIFIED_USER_RESTRICTIONS（カンマ区切り、既定値: create_room）で設定します。
+// 空文字を設定すると制限なしになります。
+func IsRestrictedForUnverifiedUser(action string) bool {
+	for _, restricted := range GetEnvList("UNVERIFIED_USER_RESTRICTIONS", []string{ActionCreateRoom}) {
+		if restricted == action {
+			return true
+		}
+	}
+	return false
+}
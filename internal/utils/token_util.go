@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// 署名付きトークンの用途。用途が異なるトークンは相互に使い回せない。
+const (
+	TokenPurposeEmailVerification  = "email_verification"
+	TokenPurposeTwoFactorChallenge = "two_factor_challenge"
+)
+
+// generatePurposeToken は用途(purpose)と有効期限付きの署名済みトークンを発行します。
+func generatePurposeToken(purpose string, userID int, ttl time.Duration, extraClaims jwt.MapClaims) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":     "my-auth-server",
+		"purpose": purpose,
+		"userId":  userID,
+		"iat":     now.Unix(),
+		"exp":     now.Add(ttl).Unix(),
+	}
+	for key, value := range extraClaims {
+		claims[key] = value
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	tokenString, err := token.SignedString(jwtSecret)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token: %v", err)
+	}
+	return tokenString, nil
+}
+
+// parsePurposeToken は署名・有効期限・用途を検証し、userID と claims を返します。
+func parsePurposeToken(purpose, tokenString string) (int, jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return jwtSecret, nil
+	})
+	if err != nil || !token.Valid {
+		return 0, nil, fmt.Errorf("invalid or expired token")
+	}
+
+	if p, _ := claims["purpose"].(string); p != purpose {
+		return 0, nil, fmt.Errorf("token purpose mismatch")
+	}
+
+	userIDFloat, ok := claims["userId"].(float64)
+	if !ok {
+		return 0, nil, fmt.Errorf("failed to get userId from token")
+	}
+	return int(userIDFloat), claims, nil
+}
+
+// GenerateEmailVerificationToken はメールアドレス確認用のトークンを発行します。
+// メールアドレスを claims に含めるため、発行後にメールアドレスが変更された場合は無効になります。
+func GenerateEmailVerificationToken(userID int, email string) (string, error) {
+	ttl := GetEnvDuration("EMAIL_VERIFICATION_TOKEN_TTL", 24*time.Hour)
+	return generatePurposeToken(TokenPurposeEmailVerification, userID, ttl, jwt.MapClaims{"email": email})
+}
+
+// ParseEmailVerificationToken はメールアドレス確認用トークンを検証し、userID とメールアドレスを返します。
+func ParseEmailVerificationToken(tokenString string) (int, string, error) {
+	userID, claims, err := parsePurposeToken(TokenPurposeEmailVerification, tokenString)
+	if err != nil {
+		return 0, "", err
+	}
+	email, ok := claims["email"].(string)
+	if !ok || email == "" {
+		return 0, "", fmt.Errorf("failed to get email from token")
+	}
+	return userID, email, nil
+}
+
+// GenerateTwoFactorChallengeToken は、パスワード認証済みで二要素認証待ちのユーザーに発行するトークンです。
+// セッションクッキーとしては利用できません。
+func GenerateTwoFactorChallengeToken(userID int) (string, error) {
+	ttl := GetEnvDuration("TWO_FACTOR_CHALLENGE_TTL", 5*time.Minute)
+	return generatePurposeToken(TokenPurposeTwoFactorChallenge, userID, ttl, nil)
+}
+
+// ParseTwoFactorChallengeToken は二要素認証チャレンジトークンを検証し、userID を返します。
+func ParseTwoFactorChallengeToken(tokenString string) (int, error) {
+	userID, _, err := parsePurposeToken(TokenPurposeTwoFactorChallenge, tokenString)
+	return userID, err
+}
+
+// GenerateRandomToken は URL セーフなランダムトークンを生成します（DB には HashToken の値のみ保存する）。
+func GenerateRandomToken(byteLength int) (string, error) {
+	b := make([]byte, byteLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random token: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken はトークンの SHA-256 ハッシュ（16進文字列）を返します。
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,124 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP (RFC 6238) の設定。一般的な認証アプリの既定値（SHA1 / 6桁 / 30秒）に合わせる。
+const (
+	totpDigits = 6
+	totpPeriod = 30
+	// 時刻ずれを考慮して前後何ステップまで許容するか
+	totpSkew = 1
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// ErrPlaintextTOTPSecret は、暗号化されていない TOTP シークレットが保存されており、平文を受け付けない場合に返されます。
+var ErrPlaintextTOTPSecret = errors.New("totp secret is not encrypted; run rotate-token-keys")
+
+// DecryptTOTPSecret は、keyring で暗号化して保存された TOTP シークレットを復号します。
+// 暗号化導入前に平文（Base32）で保存された値は、allowPlaintext の場合のみそのまま返します
+// （rotate-token-keys で暗号化し終えるまでの移行期間用）。それ以外は ErrPlaintextTOTPSecret を返します。
+func DecryptTOTPSecret(keyring *TokenKeyring, value string, allowPlaintext bool) (string, error) {
+	if !strings.Contains(value, ":") {
+		if !allowPlaintext {
+			return "", ErrPlaintextTOTPSecret
+		}
+		return value, nil
+	}
+	return keyring.Decrypt(value)
+}
+
+// GenerateTOTPSecret は 160bit のランダムな TOTP シークレット（Base32）を生成します。
+func GenerateTOTPSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate totp secret: %v", err)
+	}
+	return totpEncoding.EncodeToString(b), nil
+}
+
+// BuildTOTPURI は認証アプリに登録するための otpauth URI を生成します。
+func BuildTOTPURI(issuer, accountName, secret string) string {
+	label := url.PathEscape(issuer + ":" + accountName)
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprintf("%d", totpDigits))
+	params.Set("period", fmt.Sprintf("%d", totpPeriod))
+	return fmt.Sprintf("otpauth://totp/%s?%s", label, params.Encode())
+}
+
+// ValidateTOTP はコードを検証し、一致した時間ステップを返します。
+// 呼び出し側は返されたステップを保存し、同じステップ以前のコードの再利用を拒否してください。
+func ValidateTOTP(secret, code string, now time.Time) (int64, bool) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return 0, false
+	}
+	code = strings.TrimSpace(code)
+	if len(code) != totpDigits {
+		return 0, false
+	}
+
+	current := now.Unix() / totpPeriod
+	for offset := int64(-totpSkew); offset <= totpSkew; offset++ {
+		step := current + offset
+		if subtle.ConstantTimeCompare([]byte(generateTOTPCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// generateTOTPCode は RFC 4226 の HOTP アルゴリズムでコードを生成します。
+func generateTOTPCode(key []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, value%mod)
+}
+
+// GenerateRecoveryCodes は "XXXXX-XXXXX" 形式のリカバリーコードを生成します。
+func GenerateRecoveryCodes(count int) ([]string, error) {
+	codes := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, fmt.Errorf("failed to generate recovery code: %v", err)
+		}
+		raw := totpEncoding.EncodeToString(b)[:10]
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+	}
+	return codes, nil
+}
+
+// NormalizeRecoveryCode は入力揺れ（大文字小文字・ハイフン・空白）を吸収します。
+func NormalizeRecoveryCode(code string) string {
+	code = strings.ToUpper(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.Join(strings.Fields(code), "")
+}
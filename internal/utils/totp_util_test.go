@@ -0,0 +1,155 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret は、RFC 6238 付録 B の SHA1 のテスト用シークレット "12345678901234567890" の Base32 です。
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// RFC 6238 付録 B の SHA1 のテストベクター（8桁の値の下6桁）
+var rfc6238Vectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestGenerateTOTPCodeMatchesRFC6238(t *testing.T) {
+	key := []byte("12345678901234567890")
+	for _, v := range rfc6238Vectors {
+		if got := generateTOTPCode(key, v.unix/totpPeriod); got != v.code {
+			t.Errorf("code at %d = %s, want %s", v.unix, got, v.code)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	for _, v := range rfc6238Vectors {
+		now := time.Unix(v.unix, 0)
+		step, ok := ValidateTOTP(rfc6238Secret, v.code, now)
+		if !ok || step != v.unix/totpPeriod {
+			t.Errorf("ValidateTOTP(%s at %d) = (%d, %t), want (%d, true)", v.code, v.unix, step, ok, v.unix/totpPeriod)
+		}
+	}
+
+	// 時刻ずれは前後1ステップまで許容し、一致したステップを返す
+	key := []byte("12345678901234567890")
+	now := time.Unix(1234567890, 0)
+	current := now.Unix() / totpPeriod
+	for _, tt := range []struct {
+		name   string
+		offset int64
+		ok     bool
+	}{
+		{"two steps behind", -2, false},
+		{"one step behind", -1, true},
+		{"current step", 0, true},
+		{"one step ahead", 1, true},
+		{"two steps ahead", 2, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			code := generateTOTPCode(key, current+tt.offset)
+			step, ok := ValidateTOTP(rfc6238Secret, code, now)
+			if ok != tt.ok {
+				t.Fatalf("ok = %t, want %t", ok, tt.ok)
+			}
+			if ok && step != current+tt.offset {
+				t.Fatalf("step = %d, want %d", step, current+tt.offset)
+			}
+		})
+	}
+}
+
+func TestValidateTOTPRejectsMalformedInput(t *testing.T) {
+	now := time.Unix(59, 0)
+	for _, tt := range []struct {
+		name   string
+		secret string
+		code   string
+	}{
+		{"wrong code", rfc6238Secret, "000000"},
+		{"short code", rfc6238Secret, "28708"},
+		{"eight digit code", rfc6238Secret, "94287082"},
+		{"invalid secret", "not base32!", "287082"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := ValidateTOTP(tt.secret, tt.code, now); ok {
+				t.Fatal("ValidateTOTP accepted the code")
+			}
+		})
+	}
+
+	// 前後の空白と小文字のシークレットは受け付ける
+	if _, ok := ValidateTOTP(strings.ToLower(rfc6238Secret), " 287082 ", now); !ok {
+		t.Fatal("ValidateTOTP rejected a lower case secret or a code with spaces")
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes: %v", err)
+	}
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Fatalf("code %q is not in XXXXX-XXXXX form", code)
+		}
+		if seen[code] {
+			t.Fatalf("duplicate recovery code %q", code)
+		}
+		seen[code] = true
+	}
+
+	for _, tt := range []struct {
+		input string
+		want  string
+	}{
+		{"ABCDE-FGHIJ", "ABCDEFGHIJ"},
+		{"abcde-fghij", "ABCDEFGHIJ"},
+		{" abcde fghij ", "ABCDEFGHIJ"},
+		{"ABCDEFGHIJ", "ABCDEFGHIJ"},
+	} {
+		if got := NormalizeRecoveryCode(tt.input); got != tt.want {
+			t.Errorf("NormalizeRecoveryCode(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestDecryptTOTPSecret(t *testing.T) {
+	keyring := mustKeyring(t, "k1:"+testKeyOld, "k1")
+	encrypted, err := keyring.Encrypt(rfc6238Secret)
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+
+	for _, tt := range []struct {
+		name           string
+		value          string
+		allowPlaintext bool
+		want           string
+		wantErr        error
+	}{
+		{"encrypted", encrypted, false, rfc6238Secret, nil},
+		{"encrypted while migrating", encrypted, true, rfc6238Secret, nil},
+		// 平文は移行期間として明示的に許可した場合だけ受け付ける
+		{"plaintext", rfc6238Secret, false, "", ErrPlaintextTOTPSecret},
+		{"plaintext while migrating", rfc6238Secret, true, rfc6238Secret, nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecryptTOTPSecret(keyring, tt.value, tt.allowPlaintext)
+			if !errors.Is(err, tt.wantErr) || got != tt.want {
+				t.Fatalf("DecryptTOTPSecret = (%q, %v), want (%q, %v)", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
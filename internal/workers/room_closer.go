@@ -0,0 +1,36 @@
+package workers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"music-share-api/internal/services"
+)
+
+// RoomCloser は、空室や再生操作のない状態が続いたルームを定期的に閉じるワーカーです。
+type RoomCloser struct {
+	lifecycleService services.RoomLifecycleService
+	interval         time.Duration
+}
+
+func NewRoomCloser(lifecycleService services.RoomLifecycleService, interval time.Duration) *RoomCloser {
+	return &RoomCloser{lifecycleService: lifecycleService, interval: interval}
+}
+
+// Start は ctx がキャンセルされるまで interval ごとに RunOnce を実行します。
+func (w *RoomCloser) Start(ctx context.Context) {
+	RunEvery(ctx, w.interval, w.RunOnce)
+}
+
+// RunOnce は、閉じる対象のルームを1回分スキャンして閉じます。
+func (w *RoomCloser) RunOnce() {
+	closed, err := w.lifecycleService.CloseInactiveRooms()
+	if err != nil {
+		log.Printf("Room closer: failed to close inactive rooms: %v", err)
+		return
+	}
+	for _, room := range closed {
+		log.Printf("Room closer: closed room %d (%s)", room.RoomID, room.Reason)
+	}
+}
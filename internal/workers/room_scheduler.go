@@ -0,0 +1,36 @@
+package workers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"music-share-api/internal/services"
+)
+
+// RoomScheduler は、開始時刻になった予約のルームを定期的に開くワーカーです。
+type RoomScheduler struct {
+	scheduleService services.RoomScheduleService
+	interval        time.Duration
+}
+
+func NewRoomScheduler(scheduleService services.RoomScheduleService, interval time.Duration) *RoomScheduler {
+	return &RoomScheduler{scheduleService: scheduleService, interval: interval}
+}
+
+// Start は ctx がキャンセルされるまで interval ごとに RunOnce を実行します。
+func (w *RoomScheduler) Start(ctx context.Context) {
+	RunEvery(ctx, w.interval, w.RunOnce)
+}
+
+// RunOnce は、開始時刻になった予約を1回分スキャンしてルームを開きます。
+func (w *RoomScheduler) RunOnce() {
+	opened, err := w.scheduleService.OpenDueRooms()
+	if err != nil {
+		log.Printf("Room scheduler: failed to open scheduled rooms: %v", err)
+		return
+	}
+	for _, schedule := range opened {
+		log.Printf("Room scheduler: opened room %d for schedule %d (notified %d users)", schedule.RoomID, schedule.ScheduleID, schedule.Notified)
+	}
+}
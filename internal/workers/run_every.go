@@ -0,0 +1,21 @@
+package workers
+
+import (
+	"context"
+	"time"
+)
+
+// RunEvery は、すぐに fn を1回実行し、その後 ctx がキャンセルされるまで interval ごとに実行します。
+func RunEvery(ctx context.Context, interval time.Duration, fn func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		fn()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"music-share-api/internal/repositories"
+	"music-share-api/internal/services"
+)
+
+// TokenRefresher は、有効期限が近い外部サービスのトークンを定期的に更新するワーカーです。
+// サーバー側からユーザーの代わりにプロバイダーを呼び出す機能が、期限切れのトークンを使わないようにする。
+type TokenRefresher struct {
+	serviceRepository repositories.ServiceRepository
+	musicService      services.MusicService
+	// interval はスキャン間隔、window は「期限が近い」とみなす残り時間
+	interval  time.Duration
+	window    time.Duration
+	batchSize int
+}
+
+func NewTokenRefresher(serviceRepository repositories.ServiceRepository, musicService services.MusicService, interval, window time.Duration, batchSize int) *TokenRefresher {
+	return &TokenRefresher{
+		serviceRepository: serviceRepository,
+		musicService:      musicService,
+		interval:          interval,
+		window:            window,
+		batchSize:         batchSize,
+	}
+}
+
+// Start は ctx がキャンセルされるまで interval ごとに RunOnce を実行します。
+func (w *TokenRefresher) Start(ctx context.Context) {
+	RunEvery(ctx, w.interval, w.RunOnce)
+}
+
+// RunOnce は、期限が近いトークンを1回分スキャンして更新します。
+func (w *TokenRefresher) RunOnce() {
+	loc, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		log.Printf("Token refresher: failed to load JST location: %v", err)
+		return
+	}
+	// expires_at は JST で保存されているため、JST 基準で期限を計算する
+	expiresBefore := time.Now().In(loc).Add(w.window)
+
+	for _, provider := range w.musicService.ProviderNames() {
+		w.refreshProvider(provider, expiresBefore)
+	}
+}
+
+func (w *TokenRefresher) refreshProvider(provider string, expiresBefore time.Time) {
+	userIDs, err := w.serviceRepository.ListExpiringServiceUsers(provider, expiresBefore, w.batchSize)
+	if err != nil {
+		log.Printf("Token refresher: failed to list expiring %s tokens: %v", provider, err)
+		return
+	}
+
+	for _, userID := range userIDs {
+		refreshed, err := w.musicService.RefreshTokenIfExpiring(provider, userID, w.window)
+		switch {
+		case errors.Is(err, services.ErrRefreshInProgress):
+			// 別のリクエストが更新中なので次回のスキャンに任せる
+		case errors.Is(err, services.ErrConnectionBroken):
+			log.Printf("Token refresher: %s connection for user %d is broken", provider, userID)
+		case err != nil:
+			log.Printf("Token refresher: failed to refresh %s token for user %d: %v", provider, userID, err)
+		case refreshed:
+			log.Printf("Token refresher: refreshed %s token for user %d", provider, userID)
+		}
+	}
+}
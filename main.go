@@ -1,14 +1,21 @@
 package main
 
 import (
+	"context"
+	"expvar"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 
 	"music-share-api/internal/controllers"
+	"music-share-api/internal/mailer"
 	"music-share-api/internal/middlewares"
+	"music-share-api/internal/providers"
 	"music-share-api/internal/repositories"
 	"music-share-api/internal/services"
+	"music-share-api/internal/utils"
+	"music-share-api/internal/workers"
 
 	"time"
 
@@ -48,24 +55,131 @@ func main() {
 		DB:       0,                // デフォルトのDB
 	})
 
+	// メール送信（MAILER=smtp で SMTP、それ以外はログ出力）
+	appMailer := mailer.NewMailerFromEnv()
+
+	// 外部サービスのトークン暗号化用の鍵を読み込む
+	tokenKeyring, err := utils.LoadTokenKeyringFromEnv()
+	if err != nil {
+		log.Fatal("Failed to load token encryption keys:", err)
+	}
+
+	// 音楽配信サービス（プロバイダー）のセットアップ。新しいプロバイダーはここで登録する
+	providerRegistry := providers.NewRegistry(
+		providers.NewSpotifyProvider(providers.SpotifyConfig{
+			ClientID:     os.Getenv("SPOTIFY_CLIENT_ID"),
+			ClientSecret: os.Getenv("SPOTIFY_CLIENT_SECRET"),
+			// プレイリストの書き出しには playlist-modify-* が必要
+			Scopes: utils.GetEnv("SPOTIFY_SCOPES", "user-read-email user-read-private playlist-modify-private playlist-modify-public user-read-playback-state user-modify-playback-state"),
+			// 未設定の場合は本番の Spotify が使われる（ローカル検証ではフェイクサーバーを指定できる）
+			AccountsBaseURL: os.Getenv("SPOTIFY_ACCOUNTS_BASE_URL"),
+			APIBaseURL:      os.Getenv("SPOTIFY_API_BASE_URL"),
+			// Retry-After の尊重・再試行・サーキットブレーカーを備えたクライアントで送る
+			HTTPClient: providers.NewResilientClient(nil, providers.TransportConfig{
+				Name:             "spotify",
+				MaxRetries:       utils.GetEnvInt("PROVIDER_HTTP_MAX_RETRIES", 2),
+				BaseBackoff:      utils.GetEnvDuration("PROVIDER_HTTP_BASE_BACKOFF", 200*time.Millisecond),
+				MaxBackoff:       utils.GetEnvDuration("PROVIDER_HTTP_MAX_BACKOFF", 5*time.Second),
+				MaxRetryAfter:    utils.GetEnvDuration("PROVIDER_HTTP_MAX_RETRY_AFTER", 10*time.Second),
+				AttemptTimeout:   utils.GetEnvDuration("PROVIDER_HTTP_ATTEMPT_TIMEOUT", 10*time.Second),
+				FailureThreshold: utils.GetEnvInt("PROVIDER_HTTP_FAILURE_THRESHOLD", 5),
+				OpenDuration:     utils.GetEnvDuration("PROVIDER_HTTP_OPEN_DURATION", 30*time.Second),
+			}),
+		}),
+	)
+
+	// music serviceのセットアップ（Spotifyサインインで authService からも利用する）
+	serviceRepository := repositories.NewServiceRepository(db.DB, redisClient)
+	musicService := services.NewMusicService(serviceRepository, providerRegistry, tokenKeyring)
+	serviceController := controllers.NewServiceController(musicService)
+
 	// リポジトリ、サービス、コントローラのセットアップ
-	authRepository := repositories.NewAuthRepository(db.DB)
-	authService := services.NewAuthService(authRepository)
+	authRepository := repositories.NewAuthRepository(db.DB, redisClient)
+	authService := services.NewAuthService(authRepository, appMailer, musicService, tokenKeyring)
 	authController := controllers.NewAuthController(authService)
 
+	// ジャンル（マスタ）とタグ
+	genreRepository := repositories.NewGenreRepository(db.DB)
+	genreService := services.NewGenreService(genreRepository)
+	genreController := controllers.NewGenreController(genreService)
+
 	roomsRepository := repositories.NewRoomsRepository(db.DB)
-	roomsService := services.NewRoomsService(roomsRepository)
+	roomsService := services.NewRoomsService(roomsRepository, genreService)
 	roomsController := controllers.NewRoomsController(roomsService)
 
+	// おすすめのルーム（参加履歴から計算する）
+	recommendationRepository := repositories.NewRecommendationRepository(db.DB)
+	recommendationService := services.NewRecommendationService(recommendationRepository)
+	recommendationController := controllers.NewRecommendationController(recommendationService)
+
+	// ルームの再生記録（trx_room_plays）
+	playLogRepository := repositories.NewPlayLogRepository(db.DB)
+	playLogService := services.NewPlayLogService(playLogRepository)
+	historyController := controllers.NewHistoryController(playLogService)
+
+	// ユーザーごとの視聴履歴と統計（参加履歴と再生記録から集計する）
+	listeningRepository := repositories.NewListeningRepository(db.DB)
+	listeningService := services.NewListeningService(listeningRepository)
+	listeningController := controllers.NewListeningController(listeningService)
+
 	// room作成用のセットアップ (Redisクライアントを追加)
 	roomRepository := repositories.NewRoomRepository(db.DB, redisClient)
-	roomService := services.NewRoomService(roomRepository)
-	roomController := controllers.NewRoomController(roomService)
+	roomService := services.NewRoomService(roomRepository, musicService, genreService, playLogRepository)
+
+	// ルームのテンプレートと複製
+	roomTemplateRepository := repositories.NewRoomTemplateRepository(db.DB)
+	roomTemplateService := services.NewRoomTemplateService(roomTemplateRepository, roomService)
+	roomTemplateController := controllers.NewRoomTemplateController(roomTemplateService)
+
+	// ルームのリアルタイムイベントと再生同期
+	roomEventRepository := repositories.NewRoomEventRepository(redisClient)
+	roomEventService := services.NewRoomEventService(roomEventRepository, roomRepository)
+	roomEventController := controllers.NewRoomEventController(roomEventService)
+	playbackService := services.NewPlaybackService(roomRepository, roomEventService, musicService, playLogService)
+	playbackController := controllers.NewPlaybackController(playbackService)
 
-	// Spotify serviceのセットアップ
-	serviceRepository := repositories.NewServiceRepository(db.DB)
-	spotifyService := services.NewSpotifyService(serviceRepository)
-	serviceController := controllers.NewServiceController(spotifyService)
+	// ルーム内のチャット（直近は Redis の Stream、全件は MySQL に保存し、ルームのイベントで配信する）
+	roomMessageRepository := repositories.NewRoomMessageRepository(db.DB, redisClient)
+	roomMessageService := services.NewRoomMessageService(roomMessageRepository, roomRepository, roomEventService)
+	roomMessageController := controllers.NewRoomMessageController(roomMessageService)
+
+	// プロバイダー間の曲の対応付け（ISRC・曖昧一致、結果は MySQL にキャッシュ）
+	trackMatchRepository := repositories.NewTrackMatchRepository(db.DB)
+	trackResolverService := services.NewTrackResolverService(trackMatchRepository, roomRepository, musicService)
+	trackController := controllers.NewTrackController(trackResolverService)
+
+	// 曲検索のセットアップ（よく検索されるクエリは Redis にキャッシュする）
+	searchRepository := repositories.NewSearchRepository(redisClient)
+	searchService := services.NewSearchService(searchRepository, musicService)
+	searchController := controllers.NewSearchController(searchService)
+
+	// 期限が近い各プロバイダーのトークンをバックグラウンドで更新する
+	tokenRefresher := workers.NewTokenRefresher(
+		serviceRepository,
+		musicService,
+		utils.GetEnvDuration("TOKEN_REFRESH_INTERVAL", time.Minute),
+		utils.GetEnvDuration("TOKEN_REFRESH_WINDOW", 10*time.Minute),
+		utils.GetEnvInt("TOKEN_REFRESH_BATCH_SIZE", 100),
+	)
+	go tokenRefresher.Start(context.Background())
+
+	// 空室や再生操作のない状態が続いたルームを自動で閉じる（しきい値は ROOM_EMPTY_TIMEOUT・ROOM_IDLE_TIMEOUT）
+	roomLifecycleRepository := repositories.NewRoomLifecycleRepository(db.DB, redisClient)
+	roomLifecycleService := services.NewRoomLifecycleService(roomLifecycleRepository, roomEventService)
+	roomCloser := workers.NewRoomCloser(roomLifecycleService, utils.GetEnvDuration("ROOM_LIFECYCLE_INTERVAL", time.Minute))
+	go roomCloser.Start(context.Background())
+	// ルームの削除・復元は、自動で閉じる処理と同じ状態遷移（Redis の状態の退避・参加者への通知）で行う
+	roomController := controllers.NewRoomController(roomService, roomLifecycleService, authService)
+
+	// 開始時刻を予約したルーム（開始時刻になったら作成して参加表明したユーザーに通知する）
+	roomScheduleRepository := repositories.NewRoomScheduleRepository(db.DB)
+	roomScheduleService := services.NewRoomScheduleService(roomScheduleRepository, roomService, appMailer)
+	roomScheduleController := controllers.NewRoomScheduleController(roomScheduleService)
+	roomScheduler := workers.NewRoomScheduler(roomScheduleService, utils.GetEnvDuration("ROOM_SCHEDULE_INTERVAL", 30*time.Second))
+	go roomScheduler.Start(context.Background())
+
+	// 認証ミドルウェア（失効したセッションの判定に authService を利用）
+	authMiddleware := middlewares.AuthMiddleware(authService)
 
 	// Ginルーター設定
 	r := gin.Default()
@@ -81,26 +195,86 @@ func main() {
 	}))
 
 	// auth
-	r.GET("/auth/user-info", middlewares.AuthMiddleware(), authController.GetUserInfo)
+	r.GET("/auth/user-info", authMiddleware, authController.GetUserInfo)
 	r.POST("/auth/sign-up", authController.SignUp)
 	r.POST("/auth/sign-in", authController.SignIn)
 	r.DELETE("/auth/sign-out", authController.SignOut)
-	r.PUT("/auth/update-profile", authController.UpdateProfile)
+	r.PUT("/auth/update-profile", authMiddleware, authController.UpdateProfile)
+	r.POST("/auth/verify-email", authController.VerifyEmail)
+	r.POST("/auth/resend-verification", authMiddleware, authController.ResendVerificationEmail)
+	r.POST("/auth/forgot-password", authController.ForgotPassword)
+	r.POST("/auth/reset-password", authController.ResetPassword)
+	r.POST("/auth/change-password", authMiddleware, authController.ChangePassword)
+	r.GET("/auth/spotify/authorize", authController.SpotifyLoginAuthorize)
+	r.POST("/auth/spotify/sign-in", authController.SignInWithSpotify)
+	r.POST("/auth/2fa/verify", authController.VerifyTwoFactor)
+	r.POST("/auth/2fa/enroll", authMiddleware, authController.EnrollTwoFactor)
+	r.POST("/auth/2fa/activate", authMiddleware, authController.ActivateTwoFactor)
+	r.POST("/auth/2fa/disable", authMiddleware, authController.DisableTwoFactor)
 
-	// Spotify
-	r.POST("/spotify/connect", serviceController.SpotifyConnect)
-	r.DELETE("/spotify/disconnect", serviceController.DisconnectSpotify)
-	r.POST("/spotify/refresh-token", serviceController.RefreshSpotifyToken)
+	// 音楽配信サービス連携（:provider は "spotify" など）
+	r.GET("/services/:provider/authorize", authMiddleware, serviceController.Authorize)
+	r.POST("/services/:provider/connect", authMiddleware, serviceController.Connect)
+	r.DELETE("/services/:provider/disconnect", authMiddleware, serviceController.Disconnect)
+	r.POST("/services/:provider/refresh-token", authMiddleware, serviceController.RefreshToken)
+	// 旧クライアント向けに /spotify/* を1リリースの間だけ残す（次のリリースで削除する）
+	r.GET("/spotify/authorize", authMiddleware, controllers.WithProvider("spotify", serviceController.Authorize))
+	r.POST("/spotify/connect", authMiddleware, controllers.WithProvider("spotify", serviceController.Connect))
+	r.DELETE("/spotify/disconnect", authMiddleware, controllers.WithProvider("spotify", serviceController.Disconnect))
+	r.POST("/spotify/refresh-token", authMiddleware, controllers.WithProvider("spotify", serviceController.RefreshToken))
+
+	// users
+	r.GET("/users/me/history", authMiddleware, listeningController.GetMyHistory)
+	r.GET("/users/me/stats", authMiddleware, listeningController.GetMyStats)
+
+	// search
+	r.GET("/search/tracks", authMiddleware, searchController.SearchTracks)
+
+	// genres
+	r.GET("/genres", genreController.ListGenres)
 
 	// rooms
-	r.GET("/rooms/public", middlewares.AuthMiddleware(), roomsController.GetPublicRooms)
+	r.GET("/rooms/public", authMiddleware, roomsController.GetPublicRooms)
+	r.GET("/rooms/recommended", authMiddleware, recommendationController.RecommendRooms)
+	r.GET("/rooms/upcoming", authMiddleware, roomScheduleController.ListUpcoming)
 
 	// room
-	r.POST("/room/create", roomController.CreateRoom)
-	r.POST("/room/join", middlewares.AuthMiddleware(), roomController.JoinRoom)
-	r.POST("/room/leave", roomController.LeaveRoom)
-	r.DELETE("/room/delete/:roomId", roomController.DeleteRoom)
+	r.POST("/room/create", authMiddleware, middlewares.RequireVerifiedEmail(authService, utils.ActionCreateRoom), roomController.CreateRoom)
+	r.POST("/room/schedule", authMiddleware, middlewares.RequireVerifiedEmail(authService, utils.ActionCreateRoom), roomScheduleController.ScheduleRoom)
+	r.DELETE("/room/schedule/:scheduleId", authMiddleware, roomScheduleController.CancelSchedule)
+	r.POST("/room/schedule/:scheduleId/rsvp", authMiddleware, roomScheduleController.RSVP)
+	r.DELETE("/room/schedule/:scheduleId/rsvp", authMiddleware, roomScheduleController.CancelRSVP)
+	r.POST("/room/templates", authMiddleware, roomTemplateController.SaveTemplate)
+	r.GET("/room/templates", authMiddleware, roomTemplateController.ListTemplates)
+	r.DELETE("/room/templates/:templateId", authMiddleware, roomTemplateController.DeleteTemplate)
+	r.POST("/room/templates/:templateId/rooms", authMiddleware, middlewares.RequireVerifiedEmail(authService, utils.ActionCreateRoom), roomTemplateController.CreateRoomFromTemplate)
+	r.POST("/room/join", authMiddleware, roomController.JoinRoom)
+	r.POST("/room/leave", authMiddleware, roomController.LeaveRoom)
+	r.DELETE("/room/delete/:roomId", authMiddleware, roomController.DeleteRoom)
 	r.GET("/room/:roomId", roomController.GetRoom)
+	r.POST("/room/:roomId/import", authMiddleware, roomController.ImportPlaylist)
+	r.POST("/room/:roomId/export", authMiddleware, roomController.ExportPlaylist)
+	r.POST("/room/:roomId/restore", authMiddleware, middlewares.RequireAdmin(authService), roomController.RestoreRoom)
+	r.POST("/room/:roomId/clone", authMiddleware, middlewares.RequireVerifiedEmail(authService, utils.ActionCreateRoom), roomTemplateController.CloneRoom)
+	r.GET("/room/:roomId/events", authMiddleware, roomEventController.StreamEvents)
+	r.POST("/room/:roomId/playback", authMiddleware, playbackController.UpdatePlayback)
+	r.PUT("/room/:roomId/playback-sync", authMiddleware, playbackController.SetPlaybackSync)
+	r.GET("/room/:roomId/songs/matches", authMiddleware, trackController.ResolveRoomSongs)
+	r.GET("/room/:roomId/history", authMiddleware, historyController.GetRoomHistory)
+	r.POST("/room/:roomId/messages", authMiddleware, roomMessageController.SendMessage)
+	r.GET("/room/:roomId/messages", authMiddleware, roomMessageController.ListMessages)
+	r.DELETE("/room/:roomId/messages/:messageId", authMiddleware, roomMessageController.DeleteMessage)
+
+	// メトリクス（/debug/vars）は公開ポートとは別の、内部向けのアドレスで配信する。"off" にすると無効
+	if metricsAddr := utils.GetEnv("METRICS_ADDR", "127.0.0.1:9100"); metricsAddr != "off" {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/debug/vars", expvar.Handler())
+		go func() {
+			if err := http.ListenAndServe(metricsAddr, metricsMux); err != nil {
+				log.Printf("Metrics server stopped: %v", err)
+			}
+		}()
+	}
 
 	// サーバー起動
 	r.Run(":8080")
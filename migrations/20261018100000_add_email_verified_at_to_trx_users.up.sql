@@ -0,0 +1,7 @@
+ALTER TABLE trx_users
+    ADD COLUMN email_verified_at TIMESTAMP NULL DEFAULT NULL AFTER email;
+
+-- email_verified_at の追加前から登録済みのユーザーは確認済みとして扱う（ルームの作成などが止まらないようにする）
+UPDATE trx_users
+SET email_verified_at = COALESCE(created_at, CURRENT_TIMESTAMP)
+WHERE email_verified_at IS NULL;
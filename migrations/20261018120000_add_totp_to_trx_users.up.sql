@@ -0,0 +1,14 @@
+ALTER TABLE trx_users
+    ADD COLUMN totp_secret VARCHAR(255) NULL DEFAULT NULL AFTER sessions_revoked_at,
+    ADD COLUMN totp_enabled_at TIMESTAMP NULL DEFAULT NULL AFTER totp_secret,
+    ADD COLUMN totp_last_step BIGINT NOT NULL DEFAULT 0 AFTER totp_enabled_at;
+
+CREATE TABLE trx_users_recovery_codes (
+    code_id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    code_hash CHAR(64) NOT NULL,
+    used_at TIMESTAMP NULL DEFAULT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_recovery_codes_user_hash (user_id, code_hash),
+    FOREIGN KEY (user_id) REFERENCES trx_users(user_id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,4 @@
+-- エンベロープ暗号化により保存値が長くなるため、トークン列を拡張する
+ALTER TABLE trx_users_services
+    MODIFY COLUMN encrypted_access_token VARCHAR(2048) NOT NULL,
+    MODIFY COLUMN encrypted_refresh_token VARCHAR(2048) NOT NULL;
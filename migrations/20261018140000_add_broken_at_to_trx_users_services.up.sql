@@ -0,0 +1,4 @@
+ALTER TABLE trx_users_services
+    ADD COLUMN broken_at TIMESTAMP NULL DEFAULT NULL AFTER expires_at,
+    ADD COLUMN broken_reason VARCHAR(255) NULL DEFAULT NULL AFTER broken_at,
+    ADD INDEX idx_users_services_expires_at (service_name, expires_at);
@@ -0,0 +1,2 @@
+ALTER TABLE trx_users
+    DROP COLUMN is_spotify;
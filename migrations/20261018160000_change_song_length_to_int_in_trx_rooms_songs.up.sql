@@ -0,0 +1,10 @@
+-- song_length は曲の長さ（ミリ秒）を保存する。TIMESTAMP では整数の長さを保存できないため INT に変更する
+-- 既存の TIMESTAMP の値は長さとして読めないため、MODIFY で変換せず新しい列に置き換える（既存の曲の長さは 0 = 不明 とする）
+ALTER TABLE trx_rooms_songs
+    ADD COLUMN song_length_ms INT NOT NULL DEFAULT 0 AFTER song_length;
+
+ALTER TABLE trx_rooms_songs
+    DROP COLUMN song_length;
+
+ALTER TABLE trx_rooms_songs
+    CHANGE COLUMN song_length_ms song_length INT NOT NULL DEFAULT 0;
@@ -0,0 +1,9 @@
+-- isrc はプロバイダー共通の曲コード、track_id はプロバイダーに依存しない曲ID
+-- （ISRC があれば "isrc:<ISRC>"、なければ "<provider>:<プロバイダーの曲ID>"）
+ALTER TABLE trx_rooms_songs
+    ADD COLUMN isrc VARCHAR(12) NOT NULL DEFAULT '' AFTER song_id,
+    ADD COLUMN track_id VARCHAR(255) NOT NULL DEFAULT '' AFTER isrc,
+    ADD INDEX idx_rooms_songs_track_id (track_id);
+
+-- 既存の曲はすべて Spotify から取り込んだもの
+UPDATE trx_rooms_songs SET track_id = CONCAT('spotify:', song_id) WHERE track_id = '';
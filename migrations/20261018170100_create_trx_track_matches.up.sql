@@ -0,0 +1,11 @@
+-- プロバイダー間の曲の対応付け（ISRC 検索・曖昧一致）の結果をキャッシュする
+-- provider_track_id が空の行は、見つからなかったことを表す
+CREATE TABLE trx_track_matches (
+    track_id VARCHAR(255) NOT NULL,
+    provider VARCHAR(32) NOT NULL,
+    provider_track_id VARCHAR(255) NOT NULL DEFAULT '',
+    match_method VARCHAR(16) NOT NULL,
+    score DOUBLE NOT NULL DEFAULT 0,
+    matched_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (track_id, provider)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
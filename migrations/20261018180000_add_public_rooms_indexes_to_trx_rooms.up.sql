@@ -0,0 +1,6 @@
+-- 公開ルーム一覧の並び順（キーの降順 + room_id の降順）ごとのインデックス
+ALTER TABLE trx_rooms
+    ADD INDEX idx_trx_rooms_public_created (is_public, deleted_at, created_at, room_id),
+    ADD INDEX idx_trx_rooms_public_activity (is_public, deleted_at, updated_at, room_id),
+    ADD INDEX idx_trx_rooms_public_participants (is_public, deleted_at, now_participants, room_id),
+    ADD INDEX idx_trx_rooms_genre (genre);
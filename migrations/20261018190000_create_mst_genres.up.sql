@@ -0,0 +1,43 @@
+-- ルームのジャンル（管理対象のマスタ）。trx_rooms.genre には genre_code を保存する
+CREATE TABLE mst_genres (
+    genre_code VARCHAR(50) PRIMARY KEY,
+    sort_order INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- ジャンルの表示名（ロケールごと）
+CREATE TABLE mst_genre_names (
+    genre_code VARCHAR(50) NOT NULL,
+    locale VARCHAR(10) NOT NULL,
+    display_name VARCHAR(100) NOT NULL,
+    PRIMARY KEY (genre_code, locale),
+    FOREIGN KEY (genre_code) REFERENCES mst_genres(genre_code) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+INSERT INTO mst_genres (genre_code, sort_order) VALUES
+    ('j-pop', 10), ('k-pop', 20), ('pop', 30), ('rock', 40), ('hip-hop', 50),
+    ('r-and-b', 60), ('electronic', 70), ('jazz', 80), ('classical', 90), ('anime', 100),
+    ('vocaloid', 110), ('idol', 120), ('metal', 130), ('punk', 140), ('reggae', 150),
+    ('latin', 160), ('folk', 170), ('soundtrack', 180), ('lo-fi', 190), ('other', 1000);
+
+INSERT INTO mst_genre_names (genre_code, locale, display_name) VALUES
+    ('j-pop', 'ja', 'J-POP'), ('j-pop', 'en', 'J-Pop'),
+    ('k-pop', 'ja', 'K-POP'), ('k-pop', 'en', 'K-Pop'),
+    ('pop', 'ja', 'ポップ'), ('pop', 'en', 'Pop'),
+    ('rock', 'ja', 'ロック'), ('rock', 'en', 'Rock'),
+    ('hip-hop', 'ja', 'ヒップホップ'), ('hip-hop', 'en', 'Hip-Hop'),
+    ('r-and-b', 'ja', 'R&B'), ('r-and-b', 'en', 'R&B'),
+    ('electronic', 'ja', 'エレクトロニック'), ('electronic', 'en', 'Electronic'),
+    ('jazz', 'ja', 'ジャズ'), ('jazz', 'en', 'Jazz'),
+    ('classical', 'ja', 'クラシック'), ('classical', 'en', 'Classical'),
+    ('anime', 'ja', 'アニメ'), ('anime', 'en', 'Anime'),
+    ('vocaloid', 'ja', 'ボカロ'), ('vocaloid', 'en', 'Vocaloid'),
+    ('idol', 'ja', 'アイドル'), ('idol', 'en', 'Idol'),
+    ('metal', 'ja', 'メタル'), ('metal', 'en', 'Metal'),
+    ('punk', 'ja', 'パンク'), ('punk', 'en', 'Punk'),
+    ('reggae', 'ja', 'レゲエ'), ('reggae', 'en', 'Reggae'),
+    ('latin', 'ja', 'ラテン'), ('latin', 'en', 'Latin'),
+    ('folk', 'ja', 'フォーク'), ('folk', 'en', 'Folk'),
+    ('soundtrack', 'ja', 'サウンドトラック'), ('soundtrack', 'en', 'Soundtrack'),
+    ('lo-fi', 'ja', 'Lo-Fi'), ('lo-fi', 'en', 'Lo-Fi'),
+    ('other', 'ja', 'その他'), ('other', 'en', 'Other');
@@ -0,0 +1,37 @@
+-- ルームの自由なタグ（小文字に正規化して保存する）
+CREATE TABLE trx_room_tags (
+    room_id INT NOT NULL,
+    tag VARCHAR(32) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (room_id, tag),
+    INDEX idx_room_tags_tag (tag),
+    FOREIGN KEY (room_id) REFERENCES trx_rooms(room_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- 既存の自由入力のジャンルを、大文字小文字・空白・記号の違いを無視してジャンルコードに寄せる
+UPDATE trx_rooms r
+JOIN mst_genres g
+  ON REPLACE(REPLACE(REPLACE(REPLACE(LOWER(TRIM(r.genre)), '&', 'and'), ' ', ''), '-', ''), '_', '')
+   = REPLACE(g.genre_code, '-', '')
+SET r.genre = g.genre_code;
+
+-- マスタにないジャンルはタグとして残し、ジャンルは未設定にする
+-- タグは NormalizeTags と同じ規則（先頭の # を除き小文字化、空白の並びは - に置き換え、文字・数字・-・_ のみ、32文字以内）に揃え、
+-- 規則に合わないものはタグにせず捨てる
+INSERT IGNORE INTO trx_room_tags (room_id, tag)
+SELECT room_id, tag
+FROM (
+    SELECT room_id,
+           REGEXP_REPLACE(LOWER(TRIM(IF(LEFT(genre, 1) = '#', SUBSTRING(genre, 2), genre))), '[[:space:]]+', '-') AS tag
+    FROM (
+        SELECT room_id, REGEXP_REPLACE(genre, '^[[:space:]]+|[[:space:]]+$', '') AS genre
+        FROM trx_rooms
+        WHERE genre IS NOT NULL
+          AND genre NOT IN (SELECT genre_code FROM mst_genres)
+    ) trimmed
+) normalized
+WHERE tag REGEXP '^[\\p{L}\\p{Nd}_-]+$'
+  AND CHAR_LENGTH(tag) <= 32;
+
+UPDATE trx_rooms SET genre = ''
+WHERE genre IS NULL OR genre NOT IN (SELECT genre_code FROM mst_genres);
@@ -0,0 +1,12 @@
+-- ルームへの参加履歴（ホストの作成も含む）。left_at が NULL の行は参加中を表す
+CREATE TABLE trx_room_joins (
+    join_id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    room_id INT NOT NULL,
+    user_id INT NOT NULL,
+    joined_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    left_at TIMESTAMP NULL,
+    INDEX idx_room_joins_user (user_id, joined_at),
+    INDEX idx_room_joins_room (room_id, left_at),
+    FOREIGN KEY (room_id) REFERENCES trx_rooms(room_id),
+    FOREIGN KEY (user_id) REFERENCES trx_users(user_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,11 @@
+-- 閉じたルームの理由（自動で閉じた場合は "empty"・"idle"、手動で削除した場合は "deleted"）
+ALTER TABLE trx_rooms ADD COLUMN closed_reason VARCHAR(20) NULL AFTER deleted_at;
+
+-- 閉じたルームの Redis 上の最終状態（Redis 側は一定時間後に期限切れになる）
+CREATE TABLE trx_room_archives (
+    room_id INT PRIMARY KEY,
+    redis_state JSON NULL,
+    closed_reason VARCHAR(20) NOT NULL,
+    closed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (room_id) REFERENCES trx_rooms(room_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,22 @@
+-- ルームで実際に再生された曲の記録。ended_at が NULL の行は再生中を表す
+-- outcome は "completed"（最後まで再生）・"skipped"（途中で次の曲へ）・"stopped"（再生中にルームが閉じた）
+CREATE TABLE trx_room_plays (
+    play_id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    room_id INT NOT NULL,
+    song_index INT NOT NULL,
+    song_id VARCHAR(255) NOT NULL DEFAULT '',
+    track_id VARCHAR(255) NOT NULL DEFAULT '',
+    song_name VARCHAR(255) NOT NULL DEFAULT '',
+    artist VARCHAR(255) NOT NULL DEFAULT '',
+    song_length INT NOT NULL DEFAULT 0,
+    started_by INT NOT NULL,
+    started_at TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    ended_at TIMESTAMP(3) NULL,
+    outcome VARCHAR(20) NULL,
+    played_ms INT NOT NULL DEFAULT 0,
+    listener_count INT NOT NULL DEFAULT 0,
+    INDEX idx_room_plays_room (room_id, play_id),
+    INDEX idx_room_plays_open (room_id, ended_at),
+    FOREIGN KEY (room_id) REFERENCES trx_rooms(room_id),
+    FOREIGN KEY (started_by) REFERENCES trx_users(user_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,39 @@
+-- 開始時刻を予約したルーム。開始時刻になると room_input の内容でルームを作成する
+-- recurrence は ""（繰り返しなし）・"daily"・"weekly"。繰り返す場合は開いたあと starts_at を次の回に進める
+-- status は "scheduled"（開始待ち）・"opened"（繰り返しなしで開いた）・"cancelled"（ホストが取り消した）
+CREATE TABLE trx_room_schedules (
+    schedule_id INT AUTO_INCREMENT PRIMARY KEY,
+    host_user_id INT NOT NULL,
+    host_user_name VARCHAR(255) NOT NULL,
+    room_name VARCHAR(255) NOT NULL,
+    is_public BOOLEAN NOT NULL,
+    genre VARCHAR(255) NOT NULL DEFAULT '',
+    max_participants INT NOT NULL,
+    -- ルーム作成時の入力（曲一覧・タグ・パスワードを含む）
+    room_input JSON NOT NULL,
+    starts_at TIMESTAMP NOT NULL,
+    recurrence VARCHAR(20) NOT NULL DEFAULT '',
+    recurrence_until TIMESTAMP NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'scheduled',
+    -- 最後に開いたルーム
+    last_room_id INT NULL,
+    last_opened_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    INDEX idx_room_schedules_due (status, starts_at),
+    INDEX idx_room_schedules_host (host_user_id),
+    FOREIGN KEY (host_user_id) REFERENCES trx_users(user_id),
+    FOREIGN KEY (last_room_id) REFERENCES trx_rooms(room_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- 予約したルームへの参加表明。繰り返す場合は回（starts_at）ごとに記録する
+CREATE TABLE trx_room_schedule_rsvps (
+    schedule_id INT NOT NULL,
+    starts_at TIMESTAMP NOT NULL,
+    user_id INT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (schedule_id, starts_at, user_id),
+    INDEX idx_room_schedule_rsvps_user (user_id),
+    FOREIGN KEY (schedule_id) REFERENCES trx_room_schedules(schedule_id),
+    FOREIGN KEY (user_id) REFERENCES trx_users(user_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,35 @@
+-- ユーザーが保存したルームの設定。パスワードそのものは保存せず、password_required でルーム作成時に必須かどうかだけを持つ
+CREATE TABLE trx_room_templates (
+    template_id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    template_name VARCHAR(255) NOT NULL,
+    room_name VARCHAR(255) NOT NULL,
+    is_public BOOLEAN NOT NULL,
+    password_required BOOLEAN NOT NULL DEFAULT FALSE,
+    genre VARCHAR(255) NOT NULL DEFAULT '',
+    -- 正規化済みのタグ（文字列の配列）
+    tags JSON NOT NULL,
+    max_participants INT NOT NULL,
+    host_user_name VARCHAR(255) NOT NULL,
+    playing_playlist_name VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP NULL,
+    INDEX idx_room_templates_user (user_id, deleted_at),
+    FOREIGN KEY (user_id) REFERENCES trx_users(user_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- テンプレートの曲一覧（trx_rooms_songs と同じ項目）
+CREATE TABLE trx_room_template_songs (
+    template_id INT NOT NULL,
+    song_index INT NOT NULL,
+    song_id VARCHAR(255) NOT NULL,
+    isrc VARCHAR(12) NOT NULL DEFAULT '',
+    track_id VARCHAR(255) NOT NULL DEFAULT '',
+    song_name VARCHAR(255) NOT NULL,
+    artist VARCHAR(255) NOT NULL,
+    song_length INT NOT NULL DEFAULT 0,
+    song_image_url VARCHAR(512) NOT NULL DEFAULT '',
+    PRIMARY KEY (template_id, song_index),
+    FOREIGN KEY (template_id) REFERENCES trx_room_templates(template_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,16 @@
+-- ルーム内のチャット。直近のメッセージは Redis の Stream（room:<id>:messages）にも保持し、ここを保存先とする
+CREATE TABLE trx_room_messages (
+    message_id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    room_id INT NOT NULL,
+    user_id INT NOT NULL,
+    -- 送信時のルームでの表示名
+    user_name VARCHAR(255) NOT NULL,
+    body TEXT NOT NULL,
+    created_at TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    deleted_at TIMESTAMP NULL,
+    -- 削除したユーザー（送信者またはホスト）
+    deleted_by INT NULL,
+    INDEX idx_room_messages_room (room_id, message_id),
+    FOREIGN KEY (room_id) REFERENCES trx_rooms(room_id),
+    FOREIGN KEY (user_id) REFERENCES trx_users(user_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
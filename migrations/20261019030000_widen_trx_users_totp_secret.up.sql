@@ -0,0 +1,3 @@
+-- TOTP シークレットは外部サービスのトークンと同じエンベロープ暗号化で保存する（既存の平文は rotate-token-keys で暗号化する）
+ALTER TABLE trx_users
+    MODIFY COLUMN totp_secret VARCHAR(512) NULL DEFAULT NULL;
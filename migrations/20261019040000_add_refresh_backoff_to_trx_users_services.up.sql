@@ -0,0 +1,4 @@
+-- トークンの更新に失敗した回数と、定期更新で次に再試行する時刻（失敗ごとに間隔を倍にする。成功したら NULL に戻す）
+ALTER TABLE trx_users_services
+    ADD COLUMN refresh_failures INT NOT NULL DEFAULT 0 AFTER broken_reason,
+    ADD COLUMN next_refresh_at TIMESTAMP NULL DEFAULT NULL AFTER refresh_failures;
@@ -0,0 +1,7 @@
+-- 1ユーザー・1サービスにつき連携は1件。重複している場合は最新の連携（service_id が最大）を残す
+DELETE s FROM trx_users_services s
+JOIN trx_users_services newer
+    ON newer.user_id = s.user_id AND newer.service_name = s.service_name AND newer.service_id > s.service_id;
+
+ALTER TABLE trx_users_services
+    ADD UNIQUE KEY uq_users_services_user_service (user_id, service_name);
@@ -0,0 +1,8 @@
+-- 連携時に許可されたスコープが足りず、再連携が必要になった時刻（再連携したら NULL に戻す）
+ALTER TABLE trx_users_services
+    ADD COLUMN reauthorize_required_at TIMESTAMP NULL DEFAULT NULL AFTER next_refresh_at;
+
+-- 再生操作のスコープ（user-read-playback-state, user-modify-playback-state）を追加する前に連携した Spotify の連携は再連携が必要
+UPDATE trx_users_services
+SET reauthorize_required_at = CURRENT_TIMESTAMP
+WHERE service_name = 'spotify' AND deleted_at IS NULL;
@@ -0,0 +1,3 @@
+-- 公開ルーム一覧のキーワード検索（ルーム名・ホスト名）用。日本語の名前も検索できるよう ngram パーサーを使う
+ALTER TABLE trx_rooms
+    ADD FULLTEXT INDEX ft_trx_rooms_search (room_name, host_user_name) WITH PARSER ngram;